@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"calmdrafts/internal/actions"
+	"calmdrafts/internal/audit"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+)
+
+// actionQueuePath returns where actions that haven't been applied yet are stored
+func actionQueuePath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "actions.json")
+}
+
+// openActionQueue opens the durable action queue, or returns nil when
+// state_dir is disabled and actions are applied without being persisted
+func openActionQueue(cfg *config.Config) (*actions.Queue, error) {
+	if cfg.StateDir == "" {
+		return nil, nil
+	}
+	return actions.Open(actionQueuePath(cfg))
+}
+
+// applyAction persists an action, applies it and forgets it once it
+// succeeded. A failed action stays queued and is retried by retryActions.
+func applyAction(ctx context.Context, client *gmail.Client, cfg *config.Config, queue *actions.Queue, a *actions.Action) error {
+	if queue == nil {
+		return executeAction(ctx, client, cfg, a)
+	}
+
+	if err := queue.Add(a); err != nil {
+		return err
+	}
+	if err := queue.Save(); err != nil {
+		return err
+	}
+
+	err := executeAction(ctx, client, cfg, a)
+	if err == nil {
+		queue.Remove(a.ID)
+	} else if queue.Failed(a, err, time.Now()) {
+		log.Printf("Giving up on %s of draft %s after %d attempts", a.Kind, a.DraftID, a.Attempts)
+	}
+
+	if saveErr := queue.Save(); saveErr != nil {
+		log.Printf("Error saving action queue: %v", saveErr)
+	}
+	return err
+}
+
+// applyDeletes applies many delete actions together: every draft is
+// archived first, then all are deleted with gmail.Client.DeleteDrafts
+// instead of one request after another. Like applyAction, the actions are
+// persisted first and failed ones stay queued for a retry. It returns the
+// error of each draft that couldn't be deleted, by draft ID.
+func applyDeletes(ctx context.Context, client *gmail.Client, cfg *config.Config, queue *actions.Queue, deletes []*actions.Action) map[string]error {
+	errs := make(map[string]error)
+
+	// Trash has no batch request, and one draft gains nothing from batching
+	if cfg.UseTrash || len(deletes) < 2 {
+		for _, a := range deletes {
+			if err := applyAction(ctx, client, cfg, queue, a); err != nil {
+				errs[a.DraftID] = err
+			}
+		}
+		return errs
+	}
+
+	if queue != nil {
+		for _, a := range deletes {
+			if err := queue.Add(a); err != nil {
+				errs[a.DraftID] = err
+			}
+		}
+		if err := queue.Save(); err != nil {
+			for _, a := range deletes {
+				errs[a.DraftID] = err
+			}
+			return errs
+		}
+	}
+
+	drafts := []*gmail.Draft{}
+	archived := make(map[string]string)
+	gone := make(map[string]bool)
+	for _, a := range deletes {
+		if errs[a.DraftID] != nil {
+			continue
+		}
+		draft := &gmail.Draft{ID: a.DraftID, MessageID: a.MessageID, Subject: a.Subject, To: a.To}
+		archivePath, err := archiveDraft(ctx, client, cfg, draft)
+		switch {
+		case errors.Is(err, gmail.ErrNotFound):
+			gone[a.DraftID] = true
+		case err != nil:
+			errs[a.DraftID] = err
+		default:
+			archived[a.DraftID] = archivePath
+			drafts = append(drafts, draft)
+		}
+	}
+	for id, err := range client.DeleteDrafts(ctx, drafts, cfg.BatchDelete) {
+		if errors.Is(err, gmail.ErrNotFound) {
+			gone[id] = true
+			continue
+		}
+		errs[id] = err
+	}
+
+	now := time.Now()
+	for _, a := range deletes {
+		if err := errs[a.DraftID]; err != nil {
+			if queue != nil && queue.Failed(a, err, now) {
+				log.Printf("Giving up on %s of draft %s after %d attempts", a.Kind, a.DraftID, a.Attempts)
+			}
+			continue
+		}
+		action := audit.ActionDelete
+		if gone[a.DraftID] {
+			action = audit.ActionAlreadyDeleted
+		}
+		draft := &gmail.Draft{ID: a.DraftID, MessageID: a.MessageID, Subject: a.Subject, To: a.To}
+		recordDeletion(cfg, draft, action, a.Reason, archived[a.DraftID], a.Explanation)
+		if queue != nil {
+			queue.Remove(a.ID)
+		}
+	}
+	if queue != nil {
+		if err := queue.Save(); err != nil {
+			log.Printf("Error saving action queue: %v", err)
+		}
+	}
+	return errs
+}
+
+// retryActions applies queued actions left over from earlier checks whose
+// retry time has come. Actions on drafts that were edited or deleted since
+// are dropped. It returns the IDs of the drafts it deleted, and the errors
+// of the deletions that failed again, by draft ID.
+func retryActions(ctx context.Context, client *gmail.Client, cfg *config.Config, queue *actions.Queue, drafts []*gmail.Draft) (map[string]bool, map[string]error) {
+	deleted := make(map[string]bool)
+	failed := make(map[string]error)
+	if queue == nil {
+		return deleted, failed
+	}
+
+	current := make(map[string]*gmail.Draft, len(drafts))
+	for _, draft := range drafts {
+		current[draft.ID] = draft
+	}
+
+	applied := 0
+	deletes := []*actions.Action{}
+	for _, a := range queue.Due(time.Now()) {
+		if draft, ok := current[a.DraftID]; !ok || draft.MessageID != a.MessageID {
+			fmt.Printf("Draft %s changed since the %s was queued, dropping it\n", a.DraftID, a.Kind)
+			queue.Remove(a.ID)
+			continue
+		}
+		if a.Kind == actions.KindDelete {
+			deletes = append(deletes, a)
+			continue
+		}
+		if err := applyAction(ctx, client, cfg, queue, a); err != nil {
+			log.Printf("Error retrying %s of draft %s (attempt %d): %v", a.Kind, a.DraftID, a.Attempts, err)
+			continue
+		}
+		applied++
+	}
+
+	// Deletions that failed in earlier checks are retried together
+	errs := applyDeletes(ctx, client, cfg, queue, deletes)
+	for _, a := range deletes {
+		if err := errs[a.DraftID]; err != nil {
+			log.Printf("Error retrying %s of draft %s (attempt %d): %v", a.Kind, a.DraftID, a.Attempts, err)
+			failed[a.DraftID] = err
+			continue
+		}
+		deleted[a.DraftID] = true
+		applied++
+	}
+
+	if err := queue.Save(); err != nil {
+		log.Printf("Error saving action queue: %v", err)
+	}
+	if applied > 0 {
+		fmt.Printf("Applied %d queued action(s) from earlier checks\n", applied)
+	}
+	return deleted, failed
+}
+
+// deletionCauses names why deletions failed in a few words, most common
+// first, for the summary notification
+func deletionCauses(errs map[string]error) []string {
+	counts := make(map[string]int)
+	for _, err := range errs {
+		counts[deletionCause(err)]++
+	}
+	causes := make([]string, 0, len(counts))
+	for cause := range counts {
+		causes = append(causes, cause)
+	}
+	sort.Slice(causes, func(i, j int) bool {
+		if counts[causes[i]] != counts[causes[j]] {
+			return counts[causes[i]] > counts[causes[j]]
+		}
+		return causes[i] < causes[j]
+	})
+	return causes
+}
+
+// deletionCause names why one deletion failed
+func deletionCause(err error) string {
+	var apiErr *gmail.APIError
+	var archiveErr *archiveError
+	switch {
+	case errors.Is(err, gmail.ErrRateLimited):
+		return "quota"
+	case errors.Is(err, gmail.ErrNotFound):
+		return "not found"
+	case errors.Is(err, gmail.ErrBudgetExhausted), errors.Is(err, context.DeadlineExceeded):
+		return "stage limit"
+	case errors.As(err, &archiveErr):
+		return "archive"
+	case errors.As(err, &apiErr) && apiErr.Code >= 500:
+		return "server error"
+	case errors.As(err, &apiErr) && (apiErr.Code == 401 || apiErr.Code == 403):
+		return "not allowed"
+	}
+	return "other"
+}
+
+// executeAction makes the change described by an action in Gmail
+func executeAction(ctx context.Context, client *gmail.Client, cfg *config.Config, a *actions.Action) error {
+	switch a.Kind {
+	case actions.KindDelete:
+		draft := &gmail.Draft{ID: a.DraftID, MessageID: a.MessageID, Subject: a.Subject, To: a.To}
+		return deleteDraft(ctx, client, cfg, draft, a.Reason, a.Explanation)
+	case actions.KindLabel, actions.KindUnlabel:
+		// Labels only make pending drafts visible in Gmail, so without them
+		// the pending-delete queue still works
+		err := applyLabelAction(ctx, client, a)
+		if errors.Is(err, gmail.ErrUnavailable) {
+			fmt.Printf("Not labelling draft %s: %v\n", a.DraftID, err)
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown action %q", a.Kind)
+}
+
+// applyLabelAction adds or removes the label of a label action
+func applyLabelAction(ctx context.Context, client *gmail.Client, a *actions.Action) error {
+	if a.Kind == actions.KindLabel {
+		labelID, err := client.EnsureLabel(ctx, a.Label)
+		if err != nil {
+			return err
+		}
+		return client.ApplyLabel(ctx, a.MessageID, labelID)
+	}
+	labelID, err := client.LabelID(ctx, a.Label)
+	if err != nil || labelID == "" {
+		return err
+	}
+	return client.RemoveLabel(ctx, a.MessageID, labelID)
+}
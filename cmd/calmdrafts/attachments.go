@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+)
+
+// runAttachments saves every attachment of a draft to a directory
+func runAttachments(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("attachments", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	out := fs.String("out", ".", "Directory to save the attachments in")
+
+	// Accept the draft ID before or after the flags
+	draftID := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		draftID, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+	if draftID == "" {
+		draftID = fs.Arg(0)
+	}
+	if draftID == "" {
+		return fmt.Errorf("usage: calmdrafts attachments <draft-id> [--out dir]")
+	}
+
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err != nil {
+		return fmt.Errorf("error creating Gmail client: %v", err)
+	}
+	attachments, err := client.Attachments(ctx, draftID)
+	if errors.Is(err, gmail.ErrNotFound) {
+		return fmt.Errorf("draft %s not found", draftID)
+	}
+	if err != nil {
+		return err
+	}
+	if len(attachments) == 0 {
+		fmt.Printf("Draft %s has no attachments\n", draftID)
+		return nil
+	}
+
+	if err := os.MkdirAll(*out, 0700); err != nil {
+		return fmt.Errorf("unable to create %s: %v", *out, err)
+	}
+	for _, a := range attachments {
+		path := uniquePath(filepath.Join(*out, safeFilename(a.Filename)))
+		if err := os.WriteFile(path, a.Data, 0600); err != nil {
+			return fmt.Errorf("unable to save %s: %v", a.Filename, err)
+		}
+		fmt.Printf("Saved %s (%d bytes)\n", path, len(a.Data))
+	}
+	return nil
+}
+
+// safeFilename keeps only the last element of an attachment's name so it
+// can't escape the output directory
+func safeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// uniquePath adds " (n)" before the extension until path doesn't exist
+func uniquePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	candidate := path
+	for n := 1; ; n++ {
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+}
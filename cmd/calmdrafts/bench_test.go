@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+)
+
+// benchmarkSizes are the mailbox sizes benchmarks run against
+var benchmarkSizes = []int{100, 1000, 10000}
+
+// syntheticDrafts returns size drafts spread over the last year: empty
+// ones, short replies, templates and longer drafts
+func syntheticDrafts(size int, now time.Time) []*gmail.Draft {
+	drafts := make([]*gmail.Draft, size)
+	for n := range drafts {
+		d := &gmail.Draft{
+			ID:           fmt.Sprintf("r%d", n),
+			MessageID:    fmt.Sprintf("m%d", n),
+			InternalDate: now.Add(-time.Duration(n%365*24) * time.Hour),
+		}
+		switch n % 4 {
+		case 0:
+			d.IsEmpty = true
+		case 1:
+			d.Subject, d.To, d.IsReply, d.BodyLength = "Re: lunch", "bob@example.com", true, 12
+		case 2:
+			d.Subject, d.BodyLength = "[template] Weekly update", 800
+		default:
+			d.Subject, d.To, d.BodyLength = fmt.Sprintf("Proposal %d", n), "carol@example.com", 2400
+		}
+		drafts[n] = d
+	}
+	return drafts
+}
+
+// benchmarkEvaluate runs the rules of cfg over synthetic mailboxes the way
+// a check does
+func benchmarkEvaluate(b *testing.B, cfg *config.Config) {
+	ctx := context.Background()
+	plugins, rulesScript, model, err := loadRules(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	now := time.Now()
+
+	for _, size := range benchmarkSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			drafts := syntheticDrafts(size, now)
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := markTemplates(cfg, drafts); err != nil {
+					b.Fatal(err)
+				}
+				for _, draft := range drafts {
+					if _, err := evaluate(ctx, draft, plugins, rulesScript, model, cfg, now); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluateBuiltIn(b *testing.B) {
+	cfg := config.DefaultConfig()
+	cfg.TemplatePattern = `^\[template\]`
+	benchmarkEvaluate(b, cfg)
+}
+
+func BenchmarkEvaluateScript(b *testing.B) {
+	cfg := config.DefaultConfig()
+	cfg.ScriptPath = "testdata/classify.star"
+	benchmarkEvaluate(b, cfg)
+}
+
+func BenchmarkEvaluateBusinessDays(b *testing.B) {
+	cfg := config.DefaultConfig()
+	cfg.BusinessDays = &config.BusinessDays{Holidays: []string{"2026-01-01", "2026-12-25"}}
+	benchmarkEvaluate(b, cfg)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/buildinfo"
+	"calmdrafts/internal/config"
+)
+
+// maxLogSize is the size above which the log file is trimmed to its newer half
+const maxLogSize = 1 << 20
+
+// logPath returns where the daemon's errors and warnings are kept for bug
+// reports
+func logPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "calmdrafts.log")
+}
+
+// lastErrorPath returns where the last failed check is recorded
+func lastErrorPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "last-error.json")
+}
+
+// lastError is the last check that failed, with the error Gmail returned
+type lastError struct {
+	Time    time.Time `json:"time"`
+	Account string    `json:"account,omitempty"`
+	Error   string    `json:"error"`
+}
+
+// teeLog copies everything the standard logger writes to the log file in
+// state_dir, trimming the file first when it has grown too large
+func teeLog(cfg *config.Config) {
+	if cfg.StateDir == "" {
+		return
+	}
+	path := logPath(cfg)
+	if data, err := os.ReadFile(path); err == nil && len(data) > maxLogSize {
+		data = data[len(data)-maxLogSize/2:]
+		if i := strings.IndexByte(string(data), '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+		os.WriteFile(path, data, 0600)
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0700); err != nil {
+		log.Printf("Error opening log file: %v", err)
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Error opening log file: %v", err)
+		return
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, f))
+}
+
+// recordCheckError remembers why a check failed, for bug reports
+func recordCheckError(cfg *config.Config, checkErr error) {
+	if cfg.StateDir == "" {
+		return
+	}
+	data, err := json.Marshal(&lastError{Time: time.Now(), Account: cfg.Account, Error: checkErr.Error()})
+	if err == nil {
+		err = os.WriteFile(lastErrorPath(cfg), data, 0600)
+	}
+	if err != nil {
+		log.Printf("Error recording check error: %v", err)
+	}
+}
+
+// runBugreport collects what is needed to reproduce a problem into a zip
+// file, with secrets and email addresses removed
+func runBugreport(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("bugreport", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	out := fs.String("out", "", "Zip file to write (default: calmdrafts-bugreport-<time>.zip)")
+	lines := fs.Int("lines", 500, "Number of recent log lines and notifications to include")
+	fs.Parse(args)
+	if err := flagOverrides.applyAny(cfg); err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("calmdrafts-bugreport-%s.zip", time.Now().Format("20060102-150405"))
+	}
+
+	r := newRedactor()
+	files := []struct {
+		name    string
+		content func() (string, error)
+	}{
+		{"version.json", func() (string, error) { return indentJSON(buildinfo.Get()) }},
+		{"platform.txt", func() (string, error) { return platformInfo(), nil }},
+		{"config.json", func() (string, error) { return redactedConfig(cfg, r) }},
+		{"last-error.json", func() (string, error) { return stateFile(cfg, lastErrorPath(cfg), 0, r.text) }},
+		{"crash.txt", func() (string, error) { return stateFile(cfg, crashPath(cfg), 0, r.logLine) }},
+		{"calmdrafts.log", func() (string, error) { return stateFile(cfg, logPath(cfg), *lines, r.logLine) }},
+		{"notifications.jsonl", func() (string, error) { return stateFile(cfg, notificationsPath(cfg), *lines, r.notification) }},
+		{"history.jsonl", func() (string, error) { return stateFile(cfg, historyPath(cfg), *lines, r.text) }},
+	}
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		content, err := file.content()
+		if err != nil {
+			content = fmt.Sprintf("unavailable: %v\n", err)
+		}
+		if content == "" {
+			continue
+		}
+		w, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s\n", file.name)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nWrote %s. Secrets, email addresses and quoted draft subjects were removed, but subjects may remain in other messages, so please look through it before attaching it to an issue.\n", *out)
+	return nil
+}
+
+// indentJSON formats v as indented JSON
+func indentJSON(v interface{}) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// platformInfo describes the operating system and desktop environment
+func platformInfo() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "os: %s\narch: %s\ncpus: %d\n", runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+
+	var version []byte
+	switch runtime.GOOS {
+	case "linux":
+		if data, err := os.ReadFile("/etc/os-release"); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if name, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+					version = []byte(strings.Trim(name, `"`))
+				}
+			}
+		}
+	case "darwin":
+		version, _ = exec.Command("sw_vers", "-productVersion").Output()
+	case "windows":
+		version, _ = exec.Command("cmd", "/c", "ver").Output()
+	}
+	if v := strings.TrimSpace(string(version)); v != "" {
+		fmt.Fprintf(&b, "version: %s\n", v)
+	}
+
+	// Which of these are set decides how notifications are shown
+	for _, name := range []string{"XDG_CURRENT_DESKTOP", "XDG_SESSION_TYPE", "DISPLAY", "WAYLAND_DISPLAY", "DBUS_SESSION_BUS_ADDRESS", "TERM"} {
+		if value, ok := os.LookupEnv(name); ok {
+			if name == "DBUS_SESSION_BUS_ADDRESS" {
+				value = "set"
+			}
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	return b.String()
+}
+
+// redactedConfig returns the effective config as JSON with secrets removed
+func redactedConfig(cfg *config.Config, r *redactor) (string, error) {
+	data, err := config.GetValue(cfg, "")
+	if err != nil {
+		return "", err
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return "", err
+	}
+	return indentJSON(r.value("", value))
+}
+
+// stateFile returns the last lines of a file in state_dir, all of them when
+// lines is 0, each passed through redact. A missing file is left out.
+func stateFile(cfg *config.Config, path string, lines int, redact func(string) string) (string, error) {
+	if cfg.StateDir == "" {
+		return "", nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	kept := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		kept = append(kept, redact(scanner.Text()))
+		if lines > 0 && len(kept) > lines {
+			kept = kept[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(kept, "\n") + "\n", nil
+}
+
+// redactor removes secrets and personal data from what goes into a bug
+// report. Each email address is replaced with the same userN@example.com
+// everywhere, so entries can still be related to each other.
+type redactor struct {
+	aliases map[string]string
+	home    string
+}
+
+// emailPattern matches email addresses
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// quotedPattern matches the Go-quoted strings messages name drafts with
+var quotedPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// secretKeys are the parts of setting names whose values are secrets
+var secretKeys = []string{"password", "secret", "access_token", "token", "sha256", "key"}
+
+func newRedactor() *redactor {
+	home, _ := os.UserHomeDir()
+	return &redactor{aliases: make(map[string]string), home: home}
+}
+
+// text replaces email addresses and the home directory in free text
+func (r *redactor) text(s string) string {
+	s = emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+		alias, ok := r.aliases[strings.ToLower(email)]
+		if !ok {
+			alias = fmt.Sprintf("user%d@example.com", len(r.aliases)+1)
+			r.aliases[strings.ToLower(email)] = alias
+		}
+		return alias
+	})
+	if r.home != "" {
+		s = strings.ReplaceAll(s, r.home, "~")
+	}
+	return s
+}
+
+// logLine replaces email addresses, the home directory and quoted strings
+// in a line of the log. Messages quote draft subjects, so the quoted
+// strings go whatever they hold.
+func (r *redactor) logLine(s string) string {
+	return quotedPattern.ReplaceAllString(r.text(s), `"[redacted]"`)
+}
+
+// notification redacts a line of the notification history. Messages name
+// drafts by subject, so their text is left out, and the other fields are
+// redacted like the log.
+func (r *redactor) notification(s string) string {
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &record); err != nil {
+		return r.logLine(s)
+	}
+	for key, value := range record {
+		if text, ok := value.(string); ok {
+			record[key] = r.logLine(text)
+		}
+	}
+	if _, ok := record["message"]; ok {
+		record["message"] = "[redacted]"
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return r.logLine(s)
+	}
+	return string(data)
+}
+
+// value redacts a decoded JSON value found under the setting key
+func (r *redactor) value(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			redacted[r.text(k)] = r.value(k, child)
+		}
+		return redacted
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.value(key, child)
+		}
+		return v
+	case string:
+		if v == "" || config.IsSecretRef(v) {
+			return v
+		}
+		if isSecretKey(key) {
+			return "[redacted]"
+		}
+		// Notification URLs carry tokens in any part but the scheme
+		if scheme, rest, ok := strings.Cut(v, "://"); ok && rest != "" {
+			if u, err := url.Parse(v); err != nil || u.User != nil || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+				return scheme + "://[redacted]"
+			}
+		}
+		return r.text(v)
+	}
+	return v
+}
+
+// isSecretKey reports whether a setting holds a secret. Paths to files are
+// not secrets themselves.
+func isSecretKey(key string) bool {
+	if strings.HasSuffix(key, "_path") {
+		return false
+	}
+	for _, part := range secretKeys {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
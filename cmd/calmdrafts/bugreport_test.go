@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"calmdrafts/internal/config"
+)
+
+func testRedactor() *redactor {
+	return &redactor{aliases: make(map[string]string), home: "/home/alex"}
+}
+
+func TestRedactText(t *testing.T) {
+	r := testRedactor()
+	got := r.text("Error checking Me@Example.com: open /home/alex/.config/token.json; retrying me@example.com and boss@example.org")
+	want := "Error checking user1@example.com: open ~/.config/token.json; retrying user1@example.com and user2@example.com"
+	if got != want {
+		t.Errorf("redacted to %q, want %q", got, want)
+	}
+}
+
+func TestRedactLogLine(t *testing.T) {
+	for line, want := range map[string]string{
+		`Error sending notification: apprise: Send or delete "Offer for Acme"?`: `Error sending notification: apprise: Send or delete "[redacted]"?`,
+		`Send "Re: \"Budget\" for jo@example.com" to boss@example.com now?`:     `Send "[redacted]" to user2@example.com now?`,
+		`Error labelling draft r-12: googleapi: Error 429`:                      `Error labelling draft r-12: googleapi: Error 429`,
+		`unterminated "subject`: `unterminated "subject`,
+	} {
+		if got := testRedactor().logLine(line); got != want {
+			t.Errorf("redacted %q to %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestRedactNotification(t *testing.T) {
+	r := testRedactor()
+	line := `{"time":"2026-10-16T09:00:00Z","channel":"desktop","event":"nudge","title":"CalmDrafts","message":"Send or delete \"Offer for Acme\"? Run \"calmdrafts nudge\" to send now, snooze or delete","error":"notify-send for me@example.com: \"Offer for Acme\" timed out"}`
+	got := r.notification(line)
+	if strings.Contains(got, "Acme") || strings.Contains(got, "me@example.com") {
+		t.Errorf("subject or address left in %s", got)
+	}
+	var record map[string]string
+	if err := json.Unmarshal([]byte(got), &record); err != nil {
+		t.Fatalf("redacted notification %s isn't JSON: %v", got, err)
+	}
+	want := map[string]string{
+		"time":    "2026-10-16T09:00:00Z",
+		"channel": "desktop",
+		"event":   "nudge",
+		"title":   "CalmDrafts",
+		"message": "[redacted]",
+		"error":   `notify-send for user1@example.com: "[redacted]" timed out`,
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s is %q, want %q", key, record[key], value)
+		}
+	}
+
+	if got := r.notification(`not JSON, "Offer for Acme"`); got != `not JSON, "[redacted]"` {
+		t.Errorf("redacted a broken line to %q", got)
+	}
+}
+
+func TestRedactValue(t *testing.T) {
+	r := testRedactor()
+	var settings interface{}
+	if err := json.Unmarshal([]byte(`{
+		"mailbox": "me@example.com",
+		"token_path": "/home/alex/token.json",
+		"grafana": {"token": "hunter2"},
+		"smtp": {"password": "env:SMTP_PASSWORD"},
+		"notifications": {"apprise_urls": ["tgram://bot-token/chat", "mailto://"]}
+	}`), &settings); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(r.value("", settings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"grafana":{"token":"[redacted]"},"mailbox":"user1@example.com","notifications":{"apprise_urls":["tgram://[redacted]","mailto://"]},"smtp":{"password":"env:SMTP_PASSWORD"},"token_path":"~/token.json"}`
+	if string(data) != want {
+		t.Errorf("redacted config is\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestStateFile(t *testing.T) {
+	cfg := &config.Config{StateDir: t.TempDir()}
+	path := filepath.Join(cfg.StateDir, "calmdrafts.log")
+	if err := os.WriteFile(path, []byte("one \"a\"\ntwo \"b\"\nthree \"c\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := stateFile(cfg, path, 2, testRedactor().logLine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "two \"[redacted]\"\nthree \"[redacted]\"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, err := stateFile(cfg, filepath.Join(cfg.StateDir, "missing.log"), 0, testRedactor().logLine); got != "" || err != nil {
+		t.Errorf("missing file returned %q, %v", got, err)
+	}
+}
@@ -0,0 +1,691 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/actions"
+	"calmdrafts/internal/cache"
+	"calmdrafts/internal/classifier"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/engine"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/plugin"
+	"calmdrafts/internal/quarantine"
+	"calmdrafts/internal/report"
+	"calmdrafts/internal/runs"
+	"calmdrafts/internal/script"
+	"calmdrafts/internal/stats"
+)
+
+// checkAndCleanDrafts performs a full check: lists drafts, notifies user, and cleans up old empty drafts
+func checkAndCleanDrafts(ctx context.Context, client *gmail.Client, notif *notifier.Notifier, plugins *plugin.Manager, rulesScript *script.Script, model *classifier.Model, cfg *config.Config) (result *runs.Result, err error) {
+	now := time.Now()
+	fmt.Printf("[%s] Checking drafts...\n", now.Format("2006-01-02 15:04:05"))
+
+	// Only report what would be deleted until the user trusts the rules
+	end, observing, err := observationEnds(cfg, now)
+	if err != nil {
+		result = runs.New(cfg.Account, now)
+		err = fmt.Errorf("error checking observation period: %v", err)
+		finishRun(cfg, notif, result, err)
+		return result, err
+	}
+	if observing && !cfg.DryRun {
+		fmt.Printf("Observation period until %s: nothing is deleted yet (run \"calmdrafts enable-cleanup\" to start now)\n", end.Local().Format("2006-01-02 15:04"))
+		observed := *cfg
+		observed.DryRun = true
+		cfg = &observed
+	}
+	// A pipeline that only reports runs every check as a dry run
+	if cfg.Pipeline != nil && cfg.Pipeline.Action == "report" && !cfg.DryRun {
+		reported := *cfg
+		reported.DryRun = true
+		cfg = &reported
+	}
+
+	c := engine.NewCheck(cfg.Account, now, cfg.DryRun)
+	defer func() { finishRun(cfg, notif, c.Result, err) }()
+	err = newEngine(client, notif, plugins, rulesScript, model, cfg).Run(ctx, c)
+	return c.Result, err
+}
+
+// The stages a pipeline can be composed of, in their default order
+var (
+	pipelineClassifiers = []string{"plugins", "templates", "rules"}
+	pipelineActions     = []string{"delete", "quarantine", "report"}
+	pipelineReporters   = []string{"notify", "reminders", "triage", "stats"}
+)
+
+// validatePipeline checks the names in the pipeline setting
+func validatePipeline(cfg *config.Config) error {
+	p := cfg.Pipeline
+	if p == nil {
+		return nil
+	}
+	for _, name := range p.Classifiers {
+		if !slices.Contains(pipelineClassifiers, name) {
+			return fmt.Errorf("pipeline.classifiers: unknown classifier %q (available: %s)", name, strings.Join(pipelineClassifiers, ", "))
+		}
+	}
+	if p.Action != "" && !slices.Contains(pipelineActions, p.Action) {
+		return fmt.Errorf("pipeline.action: unknown action %q (available: %s)", p.Action, strings.Join(pipelineActions, ", "))
+	}
+	if p.Action == "quarantine" && cfg.StateDir == "" {
+		return fmt.Errorf("pipeline.action quarantine needs state_dir for the pending-delete queue")
+	}
+	for _, name := range p.Reporters {
+		if !slices.Contains(pipelineReporters, name) {
+			return fmt.Errorf("pipeline.reporters: unknown reporter %q (available: %s)", name, strings.Join(pipelineReporters, ", "))
+		}
+	}
+	for name, limit := range p.Limits {
+		if !slices.Contains(engine.Stages, name) {
+			return fmt.Errorf("pipeline.limits: unknown stage %q (available: %s)", name, strings.Join(engine.Stages, ", "))
+		}
+		if limit.Timeout.Duration < 0 || limit.Calls < 0 {
+			return fmt.Errorf("pipeline.limits.%s: timeout and calls can't be negative", name)
+		}
+	}
+	return nil
+}
+
+// newEngine wires the stages of a check for a mailbox as the pipeline
+// setting composes them
+func newEngine(client *gmail.Client, notif *notifier.Notifier, plugins *plugin.Manager, rulesScript *script.Script, model *classifier.Model, cfg *config.Config) *engine.Engine {
+	p := cfg.Pipeline
+	if p == nil {
+		p = &config.Pipeline{}
+	}
+	classifiers, reporters := p.Classifiers, p.Reporters
+	if classifiers == nil {
+		classifiers = pipelineClassifiers
+	}
+	if reporters == nil {
+		reporters = pipelineReporters
+	}
+
+	e := &engine.Engine{
+		Scanner: &draftScanner{client: client, notif: notif, cfg: cfg},
+		Cleaner: &draftCleaner{client: client, notif: notif, cfg: cfg, hold: quarantined(cfg)},
+		Limits:  make(map[string]engine.Limit, len(p.Limits)),
+	}
+	for name, limit := range p.Limits {
+		e.Limits[name] = engine.Limit{Timeout: limit.Timeout.Duration, Calls: limit.Calls}
+	}
+	// Templates and kept drafts are always marked before the rules run, so
+	// no pipeline can leave them out of the reminders and reports or delete
+	// them
+	templates := false
+	for _, name := range classifiers {
+		switch name {
+		case "plugins":
+			e.Classifiers = append(e.Classifiers, &pluginClassifier{plugins: plugins})
+		case "templates":
+			if !templates {
+				e.Classifiers = append(e.Classifiers, &templateClassifier{notif: notif, cfg: cfg})
+				templates = true
+			}
+		case "rules":
+			if !templates {
+				e.Classifiers = append(e.Classifiers, &templateClassifier{notif: notif, cfg: cfg})
+				templates = true
+			}
+			e.Classifiers = append(e.Classifiers, &ruleClassifier{plugins: plugins, rulesScript: rulesScript, model: model, cfg: cfg})
+		}
+	}
+	for _, name := range reporters {
+		switch name {
+		case "notify":
+			e.Reporters = append(e.Reporters, &notifyReporter{notif: notif, cfg: cfg})
+		case "reminders":
+			e.Reporters = append(e.Reporters, &reminderReporter{client: client, notif: notif, cfg: cfg})
+		case "triage":
+			e.Reporters = append(e.Reporters, &triageReporter{cfg: cfg})
+		case "stats":
+			e.Reporters = append(e.Reporters, &statsReporter{cfg: cfg})
+		}
+	}
+	return e
+}
+
+// draftScanner lists the drafts from Gmail and keeps the draft cache and
+// history up to date
+type draftScanner struct {
+	client *gmail.Client
+	notif  *notifier.Notifier
+	cfg    *config.Config
+}
+
+func (s *draftScanner) Scan(ctx context.Context, c *engine.Check) error {
+	drafts, err := s.client.ListDrafts(ctx)
+	if err != nil {
+		notifyError(s.cfg, s.notif, err)
+		return fmt.Errorf("error listing drafts: %v", err)
+	}
+	c.Drafts = withoutDigest(s.cfg, drafts)
+	if s.cfg.StateDir != "" {
+		prev, _ := cache.Load(draftCachePath(s.cfg))
+		c.Changed, err = cache.Update(draftCachePath(s.cfg), c.Drafts, time.Now())
+		if err != nil {
+			c.Changed = make(map[string]time.Time)
+			c.Result.Logf("Error caching drafts: %v", err)
+		}
+		// Kept so "calmdrafts simulate" can replay the folder under another policy
+		if err := cache.OpenHistory(draftHistoryPath(s.cfg)).Record(prev, c.Drafts, time.Now()); err != nil {
+			c.Result.Logf("Error recording draft history: %v", err)
+		}
+	}
+	return nil
+}
+
+// pluginClassifier lets classifier plugins override the built-in
+// emptiness check
+type pluginClassifier struct {
+	plugins *plugin.Manager
+}
+
+func (p *pluginClassifier) Classify(ctx context.Context, c *engine.Check) error {
+	for _, draft := range c.Drafts {
+		if err := engine.Stopped(ctx); err != nil {
+			return err
+		}
+		empty, ok, err := p.plugins.Classify(ctx, draft)
+		if err != nil {
+			c.Result.Logf("Error running classifier plugins for draft %s: %v", draft.ID, err)
+			continue
+		}
+		if ok {
+			draft.IsEmpty = empty
+		}
+	}
+	return nil
+}
+
+// templateClassifier marks the drafts kept as templates or with the triage
+// report's keep link, which no rule deletes
+type templateClassifier struct {
+	notif *notifier.Notifier
+	cfg   *config.Config
+}
+
+func (t *templateClassifier) Classify(ctx context.Context, c *engine.Check) error {
+	if err := markTemplates(t.cfg, c.Drafts); err != nil {
+		notifyError(t.cfg, t.notif, err)
+		return err
+	}
+	if err := markKept(t.cfg, c.Drafts); err != nil {
+		c.Result.Logf("Error reading kept drafts: %v", err)
+	}
+	return nil
+}
+
+// ruleClassifier decides with the configured rules: the built-in rules,
+// rule plugins, the script and the abandoned-draft model
+type ruleClassifier struct {
+	plugins     *plugin.Manager
+	rulesScript *script.Script
+	model       *classifier.Model
+	cfg         *config.Config
+}
+
+func (r *ruleClassifier) Classify(ctx context.Context, c *engine.Check) error {
+	emptyCount := 0
+	for _, draft := range c.Drafts {
+		if draft.IsEmpty {
+			emptyCount++
+		}
+	}
+	fmt.Printf("Found %d draft(s) (%d empty)\n", len(c.Drafts), emptyCount)
+
+	for _, draft := range c.Drafts {
+		if err := engine.Stopped(ctx); err != nil {
+			return err // drafts without a decision are kept
+		}
+		v, err := evaluate(ctx, draft, r.plugins, r.rulesScript, r.model, r.cfg, c.Now)
+		if err != nil {
+			c.Result.Logf("Error evaluating rules: %v", err)
+			continue
+		}
+		d := v.decision()
+		d.Outcome = "keep"
+		c.Decisions[draft.ID] = d
+	}
+	return nil
+}
+
+// draftCleaner deletes the drafts that qualify, through the pending-delete
+// queue when there is a grace period, and retries deletions that failed
+// in earlier checks
+type draftCleaner struct {
+	client *gmail.Client
+	notif  *notifier.Notifier
+	cfg    *config.Config
+	hold   bool // Keep queued drafts until approved in review, whatever the grace period
+}
+
+func (cl *draftCleaner) Clean(ctx context.Context, c *engine.Check) error {
+	cfg, now := cl.cfg, c.Now
+
+	// Finish changes interrupted by a crash or a failed request first
+	var actionQueue *actions.Queue
+	if !cfg.DryRun {
+		var err error
+		actionQueue, err = openActionQueue(cfg)
+		if err != nil {
+			notifyError(cfg, cl.notif, err)
+			return fmt.Errorf("error opening action queue: %v", err)
+		}
+		c.Retried, c.Failures = retryActions(ctx, cl.client, cfg, actionQueue, c.Drafts)
+		for id := range c.Retried {
+			c.Deleted[id] = true
+		}
+	}
+
+	// With a grace period, drafts are queued for review before deletion
+	var queue *quarantine.Queue
+	queued := make(map[string]bool)
+	pendingCount, queuedCount := 0, 0
+	if (cfg.GracePeriod.Duration > 0 || cl.hold) && !cfg.DryRun {
+		var err error
+		queue, err = quarantine.Open(pendingQueuePath(cfg))
+		if err != nil {
+			notifyError(cfg, cl.notif, err)
+			return fmt.Errorf("error opening pending queue: %v", err)
+		}
+	}
+
+	// Rules with their own schedule only act when due
+	due, err := dueRules(cfg, now)
+	if err != nil {
+		notifyError(cfg, cl.notif, err)
+		return err
+	}
+
+	deletedCount := 0
+	deletes := []*actions.Action{}
+	for _, draft := range c.Drafts {
+		d, ok := c.Decisions[draft.ID]
+		if !ok {
+			continue
+		}
+		if c.Retried[draft.ID] {
+			d.Outcome = "deleted, retried from the action queue"
+			continue
+		}
+		if !due[d.Rule] && (d.Stale || d.Delete) {
+			d.Explain("rules.%s.every: not due yet, keep", d.Rule)
+			if queue != nil && queue.Get(draft.ID) != nil {
+				queued[draft.ID] = true // keep its place in the queue
+			}
+			continue
+		}
+		if d.Stale {
+			d.Outcome = "stale"
+			c.Stale = append(c.Stale, draft)
+			continue
+		}
+		shouldDelete := d.Delete
+
+		if shouldDelete && cfg.MaxDeletions > 0 && deletedCount >= cfg.MaxDeletions {
+			fmt.Printf("Reached max_deletions (%d), keeping draft %s until the next check\n", cfg.MaxDeletions, draft.ID)
+			d.Explain("max_deletions: %d already deleted, keep until the next check", cfg.MaxDeletions)
+			shouldDelete = false
+			if queue != nil && queue.Get(draft.ID) != nil {
+				queued[draft.ID] = true // keep its place in the queue
+			}
+		}
+
+		// Nothing deletes a draft below min_age, whatever the rules say
+		if shouldDelete && belowMinAge(cfg, draft, now) {
+			fmt.Printf("Draft %s is younger than min_age (%v), keeping it\n", draft.ID, cfg.MinAge)
+			d.Explain("min_age: younger than %v, keep", cfg.MinAge)
+			shouldDelete = false
+		}
+
+		// Never race an open compose window
+		if shouldDelete && recentlyEdited(draft, c.Changed[draft.ID], now, cfg.RecentEditGuard.Duration) {
+			fmt.Printf("Draft %s changed in the last %v, keeping it until the next check\n", draft.ID, cfg.RecentEditGuard)
+			d.Explain("recent_edit_guard: changed in the last %v, keep until the next check", cfg.RecentEditGuard)
+			shouldDelete = false
+			if queue != nil && queue.Get(draft.ID) != nil {
+				queued[draft.ID] = true
+			}
+		}
+
+		// A failed deletion from an earlier check is retried from the action queue
+		if shouldDelete && actionQueue != nil && actionQueue.Has(actions.KindDelete, draft.ID) {
+			d.Outcome = "delete, retried from the action queue"
+			continue
+		}
+
+		if shouldDelete && cfg.DryRun {
+			fmt.Printf("Would delete draft (ID: %s, age: %v, subject: %q)\n", draft.ID, time.Since(draft.InternalDate).Round(time.Hour), draft.Subject)
+			d.Outcome = "delete (dry run)"
+			c.Deleted[draft.ID] = true
+			deletedCount++
+			continue
+		}
+
+		// Hold the draft in the pending-delete queue until its grace period ends
+		if shouldDelete && queue != nil {
+			queued[draft.ID] = true
+			entry := queue.Get(draft.ID)
+			if entry == nil || entry.MessageID != draft.MessageID {
+				queue.Add(&quarantine.Entry{
+					DraftID:   draft.ID,
+					MessageID: draft.MessageID,
+					Subject:   draft.Subject,
+					To:        draft.To,
+					Reason:    d.Reason,
+				})
+				if err := applyAction(ctx, cl.client, cfg, actionQueue, pendingLabelAction(actions.KindLabel, draft)); err != nil {
+					c.Result.Logf("Error labelling draft %s: %v", draft.ID, err)
+				}
+				if cl.hold {
+					fmt.Printf("Quarantined draft until approved in review (ID: %s, subject: %q)\n", draft.ID, draft.Subject)
+					d.Outcome = "quarantined until approved (pipeline.action)"
+				} else {
+					fmt.Printf("Queued draft for deletion in %v (ID: %s, subject: %q)\n", cfg.GracePeriod, draft.ID, draft.Subject)
+					d.Outcome = fmt.Sprintf("queued for deletion in %v (grace_period)", cfg.GracePeriod)
+				}
+				pendingCount++
+				queuedCount++
+				continue
+			}
+			due := entry.Due(cfg.GracePeriod.Duration, now)
+			if cl.hold {
+				due = entry.Decision == quarantine.DecisionApproved
+			}
+			if !due {
+				if entry.Decision != quarantine.DecisionRejected {
+					d.Outcome = "pending deletion (grace_period)"
+					if cl.hold {
+						d.Outcome = "quarantined until approved (pipeline.action)"
+					}
+					pendingCount++
+				} else if !entry.Unlabeled {
+					// Rejected while Gmail was unreachable
+					if err := applyAction(ctx, cl.client, cfg, actionQueue, pendingLabelAction(actions.KindUnlabel, draft)); err != nil {
+						c.Result.Logf("Error labelling draft %s: %v", draft.ID, err)
+					}
+					entry.Unlabeled = true
+				}
+				continue
+			}
+		}
+
+		if shouldDelete {
+			age := time.Since(draft.InternalDate)
+			if d.ByRule {
+				fmt.Printf("Deleting draft by rule (ID: %s, age: %v, reason: %s)\n", draft.ID, age.Round(time.Hour), d.Reason)
+			} else {
+				fmt.Printf("Deleting empty draft (ID: %s, age: %v)\n", draft.ID, age.Round(time.Hour))
+			}
+
+			deletes = append(deletes, &actions.Action{
+				Kind:        actions.KindDelete,
+				DraftID:     draft.ID,
+				MessageID:   draft.MessageID,
+				Subject:     draft.Subject,
+				To:          draft.To,
+				Reason:      d.Reason,
+				Explanation: d.Trace,
+			})
+			deletedCount++ // counts toward max_deletions until it fails
+		}
+	}
+
+	// Delete together what qualified, so many deletions don't take one
+	// request after another
+	if len(deletes) > 0 {
+		errs := applyDeletes(ctx, cl.client, cfg, actionQueue, deletes)
+		for _, a := range deletes {
+			d := c.Decisions[a.DraftID]
+			if err := errs[a.DraftID]; err != nil {
+				log.Printf("%v", err)
+				d.Outcome = "delete failed: " + err.Error()
+				c.Failures[a.DraftID] = err
+				deletedCount--
+				continue
+			}
+			d.Outcome = "deleted"
+			c.Deleted[a.DraftID] = true
+			if queue != nil {
+				queue.Remove(a.DraftID)
+			}
+		}
+		if len(errs) > 0 {
+			retry := ""
+			if actionQueue != nil {
+				retry = " and will be retried from the action queue"
+			}
+			fmt.Printf("Deleted %d of %d draft(s); %d failed%s\n", len(deletes)-len(errs), len(deletes), len(errs), retry)
+		}
+	}
+
+	if explain {
+		printExplanations(c.Drafts, c.Decisions)
+	}
+
+	// Drafts that are no longer eligible leave the queue and lose the label
+	if queue != nil {
+		current := make(map[string]*gmail.Draft, len(c.Drafts))
+		for _, draft := range c.Drafts {
+			current[draft.ID] = draft
+		}
+		for _, entry := range queue.Entries() {
+			if queued[entry.DraftID] {
+				continue
+			}
+			queue.Remove(entry.DraftID)
+			if draft, ok := current[entry.DraftID]; ok && draft.MessageID == entry.MessageID {
+				if err := applyAction(ctx, cl.client, cfg, actionQueue, pendingLabelAction(actions.KindUnlabel, draft)); err != nil {
+					c.Result.Logf("Error labelling draft %s: %v", draft.ID, err)
+				}
+			}
+		}
+		if err := queue.Save(); err != nil {
+			c.Result.Logf("Error saving pending queue: %v", err)
+		}
+	}
+
+	// Most likely abandoned first
+	sort.SliceStable(c.Stale, func(i, j int) bool {
+		return c.Decisions[c.Stale[i].ID].Score > c.Decisions[c.Stale[j].ID].Score
+	})
+
+	c.Result.Counts.Deleted = deletedCount
+	c.Result.Counts.Pending = pendingCount
+	c.Result.Counts.Queued = queuedCount
+	c.Result.Causes = deletionCauses(c.Failures)
+	return nil
+}
+
+// notifyReporter sends the notifications of a check: the alarm, the
+// summary, pending and stale drafts and deletions
+type notifyReporter struct {
+	notif *notifier.Notifier
+	cfg   *config.Config
+}
+
+func (n *notifyReporter) Report(ctx context.Context, c *engine.Check) error {
+	counts := c.Result.Counts
+
+	// A runaway client creating drafts in a loop warrants more than the usual notification
+	if n.cfg.Alarm != nil {
+		if message := alarmMessage(n.cfg.Alarm, counts.Drafts, counts.Empty); message != "" {
+			fmt.Printf("ALARM: %s\n", message)
+			if err := n.notif.NotifyAlarm(message); err != nil {
+				c.Result.Logf("Error sending alarm: %v", err)
+			}
+		}
+	}
+
+	if err := n.notif.NotifyDraftsWithDetails(counts.Drafts, counts.Empty); err != nil {
+		c.Result.Logf("Error sending notification: %v", err)
+	}
+
+	if counts.Pending > 0 {
+		fmt.Printf("%d draft(s) pending deletion, run \"calmdrafts review\" to approve or reject them\n", counts.Pending)
+	}
+	if counts.Queued > 0 {
+		if err := n.notif.NotifyPending(counts.Pending); err != nil {
+			c.Result.Logf("Error sending pending notification: %v", err)
+		}
+	}
+
+	// Remind about stale drafts, most likely abandoned first
+	var top *gmail.Draft
+	for _, draft := range c.Stale {
+		fmt.Printf("Stale draft (ID: %s, score: %.2f, subject: %q%s)\n", draft.ID, c.Decisions[draft.ID].Score, draft.Subject, replyContext(draft, c.Now))
+		if top == nil || (top.Subject == "" && top.ReplyTo == nil) {
+			top = draft
+		}
+	}
+	topSubject, replyTo, replyAge := "", "", time.Duration(0)
+	if top != nil {
+		topSubject = top.Subject
+		if top.ReplyTo != nil {
+			replyTo, replyAge = top.ReplyTo.Sender(), c.Now.Sub(top.ReplyTo.Date)
+		}
+	}
+	if err := n.notif.NotifyStale(len(c.Stale), topSubject, replyTo, replyAge); err != nil {
+		c.Result.Logf("Error sending stale notification: %v", err)
+	}
+
+	reportDeletions(n.notif, c.Result, !c.DryRun)
+	return nil
+}
+
+// reminderReporter keeps the drafts that remind the user up to date:
+// follow-ups, nudges and the digest draft
+type reminderReporter struct {
+	client *gmail.Client
+	notif  *notifier.Notifier
+	cfg    *config.Config
+}
+
+func (r *reminderReporter) Report(ctx context.Context, c *engine.Check) error {
+	cfg := r.cfg
+	if cfg.StateDir == "" || c.DryRun {
+		return nil
+	}
+	if cfg.FollowUps != nil {
+		staleRules := make(map[string]string, len(c.Stale))
+		for _, draft := range c.Stale {
+			staleRules[draft.ID] = c.Decisions[draft.ID].Rule
+		}
+		if err := createFollowUps(ctx, r.client, cfg, c.Drafts, c.Stale, staleRules, c.Now); err != nil {
+			c.Result.Logf("Error creating follow-ups: %v", err)
+		}
+	}
+	if cfg.Nudge != nil {
+		remaining := []*gmail.Draft{}
+		for _, draft := range c.Drafts {
+			if !c.Deleted[draft.ID] && !draft.IsTemplate {
+				remaining = append(remaining, draft)
+			}
+		}
+		if err := nudgeDrafts(cfg, r.notif, remaining, c.Changed, c.Now); err != nil {
+			c.Result.Logf("Error nudging about drafts: %v", err)
+		}
+	}
+	if cfg.DigestDraft {
+		if err := updateDigestDraft(ctx, r.client, cfg, c.Stale, c.Now); err != nil {
+			c.Result.Logf("Error updating digest draft: %v", err)
+		}
+	}
+	return nil
+}
+
+// triageReporter groups the remaining drafts into triage buckets and
+// writes the report
+type triageReporter struct {
+	cfg *config.Config
+}
+
+func (t *triageReporter) Report(ctx context.Context, c *engine.Check) error {
+	triage := report.NewTriage(c.Now)
+	triage.LargeDraftSize = t.cfg.LargeDraftSize
+	triage.Locale = locale(t.cfg)
+	triage.Mailbox = t.cfg.Mailbox
+	if t.cfg.ReportPath != "" {
+		links, err := reportActions(t.cfg)
+		if err != nil {
+			c.Result.Logf("Error preparing report links: %v", err)
+		}
+		triage.Actions = links
+	}
+	isStale := make(map[string]bool)
+	for _, draft := range c.Stale {
+		isStale[draft.ID] = true
+	}
+	score := func(draft *gmail.Draft) float64 {
+		if d, ok := c.Decisions[draft.ID]; ok {
+			return d.Score
+		}
+		return 0
+	}
+	for _, draft := range c.Drafts {
+		switch {
+		case c.Deleted[draft.ID]:
+			continue
+		case draft.IsTemplate:
+			triage.Add(report.BucketTemplates, draft, 0)
+		case isStale[draft.ID]:
+			triage.Add(report.BucketNeedsDecision, draft, score(draft))
+		case draft.IsEmpty:
+			triage.Add(report.BucketSafeToDelete, draft, score(draft))
+		default:
+			triage.Add(report.BucketInProgress, draft, score(draft))
+		}
+	}
+	fmt.Printf("Triage: %s\n", triage.Summary())
+
+	if t.cfg.ReportPath != "" {
+		if err := writeReport(t.cfg.ReportPath, triage); err != nil {
+			c.Result.Logf("Error writing report: %v", err)
+		}
+	}
+	return nil
+}
+
+// statsReporter records an observation of the mailbox for stats and
+// publishes it to MQTT
+type statsReporter struct {
+	cfg *config.Config
+}
+
+func (s *statsReporter) Report(ctx context.Context, c *engine.Check) error {
+	counts := c.Result.Counts
+	obs := &stats.Observation{
+		Time:    c.Now,
+		Drafts:  counts.Drafts,
+		Empty:   counts.Empty,
+		Stale:   counts.Stale,
+		Pending: counts.Pending,
+		Ages:    stats.NewHistogram(c.Drafts, c.Now),
+		Bytes:   stats.TotalSize(c.Drafts),
+	}
+	if !c.DryRun {
+		obs.Deleted = counts.Deleted
+	}
+
+	// Keep a history of observations for stats export
+	if s.cfg.StateDir != "" {
+		if err := stats.OpenHistory(historyPath(s.cfg)).Append(obs); err != nil {
+			c.Result.Logf("Error recording stats: %v", err)
+		}
+	}
+	if err := publishState(s.cfg, obs); err != nil {
+		c.Result.Logf("Error publishing to MQTT: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/engine"
+	"calmdrafts/internal/gmail"
+)
+
+// explain prints how the rules decided about every draft during a check,
+// set by clean --explain
+var explain bool
+
+// runClean runs a single check of the mailbox, like -check, optionally
+// explaining every decision
+func runClean(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	fs.BoolVar(&explain, "explain", false, "Print the rules and exclusions that decided about every draft")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	plugins, rulesScript, model, err := loadRules(cfg)
+	if err != nil {
+		return err
+	}
+	notif, err := newNotifier(cfg, plugins, true)
+	if err != nil {
+		return err
+	}
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err != nil {
+		notifyError(cfg, notif, err)
+		return fmt.Errorf("error creating Gmail client: %v", err)
+	}
+	if _, err := checkAndCleanDrafts(ctx, client, notif, plugins, rulesScript, model, cfg); err != nil {
+		return err
+	}
+	if !cfg.DryRun {
+		remindTrashPurge(cfg, notif, time.Now())
+	}
+	return nil
+}
+
+// printExplanations prints the decision trace and outcome of every draft
+func printExplanations(drafts []*gmail.Draft, decisions map[string]*engine.Decision) {
+	for _, draft := range drafts {
+		d, ok := decisions[draft.ID]
+		if !ok {
+			continue
+		}
+		subject := draft.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		fmt.Printf("\nDraft %s  %q\n", draft.ID, subject)
+		for _, step := range d.Trace {
+			fmt.Printf("  %s\n", step)
+		}
+		fmt.Printf("  => %s\n", d.Outcome)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"calmdrafts/internal/config"
+)
+
+// command is a subcommand run instead of the default daemon mode
+type command struct {
+	name        string
+	description string
+	run         func(ctx context.Context, cfg *config.Config, args []string) error
+}
+
+// commands lists all subcommands in the order shown by usage
+var commands = []*command{
+	{name: "clean", description: "Run a single check, optionally explaining every decision", run: runClean},
+	{name: "rules", description: "Test the configured rules against the mailbox or a fixture without changing anything", run: runRules},
+	{name: "policy", description: "Lint a policy file or print its JSON Schema", run: runPolicy},
+	{name: "simulate", description: "Replay the recorded draft history under a proposed policy", run: runSimulate},
+	{name: "plan", description: "Write the deletions a check would make to a signed plan file", run: runPlan},
+	{name: "apply", description: "Apply exactly the deletions in a plan file", run: runApply},
+	{name: "list", description: "List drafts, from the local cache when Gmail is unreachable", run: runList},
+	{name: "search", description: "Find drafts with a Gmail search query and local filters", run: runSearch},
+	{name: "attachments", description: "Download the attachments of a draft", run: runAttachments},
+	{name: "status", description: "Summarize the last check from local state", run: runStatus},
+	{name: "stats", description: "Show draft counts and an age histogram", run: runStats},
+	{name: "runs", description: "List recent checks, or show one with the decision trace of every draft", run: runRuns},
+	{name: "state", description: "Export the local state and audit log to a zip file, or import it on another machine", run: runState},
+	{name: "review", description: "Approve or reject drafts waiting in the pending-delete queue", run: runReview},
+	{name: "nudge", description: "Send, snooze or delete drafts that look ready to send", run: runNudge},
+	{name: "enable-cleanup", description: "End the observation period so checks start deleting drafts", run: runEnableCleanup},
+	{name: "notifications", description: "List recent notifications and whether they were delivered", run: runNotifications},
+	{name: "restore", description: "Recreate a deleted draft from the archive", run: runRestore},
+	{name: "fleet", description: "Check every user of a Workspace domain with the central policy", run: runFleet},
+	{name: "serve", description: "Host CalmDrafts for several users who connect their mailbox through the browser", run: runServe},
+	{name: "config", description: "Get or set individual config values", run: runConfig},
+	{name: "bugreport", description: "Collect version, redacted config, logs and platform details into a zip for an issue", run: runBugreport},
+	{name: "doctor", description: "Diagnose credentials, token, API access, notifications and permissions", run: runDoctor},
+	{name: "gc", description: "Prune the archive and audit log according to the retention policy", run: runGC},
+	{name: "update", description: "Download and install the latest release", run: runUpdate},
+	{name: "version", description: "Print version and build information", run: runVersion},
+}
+
+// findCommand returns the subcommand with the given name, or nil
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// usage prints the global flags and available subcommands
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprint(out, "Usage: calmdrafts [flags] [command] [command flags]\n\n")
+	fmt.Fprintf(out, "Without a command, %s runs continuously and checks drafts periodically.\n\n", appName)
+	fmt.Fprintln(out, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-15s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"calmdrafts/internal/config"
+)
+
+// runConfig reads or modifies individual config values
+func runConfig(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: config get [key] | config set <key> <value>")
+	}
+
+	switch args[0] {
+	case "get":
+		key := ""
+		if len(args) > 1 {
+			key = args[1]
+		}
+		value, err := config.GetValue(cfg, key)
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: config set <key> <value>")
+		}
+		if err := config.SetValue(*configPath, args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("Set %s = %s in %s\n", args[1], args[2], *configPath)
+		return nil
+	default:
+		return fmt.Errorf("unknown config subcommand %q (want get or set)", args[0])
+	}
+}
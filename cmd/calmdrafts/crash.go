@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"calmdrafts/internal/buildinfo"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/notifier"
+)
+
+// crashPath returns where the stack trace of the last panic is kept
+func crashPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "crash.txt")
+}
+
+// panicError is a panic recovered by recovered, with its stack trace
+type panicError struct {
+	what  string
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("unexpected failure during %s: %v", e.what, e.value)
+}
+
+// recovered runs fn, turning a panic into an error carrying the stack trace,
+// so a bug hit by one draft or notification doesn't kill the daemon
+func recovered(what string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{what: what, value: r, stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
+
+// reportPanic logs the stack trace of a recovered panic, keeps it in
+// state_dir for bug reports and notifies the user. Other errors are left to
+// the caller. It reports whether err was a panic.
+func reportPanic(cfg *config.Config, notif *notifier.Notifier, err error) bool {
+	var p *panicError
+	if !errors.As(err, &p) {
+		return false
+	}
+	log.Printf("%v\n%s", p, p.stack)
+
+	if cfg.StateDir != "" {
+		report := fmt.Sprintf("%s\n%s\n\n%v\n\n%s", time.Now().Format(time.RFC3339), buildinfo.Get(), p, p.stack)
+		if err := os.MkdirAll(cfg.StateDir, 0700); err == nil {
+			err = os.WriteFile(crashPath(cfg), []byte(report), 0600)
+		}
+		if err != nil {
+			log.Printf("Error saving crash report: %v", err)
+		}
+	}
+
+	// The notifier may be what panicked
+	if notif != nil {
+		if err := recovered("error notification", func() error { return notif.NotifyError(p) }); err != nil {
+			log.Printf("Error sending notification: %v", err)
+		}
+	}
+	return true
+}
+
+// exitOnPanic is deferred by the daemon: a panic that escaped the
+// per-check recovery is reported before the process exits, so a service
+// manager restarts it and the user learns why
+func exitOnPanic(cfg *config.Config, notif *notifier.Notifier) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	reportPanic(cfg, notif, &panicError{what: "the main loop", value: r, stack: debug.Stack()})
+	os.Exit(2)
+}
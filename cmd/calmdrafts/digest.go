@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/report"
+)
+
+// digestState remembers the digest draft between checks
+type digestState struct {
+	DraftID string `json:"draft_id"`
+	SHA256  string `json:"sha256"` // Hash of the listed drafts, to skip unchanged updates
+}
+
+// digestStatePath returns where the digest draft's ID is stored
+func digestStatePath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "digest.json")
+}
+
+// loadDigestState reads the digest state. A missing file is an empty state.
+func loadDigestState(cfg *config.Config) *digestState {
+	state := &digestState{}
+	if cfg.StateDir == "" {
+		return state
+	}
+	if data, err := os.ReadFile(digestStatePath(cfg)); err == nil {
+		json.Unmarshal(data, state)
+	}
+	return state
+}
+
+// saveDigestState writes the digest state
+func saveDigestState(cfg *config.Config, state *digestState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	return os.WriteFile(digestStatePath(cfg), append(data, '\n'), 0600)
+}
+
+// withoutDigest removes the digest draft from a draft list so it is never
+// counted, reported or cleaned up
+func withoutDigest(cfg *config.Config, drafts []*gmail.Draft) []*gmail.Draft {
+	digestID := loadDigestState(cfg).DraftID
+	kept := drafts[:0]
+	for _, draft := range drafts {
+		if draft.ID == digestID || draft.Subject == report.DigestSubject {
+			continue
+		}
+		kept = append(kept, draft)
+	}
+	return kept
+}
+
+// updateDigestDraft keeps a draft listing the stale drafts in the mailbox,
+// for people who live in the Gmail UI. The draft is removed once nothing
+// is stale.
+func updateDigestDraft(ctx context.Context, client *gmail.Client, cfg *config.Config, stale []*gmail.Draft, now time.Time) error {
+	state := loadDigestState(cfg)
+
+	if len(stale) == 0 {
+		if state.DraftID == "" {
+			return nil
+		}
+		if err := client.DeleteDraft(ctx, state.DraftID); err != nil && !errors.Is(err, gmail.ErrNotFound) {
+			return err
+		}
+		fmt.Println("Removed the digest draft, nothing is stale")
+		return saveDigestState(cfg, &digestState{})
+	}
+
+	body := report.DigestBody(cfg.Mailbox, stale)
+	sum := sha256.Sum256([]byte(body))
+	hash := hex.EncodeToString(sum[:])
+	if state.DraftID != "" && state.SHA256 == hash {
+		return nil
+	}
+
+	// The note doesn't count toward the hash, so it is only refreshed
+	// along with the list
+	note := ""
+	if calls, err := weeklyCalls(cfg, now); err != nil {
+		log.Printf("Error reading run history: %v", err)
+	} else if calls != nil && calls.Calls > 0 {
+		note = calls.Summary("this week")
+	}
+	raw := report.DigestMessage(body, note, now)
+	err := gmail.ErrNotFound
+	if state.DraftID != "" {
+		err = client.UpdateDraft(ctx, state.DraftID, raw)
+	}
+	if errors.Is(err, gmail.ErrNotFound) {
+		// Never created, or deleted by the user
+		state.DraftID, err = client.CreateDraft(ctx, raw)
+	}
+	if err != nil {
+		return err
+	}
+	state.SHA256 = hash
+	fmt.Printf("Updated the digest draft %q (ID: %s)\n", report.DigestSubject, state.DraftID)
+	return saveDigestState(cfg, state)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/plugin"
+)
+
+// checkStatus is the outcome of a single diagnostic
+type checkStatus int
+
+const (
+	statusOK checkStatus = iota
+	statusWarn
+	statusFail
+)
+
+// diagnosis is the result of one doctor check, with a suggested fix
+type diagnosis struct {
+	name    string
+	status  checkStatus
+	message string
+	fix     string
+}
+
+// maxClockSkew is the largest local clock offset that won't upset OAuth
+const maxClockSkew = time.Minute
+
+// runDoctor checks the environment and prints actionable fixes
+func runDoctor(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	sendTest := fs.Bool("notify", false, "Also send a test notification")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	results := []diagnosis{}
+	add := func(d diagnosis) {
+		results = append(results, d)
+		label := map[checkStatus]string{statusOK: " OK ", statusWarn: "WARN", statusFail: "FAIL"}[d.status]
+		fmt.Printf("[%s] %s: %s\n", label, d.name, d.message)
+		if d.status != statusOK && d.fix != "" {
+			fmt.Printf("       Fix: %s\n", d.fix)
+		}
+	}
+
+	add(checkCredentials(cfg))
+	tokenOK := checkToken(ctx, cfg, add)
+	if tokenOK {
+		add(checkGmail(ctx, cfg))
+	}
+	add(checkClock(ctx))
+	add(checkNotifications(cfg, *sendTest))
+	for _, d := range checkPermissions(cfg) {
+		add(d)
+	}
+
+	failed := 0
+	for _, d := range results {
+		if d.status == statusFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	fmt.Println("All checks passed")
+	return nil
+}
+
+// checkCredentials verifies the OAuth client file
+func checkCredentials(cfg *config.Config) diagnosis {
+	d := diagnosis{name: "Credentials"}
+	if err := gmail.ValidateCredentials(cfg.CredentialsPath); err != nil {
+		d.status = statusFail
+		d.message = fmt.Sprintf("%s is not usable: %v", cfg.CredentialsPath, err)
+		d.fix = "Download a \"Desktop app\" OAuth client JSON from Google Cloud Console > APIs & Services > Credentials and save it as " + cfg.CredentialsPath
+		return d
+	}
+	d.message = cfg.CredentialsPath + " is a valid OAuth client"
+	return d
+}
+
+// checkToken verifies the stored token can be refreshed and has the needed scopes
+func checkToken(ctx context.Context, cfg *config.Config, add func(diagnosis)) bool {
+	reauth := fmt.Sprintf("Delete %s and run calmdrafts once interactively to re-authorize", cfg.TokenPath)
+
+	if _, err := os.Stat(cfg.TokenPath); err != nil {
+		add(diagnosis{name: "Token", status: statusFail, message: cfg.TokenPath + " not found", fix: "Run calmdrafts once interactively to authorize access"})
+		return false
+	}
+
+	status, err := gmail.InspectToken(ctx, cfg.CredentialsPath, cfg.TokenPath)
+	if err != nil {
+		add(diagnosis{name: "Token", status: statusFail, message: err.Error(), fix: reauth})
+		return false
+	}
+
+	d := diagnosis{name: "Token", message: fmt.Sprintf("valid until %s", status.Expiry.Format(time.RFC3339))}
+	if !status.HasRefreshToken {
+		d.status = statusWarn
+		d.message += ", but has no refresh token and will stop working when it expires"
+		d.fix = reauth
+	}
+	add(d)
+
+	missing := []string{}
+	for _, scope := range append(gmail.RequiredScopes, gmailOptions(cfg).Scopes...) {
+		found := false
+		for _, granted := range status.Scopes {
+			if granted == scope {
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		add(diagnosis{name: "Scopes", status: statusFail, message: "missing " + strings.Join(missing, ", "), fix: reauth})
+		return false
+	}
+	add(diagnosis{name: "Scopes", message: strings.Join(status.Scopes, ", ")})
+	return true
+}
+
+// checkGmail makes a real API call
+func checkGmail(ctx context.Context, cfg *config.Config) diagnosis {
+	d := diagnosis{name: "Gmail API"}
+	client, err := gmail.OpenClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err == nil {
+		var email string
+		email, err = client.Profile(ctx)
+		if err == nil {
+			d.message = "reachable, authenticated as " + email
+			if cfg.Mailbox != "" {
+				d.message = "reachable, acting as delegate on " + email
+			}
+			return d
+		}
+	}
+	d.status = statusFail
+	d.message = err.Error()
+	d.fix = "Check your internet connection and that the Gmail API is enabled for your Google Cloud project"
+	if cfg.Mailbox != "" {
+		d.fix = fmt.Sprintf("Check that %s has added you as a delegate and that your Workspace allows delegated access through the Gmail API", cfg.Mailbox)
+	}
+	return d
+}
+
+// checkClock compares the local clock with Google's
+func checkClock(ctx context.Context) diagnosis {
+	d := diagnosis{name: "Clock"}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, "https://www.googleapis.com/", nil)
+	if err != nil {
+		d.status, d.message = statusWarn, err.Error()
+		return d
+	}
+	start := time.Now()
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		d.status, d.message = statusWarn, fmt.Sprintf("unable to reach Google to compare clocks: %v", err)
+		return d
+	}
+	resp.Body.Close()
+
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		d.status, d.message = statusWarn, "Google did not return a usable Date header"
+		return d
+	}
+
+	// Compare against the midpoint of the request to cancel out latency
+	local := start.Add(time.Since(start) / 2)
+	skew := local.Sub(remote)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew {
+		d.status = statusFail
+		d.message = fmt.Sprintf("local clock is off by %v", skew.Round(time.Second))
+		d.fix = "Enable automatic time synchronization (NTP) in your system settings"
+		return d
+	}
+	d.message = fmt.Sprintf("within %v of Google", maxClockSkew)
+	return d
+}
+
+// checkNotifications verifies the desktop backend and lists plugin notifiers
+func checkNotifications(cfg *config.Config, sendTest bool) diagnosis {
+	d := diagnosis{name: "Notifications"}
+
+	fallback := "printed on the terminal"
+	if cfg.Notifications != nil && cfg.Notifications.Wall {
+		fallback += " or broadcast with wall"
+	}
+	d.message = "desktop backend available"
+	if err := notifier.CheckDesktop(); err != nil {
+		d.status = statusWarn
+		d.message = fmt.Sprintf("desktop notifications unavailable (%v), they are %s", err, fallback)
+		d.fix = "Run CalmDrafts inside a desktop session, or install a notifier plugin"
+	}
+
+	plugins, err := plugin.Load(cfg.PluginsDir)
+	if err != nil {
+		d.status, d.message = statusWarn, err.Error()
+		d.fix = "Check permissions on " + cfg.PluginsDir
+		return d
+	}
+	if n := len(plugins.Plugins(plugin.KindNotifier)); n > 0 {
+		d.message += fmt.Sprintf(", %d notifier plugin(s)", n)
+	}
+
+	if sendTest {
+		notif, err := newNotifier(cfg, plugins, true)
+		if err != nil {
+			d.status, d.message = statusFail, err.Error()
+			return d
+		}
+		if err := notif.NotifyTest(); err != nil {
+			d.status = statusFail
+			d.message = "test notification failed: " + err.Error()
+			d.fix = "On macOS allow notifications for your terminal in System Settings > Notifications"
+			if notif.DesktopError() != nil {
+				d.fix = "Run CalmDrafts in a terminal, set notifications.wall, or install a notifier plugin"
+			}
+			return d
+		}
+		if err := notif.DesktopError(); err != nil && d.status == statusOK {
+			d.status = statusWarn
+			d.message = fmt.Sprintf("desktop notification failed (%v), it was %s", err, fallback)
+			d.fix = "Check that a notification daemon is running in your desktop session"
+		}
+		d.message += ", test notification sent"
+	}
+	return d
+}
+
+// checkPermissions makes sure secrets are private and data paths are writable
+func checkPermissions(cfg *config.Config) []diagnosis {
+	results := []diagnosis{}
+
+	for _, path := range []string{cfg.CredentialsPath, cfg.TokenPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		d := diagnosis{name: "Permissions", message: path + " is private"}
+		if info.Mode().Perm()&0077 != 0 {
+			d.status = statusWarn
+			d.message = fmt.Sprintf("%s is readable by other users (%v)", path, info.Mode().Perm())
+			d.fix = "chmod 600 " + path
+		}
+		results = append(results, d)
+	}
+
+	// Each path with the directory that must be writable for it
+	writable := [][2]string{{cfg.TokenPath, filepath.Dir(cfg.TokenPath)}}
+	if cfg.ArchiveDir != "" {
+		writable = append(writable, [2]string{cfg.ArchiveDir, cfg.ArchiveDir})
+	}
+	if cfg.AuditLogPath != "" {
+		writable = append(writable, [2]string{cfg.AuditLogPath, filepath.Dir(cfg.AuditLogPath)})
+	}
+	if usesPendingQueue(cfg) {
+		writable = append(writable, [2]string{cfg.StateDir, cfg.StateDir})
+	}
+	for _, w := range writable {
+		path, dir := w[0], w[1]
+		d := diagnosis{name: "Permissions", message: path + " is writable"}
+		if err := checkWritable(dir); err != nil {
+			d.status = statusFail
+			d.message = fmt.Sprintf("%s is not writable: %v", path, err)
+			d.fix = "Fix ownership or permissions of " + dir
+		}
+		results = append(results, d)
+	}
+
+	return results
+}
+
+// checkWritable creates and removes a temporary file in dir. A missing
+// directory is fine as long as its parent is writable.
+func checkWritable(dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return checkWritable(filepath.Dir(dir))
+	}
+	f, err := os.CreateTemp(dir, ".calmdrafts-doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
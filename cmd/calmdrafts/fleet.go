@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/classifier"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/plugin"
+	"calmdrafts/internal/script"
+	"calmdrafts/internal/stats"
+)
+
+// defaultOptOutLabel is the Gmail label users create to be left alone
+const defaultOptOutLabel = "CalmDrafts/Opt out"
+
+// fleetResult is the outcome of checking one user
+type fleetResult struct {
+	user   string
+	status string // "ok", "opted out" or the error
+	obs    *stats.Observation
+}
+
+// runFleet checks every configured Workspace user with the central policy,
+// once or on every check_interval
+func runFleet(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("fleet", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	once := fs.Bool("once", false, "Check every user once and exit")
+	fs.Parse(args)
+	if err := flagOverrides.applyAny(cfg); err != nil {
+		return err
+	}
+
+	if cfg.Fleet == nil || cfg.Fleet.ServiceAccountPath == "" {
+		return fmt.Errorf("fleet.service_account_path is not set")
+	}
+	users, err := fleetUsers(cfg.Fleet)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("fleet has no users")
+	}
+
+	plugins, rulesScript, model, err := loadRules(cfg)
+	if err != nil {
+		return fmt.Errorf("error loading rules: %v", err)
+	}
+
+	// Users aren't sitting at this machine, so only plugin backends notify
+	notif, err := newNotifier(cfg, plugins, false)
+	if err != nil {
+		return err
+	}
+
+	if *once {
+		checkFleet(ctx, cfg, users, notif, plugins, rulesScript, model)
+		return nil
+	}
+
+	// Answer the Windows service manager before the first check, which can
+	// take longer than it waits
+	sigChan := make(chan os.Signal, 1)
+	defer handleShutdown(sigChan)()
+	checkFleet(ctx, cfg, users, notif, plugins, rulesScript, model)
+
+	ticker := time.NewTicker(cfg.CheckInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			checkFleet(ctx, cfg, users, notif, plugins, rulesScript, model)
+		case sig := <-sigChan:
+			fmt.Printf("\nReceived signal %v, shutting down gracefully...\n", sig)
+			return nil
+		}
+	}
+}
+
+// fleetUsers returns the configured users followed by those in users_file,
+// without duplicates
+func fleetUsers(fleet *config.Fleet) ([]string, error) {
+	users := []string{}
+	seen := make(map[string]bool)
+	add := func(user string) {
+		user = strings.ToLower(strings.TrimSpace(user))
+		if user != "" && !strings.HasPrefix(user, "#") && !seen[user] {
+			seen[user] = true
+			users = append(users, user)
+		}
+	}
+
+	for _, user := range fleet.Users {
+		add(user)
+	}
+	if fleet.UsersFile != "" {
+		file, err := os.Open(fleet.UsersFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read users file: %v", err)
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			add(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("unable to read users file: %v", err)
+		}
+	}
+	return users, nil
+}
+
+// fleetDir returns the directory holding per-user data and reports
+func fleetDir(cfg *config.Config) string {
+	if cfg.Fleet.Dir != "" {
+		return cfg.Fleet.Dir
+	}
+	return "fleet"
+}
+
+// perUserConfig returns the policy with local data moved to a user's own
+// directory
+func perUserConfig(cfg *config.Config, dir string) *config.Config {
+	userCfg := *cfg
+	userCfg.StateDir = filepath.Join(dir, "state")
+	userCfg.ReportPath = filepath.Join(dir, "report.md")
+	if cfg.ArchiveDir != "" {
+		userCfg.ArchiveDir = filepath.Join(dir, "archive")
+	}
+	if cfg.AuditLogPath != "" {
+		userCfg.AuditLogPath = filepath.Join(dir, "audit.log")
+	}
+	userCfg.Mailbox = ""
+	userCfg.Push = nil
+	userCfg.Grafana = nil
+	userCfg.ReportActions = nil
+	userCfg.Fleet = nil
+	userCfg.Server = nil
+	return &userCfg
+}
+
+// checkFleet checks every user in turn and writes the aggregate report
+func checkFleet(ctx context.Context, cfg *config.Config, users []string, notif *notifier.Notifier, plugins *plugin.Manager, rulesScript *script.Script, model *classifier.Model) {
+	optOutLabel := cfg.Fleet.OptOutLabel
+	if optOutLabel == "" {
+		optOutLabel = defaultOptOutLabel
+	}
+
+	results := make([]*fleetResult, 0, len(users))
+	for _, user := range users {
+		fmt.Printf("== %s\n", user)
+		result := &fleetResult{user: user, status: "ok"}
+		results = append(results, result)
+
+		userCfg := perUserConfig(cfg, filepath.Join(fleetDir(cfg), user))
+		client, err := gmail.NewServiceAccountClient(ctx, cfg.Fleet.ServiceAccountPath, user, gmailOptions(userCfg))
+		if err != nil {
+			result.status = err.Error()
+			log.Printf("Error creating Gmail client for %s: %v", user, err)
+			continue
+		}
+
+		labelID, err := client.LabelID(ctx, optOutLabel)
+		if err != nil {
+			result.status = err.Error()
+			log.Printf("Error checking opt-out label for %s: %v", user, err)
+			continue
+		}
+		if labelID != "" {
+			result.status = "opted out"
+			fmt.Printf("Skipping %s, who has the %q label\n", user, optOutLabel)
+			continue
+		}
+
+		err = recovered("check of "+user, func() error {
+			_, err := checkAndCleanDrafts(ctx, client, notif, plugins, rulesScript, model, userCfg)
+			return err
+		})
+		if err != nil {
+			result.status = err.Error()
+			if !reportPanic(userCfg, notif, err) {
+				log.Printf("Error checking %s: %v", user, err)
+			}
+			continue
+		}
+		if !userCfg.DryRun {
+			remindTrashPurge(userCfg, notif, time.Now())
+		}
+		if observations, err := stats.OpenHistory(historyPath(userCfg)).Observations(); err == nil && len(observations) > 0 {
+			result.obs = observations[len(observations)-1]
+		}
+	}
+
+	path := filepath.Join(fleetDir(cfg), "report.md")
+	if err := writeFleetReport(path, results, time.Now()); err != nil {
+		log.Printf("Error writing fleet report: %v", err)
+	}
+}
+
+// writeFleetReport writes one Markdown row per user and the fleet totals
+func writeFleetReport(path string, results []*fleetResult, now time.Time) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# CalmDrafts fleet report\n\nChecked %d user(s) at %s.\n\n", len(results), now.Format("2006-01-02 15:04"))
+	b.WriteString("| User | Drafts | Empty | Deleted | Stale | Pending | Status |\n|---|---:|---:|---:|---:|---:|---|\n")
+
+	total := &stats.Observation{}
+	checked := 0
+	for _, r := range results {
+		if r.obs == nil {
+			fmt.Fprintf(&b, "| %s | | | | | | %s |\n", r.user, r.status)
+			continue
+		}
+		o := r.obs
+		fmt.Fprintf(&b, "| %s | %d | %d | %d | %d | %d | %s |\n", r.user, o.Drafts, o.Empty, o.Deleted, o.Stale, o.Pending, r.status)
+		total.Drafts += o.Drafts
+		total.Empty += o.Empty
+		total.Deleted += o.Deleted
+		total.Stale += o.Stale
+		total.Pending += o.Pending
+		checked++
+	}
+	fmt.Fprintf(&b, "| **Total (%d checked)** | %d | %d | %d | %d | %d | |\n", checked, total.Drafts, total.Empty, total.Deleted, total.Stale, total.Pending)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0600)
+}
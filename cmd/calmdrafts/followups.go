@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/followup"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/report"
+)
+
+// followUpsPath returns where the follow-ups already created are recorded
+func followUpsPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "followups.json")
+}
+
+// followUpTarget returns where a stale draft decided by rule gets its
+// follow-up, falling back to the "*" entry
+func followUpTarget(cfg *config.Config, rule string) (followup.Target, error) {
+	name, ok := cfg.FollowUps.Rules[rule]
+	if !ok {
+		name, ok = cfg.FollowUps.Rules["*"]
+	}
+	if !ok {
+		return followup.TargetNone, nil
+	}
+	return followup.ParseTarget(name)
+}
+
+// createFollowUps creates a task or calendar reminder for each stale draft
+// that doesn't have one yet. staleRules maps draft IDs to the rule that
+// found them stale.
+func createFollowUps(ctx context.Context, client *gmail.Client, cfg *config.Config, drafts, stale []*gmail.Draft, staleRules map[string]string, now time.Time) error {
+	store, err := followup.Open(followUpsPath(cfg))
+	if err != nil {
+		return err
+	}
+	creator, err := followup.NewCreator(ctx, client.HTTPClient(), cfg.FollowUps.TaskList, cfg.FollowUps.CalendarID)
+	if err != nil {
+		return err
+	}
+
+	due := cfg.FollowUps.Due.Duration
+	if due <= 0 {
+		due = 24 * time.Hour
+	}
+	for _, draft := range stale {
+		if store.Get(draft.ID) != nil {
+			continue
+		}
+		target, err := followUpTarget(cfg, staleRules[draft.ID])
+		if err != nil {
+			return err
+		}
+		if target == followup.TargetNone {
+			continue
+		}
+
+		item := followup.NewItem(draft.To, draft.Subject, report.DraftLink(cfg.Mailbox, draft), now.Add(due))
+		id, err := creator.Create(ctx, target, item)
+		if err != nil {
+			log.Printf("Error creating follow-up for draft %s: %v", draft.ID, err)
+			continue
+		}
+		store.Add(&followup.Entry{DraftID: draft.ID, Subject: draft.Subject, Target: target, ID: id})
+		fmt.Printf("Created %s follow-up %q (draft ID: %s)\n", target, item.Title, draft.ID)
+	}
+
+	// Forget drafts that were sent or deleted
+	exists := make(map[string]bool, len(drafts))
+	for _, draft := range drafts {
+		exists[draft.ID] = true
+	}
+	store.Prune(func(draftID string) bool { return exists[draftID] })
+	return store.Save()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"calmdrafts/internal/archive"
+	"calmdrafts/internal/audit"
+	"calmdrafts/internal/cache"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/runs"
+	"calmdrafts/internal/stats"
+)
+
+// runGC applies the retention policy once
+func runGC(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	return collectGarbage(cfg)
+}
+
+// collectGarbage prunes the archive directory, the audit log and the
+// histories in the state directory according to the configured retention
+// limits
+func collectGarbage(cfg *config.Config) error {
+	r := cfg.Retention
+
+	if cfg.ArchiveDir != "" {
+		removed, freed, err := archive.Prune(cfg.ArchiveDir, r.ArchiveMaxAge.Duration, r.ArchiveMaxBytes)
+		if err != nil {
+			return fmt.Errorf("error pruning archive: %v", err)
+		}
+		if removed > 0 {
+			fmt.Printf("Removed %d archived draft(s), freed %d KiB\n", removed, freed/1024)
+		}
+	}
+
+	if cfg.AuditLogPath != "" {
+		dropped, err := audit.Open(cfg.AuditLogPath).Prune(r.AuditMaxAge.Duration, r.AuditMaxBytes)
+		if err != nil {
+			return fmt.Errorf("error pruning audit log: %v", err)
+		}
+		if dropped > 0 {
+			fmt.Printf("Dropped %d audit log entries\n", dropped)
+		}
+	}
+
+	if cfg.StateDir != "" {
+		dropped, err := notifier.OpenHistory(notificationsPath(cfg)).Prune(r.StateMaxAge.Duration, r.StateMaxBytes)
+		if err != nil {
+			return fmt.Errorf("error pruning notification history: %v", err)
+		}
+		if dropped > 0 {
+			fmt.Printf("Dropped %d recorded notifications\n", dropped)
+		}
+
+		dropped, err = cache.OpenHistory(draftHistoryPath(cfg)).Prune(r.StateMaxAge.Duration, r.StateMaxBytes)
+		if err != nil {
+			return fmt.Errorf("error pruning draft history: %v", err)
+		}
+		if dropped > 0 {
+			fmt.Printf("Dropped %d draft history events\n", dropped)
+		}
+
+		dropped, err = runs.OpenHistory(runsPath(cfg)).Prune(r.StateMaxAge.Duration, r.StateMaxBytes)
+		if err != nil {
+			return fmt.Errorf("error pruning run history: %v", err)
+		}
+		if dropped > 0 {
+			fmt.Printf("Dropped %d recorded runs\n", dropped)
+		}
+
+		dropped, err = stats.OpenHistory(historyPath(cfg)).Prune(r.StateMaxAge.Duration, r.StateMaxBytes)
+		if err != nil {
+			return fmt.Errorf("error pruning check history: %v", err)
+		}
+		if dropped > 0 {
+			fmt.Printf("Dropped %d recorded checks\n", dropped)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"calmdrafts/internal/audit"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/grafana"
+	"calmdrafts/internal/stats"
+)
+
+// startGrafanaServer serves the check history and deletions of every
+// mailbox to Grafana. Without a token it only listens on loopback, since
+// the deletions name the drafts by subject.
+func startGrafanaServer(cfg *config.Config, mailboxes []*mailbox) error {
+	if cfg.Grafana.Token == "" && !isLoopback(cfg.Grafana.Listen) {
+		return fmt.Errorf("grafana.token is not set, so grafana.listen must be a loopback address, such as 127.0.0.1:8092")
+	}
+	handler := &grafana.Handler{Token: cfg.Grafana.Token}
+	for _, m := range mailboxes {
+		if m.cfg.StateDir == "" {
+			continue
+		}
+		handler.Sources = append(handler.Sources, grafanaSource(m.cfg))
+	}
+	if len(handler.Sources) == 0 {
+		return fmt.Errorf("state_dir is not set, so there is no history to serve")
+	}
+
+	ln, err := net.Listen("tcp", cfg.Grafana.Listen)
+	if err != nil {
+		return fmt.Errorf("unable to listen for Grafana: %v", err)
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			log.Printf("Grafana endpoint stopped: %v", err)
+		}
+	}()
+
+	fmt.Printf("Serving draft history to Grafana on %s\n", ln.Addr())
+	return nil
+}
+
+// grafanaSource reads a mailbox's check history and, when there is an
+// audit log, the drafts deleted or trashed
+func grafanaSource(cfg *config.Config) *grafana.Source {
+	history := stats.OpenHistory(historyPath(cfg))
+	src := &grafana.Source{Account: cfg.Account, Observations: history.Observations}
+	if cfg.AuditLogPath == "" {
+		return src
+	}
+	auditLog := audit.Open(cfg.AuditLogPath)
+	src.Events = func() ([]grafana.Event, error) {
+		entries, err := auditLog.Entries()
+		if err != nil {
+			return nil, err
+		}
+		var events []grafana.Event
+		for _, e := range entries {
+			if e.Action != audit.ActionDelete && e.Action != audit.ActionTrash {
+				continue
+			}
+			events = append(events, grafana.Event{Time: e.Time, Action: string(e.Action), Subject: e.Subject, Reason: e.Reason})
+		}
+		return events, nil
+	}
+	return src
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"calmdrafts/internal/config"
+)
+
+func TestIsLoopback(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"127.0.0.1:8092": true,
+		"127.0.0.2:8092": true,
+		"[::1]:8092":     true,
+		"localhost:8092": true,
+		":8092":          false,
+		"0.0.0.0:8092":   false,
+		"[::]:8092":      false,
+		"10.0.0.5:8092":  false,
+		"grafana:8092":   false,
+		"127.0.0.1":      false,
+	} {
+		if got := isLoopback(addr); got != ok {
+			t.Errorf("isLoopback(%q) is %v, want %v", addr, got, ok)
+		}
+	}
+}
+
+func TestGrafanaNeedsToken(t *testing.T) {
+	tests := []struct {
+		grafana config.Grafana
+		refused bool
+	}{
+		{config.Grafana{Listen: ":8092"}, true},
+		{config.Grafana{Listen: "0.0.0.0:8092"}, true},
+		{config.Grafana{Listen: "127.0.0.1:8092"}, false},
+		{config.Grafana{Listen: ":8092", Token: "a-long-random-secret"}, false},
+	}
+	for _, tt := range tests {
+		// Without a mailbox to serve, a server that passes the check stops
+		// short of listening
+		err := startGrafanaServer(&config.Config{Grafana: &tt.grafana}, nil)
+		if err == nil {
+			t.Fatalf("%+v: started without a mailbox", tt.grafana)
+		}
+		if refused := strings.Contains(err.Error(), "grafana.token"); refused != tt.refused {
+			t.Errorf("%+v: returned %v, want refused %v", tt.grafana, err, tt.refused)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/classifier"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/jobs"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/plugin"
+	"calmdrafts/internal/script"
+)
+
+// jobsPath returns where the daemon keeps the schedule of its jobs. With
+// several accounts it is in the top-level state_dir, shared by them all.
+func jobsPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "jobs.json")
+}
+
+// The daemon's jobs other than the drafts check, with how often they run
+// unless the jobs setting says otherwise
+var jobIntervals = map[string]time.Duration{
+	"trash": time.Hour,      // Remind about trashed drafts Gmail is about to purge
+	"gc":    24 * time.Hour, // Prune the archive, audit log and histories
+	"watch": time.Hour,      // Renew the Gmail push watch before it expires
+}
+
+// jobNames returns the names of the configurable jobs, sorted
+func jobNames() []string {
+	names := make([]string, 0, len(jobIntervals))
+	for name := range jobIntervals {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// validateJobs checks the names and intervals in the jobs setting
+func validateJobs(cfg *config.Config) error {
+	for name, job := range cfg.Jobs {
+		if _, ok := jobIntervals[name]; !ok {
+			return fmt.Errorf("jobs: unknown job %q (available: %s; the drafts check runs every check_interval)", name, strings.Join(jobNames(), ", "))
+		}
+		if job != nil && job.Every.Duration < 0 {
+			return fmt.Errorf("jobs.%s.every can't be negative", name)
+		}
+	}
+	return nil
+}
+
+// daemon is what the daemon's jobs share
+type daemon struct {
+	cfg         *config.Config
+	mailboxes   []*mailbox
+	notif       *notifier.Notifier
+	plugins     *plugin.Manager
+	rulesScript *script.Script
+	model       *classifier.Model
+	wait        *interval
+}
+
+// jobs returns the daemon's jobs. The drafts check runs on the check
+// interval; the others on the jobs setting, unless disabled there.
+func (d *daemon) jobs() []*jobs.Job {
+	all := []*jobs.Job{
+		{Name: "drafts", Run: d.checkDrafts, Next: d.nextCheck},
+		{Name: "trash", Run: d.remindTrash},
+		{Name: "gc", Run: d.collectGarbage},
+	}
+	if d.cfg.Push != nil {
+		all = append(all, &jobs.Job{Name: "watch", Run: d.renewWatches})
+	}
+
+	enabled := all[:0]
+	for _, job := range all {
+		if job.Next != nil {
+			enabled = append(enabled, job)
+			continue
+		}
+		every := jobIntervals[job.Name]
+		if c := d.cfg.Jobs[job.Name]; c != nil {
+			if c.Disabled {
+				continue
+			}
+			if c.Every.Duration > 0 {
+				every = c.Every.Duration
+			}
+		}
+		job.Next = jobs.Every(every)
+		enabled = append(enabled, job)
+	}
+	return enabled
+}
+
+// checkDrafts checks every mailbox, unless the check is put off to save
+// battery or data
+func (d *daemon) checkDrafts(ctx context.Context) error {
+	if deferCheck(d.cfg, time.Now()) != "" {
+		return jobs.ErrSkipped
+	}
+	if !d.check(ctx, "check") {
+		return fmt.Errorf("check failed, see the log")
+	}
+	return nil
+}
+
+// nextCheck returns when the drafts are checked next: soon after a put-off
+// check, and on the check interval otherwise
+func (d *daemon) nextCheck(due, now time.Time, err error) time.Time {
+	if err == jobs.ErrSkipped {
+		return now.Round(0).Add(d.wait.retry())
+	}
+	next := d.wait.due(due, now, d.wait.next(d.changed()))
+	if d.wait.adaptive || d.wait.align {
+		fmt.Printf("Next check at %s\n", next.Format("15:04:05"))
+	}
+	return next
+}
+
+// check checks the drafts of every mailbox and retries failed
+// notifications. It reports whether every check succeeded.
+func (d *daemon) check(ctx context.Context, what string) bool {
+	ok := true
+	for _, m := range d.mailboxes {
+		if m.cfg.Account != "" {
+			fmt.Printf("== %s\n", m.cfg.Account)
+		}
+		m.state.Lock()
+		err := recovered(what, func() error {
+			_, err := checkAndCleanDrafts(ctx, m.client, d.notif, d.plugins, d.rulesScript, d.model, m.cfg)
+			return err
+		})
+		m.state.Unlock()
+		if err != nil {
+			if !reportPanic(m.cfg, d.notif, err) {
+				log.Printf("Error during %s: %v", what, err)
+			}
+			recordCheckError(m.cfg, err)
+			ok = false
+		}
+	}
+	if err := d.notif.Retry(); err != nil {
+		log.Printf("Error retrying notifications: %v", err)
+	}
+	return ok
+}
+
+// changed reports whether any mailbox's drafts changed since the previous
+// call
+func (d *daemon) changed() bool {
+	active := false
+	for _, m := range d.mailboxes {
+		fingerprint := draftsFingerprint(m.cfg)
+		if m.fingerprint != "" && fingerprint != m.fingerprint {
+			active = true
+		}
+		m.fingerprint = fingerprint
+	}
+	return active
+}
+
+// remindTrash reminds about trashed drafts of every mailbox that Gmail is
+// about to purge
+func (d *daemon) remindTrash(ctx context.Context) error {
+	for _, m := range d.mailboxes {
+		if m.cfg.DryRun {
+			continue
+		}
+		err := recovered("trash reminder", func() error {
+			remindTrashPurge(m.cfg, d.notif, time.Now())
+			return nil
+		})
+		if err != nil {
+			reportPanic(m.cfg, d.notif, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// collectGarbage prunes the local data of every mailbox
+func (d *daemon) collectGarbage(ctx context.Context) error {
+	failed := 0
+	for _, m := range d.mailboxes {
+		m.state.Lock()
+		err := recovered("cleanup of local data", func() error { return collectGarbage(m.cfg) })
+		m.state.Unlock()
+		if err != nil {
+			if !reportPanic(m.cfg, d.notif, err) {
+				log.Printf("Error during cleanup of local data: %v", err)
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("cleanup of local data failed for %d mailbox(es)", failed)
+	}
+	return nil
+}
+
+// renewWatches renews the Gmail push watch of every mailbox that is about
+// to expire
+func (d *daemon) renewWatches(ctx context.Context) error {
+	for _, m := range d.mailboxes {
+		renewWatch(ctx, m)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/cache"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/i18n"
+)
+
+// draftCachePath returns where the last fetched draft list is stored
+func draftCachePath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "drafts.json")
+}
+
+// countEdits sets how often each draft was edited from the draft cache,
+// without updating it, so commands that don't check the drafts score them
+// as a check would
+func countEdits(cfg *config.Config, drafts []*gmail.Draft) {
+	if cfg.StateDir == "" {
+		return
+	}
+	if prev, err := cache.Load(draftCachePath(cfg)); err == nil {
+		cache.CountEdits(prev, drafts)
+	}
+}
+
+// fetchDrafts lists drafts from Gmail, falling back to the cached list when
+// Gmail can't be reached. cachedAt is zero for live data.
+func fetchDrafts(ctx context.Context, cfg *config.Config) (drafts []*gmail.Draft, cachedAt time.Time, err error) {
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err == nil {
+		drafts, err = client.ListDrafts(ctx)
+		if err == nil {
+			if cfg.StateDir != "" {
+				if _, err := cache.Update(draftCachePath(cfg), drafts, time.Now()); err != nil {
+					fmt.Fprintf(os.Stderr, "Error caching drafts: %v\n", err)
+				}
+			}
+			return drafts, time.Time{}, nil
+		}
+	}
+
+	if cfg.StateDir == "" {
+		return nil, time.Time{}, err
+	}
+	snap, cacheErr := cache.Load(draftCachePath(cfg))
+	if cacheErr != nil {
+		return nil, time.Time{}, fmt.Errorf("%v (%v)", err, cacheErr)
+	}
+	fmt.Fprintf(os.Stderr, "Offline: %v\n", err)
+	fmt.Printf("Showing cached drafts from %s (%s ago), which may be stale\n\n",
+		snap.Time.Format("2006-01-02 15:04"), time.Since(snap.Time).Round(time.Minute))
+	return snap.Drafts, snap.Time, nil
+}
+
+// runList prints every draft, oldest first
+func runList(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	sortBy := fs.String("sort", "age", "Sort by age (oldest first), subject, to or size (largest first)")
+	emptyOnly := fs.Bool("empty-only", false, "Only list empty drafts")
+	duplicates := fs.Bool("duplicates", false, "Only list non-empty drafts with the same content as another, grouped")
+	var olderThan time.Duration
+	fs.Func("older-than", "Only list drafts older than this (e.g. 7d)", durationFlag(&olderThan))
+	to := fs.String("to", "", "Only list drafts whose recipients contain this text, or match it as a glob like *@example.com")
+	var labels, notLabels []string
+	fs.Func("label", "Only list drafts with this label (repeatable)", func(s string) error {
+		labels = append(labels, s)
+		return nil
+	})
+	fs.Func("not-label", "Leave out drafts with this label (repeatable)", func(s string) error {
+		notLabels = append(notLabels, s)
+		return nil
+	})
+	client := fs.String("client", "", "Only list drafts created by this mail client, e.g. ios-mail, or unknown")
+	orphaned := fs.Bool("orphaned", false, "Only list reply drafts whose thread was deleted, or archived longer than orphans.archived_for")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	less, ok := draftOrders[*sortBy]
+	if !ok {
+		return fmt.Errorf("unknown sort %q (use age, subject, to or size)", *sortBy)
+	}
+
+	drafts, _, err := fetchDrafts(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	matches := []*gmail.Draft{}
+	for _, d := range drafts {
+		switch {
+		case *emptyOnly && !d.IsEmpty:
+		case olderThan > 0 && now.Sub(d.InternalDate) < olderThan:
+		case *to != "" && !matchRecipients(d, *to):
+		case slices.ContainsFunc(labels, func(l string) bool { return !hasLabel(d, l) }):
+		case slices.ContainsFunc(notLabels, func(l string) bool { return hasLabel(d, l) }):
+		case *client != "" && !(d.Client == *client || (d.Client == "" && *client == "unknown")):
+		case *orphaned && orphanReason(cfg, d, now) == "":
+		default:
+			matches = append(matches, d)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return less(matches[i], matches[j])
+	})
+
+	if *duplicates {
+		groups := duplicateGroups(matches)
+		for i, group := range groups {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("Same content (%s):\n", group[0].ContentHash)
+			printDrafts(group, now, cfg.Accessible)
+		}
+		if len(groups) == 0 {
+			fmt.Println("No duplicate drafts")
+		}
+		return nil
+	}
+
+	printDrafts(matches, now, cfg.Accessible)
+	return nil
+}
+
+// duplicateGroups groups the non-empty drafts by content hash, keeping the
+// groups of more than one draft in the order of their first draft
+func duplicateGroups(drafts []*gmail.Draft) [][]*gmail.Draft {
+	byHash := make(map[string][]*gmail.Draft)
+	order := []string{}
+	for _, d := range drafts {
+		if d.IsEmpty || d.ContentHash == "" {
+			continue
+		}
+		if _, ok := byHash[d.ContentHash]; !ok {
+			order = append(order, d.ContentHash)
+		}
+		byHash[d.ContentHash] = append(byHash[d.ContentHash], d)
+	}
+
+	groups := [][]*gmail.Draft{}
+	for _, hash := range order {
+		if len(byHash[hash]) > 1 {
+			groups = append(groups, byHash[hash])
+		}
+	}
+	return groups
+}
+
+// draftOrders are the orderings accepted by list --sort
+var draftOrders = map[string]func(a, b *gmail.Draft) bool{
+	"age": func(a, b *gmail.Draft) bool { return a.InternalDate.Before(b.InternalDate) },
+	"subject": func(a, b *gmail.Draft) bool {
+		return strings.ToLower(a.Subject) < strings.ToLower(b.Subject)
+	},
+	"to":   func(a, b *gmail.Draft) bool { return strings.ToLower(a.To) < strings.ToLower(b.To) },
+	"size": func(a, b *gmail.Draft) bool { return a.Size > b.Size },
+}
+
+// hasLabel reports whether a draft has the named label, ignoring case
+func hasLabel(d *gmail.Draft, name string) bool {
+	return slices.ContainsFunc(d.Labels, func(l string) bool { return strings.EqualFold(l, name) })
+}
+
+// matchRecipients reports whether any To, Cc or Bcc recipient matches
+// pattern, as a glob when it contains wildcards and as a substring
+// otherwise, ignoring case
+func matchRecipients(d *gmail.Draft, pattern string) bool {
+	pattern = strings.ToLower(pattern)
+	glob := strings.ContainsAny(pattern, "*?[")
+	for _, r := range d.Recipients() {
+		full := strings.ToLower(r.String())
+		if !glob {
+			if strings.Contains(full, pattern) {
+				return true
+			}
+			continue
+		}
+		// Match the bare address of "Name <address>" too
+		if ok, _ := path.Match(pattern, strings.ToLower(r.Email)); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, full); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// printDrafts prints drafts as a table followed by their count. Accessible
+// output has a sentence per draft instead, as tables are hard to follow
+// with a screen reader.
+func printDrafts(drafts []*gmail.Draft, now time.Time, accessible bool) {
+	if accessible {
+		english := i18n.Parse("en")
+		for i, d := range drafts {
+			if d.Subject == "" {
+				fmt.Printf("Draft %d of %d, no subject", i+1, len(drafts))
+			} else {
+				fmt.Printf("Draft %d of %d: %q", i+1, len(drafts), d.Subject)
+			}
+			switch recipients := d.Recipients(); {
+			case len(recipients) == 1:
+				fmt.Printf(", to %s", recipients[0])
+			case len(recipients) > 1:
+				fmt.Printf(", to %d recipients", len(recipients))
+			}
+			fmt.Printf(", saved %s", english.Ago(now.Sub(d.InternalDate)))
+			fmt.Print(replyContext(d, now))
+			if d.IsEmpty {
+				fmt.Print(", empty")
+			}
+			if len(d.Labels) > 0 {
+				fmt.Printf(", labels %s", strings.Join(d.Labels, ", "))
+			}
+			fmt.Printf(". ID %s.\n", d.ID)
+		}
+		fmt.Printf("%d draft(s).\n", len(drafts))
+		return
+	}
+
+	fmt.Printf("%-18s %6s %-5s %-40s %-24s %s\n", "ID", "AGE", "EMPTY", "SUBJECT", "LABELS", "TO")
+	for _, d := range drafts {
+		empty := ""
+		if d.IsEmpty {
+			empty = "yes"
+		}
+		// A reply without a subject is told apart by the message it answers
+		subject := d.Subject
+		if subject == "" && (d.ReplyTo != nil || d.ParentDeleted) {
+			subject = strings.TrimPrefix(replyContext(d, now), ", ")
+		}
+		fmt.Printf("%-18s %6s %-5s %-40s %-24s %s\n", d.ID, formatAge(now.Sub(d.InternalDate)), empty, truncate(subject, 40),
+			truncate(strings.Join(d.Labels, ","), 24), d.To)
+	}
+	fmt.Printf("\n%d draft(s)\n", len(drafts))
+}
+
+// replyContext describes the message a reply draft answers, like ", reply
+// to Alice from 12 days ago", or returns "" for other drafts
+func replyContext(d *gmail.Draft, now time.Time) string {
+	if d.ParentDeleted {
+		return ", reply to a deleted thread"
+	}
+	if d.ReplyTo == nil {
+		return ""
+	}
+	return fmt.Sprintf(", reply to %s from %s", d.ReplyTo.Sender(), i18n.Parse("en").Ago(now.Sub(d.ReplyTo.Date)))
+}
+
+// formatAge renders an age in the largest whole unit
+func formatAge(age time.Duration) string {
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	}
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
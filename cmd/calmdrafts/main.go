@@ -2,24 +2,49 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"calmdrafts/internal/archive"
+	"calmdrafts/internal/audit"
+	"calmdrafts/internal/buildinfo"
 	"calmdrafts/internal/config"
+	"calmdrafts/internal/fixture"
+	"calmdrafts/internal/followup"
 	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/jobs"
 	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/nudge"
+	"calmdrafts/internal/report"
 )
 
 const appName = "CalmDrafts"
 
+// configPath is the config file given on the command line, needed by
+// commands that modify it
+var configPath = flag.String("config", "config.json", "Path to configuration file")
+
+// Record or replay Gmail API responses for reproducible bug reports
+var (
+	recordDir = flag.String("record", "", "Save sanitized Gmail API responses as fixtures in this directory")
+	replayDir = flag.String("replay", "", "Answer Gmail API requests from fixtures in this directory, without network access")
+)
+
 func main() {
-	configPath := flag.String("config", "config.json", "Path to configuration file")
 	checkNow := flag.Bool("check", false, "Run a single check and exit")
+	profile := flag.String("profile", "", "Name of a profile in the config file to apply")
+	allAccounts := flag.Bool("all-accounts", false, "Run the command once for every account in the config file; the daemon always checks them all")
+	flagOverrides := addOverrideFlags(flag.CommandLine)
+	globalOverrides = flagOverrides
+	flag.Usage = usage
 	flag.Parse()
 
 	// Load configuration
@@ -27,50 +52,171 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error loading config: %v", err)
 	}
+	if *profile != "" {
+		if err := cfg.ApplyProfile(*profile); err != nil {
+			log.Fatalf("Error loading config: %v", err)
+		}
+	}
+	if err := flagOverrides.applyAny(cfg); err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if *recordDir != "" && *replayDir != "" {
+		log.Fatalf("-record and -replay cannot be used together")
+	}
 
-	// Create notifier
-	notif := notifier.New(appName)
-
-	// Create Gmail client
 	ctx := context.Background()
-	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath)
+
+	// Run a subcommand instead of the daemon when one is given
+	if flag.NArg() > 0 {
+		cmd := findCommand(flag.Arg(0))
+		if cmd == nil {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", flag.Arg(0))
+			usage()
+			os.Exit(2)
+		}
+		args, all := cutAllAccounts(flag.Args()[1:])
+		if all || *allAccounts {
+			err = runAllAccounts(ctx, cmd, *profile, flagOverrides, args)
+		} else {
+			err = cmd.run(ctx, cfg, args)
+		}
+		if err != nil {
+			log.Fatalf("Error running %s: %v", cmd.name, err)
+		}
+		return
+	}
+	if *allAccounts && cfg.Account != "" {
+		log.Fatalf("-all-accounts and -account cannot be used together")
+	}
+
+	// Keep the daemon's errors for "calmdrafts bugreport"
+	teeLog(cfg)
+
+	// The daemon checks every account unless --account selected one
+	configs := []*config.Config{cfg}
+	if len(cfg.Accounts) > 0 && cfg.Account == "" {
+		configs, err = accountConfigs(*profile, flagOverrides)
+		if err != nil {
+			log.Fatalf("Error loading config: %v", err)
+		}
+	}
+
+	// Load plugins, script and model
+	plugins, rulesScript, model, err := loadRules(cfg)
 	if err != nil {
-		log.Fatalf("Error creating Gmail client: %v", err)
-		notif.NotifyError(err)
-		os.Exit(1)
+		log.Fatalf("Error loading rules: %v", err)
 	}
 
-	fmt.Printf("%s started. Checking drafts every %v\n", appName, cfg.CheckInterval)
+	// Create notifier
+	notif, err := newNotifier(cfg, plugins, true)
+	if err != nil {
+		log.Fatalf("Error configuring notifications: %v", err)
+	}
+	defer exitOnPanic(cfg, notif)
+
+	// Create a Gmail client per mailbox
+	mailboxes := make([]*mailbox, 0, len(configs))
+	for _, c := range configs {
+		client, err := gmail.NewClient(ctx, c.CredentialsPath, c.TokenPath, gmailOptions(c))
+		if err != nil {
+			notifyError(c, notif, err)
+			log.Fatalf("Error creating Gmail client: %v", err)
+		}
+		mailboxes = append(mailboxes, &mailbox{cfg: c, client: client})
+	}
+
+	// Run notification actions in the main loop, between checks
+	actionRequests := make(chan notifier.Action, 1)
+	notif.SetActionHandler(func(event notifier.Event, action notifier.Action) {
+		select {
+		case actionRequests <- action:
+		default:
+		}
+	})
+
+	wait, err := newInterval(cfg)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	fmt.Printf("%s %s started. Checking drafts every %v\n", appName, buildinfo.Get().Version, wait)
+	d := &daemon{cfg: cfg, mailboxes: mailboxes, notif: notif, plugins: plugins, rulesScript: rulesScript, model: model, wait: wait}
 
 	if *checkNow {
 		// Run a single check and exit
-		if err := checkAndCleanDrafts(ctx, client, notif, cfg); err != nil {
-			log.Printf("Error during check: %v", err)
+		if deferCheck(cfg, time.Now()) != "" {
+			return
+		}
+		ok := d.check(ctx, "check")
+		d.remindTrash(ctx)
+		if !ok {
 			os.Exit(1)
 		}
 		return
 	}
 
-	// Set up periodic checking
-	ticker := time.NewTicker(cfg.CheckInterval)
-	defer ticker.Stop()
-
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer handleShutdown(sigChan)()
 
-	// Run initial check
-	if err := checkAndCleanDrafts(ctx, client, notif, cfg); err != nil {
-		log.Printf("Error during initial check: %v", err)
+	// Check as soon as Gmail reports a change when push is configured
+	checkRequests := make(chan struct{}, 1)
+	if cfg.Push != nil {
+		if err := startPushServer(cfg, checkRequests); err != nil {
+			log.Fatalf("Error starting push endpoint: %v", err)
+		}
+	}
+	if cfg.Grafana != nil {
+		if err := startGrafanaServer(cfg, mailboxes); err != nil {
+			log.Fatalf("Error starting Grafana endpoint: %v", err)
+		}
+	}
+	if cfg.ReportActions != nil {
+		if err := startReportActionsServer(cfg, mailboxes); err != nil {
+			log.Fatalf("Error serving report links: %v", err)
+		}
+	}
+
+	// Every job runs on its own schedule, kept in state_dir across
+	// restarts; without a saved schedule they all start now
+	path := ""
+	if cfg.StateDir != "" {
+		path = jobsPath(cfg)
+	}
+	scheduler := jobs.New(path)
+	scheduler.SkipMissed = cfg.Schedule != nil && cfg.Schedule.SkipMissed
+	for _, job := range d.jobs() {
+		scheduler.Add(job, time.Now())
 	}
+	if err := scheduler.Start(ctx); err != nil {
+		log.Fatalf("Error starting jobs: %v", err)
+	}
+	defer scheduler.Stop()
+	for _, j := range scheduler.Statuses() {
+		if j.Name == "drafts" && j.Next.After(time.Now()) {
+			fmt.Printf("Next check at %s, as scheduled before the restart\n", j.Next.Local().Format("15:04:05"))
+		}
+	}
+
+	// Push notifications are looked up in the Gmail history first, so
+	// redelivered ones and changes already looked up don't cost a check.
+	// Requests arriving during a lookup are merged into the next one.
+	go func() {
+		for range checkRequests {
+			if d.pushedChanges(ctx) {
+				scheduler.Trigger("drafts")
+			}
+		}
+	}()
 
 	// Main loop
 	for {
 		select {
-		case <-ticker.C:
-			if err := checkAndCleanDrafts(ctx, client, notif, cfg); err != nil {
-				log.Printf("Error during check: %v", err)
-			}
+		case action := <-actionRequests:
+			err := recovered("notification action", func() error {
+				handleAction(ctx, action, mailboxes, notif, scheduler)
+				return nil
+			})
+			reportPanic(cfg, notif, err)
 		case sig := <-sigChan:
 			fmt.Printf("\nReceived signal %v, shutting down gracefully...\n", sig)
 			return
@@ -78,55 +224,278 @@ func main() {
 	}
 }
 
-// checkAndCleanDrafts performs a full check: lists drafts, notifies user, and cleans up old empty drafts
-func checkAndCleanDrafts(ctx context.Context, client *gmail.Client, notif *notifier.Notifier, cfg *config.Config) error {
-	fmt.Printf("[%s] Checking drafts...\n", time.Now().Format("2006-01-02 15:04:05"))
+// handleAction carries out an action chosen on a notification
+func handleAction(ctx context.Context, action notifier.Action, mailboxes []*mailbox, notif *notifier.Notifier, scheduler *jobs.Scheduler) {
+	switch action {
+	case notifier.ActionSend:
+		// The button belongs to the latest nudge, so offer the draft it named
+		// in whichever mailbox sent it. Nothing is sent until the user
+		// confirms on a second notification.
+		var offer *mailbox
+		var latest *nudge.Entry
+		for _, m := range mailboxes {
+			m.state.Lock()
+			m.sendOffer = nil
+			if m.cfg.Nudge != nil && m.cfg.StateDir != "" {
+				entry, err := latestNudge(m.cfg, time.Now())
+				if err != nil {
+					log.Printf("Error reading nudges: %v", err)
+				} else if entry != nil && (latest == nil || entry.NudgedAt.After(latest.NudgedAt)) {
+					offer, latest = m, entry
+				}
+			}
+			m.state.Unlock()
+		}
+		if offer == nil {
+			break
+		}
+		if err := offerSend(notif, latest); err != nil {
+			log.Printf("Error offering to send the nudged draft: %v", err)
+			break
+		}
+		offer.state.Lock()
+		offer.sendOffer = latest
+		offer.state.Unlock()
+	case notifier.ActionConfirmSend:
+		for _, m := range mailboxes {
+			m.state.Lock()
+			if m.sendOffer != nil {
+				if err := confirmSend(ctx, m.client, m.cfg, m.sendOffer); err != nil {
+					log.Printf("Error sending the nudged draft: %v", err)
+				}
+				m.sendOffer = nil
+			}
+			m.state.Unlock()
+		}
+	case notifier.ActionSnooze:
+		for _, m := range mailboxes {
+			if m.cfg.Nudge == nil || m.cfg.StateDir == "" {
+				continue
+			}
+			m.state.Lock()
+			if err := snoozeNudges(m.cfg, time.Now()); err != nil {
+				log.Printf("Error snoozing nudges: %v", err)
+			}
+			m.state.Unlock()
+		}
+	case notifier.ActionDelete:
+		for _, m := range mailboxes {
+			if !usesPendingQueue(m.cfg) || m.cfg.StateDir == "" {
+				continue
+			}
+			m.state.Lock()
+			if err := approvePending(m.cfg); err != nil {
+				log.Printf("Error approving pending deletions: %v", err)
+			}
+			m.state.Unlock()
+		}
+		scheduler.Trigger("drafts")
+	}
+}
+
+// mailbox is an account checked by the daemon
+type mailbox struct {
+	cfg         *config.Config
+	client      *gmail.Client
+	watchExpiry time.Time
+	historyID   atomic.Uint64 // Gmail history ID push notifications are looked up from
+	fingerprint string        // Drafts seen by the last check, see draftsFingerprint
+	sendOffer   *nudge.Entry  // Draft offered by Send now, waiting for Confirm send
+	state       sync.Mutex    // Held by jobs changing files in state_dir
+}
 
-	// List all drafts
-	drafts, err := client.ListDrafts(ctx)
+// accountConfigs loads the config once per listed account, with the profile
+// and flag overrides applied on top
+func accountConfigs(profile string, o *overrides) ([]*config.Config, error) {
+	base, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return nil, err
+	}
+	names, err := base.AccountNames()
 	if err != nil {
-		notif.NotifyError(err)
-		return fmt.Errorf("error listing drafts: %v", err)
+		return nil, err
 	}
 
-	// Count empty drafts
-	emptyCount := 0
-	for _, draft := range drafts {
-		if draft.IsEmpty {
-			emptyCount++
+	configs := make([]*config.Config, 0, len(names))
+	for _, name := range names {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		if profile != "" {
+			if err := cfg.ApplyProfile(profile); err != nil {
+				return nil, err
+			}
+		}
+		if err := cfg.ApplyAccount(name); err != nil {
+			return nil, err
+		}
+		if err := o.applyAny(cfg); err != nil {
+			return nil, err
 		}
+		configs = append(configs, cfg)
 	}
+	return configs, nil
+}
 
-	fmt.Printf("Found %d draft(s) (%d empty)\n", len(drafts), emptyCount)
+// gmailOptions returns the Gmail client settings derived from the config
+func gmailOptions(cfg *config.Config) gmail.Options {
+	userAgent := buildinfo.UserAgent()
+	if cfg.UserAgent != "" {
+		userAgent += " " + cfg.UserAgent
+	}
 
-	// Notify user about drafts
-	if err := notif.NotifyDraftsWithDetails(len(drafts), emptyCount); err != nil {
-		log.Printf("Error sending notification: %v", err)
+	opts := gmail.Options{
+		UserAgent:    userAgent,
+		QuotaProject: cfg.QuotaProject,
+		Mailbox:      cfg.Mailbox,
+		Boilerplate:  cfg.Boilerplate,
+	}
+	if cfg.FollowUps != nil {
+		opts.Scopes = append(opts.Scopes, followup.Scopes...)
+	}
+	if cfg.BatchDelete && !cfg.UseTrash {
+		opts.Scopes = append(opts.Scopes, gmail.MailScope)
 	}
+	if *recordDir != "" {
+		opts.Transport = func(base http.RoundTripper) http.RoundTripper {
+			return &fixture.Recorder{Dir: *recordDir, Base: base}
+		}
+	}
+	if *replayDir != "" {
+		opts.Replay = &fixture.Replayer{Dir: *replayDir}
+	}
+	return opts
+}
 
-	// Clean up old empty drafts
-	deletedCount := 0
-	cutoffTime := time.Now().Add(-cfg.CleanupAge)
+// alarmMessage describes the limits the draft counts exceed, or returns ""
+func alarmMessage(alarm *config.Alarm, drafts, empty int) string {
+	exceeded := []string{}
+	if alarm.MaxDrafts > 0 && drafts > alarm.MaxDrafts {
+		exceeded = append(exceeded, fmt.Sprintf("%d drafts (limit %d)", drafts, alarm.MaxDrafts))
+	}
+	if alarm.MaxEmpty > 0 && empty > alarm.MaxEmpty {
+		exceeded = append(exceeded, fmt.Sprintf("%d empty drafts (limit %d)", empty, alarm.MaxEmpty))
+	}
+	if len(exceeded) == 0 {
+		return ""
+	}
+	return "Drafts folder over its limit: " + strings.Join(exceeded, ", ") + ". A mail client may be creating drafts in a loop"
+}
 
-	for _, draft := range drafts {
-		if draft.IsEmpty && draft.InternalDate.Before(cutoffTime) {
-			age := time.Since(draft.InternalDate)
-			fmt.Printf("Deleting empty draft (ID: %s, age: %v)\n", draft.ID, age.Round(time.Hour))
+// deleteDraft archives a draft, deletes it and records the deletion in the
+// audit log. The draft is kept if it can't be archived. A draft that is
+// already gone counts as deleted and is logged as such.
+func deleteDraft(ctx context.Context, client *gmail.Client, cfg *config.Config, draft *gmail.Draft, reason string, explanation []string) error {
+	action := audit.ActionDelete
 
-			if err := client.DeleteDraft(ctx, draft.ID); err != nil {
-				log.Printf("Error deleting draft %s: %v", draft.ID, err)
-				continue
-			}
-			deletedCount++
-		}
+	// Archive the full message first so the draft can be restored
+	archivePath, err := archiveDraft(ctx, client, cfg, draft)
+	if errors.Is(err, gmail.ErrNotFound) {
+		action = audit.ActionAlreadyDeleted
+	} else if err != nil {
+		return err
 	}
 
-	if deletedCount > 0 {
-		fmt.Printf("Deleted %d old empty draft(s)\n", deletedCount)
-		if err := notif.NotifyCleanup(deletedCount); err != nil {
-			log.Printf("Error sending cleanup notification: %v", err)
+	if action == audit.ActionDelete && cfg.UseTrash {
+		action = audit.ActionTrash
+		err := client.TrashMessage(ctx, draft.MessageID)
+		if errors.Is(err, gmail.ErrNotFound) {
+			action = audit.ActionAlreadyDeleted
+		} else if errors.Is(err, gmail.ErrUnavailable) {
+			return fmt.Errorf("error trashing draft %s: %v (turn off use_trash to delete drafts instead)", draft.ID, err)
+		} else if err != nil {
+			return err
+		}
+	}
+	if action == audit.ActionDelete {
+		err := client.DeleteDraft(ctx, draft.ID)
+		if errors.Is(err, gmail.ErrNotFound) {
+			action = audit.ActionAlreadyDeleted
+		} else if err != nil {
+			return err
 		}
 	}
 
+	recordDeletion(cfg, draft, action, reason, archivePath, explanation)
 	return nil
 }
+
+// archiveDraft saves the full message of a draft in archive_dir, if set,
+// and returns the path. It returns ErrNotFound if the draft is gone.
+func archiveDraft(ctx context.Context, client *gmail.Client, cfg *config.Config, draft *gmail.Draft) (string, error) {
+	if cfg.ArchiveDir == "" {
+		return "", nil
+	}
+	raw, err := client.GetRawDraft(ctx, draft.ID)
+	if errors.Is(err, gmail.ErrNotFound) {
+		return "", err
+	}
+	archivePath := ""
+	if err == nil {
+		archivePath, err = archive.Save(cfg.ArchiveDir, draft.ID, raw)
+	}
+	if err != nil {
+		return "", &archiveError{draftID: draft.ID, err: err}
+	}
+	return archivePath, nil
+}
+
+// archiveError is a draft that wasn't deleted because it couldn't be archived
+type archiveError struct {
+	draftID string
+	err     error
+}
+
+func (e *archiveError) Error() string {
+	return fmt.Sprintf("error archiving draft %s, skipping deletion: %v", e.draftID, e.err)
+}
+
+// recordDeletion records a deletion in the audit log, if enabled
+func recordDeletion(cfg *config.Config, draft *gmail.Draft, action audit.Action, reason, archivePath string, explanation []string) {
+	if action == audit.ActionAlreadyDeleted {
+		fmt.Printf("Draft %s was already deleted\n", draft.ID)
+	}
+	if cfg.AuditLogPath == "" {
+		return
+	}
+	entry := &audit.Entry{
+		Action:      action,
+		DraftID:     draft.ID,
+		MessageID:   draft.MessageID,
+		Subject:     draft.Subject,
+		To:          draft.To,
+		Reason:      reason,
+		ArchivePath: archivePath,
+		Explanation: explanation,
+	}
+	if err := audit.Open(cfg.AuditLogPath).Append(entry); err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+}
+
+// belowMinAge reports whether a draft is younger than min_age, the floor
+// below which no rule deletes a draft
+func belowMinAge(cfg *config.Config, draft *gmail.Draft, now time.Time) bool {
+	return cfg.MinAge.Duration > 0 && now.Sub(draft.InternalDate) < cfg.MinAge.Duration
+}
+
+// recentlyEdited reports whether a draft was saved, or seen to change,
+// within the guard period
+func recentlyEdited(draft *gmail.Draft, changedAt, now time.Time, guard time.Duration) bool {
+	if guard <= 0 {
+		return false
+	}
+	return now.Sub(draft.InternalDate) < guard || now.Sub(changedAt) < guard
+}
+
+// writeReport writes the triage report as Markdown to path
+func writeReport(path string, triage *report.Triage) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return triage.WriteMarkdown(file)
+}
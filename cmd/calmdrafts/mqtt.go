@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/mqtt"
+	"calmdrafts/internal/stats"
+)
+
+// mqttTopic returns the topic prefix everything is published under, with
+// the account name when one is selected
+func mqttTopic(cfg *config.Config) string {
+	topic := cfg.Notifications.MQTT.Topic
+	if topic == "" {
+		topic = "calmdrafts"
+	}
+	if cfg.Account != "" {
+		topic += "/" + cfg.Account
+	}
+	return topic
+}
+
+// mqttBroker returns the configured broker, or nil when MQTT isn't set up
+func mqttBroker(cfg *config.Config) (*mqtt.Broker, error) {
+	if cfg.Notifications == nil || cfg.Notifications.MQTT == nil {
+		return nil, nil
+	}
+	m := cfg.Notifications.MQTT
+	if m.Broker == "" {
+		return nil, fmt.Errorf("notifications.mqtt needs broker")
+	}
+	clientID := m.ClientID
+	if clientID == "" {
+		host, _ := os.Hostname()
+		clientID = "calmdrafts-" + host
+	}
+	return &mqtt.Broker{URL: m.Broker, ClientID: clientID, Username: m.Username, Password: m.Password}, nil
+}
+
+// publishState publishes the draft counts of a check as a retained message
+// on <topic>/state, so subscribers get the latest counts as soon as they
+// connect
+func publishState(cfg *config.Config, obs *stats.Observation) error {
+	broker, err := mqttBroker(cfg)
+	if err != nil || broker == nil {
+		return err
+	}
+	payload, err := json.Marshal(obs)
+	if err != nil {
+		return err
+	}
+	return broker.Publish(&mqtt.Message{Topic: mqttTopic(cfg) + "/state", Payload: payload, Retain: true})
+}
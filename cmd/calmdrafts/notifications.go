@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"calmdrafts/internal/buildinfo"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/runs"
+)
+
+// notificationsPath returns where sent notifications are recorded
+func notificationsPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "notifications.jsonl")
+}
+
+// runNotifications lists recent notifications and whether they were
+// delivered
+func runNotifications(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("notifications", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	limit := fs.Int("limit", 20, "Show at most this many notifications, most recent last; 0 shows all")
+	channel := fs.String("channel", "", "Only show notifications sent to this channel")
+	event := fs.String("event", "", "Only show notifications about this event")
+	failed := fs.Bool("failed", false, "Only show notifications that could not be delivered or were suppressed")
+	samplePayload := fs.Bool("sample-payload", false, "Print an example webhook payload for every event, or the one given with --event, and exit")
+	format := fs.String("format", "", "Webhook format of --sample-payload: calmdrafts, flat (zapier, make) or ifttt (default: notifications.webhook.format)")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if *samplePayload {
+		if *format == "" && cfg.Notifications != nil && cfg.Notifications.Webhook != nil {
+			*format = cfg.Notifications.Webhook.Format
+		}
+		return printSamplePayloads(cfg, *format, *event)
+	}
+
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so no notifications are recorded")
+	}
+	if *event != "" {
+		if _, err := notifier.ParseEvent(*event); err != nil {
+			return err
+		}
+	}
+	records, err := notifier.OpenHistory(notificationsPath(cfg)).Records()
+	if err != nil {
+		return err
+	}
+
+	shown := []*notifier.Record{}
+	for _, r := range records {
+		if (*channel != "" && r.Channel != *channel) || (*event != "" && string(r.Event) != *event) || (*failed && r.Error == "" && !r.Suppressed) {
+			continue
+		}
+		shown = append(shown, r)
+	}
+	if *limit > 0 && len(shown) > *limit {
+		shown = shown[len(shown)-*limit:]
+	}
+	if len(shown) == 0 {
+		fmt.Println("No notifications recorded")
+		return nil
+	}
+
+	for _, r := range shown {
+		event := string(r.Event)
+		if event == "" {
+			event = "-"
+		}
+		result := "sent"
+		if r.Error != "" {
+			result = "FAILED"
+		} else if r.Suppressed {
+			result = "suppressed"
+		}
+		fmt.Printf("%s  %-8s  %-8s  %-10s  %s: %s\n", r.Time.Local().Format("2006-01-02 15:04"), r.Channel, event, result, r.Title, r.Message)
+		if r.Error != "" {
+			fmt.Printf("                  %s\n", r.Error)
+		}
+	}
+	return nil
+}
+
+// messageRecorder is a notification backend that keeps the messages it is
+// sent
+type messageRecorder struct {
+	messages []*notifier.Message
+	data     bool // Receives the run event, like a webhook in the calmdrafts format
+}
+
+func (r *messageRecorder) Send(m *notifier.Message) error {
+	r.messages = append(r.messages, m)
+	return nil
+}
+
+func (r *messageRecorder) SendsData() bool {
+	return r.data
+}
+
+// printSamplePayloads prints the webhook payload of a typical notification
+// for each event, for building automations before any event happened
+func printSamplePayloads(cfg *config.Config, formatName, event string) error {
+	format, err := notifier.ParseWebhookFormat(formatName)
+	if err != nil {
+		return err
+	}
+	if event != "" {
+		if _, err := notifier.ParseEvent(event); err != nil {
+			return err
+		}
+	}
+
+	recorder := &messageRecorder{data: format == notifier.FormatCalmDrafts}
+	notif := notifier.New(appName, buildinfo.Get().String())
+	notif.SetLocale(locale(cfg))
+	notif.DisableDesktop()
+	notif.AddBackend("webhook", recorder)
+	notif.NotifyDraftsWithDetails(12, 3)
+	notif.NotifyStale(2, "Re: Q3 budget", "Alice Smith", 12*24*time.Hour)
+	notif.NotifyNudge(1, "Re: Dinner on Friday")
+	notif.NotifyPending(3)
+	notif.NotifyCleanup(3)
+	notif.NotifyCleanupFailures(12, 2, []string{"quota", "not found"}, true)
+	notif.NotifyTrashPurge(2, 3)
+	notif.NotifyAlarm("52 drafts, more than the limit of 50")
+	notif.NotifyError(errors.New("unable to retrieve drafts: connection reset by peer"))
+	notif.NotifyAuth(errors.New("token has been expired or revoked"))
+	now := time.Now().Truncate(time.Second)
+	notif.NotifyErrorOngoing(errors.New("unable to retrieve drafts: Gmail rate limit exceeded"), now.Add(-26*time.Hour), 27)
+	notif.NotifyRecovered("unable to retrieve drafts: Gmail rate limit exceeded", now.Add(-30*time.Hour))
+	notif.NotifyRun(sampleRun(now))
+
+	for i, m := range recorder.messages {
+		if event != "" && string(m.Event) != event {
+			continue
+		}
+		payload, err := notifier.Payload(format, fmt.Sprintf("3f2a9c1e5b7d4a%02d", i), m, now)
+		if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		json.Indent(&out, payload, "", "  ")
+		fmt.Printf("# %s\n%s\n\n", m.Event, out.String())
+	}
+	return nil
+}
+
+// sampleRun returns the result of a typical check that finished at now
+func sampleRun(now time.Time) *runs.Result {
+	r := runs.New("", now.Add(-1400*time.Millisecond))
+	r.ID = "9c41e7a2"
+	r.DurationMS = 1400
+	r.Counts = runs.Counts{Drafts: 12, Empty: 3, Stale: 2, Deleted: 2, Failed: 1}
+	r.Rules = map[string]int{"built-in": 3, "abandoned model": 2}
+	r.Actions = []*runs.Action{
+		{DraftID: "r-5139266451326716405", Rule: "built-in", Outcome: "deleted", Reason: "empty for 9d"},
+		{DraftID: "r-2712093917427301652", Rule: "built-in", Outcome: "deleted", Reason: "empty for 14d"},
+		{DraftID: "r-8807231450996123441", Rule: "built-in", Outcome: "delete failed", Reason: "empty for 30d", Error: "unable to delete draft r-8807231450996123441: Gmail API Error 429: Quota exceeded"},
+		{DraftID: "r-1290374650128734506", Subject: "Re: Q3 budget", Rule: "abandoned model", Outcome: "stale"},
+		{DraftID: "r-6601928374650192837", Subject: "Offsite agenda", Rule: "abandoned model", Outcome: "stale"},
+	}
+	r.Stages = []*runs.Stage{{Name: "scan", DurationMS: 820, Calls: 15}, {Name: "classify", DurationMS: 60}, {Name: "clean", DurationMS: 410, Calls: 2}, {Name: "report", DurationMS: 110, Calls: 1}}
+	return r
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"calmdrafts/internal/buildinfo"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/i18n"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/plugin"
+)
+
+// notificationChannels lists the channel names accepted in
+// notifications.events
+var notificationChannels = []string{notifier.Desktop, "plugins", "smtp", "matrix", "mqtt", "apprise", "webhook"}
+
+// locale returns the configured language of notifications and reports,
+// defaulting to the environment's
+func locale(cfg *config.Config) *i18n.Locale {
+	if cfg.Locale != "" {
+		return i18n.Parse(cfg.Locale)
+	}
+	return i18n.FromEnv()
+}
+
+// webhookQueuePath returns where webhook deliveries waiting for a retry are
+// stored
+func webhookQueuePath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "webhooks.json")
+}
+
+// newNotifier creates the notifier for the configured channels. Without a
+// desktop, only the backends notify.
+func newNotifier(cfg *config.Config, plugins *plugin.Manager, desktop bool) (*notifier.Notifier, error) {
+	notif := notifier.New(appName, buildinfo.Get().String())
+	notif.SetLocale(locale(cfg))
+	notif.SetAccessible(cfg.Accessible)
+	if !desktop {
+		notif.DisableDesktop()
+	}
+	if len(plugins.Plugins(plugin.KindNotifier)) > 0 {
+		notif.AddBackend("plugins", plugins)
+	}
+	if cfg.StateDir != "" {
+		notif.SetHistory(notifier.OpenHistory(notificationsPath(cfg)))
+	}
+
+	if cfg.Notifications == nil {
+		return notif, nil
+	}
+	if s := cfg.Notifications.SMTP; s != nil {
+		switch {
+		case s.Host == "" || s.From == "" || len(s.To) == 0:
+			return nil, fmt.Errorf("notifications.smtp needs host, from and to")
+		case s.TLS != "" && s.TLS != notifier.TLSStartTLS && s.TLS != notifier.TLSImplicit && s.TLS != notifier.TLSNone:
+			return nil, fmt.Errorf("notifications.smtp.tls must be %q, %q or %q", notifier.TLSStartTLS, notifier.TLSImplicit, notifier.TLSNone)
+		}
+		notif.AddBackend("smtp", &notifier.SMTP{
+			Host:     s.Host,
+			Port:     s.Port,
+			TLS:      s.TLS,
+			Username: s.Username,
+			Password: s.Password,
+			From:     s.From,
+			To:       s.To,
+		})
+	}
+	if m := cfg.Notifications.Matrix; m != nil {
+		if m.Homeserver == "" || m.AccessToken == "" || m.RoomID == "" {
+			return nil, fmt.Errorf("notifications.matrix needs homeserver, access_token and room_id")
+		}
+		notif.AddBackend("matrix", &notifier.Matrix{Homeserver: m.Homeserver, AccessToken: m.AccessToken, RoomID: m.RoomID})
+	}
+	if a := cfg.Notifications.Apprise; a != nil {
+		if len(a.URLs) == 0 {
+			return nil, fmt.Errorf("notifications.apprise needs urls")
+		}
+		if a.Server == "" {
+			command := a.Command
+			if command == "" {
+				command = "apprise"
+			}
+			if _, err := exec.LookPath(command); err != nil {
+				return nil, fmt.Errorf("notifications.apprise: %s not found, install it with \"pip install apprise\" or set server", command)
+			}
+		}
+		notif.AddBackend("apprise", &notifier.Apprise{URLs: a.URLs, Command: a.Command, Server: a.Server})
+	}
+	if w := cfg.Notifications.Webhook; w != nil {
+		if w.URL == "" {
+			return nil, fmt.Errorf("notifications.webhook needs url")
+		}
+		format, err := notifier.ParseWebhookFormat(w.Format)
+		if err != nil {
+			return nil, fmt.Errorf("notifications.webhook: %v", err)
+		}
+		webhook := &notifier.Webhook{URL: w.URL, Secret: w.Secret, Format: format}
+		if cfg.StateDir != "" {
+			webhook.QueuePath = webhookQueuePath(cfg)
+		}
+		notif.AddBackend("webhook", webhook)
+	}
+	broker, err := mqttBroker(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if broker != nil {
+		notif.AddBackend("mqtt", &notifier.MQTT{Broker: broker, Topic: mqttTopic(cfg)})
+	}
+	notif.SetAppID(cfg.Notifications.AppID)
+	notif.SetWall(cfg.Notifications.Wall)
+	for channel, names := range cfg.Notifications.Events {
+		if !slices.Contains(notificationChannels, channel) {
+			return nil, fmt.Errorf("notifications.events: unknown channel %q (available: %s)", channel, strings.Join(notificationChannels, ", "))
+		}
+		events := make([]notifier.Event, 0, len(names))
+		for _, name := range names {
+			event, err := notifier.ParseEvent(name)
+			if err != nil {
+				return nil, fmt.Errorf("notifications.events.%s: %v", channel, err)
+			}
+			events = append(events, event)
+		}
+		notif.SetEvents(channel, events)
+	}
+	for channel, events := range cfg.Notifications.Styles {
+		if channel != notifier.Any && !slices.Contains(notificationChannels, channel) {
+			return nil, fmt.Errorf("notifications.styles: unknown channel %q (available: %s, %s)", channel, notifier.Any, strings.Join(notificationChannels, ", "))
+		}
+		for event, style := range events {
+			if event != notifier.Any {
+				if _, err := notifier.ParseEvent(event); err != nil {
+					return nil, fmt.Errorf("notifications.styles.%s: %v", channel, err)
+				}
+			}
+			notif.SetStyle(channel, event, notifier.Style{Icon: style.Icon, Sound: style.Sound})
+		}
+	}
+	for channel, perHour := range cfg.Notifications.RateLimits {
+		if !slices.Contains(notificationChannels, channel) {
+			return nil, fmt.Errorf("notifications.rate_limits: unknown channel %q (available: %s)", channel, strings.Join(notificationChannels, ", "))
+		}
+		notif.SetRateLimit(channel, perHour)
+	}
+	return notif, nil
+}
+
+// notifyError reports a failed check, asking to sign in again when the
+// token is no longer valid. An error that keeps failing the checks is only
+// notified the first time, then as a reminder once every errorReminder,
+// until a check succeeds again, see recoverError.
+func notifyError(cfg *config.Config, notif *notifier.Notifier, err error) {
+	now := time.Now()
+	key := errorKey(err)
+	if e := loadOngoingError(cfg); e != nil && e.Key == key {
+		e.Count++
+		e.Last = now
+		if now.Sub(e.Notified) < errorReminder {
+			fmt.Printf("Not notifying about the same error again, ongoing since %s (%d times)\n", e.Since.Local().Format("2006-01-02 15:04"), e.Count)
+			saveOngoingError(cfg, e)
+			return
+		}
+		e.Notified = now
+		saveOngoingError(cfg, e)
+		if gmail.IsAuthError(err) {
+			notif.NotifyAuth(err)
+			return
+		}
+		notif.NotifyErrorOngoing(err, e.Since, e.Count)
+		return
+	}
+
+	// A new error, or a different one than before, is notified right away
+	saveOngoingError(cfg, &ongoingError{Key: key, Message: err.Error(), Since: now, Last: now, Notified: now, Count: 1})
+	if gmail.IsAuthError(err) {
+		notif.NotifyAuth(err)
+		return
+	}
+	notif.NotifyError(err)
+}
+
+// recoverError notifies that checks work again after an ongoing error,
+// and forgets the error
+func recoverError(cfg *config.Config, notif *notifier.Notifier) {
+	e := loadOngoingError(cfg)
+	if e == nil {
+		return
+	}
+	saveOngoingError(cfg, nil)
+	fmt.Printf("Checks work again after failing since %s\n", e.Since.Local().Format("2006-01-02 15:04"))
+	if err := notif.NotifyRecovered(e.Message, e.Since); err != nil {
+		log.Printf("Error sending recovery notification: %v", err)
+	}
+}
+
+// errorReminder is how long an ongoing error goes without a notification
+const errorReminder = 24 * time.Hour
+
+// ongoingError is the error that failed the last checks of a mailbox
+type ongoingError struct {
+	Key      string    `json:"key"` // Identifies repeats, see errorKey
+	Message  string    `json:"message"`
+	Since    time.Time `json:"since"`
+	Last     time.Time `json:"last"`
+	Notified time.Time `json:"notified"` // When the user was last told about it
+	Count    int       `json:"count"`    // Checks it failed
+}
+
+// errorNumbers matches the numbers in error messages, such as draft IDs,
+// that differ between repeats of the same error
+var errorNumbers = regexp.MustCompile(`[0-9]+`)
+
+// errorKey identifies repeats of an error
+func errorKey(err error) string {
+	if gmail.IsAuthError(err) {
+		return "auth"
+	}
+	return errorNumbers.ReplaceAllString(err.Error(), "#")
+}
+
+// ongoingErrorPath returns where the ongoing error of a mailbox is kept
+func ongoingErrorPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "ongoing-error.json")
+}
+
+// ongoingErrors keeps the ongoing errors of mailboxes without state_dir,
+// by account, for as long as the daemon runs
+var ongoingErrors = struct {
+	sync.Mutex
+	byAccount map[string]*ongoingError
+}{byAccount: make(map[string]*ongoingError)}
+
+// loadOngoingError returns the ongoing error of a mailbox, or nil
+func loadOngoingError(cfg *config.Config) *ongoingError {
+	if cfg.StateDir == "" {
+		ongoingErrors.Lock()
+		defer ongoingErrors.Unlock()
+		return ongoingErrors.byAccount[cfg.Account]
+	}
+	b, err := os.ReadFile(ongoingErrorPath(cfg))
+	if err != nil {
+		return nil
+	}
+	e := &ongoingError{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil
+	}
+	return e
+}
+
+// saveOngoingError keeps the ongoing error of a mailbox, or forgets it
+// when e is nil
+func saveOngoingError(cfg *config.Config, e *ongoingError) {
+	if cfg.StateDir == "" {
+		ongoingErrors.Lock()
+		defer ongoingErrors.Unlock()
+		if e == nil {
+			delete(ongoingErrors.byAccount, cfg.Account)
+		} else {
+			ongoingErrors.byAccount[cfg.Account] = e
+		}
+		return
+	}
+	path := ongoingErrorPath(cfg)
+	if e == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error forgetting ongoing error: %v", err)
+		}
+		return
+	}
+	b, err := json.Marshal(e)
+	if err == nil {
+		if err = os.MkdirAll(cfg.StateDir, 0700); err == nil {
+			err = os.WriteFile(path, b, 0600)
+		}
+	}
+	if err != nil {
+		log.Printf("Error recording ongoing error: %v", err)
+	}
+}
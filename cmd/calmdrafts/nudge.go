@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/actions"
+	"calmdrafts/internal/audit"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/nudge"
+)
+
+// nudgesPath returns where outstanding send-or-delete nudges are stored
+func nudgesPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "nudges.json")
+}
+
+// nudgeAfter returns how long a ready draft must be unchanged before a nudge
+func nudgeAfter(cfg *config.Config) time.Duration {
+	if cfg.Nudge.After.Duration > 0 {
+		return cfg.Nudge.After.Duration
+	}
+	return 3 * 24 * time.Hour
+}
+
+// nudgeSnooze returns how long snoozing postpones a nudge
+func nudgeSnooze(cfg *config.Config) time.Duration {
+	if cfg.Nudge != nil && cfg.Nudge.Snooze.Duration > 0 {
+		return cfg.Nudge.Snooze.Duration
+	}
+	return 24 * time.Hour
+}
+
+// nudgeDrafts asks once about each draft that looks ready to send but
+// hasn't changed in a while, and again when a snooze ends. Edited or
+// deleted drafts lose their nudge.
+func nudgeDrafts(cfg *config.Config, notif *notifier.Notifier, drafts []*gmail.Draft, changed map[string]time.Time, now time.Time) error {
+	store, err := nudge.Open(nudgesPath(cfg))
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]*gmail.Draft, len(drafts))
+	fresh := []*nudge.Entry{}
+	for _, draft := range drafts {
+		current[draft.ID] = draft
+		if !nudge.Ready(draft, changed[draft.ID], nudgeAfter(cfg), now) {
+			continue
+		}
+		entry := store.Get(draft.ID)
+		if entry != nil && entry.MessageID == draft.MessageID {
+			if entry.SnoozedUntil.IsZero() || entry.Snoozed(now) {
+				continue
+			}
+			entry.SnoozedUntil = time.Time{}
+			entry.NudgedAt = now
+			fresh = append(fresh, entry)
+			continue
+		}
+		entry = &nudge.Entry{DraftID: draft.ID, MessageID: draft.MessageID, Subject: draft.Subject, To: draft.To, NudgedAt: now}
+		store.Add(entry)
+		fresh = append(fresh, entry)
+	}
+	for _, entry := range store.Entries() {
+		if draft, ok := current[entry.DraftID]; !ok || draft.MessageID != entry.MessageID {
+			store.Remove(entry.DraftID)
+		}
+	}
+
+	if len(fresh) > 0 {
+		// The notification names the first, which Send now offers to send;
+		// see namedNudge
+		sort.Slice(fresh, func(i, j int) bool { return fresh[i].DraftID < fresh[j].DraftID })
+		for _, entry := range fresh {
+			fmt.Printf("Draft ready to send (ID: %s, to: %s, subject: %q)\n", entry.DraftID, entry.To, entry.Subject)
+		}
+		if err := notif.NotifyNudge(len(fresh), fresh[0].Subject); err != nil {
+			log.Printf("Error sending nudge notification: %v", err)
+		}
+	}
+	return store.Save()
+}
+
+// snoozeNudges postpones every outstanding nudge, for the Snooze button of
+// the nudge notification
+func snoozeNudges(cfg *config.Config, now time.Time) error {
+	store, err := nudge.Open(nudgesPath(cfg))
+	if err != nil {
+		return err
+	}
+	snoozed := 0
+	for _, entry := range store.Entries() {
+		if !entry.Snoozed(now) {
+			entry.SnoozedUntil = now.Add(nudgeSnooze(cfg))
+			snoozed++
+		}
+	}
+	if snoozed > 0 {
+		fmt.Printf("Snoozed %d nudge(s) until %s\n", snoozed, now.Add(nudgeSnooze(cfg)).Format("2006-01-02 15:04"))
+	}
+	return store.Save()
+}
+
+// namedNudge returns the draft the latest nudge notification named: the
+// first by ID of the drafts nudged about last. It returns nil when there is
+// none or it was snoozed.
+func namedNudge(store *nudge.Store, now time.Time) *nudge.Entry {
+	var named *nudge.Entry
+	for _, entry := range store.Entries() {
+		if named == nil || entry.NudgedAt.After(named.NudgedAt) {
+			named = entry
+		}
+	}
+	if named == nil || named.Snoozed(now) {
+		return nil
+	}
+	return named
+}
+
+// latestNudge returns the draft the latest nudge notification of a mailbox
+// named, nil if there is none
+func latestNudge(cfg *config.Config, now time.Time) (*nudge.Entry, error) {
+	store, err := nudge.Open(nudgesPath(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return namedNudge(store, now), nil
+}
+
+// offerSend asks the user to confirm sending a nudged draft, for the Send
+// now button of the nudge notification
+func offerSend(notif *notifier.Notifier, entry *nudge.Entry) error {
+	if err := notif.NotifyConfirmSend(entry.Subject, entry.To); err != nil {
+		return fmt.Errorf("unable to ask for confirmation: %v", err)
+	}
+	return nil
+}
+
+// confirmSend sends the draft offered by offerSend, for the Confirm send
+// button, unless it was edited, deleted or dealt with since
+func confirmSend(ctx context.Context, client *gmail.Client, cfg *config.Config, offered *nudge.Entry) error {
+	store, err := nudge.Open(nudgesPath(cfg))
+	if err != nil {
+		return err
+	}
+	entry := store.Get(offered.DraftID)
+	if entry == nil || entry.MessageID != offered.MessageID {
+		fmt.Printf("Draft %s changed since the nudge, not sending it\n", offered.DraftID)
+		return nil
+	}
+
+	drafts, err := client.ListDrafts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, draft := range drafts {
+		if draft.ID == entry.DraftID && draft.MessageID == entry.MessageID {
+			if err := sendNudged(ctx, client, cfg, store, draft); err != nil {
+				return err
+			}
+			return store.Save()
+		}
+	}
+	fmt.Printf("Draft %s changed since the nudge, dropping it\n", entry.DraftID)
+	store.Remove(entry.DraftID)
+	return store.Save()
+}
+
+// sendNudged sends a draft the user was nudged about, drops its nudge and
+// records it in the audit log
+func sendNudged(ctx context.Context, client *gmail.Client, cfg *config.Config, store *nudge.Store, draft *gmail.Draft) error {
+	if err := client.SendDraft(ctx, draft.ID); err != nil {
+		return err
+	}
+	store.Remove(draft.ID)
+	fmt.Printf("Sent draft %s to %s\n", draft.ID, draft.To)
+	if cfg.AuditLogPath != "" {
+		entry := &audit.Entry{
+			Action:    audit.ActionSend,
+			DraftID:   draft.ID,
+			MessageID: draft.MessageID,
+			Subject:   draft.Subject,
+			To:        draft.To,
+			Reason:    "nudge",
+		}
+		if err := audit.Open(cfg.AuditLogPath).Append(entry); err != nil {
+			log.Printf("Error writing audit log: %v", err)
+		}
+	}
+	return nil
+}
+
+// runNudge lets the user send, snooze or delete the drafts they were nudged
+// about
+func runNudge(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("nudge", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	list := fs.Bool("list", false, "Only list outstanding nudges")
+	send := fs.String("send", "", "Send the draft with this ID now")
+	snooze := fs.String("snooze", "", "Postpone the nudge for the draft with this ID")
+	del := fs.String("delete", "", "Delete the draft with this ID")
+	yes := fs.Bool("yes", false, "Send without asking for confirmation")
+	var snoozeFor time.Duration
+	fs.Func("for", "How long --snooze postpones the nudge (default: nudge.snooze, or 1d)", durationFlag(&snoozeFor))
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+	if snoozeFor <= 0 {
+		snoozeFor = nudgeSnooze(cfg)
+	}
+
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so no nudges are recorded")
+	}
+	store, err := nudge.Open(nudgesPath(cfg))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	outstanding := []*nudge.Entry{}
+	for _, entry := range store.Entries() {
+		if !entry.Snoozed(now) {
+			outstanding = append(outstanding, entry)
+		}
+	}
+	if *list {
+		if len(store.Entries()) == 0 {
+			fmt.Println("No drafts to nudge about")
+		}
+		for _, entry := range store.Entries() {
+			printNudge(entry, now)
+		}
+		return nil
+	}
+
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err != nil {
+		return fmt.Errorf("error creating Gmail client: %v", err)
+	}
+	drafts, err := client.ListDrafts(ctx)
+	if err != nil {
+		return err
+	}
+	actionQueue, err := openActionQueue(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Never send or delete a draft edited since the nudge
+	current := make(map[string]*gmail.Draft, len(drafts))
+	for _, draft := range drafts {
+		current[draft.ID] = draft
+	}
+	draftFor := func(entry *nudge.Entry) *gmail.Draft {
+		draft, ok := current[entry.DraftID]
+		if !ok || draft.MessageID != entry.MessageID {
+			fmt.Printf("Draft %s changed since the nudge, dropping it\n", entry.DraftID)
+			store.Remove(entry.DraftID)
+			return nil
+		}
+		return draft
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	decide := func(entry *nudge.Entry, choice string, confirmed bool) error {
+		if choice == "snooze" {
+			entry.SnoozedUntil = now.Add(snoozeFor)
+			fmt.Printf("Snoozed draft %s until %s\n", entry.DraftID, entry.SnoozedUntil.Format("2006-01-02 15:04"))
+			return nil
+		}
+
+		draft := draftFor(entry)
+		if draft == nil {
+			return nil
+		}
+		if choice == "delete" {
+			a := &actions.Action{
+				Kind:      actions.KindDelete,
+				DraftID:   draft.ID,
+				MessageID: draft.MessageID,
+				Subject:   draft.Subject,
+				To:        draft.To,
+				Reason:    "nudge",
+			}
+			if err := applyAction(ctx, client, cfg, actionQueue, a); err != nil {
+				return err
+			}
+			store.Remove(entry.DraftID)
+			fmt.Printf("Deleted draft %s\n", entry.DraftID)
+			return nil
+		}
+
+		if !confirmed {
+			fmt.Printf("Send %q to %s now? [y/N] ", draft.Subject, draft.To)
+			line, _ := in.ReadString('\n')
+			if strings.ToLower(strings.TrimSpace(line)) != "y" {
+				fmt.Println("Not sent")
+				return nil
+			}
+		}
+		return sendNudged(ctx, client, cfg, store, draft)
+	}
+
+	// Non-interactive decisions
+	if *send != "" || *snooze != "" || *del != "" {
+		decisions := []struct {
+			id     string
+			choice string
+		}{{*send, "send"}, {*snooze, "snooze"}, {*del, "delete"}}
+		for _, d := range decisions {
+			if d.id == "" {
+				continue
+			}
+			entry := store.Get(d.id)
+			if entry == nil {
+				return fmt.Errorf("there is no nudge for draft %s", d.id)
+			}
+			if err := decide(entry, d.choice, *yes); err != nil {
+				return err
+			}
+		}
+		return store.Save()
+	}
+
+	if len(outstanding) == 0 {
+		fmt.Println("No drafts to nudge about")
+		return store.Save()
+	}
+
+	choices := map[string]string{"s": "send", "n": "snooze", "d": "delete"}
+	for i, entry := range outstanding {
+		fmt.Printf("\n(%d/%d) ", i+1, len(outstanding))
+		printNudge(entry, now)
+		fmt.Print("[s]end now, s[n]ooze, [d]elete, s[k]ip, [q]uit? ")
+
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			break
+		}
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if answer == "q" {
+			break
+		}
+		choice, ok := choices[answer]
+		if !ok {
+			continue
+		}
+		if err := decide(entry, choice, *yes); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		// Save after every decision so quitting early loses nothing
+		if err := store.Save(); err != nil {
+			return err
+		}
+	}
+
+	return store.Save()
+}
+
+// printNudge describes a draft the user was nudged about
+func printNudge(entry *nudge.Entry, now time.Time) {
+	subject := entry.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	fmt.Printf("%s  %q  to: %s  nudged %s ago", entry.DraftID, subject, entry.To, now.Sub(entry.NudgedAt).Round(time.Minute))
+	if entry.Snoozed(now) {
+		fmt.Printf("  snoozed until %s", entry.SnoozedUntil.Format("2006-01-02 15:04"))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"calmdrafts/internal/config"
+)
+
+// observationState records when the observation period started and whether
+// cleanup was enabled early
+type observationState struct {
+	StartedAt time.Time `json:"started_at"`
+	EnabledAt time.Time `json:"enabled_at,omitempty"`
+}
+
+// observationPath returns where the observation period is tracked
+func observationPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "observation.json")
+}
+
+// loadObservation reads the observation state. A missing file is an empty
+// state.
+func loadObservation(cfg *config.Config) (*observationState, error) {
+	state := &observationState{}
+	data, err := os.ReadFile(observationPath(cfg))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid observation state: %v", err)
+	}
+	return state, nil
+}
+
+// saveObservation writes the observation state
+func saveObservation(cfg *config.Config, state *observationState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	return os.WriteFile(observationPath(cfg), append(data, '\n'), 0600)
+}
+
+// observationEnds returns when the observation period ends and whether it
+// is still running. The period starts with the first check.
+func observationEnds(cfg *config.Config, now time.Time) (time.Time, bool, error) {
+	if cfg.ObservationPeriod.Duration <= 0 {
+		return time.Time{}, false, nil
+	}
+	if cfg.StateDir == "" {
+		return time.Time{}, false, fmt.Errorf("observation_period needs state_dir to remember when it started")
+	}
+	state, err := loadObservation(cfg)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if state.StartedAt.IsZero() {
+		state.StartedAt = now
+		if err := saveObservation(cfg, state); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+	end := state.StartedAt.Add(cfg.ObservationPeriod.Duration)
+	if !state.EnabledAt.IsZero() {
+		return end, false, nil
+	}
+	return end, now.Before(end), nil
+}
+
+// runEnableCleanup ends the observation period early so real deletions begin
+func runEnableCleanup(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("enable-cleanup", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if cfg.ObservationPeriod.Duration <= 0 {
+		fmt.Println("No observation period is configured, cleanup is already enabled")
+		return nil
+	}
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so the observation period can't be tracked")
+	}
+	state, err := loadObservation(cfg)
+	if err != nil {
+		return err
+	}
+	if !state.EnabledAt.IsZero() {
+		fmt.Printf("Cleanup was already enabled on %s\n", state.EnabledAt.Local().Format("2006-01-02 15:04"))
+		return nil
+	}
+	now := time.Now()
+	if state.StartedAt.IsZero() {
+		state.StartedAt = now
+	}
+	state.EnabledAt = now
+	if err := saveObservation(cfg, state); err != nil {
+		return err
+	}
+	fmt.Println("Cleanup enabled: the next check deletes drafts for real")
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"calmdrafts/internal/config"
+)
+
+// overrides collects config changes requested with command-line flags.
+// They are applied after the config file and profile have been loaded.
+type overrides struct {
+	account string // Account selected with --account, applied first
+	sets    []func(cfg *config.Config)
+	global  *overrides // The flags given before the command, for a command's own flags
+}
+
+// globalOverrides are the flags given before the command
+var globalOverrides *overrides
+
+// addOverrideFlags registers a flag for every top-level config field on fs
+func addOverrideFlags(fs *flag.FlagSet) *overrides {
+	o := &overrides{global: globalOverrides}
+
+	fs.Func("account", "Name of the account in the config file to act on", func(s string) error {
+		o.account = s
+		return nil
+	})
+
+	duration := func(name, usage string, field func(*config.Config) *config.Duration) {
+		fs.Func(name, usage, func(s string) error {
+			d, err := config.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			o.sets = append(o.sets, func(cfg *config.Config) { field(cfg).Duration = d })
+			return nil
+		})
+	}
+	str := func(name, usage string, field func(*config.Config) *string) {
+		fs.Func(name, usage, func(s string) error {
+			o.sets = append(o.sets, func(cfg *config.Config) { *field(cfg) = s })
+			return nil
+		})
+	}
+
+	duration("check-interval", "Override check_interval (e.g. 30m)", func(c *config.Config) *config.Duration { return &c.CheckInterval })
+	duration("cleanup-age", "Override cleanup_age (e.g. 7d)", func(c *config.Config) *config.Duration { return &c.CleanupAge })
+	duration("recent-edit-guard", "Override recent_edit_guard (e.g. 15m)", func(c *config.Config) *config.Duration { return &c.RecentEditGuard })
+	duration("min-age", "Override min_age (e.g. 24h)", func(c *config.Config) *config.Duration { return &c.MinAge })
+	duration("grace-period", "Override grace_period (e.g. 2d)", func(c *config.Config) *config.Duration { return &c.GracePeriod })
+	str("credentials-path", "Override credentials_path", func(c *config.Config) *string { return &c.CredentialsPath })
+	str("token-path", "Override token_path", func(c *config.Config) *string { return &c.TokenPath })
+	str("mailbox", "Override mailbox (a delegated address to clean)", func(c *config.Config) *string { return &c.Mailbox })
+	str("plugins-dir", "Override plugins_dir", func(c *config.Config) *string { return &c.PluginsDir })
+	str("script-path", "Override script_path", func(c *config.Config) *string { return &c.ScriptPath })
+	str("report-path", "Override report_path", func(c *config.Config) *string { return &c.ReportPath })
+	str("archive-dir", "Override archive_dir", func(c *config.Config) *string { return &c.ArchiveDir })
+	str("user-agent", "Override user_agent", func(c *config.Config) *string { return &c.UserAgent })
+	str("quota-project", "Override quota_project", func(c *config.Config) *string { return &c.QuotaProject })
+	str("locale", "Override locale (e.g. fr)", func(c *config.Config) *string { return &c.Locale })
+	str("audit-log-path", "Override audit_log_path", func(c *config.Config) *string { return &c.AuditLogPath })
+	str("state-dir", "Override state_dir", func(c *config.Config) *string { return &c.StateDir })
+
+	fs.Func("abandoned-threshold", "Override abandoned_threshold (0-1)", func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		o.sets = append(o.sets, func(cfg *config.Config) { cfg.AbandonedThreshold = v })
+		return nil
+	})
+	fs.Func("max-deletions", "Override max_deletions per check (0 = unlimited)", func(s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		o.sets = append(o.sets, func(cfg *config.Config) { cfg.MaxDeletions = v })
+		return nil
+	})
+	fs.BoolFunc("use-trash", "Move drafts to Gmail's Trash instead of deleting them permanently", func(s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		o.sets = append(o.sets, func(cfg *config.Config) { cfg.UseTrash = v })
+		return nil
+	})
+	fs.BoolFunc("accessible", "Print linear, screen-reader-friendly output without tables, charts or banners", func(s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		o.sets = append(o.sets, func(cfg *config.Config) { cfg.Accessible = v })
+		return nil
+	})
+	fs.BoolFunc("dry-run", "Report what would be deleted without deleting anything", func(s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		o.sets = append(o.sets, func(cfg *config.Config) { cfg.DryRun = v })
+		return nil
+	})
+
+	return o
+}
+
+// apply changes cfg according to the flags that were set. When the config
+// lists accounts, one must be selected, so a manual command never acts on
+// the wrong mailbox.
+func (o *overrides) apply(cfg *config.Config) error {
+	if err := o.applyAny(cfg); err != nil {
+		return err
+	}
+	if len(cfg.Accounts) > 0 && cfg.Account == "" {
+		names, err := cfg.AccountNames()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("the config lists several accounts, choose one with --account (%s)", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// applyAny is apply for commands that cover every account, such as the
+// daemon. The account is applied only once, before the other flags: when
+// it is selected after the command, the flags given before the command,
+// which the account's settings just replaced, are applied again.
+func (o *overrides) applyAny(cfg *config.Config) error {
+	if o.account != "" && o.account != cfg.Account {
+		if cfg.Account != "" {
+			return fmt.Errorf("--account %s and --account %s select different accounts", cfg.Account, o.account)
+		}
+		if err := cfg.ApplyAccount(o.account); err != nil {
+			return err
+		}
+		if o.global != nil {
+			for _, set := range o.global.sets {
+				set(cfg)
+			}
+		}
+	}
+	for _, set := range o.sets {
+		set(cfg)
+	}
+	return nil
+}
+
+// cutAllAccounts removes --all-accounts from the arguments of a command,
+// where it is accepted as well as before the command, and reports whether
+// it was there
+func cutAllAccounts(args []string) ([]string, bool) {
+	rest := make([]string, 0, len(args))
+	found := false
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch arg {
+		case "-all-accounts", "--all-accounts", "-all-accounts=true", "--all-accounts=true":
+			found = true
+		case "-all-accounts=false", "--all-accounts=false":
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, found
+}
+
+// runAllAccounts runs a command once for every account listed in the
+// config, stopping at the first that fails
+func runAllAccounts(ctx context.Context, cmd *command, profile string, o *overrides, args []string) error {
+	if o.account != "" {
+		return fmt.Errorf("--all-accounts and --account cannot be used together")
+	}
+	configs, err := accountConfigs(profile, o)
+	if err != nil {
+		return err
+	}
+	if len(configs) == 0 {
+		return fmt.Errorf("--all-accounts needs accounts listed in the config")
+	}
+	for i, cfg := range configs {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Account %s:\n", cfg.Account)
+		if err := cmd.run(ctx, cfg, args); err != nil {
+			return fmt.Errorf("account %s: %v", cfg.Account, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"calmdrafts/internal/actions"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/plan"
+)
+
+// planKeyPath returns where the key signing plans is stored
+func planKeyPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "plan.key")
+}
+
+// runPlan writes the deletions a check would make to a signed plan file,
+// without changing anything
+func runPlan(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	out := fs.String("out", "calmdrafts.plan", "File to write the plan to")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so there is no key to sign plans with")
+	}
+	key, err := plan.LoadKey(planKeyPath(cfg))
+	if err != nil {
+		return err
+	}
+
+	plugins, rulesScript, model, err := loadRules(cfg)
+	if err != nil {
+		return err
+	}
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err != nil {
+		return fmt.Errorf("error creating Gmail client: %v", err)
+	}
+	drafts, err := client.ListDrafts(ctx)
+	if err != nil {
+		return err
+	}
+	if err := markTemplates(cfg, drafts); err != nil {
+		return err
+	}
+	if err := markKept(cfg, drafts); err != nil {
+		return err
+	}
+	countEdits(cfg, drafts)
+
+	now := time.Now()
+	p := &plan.Plan{Version: plan.CurrentVersion, CreatedAt: now, Mailbox: cfg.Mailbox, Actions: []*actions.Action{}}
+	for _, draft := range drafts {
+		if empty, ok, err := plugins.Classify(ctx, draft); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running classifier plugins for draft %s: %v\n", draft.ID, err)
+		} else if ok {
+			draft.IsEmpty = empty
+		}
+
+		v, err := evaluate(ctx, draft, plugins, rulesScript, model, cfg, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			continue
+		}
+		if !v.delete || v.stale || belowMinAge(cfg, draft, now) || recentlyEdited(draft, time.Time{}, now, cfg.RecentEditGuard.Duration) {
+			continue
+		}
+		if cfg.MaxDeletions > 0 && len(p.Actions) >= cfg.MaxDeletions {
+			fmt.Printf("Reached max_deletions (%d), leaving the remaining drafts for a later plan\n", cfg.MaxDeletions)
+			break
+		}
+
+		p.Actions = append(p.Actions, &actions.Action{
+			Kind:      actions.KindDelete,
+			DraftID:   draft.ID,
+			MessageID: draft.MessageID,
+			Subject:   draft.Subject,
+			To:        draft.To,
+			Reason:    v.reason,
+			CreatedAt: now,
+		})
+		subject := draft.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		fmt.Printf("- delete %s  %q  age: %s  reason: %s\n", draft.ID, subject, formatAge(now.Sub(draft.InternalDate)), v.reason)
+	}
+
+	if err := p.Sign(key); err != nil {
+		return err
+	}
+	if err := p.Save(*out); err != nil {
+		return err
+	}
+	if len(p.Actions) == 0 {
+		fmt.Printf("No changes. Wrote an empty plan to %s\n", *out)
+		return nil
+	}
+	fmt.Printf("\nPlan: %d draft(s) to delete. Run \"calmdrafts apply %s\" to apply it.\n", len(p.Actions), *out)
+	return nil
+}
+
+// runApply executes exactly the actions of a signed plan. Drafts that were
+// edited or deleted since the plan was made are left alone.
+func runApply(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	maxAge := fs.Duration("max-age", 24*time.Hour, "Refuse plans older than this")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: calmdrafts apply [flags] <plan>")
+	}
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so there is no key to verify plans with")
+	}
+
+	p, err := plan.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	key, err := plan.LoadKey(planKeyPath(cfg))
+	if err != nil {
+		return err
+	}
+	if err := p.Verify(key); err != nil {
+		return err
+	}
+	if age := time.Since(p.CreatedAt); age > *maxAge {
+		return fmt.Errorf("plan is %s old, older than --max-age %s; make a new one", age.Round(time.Minute), *maxAge)
+	}
+	if p.Mailbox != cfg.Mailbox {
+		return fmt.Errorf("plan was made for mailbox %q, not %q", p.Mailbox, cfg.Mailbox)
+	}
+
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err != nil {
+		return fmt.Errorf("error creating Gmail client: %v", err)
+	}
+	drafts, err := client.ListDrafts(ctx)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]*gmail.Draft, len(drafts))
+	for _, draft := range drafts {
+		current[draft.ID] = draft
+	}
+
+	actionQueue, err := openActionQueue(cfg)
+	if err != nil {
+		return err
+	}
+
+	applied, skipped, failed := 0, 0, 0
+	deletes := []*actions.Action{}
+	for _, planned := range p.Actions {
+		draft, ok := current[planned.DraftID]
+		if !ok || draft.MessageID != planned.MessageID {
+			fmt.Printf("Skipping draft %s, which changed since the plan was made\n", planned.DraftID)
+			skipped++
+			continue
+		}
+		if cfg.DryRun {
+			fmt.Printf("Would delete draft %s (%s)\n", planned.DraftID, planned.Reason)
+			applied++
+			continue
+		}
+
+		a := *planned
+		a.ID, a.CreatedAt = "", time.Now()
+		deletes = append(deletes, &a)
+	}
+
+	errs := applyDeletes(ctx, client, cfg, actionQueue, deletes)
+	for _, a := range deletes {
+		if err := errs[a.DraftID]; err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("Deleted draft %s (%s)\n", a.DraftID, a.Reason)
+		applied++
+	}
+
+	fmt.Printf("Applied %d of %d action(s), %d skipped, %d failed\n", applied, len(p.Actions), skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d action(s) failed and will be retried at the next check", failed)
+	}
+	return nil
+}
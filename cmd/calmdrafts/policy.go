@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"calmdrafts/internal/classifier"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/script"
+)
+
+// runPolicy dispatches the policy subcommands
+func runPolicy(ctx context.Context, cfg *config.Config, args []string) error {
+	usage := fmt.Errorf("usage: calmdrafts policy lint [file] | calmdrafts policy schema")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "schema":
+		_, err := os.Stdout.Write(config.PolicySchema)
+		return err
+	case "lint":
+		fs := flag.NewFlagSet("policy lint", flag.ExitOnError)
+		fs.Parse(args[1:])
+		path := cfg.PolicyPath
+		if fs.NArg() > 0 {
+			path = fs.Arg(0)
+		}
+		if path == "" {
+			return fmt.Errorf("no policy file given and policy_path is not set")
+		}
+		return lintPolicy(path)
+	}
+	return usage
+}
+
+// lintPolicy prints the problems in a policy file and fails if any is an error
+func lintPolicy(path string) error {
+	problems := config.LintPolicy(path)
+
+	// Check that the referenced script and model load, not just that they exist
+	errors := 0
+	for _, p := range problems {
+		if !p.Warning {
+			errors++
+		}
+	}
+	if errors == 0 {
+		policy, err := config.LoadPolicy(path)
+		if err != nil {
+			return err
+		}
+		if policy.Script != "" {
+			if _, err := script.Load(policy.Script); err != nil {
+				problems = append(problems, config.PolicyProblem{Message: fmt.Sprintf("script: %v", err)})
+				errors++
+			}
+		}
+		if policy.AbandonedModel != "" {
+			if _, err := classifier.LoadModel(policy.AbandonedModel); err != nil {
+				problems = append(problems, config.PolicyProblem{Message: fmt.Sprintf("abandoned_model: %v", err)})
+				errors++
+			}
+		}
+	}
+
+	for _, p := range problems {
+		fmt.Printf("%s: %s\n", path, p)
+	}
+	if errors > 0 {
+		return fmt.Errorf("%s has %d error(s)", path, errors)
+	}
+	fmt.Printf("%s: OK\n", path)
+	return nil
+}
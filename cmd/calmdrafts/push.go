@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/push"
+)
+
+// watchRenewal is how long before expiry the Gmail watch is renewed
+const watchRenewal = 24 * time.Hour
+
+// startPushServer listens for Pub/Sub push deliveries and requests a check
+// for each one. Requests arriving while a check is already pending are
+// coalesced into it.
+func startPushServer(cfg *config.Config, checkRequests chan<- struct{}) error {
+	path := cfg.Push.Path
+	if path == "" {
+		path = "/gmail/push"
+	}
+
+	handler := &push.Handler{
+		Token:          cfg.Push.Token,
+		Audience:       cfg.Push.Audience,
+		ServiceAccount: cfg.Push.ServiceAccount,
+		Notify: func(n *push.Notification) {
+			fmt.Printf("Push notification for %s (history %d)\n", n.EmailAddress, n.HistoryID)
+			select {
+			case checkRequests <- struct{}{}:
+			default:
+			}
+		},
+	}
+	if handler.Token == "" && handler.Audience == "" {
+		return fmt.Errorf("push needs a token or an audience to verify deliveries")
+	}
+	if handler.Audience != "" && handler.ServiceAccount == "" {
+		return fmt.Errorf("push.audience needs push.service_account, the service account the push subscription authenticates as")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+
+	ln, err := net.Listen("tcp", cfg.Push.Listen)
+	if err != nil {
+		return fmt.Errorf("unable to listen for push deliveries: %v", err)
+	}
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			log.Printf("Push endpoint stopped: %v", err)
+		}
+	}()
+
+	fmt.Printf("Receiving Gmail push notifications on %s%s\n", ln.Addr(), path)
+	return nil
+}
+
+// renewWatch registers the Gmail watch on the push topic when it is missing
+// or about to expire. The first watch also gives the history ID push
+// notifications are compared against.
+func renewWatch(ctx context.Context, m *mailbox) {
+	cfg := m.cfg
+	if cfg.Push == nil || cfg.Push.Topic == "" || time.Until(m.watchExpiry) > watchRenewal || !m.client.Supports(gmail.FeatureWatch) {
+		return
+	}
+
+	historyID, exp, err := m.client.Watch(ctx, cfg.Push.Topic)
+	if errors.Is(err, gmail.ErrUnavailable) {
+		log.Printf("Error renewing Gmail watch, checking on the interval only: %v", err)
+		return
+	}
+	if err != nil {
+		log.Printf("Error renewing Gmail watch: %v", err)
+		return
+	}
+	m.watchExpiry = exp
+	m.historyID.CompareAndSwap(0, historyID)
+}
+
+// pushedChanges reports whether drafts changed in any mailbox since the
+// history ID it last saw, moving each one to its latest history ID. A
+// mailbox without a history ID yet, or whose history can't be read, counts
+// as changed.
+func (d *daemon) pushedChanges(ctx context.Context) bool {
+	changed := false
+	for _, m := range d.mailboxes {
+		since := m.historyID.Load()
+		if since == 0 {
+			changed = true
+			continue
+		}
+		drafts, latest, err := m.client.DraftChanges(ctx, since)
+		if err != nil {
+			log.Printf("Error reading Gmail history, checking anyway: %v", err)
+			changed = true
+			continue
+		}
+		if latest > since {
+			m.historyID.Store(latest)
+		}
+		if drafts {
+			changed = true
+		}
+	}
+	if !changed {
+		fmt.Println("No draft changes since the last push notification, skipping the check")
+	}
+	return changed
+}
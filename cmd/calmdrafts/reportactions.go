@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"calmdrafts/internal/actions"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/report"
+)
+
+// reportActionsListen returns the address the daemon serves the triage
+// report's links on
+func reportActionsListen(cfg *config.Config) string {
+	if cfg.ReportActions.Listen != "" {
+		return cfg.ReportActions.Listen
+	}
+	return "127.0.0.1:8093"
+}
+
+// reportActions returns what signs a mailbox's report links, nil when they
+// are off or there is no state_dir to keep their key in
+func reportActions(cfg *config.Config) (*report.Actions, error) {
+	if cfg.ReportActions == nil || cfg.StateDir == "" {
+		return nil, nil
+	}
+	key, err := reportActionsKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &report.Actions{URL: "http://" + reportActionsListen(cfg), Key: key}, nil
+}
+
+// reportActionsKey reads the key signing a mailbox's report links,
+// creating it on first use
+func reportActionsKey(cfg *config.Config) ([]byte, error) {
+	path := filepath.Join(cfg.StateDir, "report-links.key")
+	key, err := os.ReadFile(path)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read report link key: %v", err)
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("unable to generate report link key: %v", err)
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create state directory: %v", err)
+	}
+	// Another process may create it at the same time; theirs wins
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to save report link key: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(key); err != nil {
+		return nil, fmt.Errorf("unable to save report link key: %v", err)
+	}
+	return key, nil
+}
+
+// keptPath returns where the drafts kept with a report's keep link are
+// stored
+func keptPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "kept.json")
+}
+
+// loadKept returns the IDs of the drafts kept with a report's keep link
+func loadKept(cfg *config.Config) (map[string]bool, error) {
+	kept := make(map[string]bool)
+	if cfg.StateDir == "" {
+		return kept, nil
+	}
+	data, err := os.ReadFile(keptPath(cfg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return kept, nil
+		}
+		return nil, fmt.Errorf("unable to read kept drafts: %v", err)
+	}
+
+	ids := []string{}
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("unable to parse kept drafts: %v", err)
+	}
+	for _, id := range ids {
+		kept[id] = true
+	}
+	return kept, nil
+}
+
+// saveKept writes the IDs of the drafts kept with a report's keep link
+func saveKept(cfg *config.Config, kept map[string]bool) error {
+	ids := make([]string, 0, len(kept))
+	for id := range kept {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	data, err := json.MarshalIndent(ids, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cfg.StateDir, 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	tmp := keptPath(cfg) + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("unable to write kept drafts: %v", err)
+	}
+	if err := os.Rename(tmp, keptPath(cfg)); err != nil {
+		return fmt.Errorf("unable to write kept drafts: %v", err)
+	}
+	return nil
+}
+
+// markKept marks the drafts kept with a report's keep link, which no rule
+// deletes or reports as stale
+func markKept(cfg *config.Config, drafts []*gmail.Draft) error {
+	kept, err := loadKept(cfg)
+	if err != nil {
+		return err
+	}
+	for _, draft := range drafts {
+		draft.IsKept = kept[draft.ID]
+	}
+	return nil
+}
+
+// isLoopback reports whether a listen address only accepts connections
+// from this machine
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// startReportActionsServer serves the delete and keep links of every
+// mailbox's triage report
+func startReportActionsServer(cfg *config.Config, mailboxes []*mailbox) error {
+	listen := reportActionsListen(cfg)
+	if !isLoopback(listen) {
+		return fmt.Errorf("report_actions.listen must be a loopback address, such as 127.0.0.1:8093, since anyone who can reach it with a link from the report can delete the draft")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /drafts/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		id, action := r.PathValue("id"), r.PathValue("action")
+		messageID, sig := r.URL.Query().Get("message"), r.URL.Query().Get("sig")
+		if action != report.ActionDelete && action != report.ActionKeep {
+			http.NotFound(w, r)
+			return
+		}
+		for _, m := range mailboxes {
+			links, err := reportActions(m.cfg)
+			if err != nil {
+				log.Printf("Error checking a report link: %v", err)
+				continue
+			}
+			if links == nil || !links.Verify(action, id, messageID, sig) {
+				continue
+			}
+			done, err := applyReportAction(r.Context(), m, action, id, messageID)
+			if err != nil {
+				log.Printf("Error applying a report link: %v", err)
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintln(w, done)
+			return
+		}
+		http.Error(w, "This link is not from a CalmDrafts report of this machine", http.StatusForbidden)
+	})
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("unable to listen for report links: %v", err)
+	}
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			log.Printf("Report links stopped: %v", err)
+		}
+	}()
+
+	fmt.Printf("Serving the triage report's delete and keep links on %s\n", ln.Addr())
+	return nil
+}
+
+// applyReportAction deletes or keeps a draft for a report link, unless it
+// was edited or deleted since the report. It returns what was done, for
+// the browser.
+func applyReportAction(ctx context.Context, m *mailbox, action, draftID, messageID string) (string, error) {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	drafts, err := m.client.ListDrafts(ctx)
+	if err != nil {
+		return "", err
+	}
+	var draft *gmail.Draft
+	for _, d := range drafts {
+		if d.ID == draftID {
+			draft = d
+		}
+	}
+	if draft == nil {
+		return "The draft is already gone", nil
+	}
+	subject := draft.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	if draft.MessageID != messageID {
+		return fmt.Sprintf("Draft %q was edited since the report, so it was left alone", subject), nil
+	}
+
+	if action == report.ActionKeep {
+		kept, err := loadKept(m.cfg)
+		if err != nil {
+			return "", err
+		}
+		// Forget the drafts that are gone
+		current := make(map[string]bool, len(drafts))
+		for _, d := range drafts {
+			current[d.ID] = true
+		}
+		for id := range kept {
+			if !current[id] {
+				delete(kept, id)
+			}
+		}
+		kept[draft.ID] = true
+		if err := saveKept(m.cfg, kept); err != nil {
+			return "", err
+		}
+		fmt.Printf("Keeping draft %s, as asked from the report\n", draft.ID)
+		return fmt.Sprintf("Kept draft %q: CalmDrafts won't delete it or report it as stale", subject), nil
+	}
+
+	queue, err := openActionQueue(m.cfg)
+	if err != nil {
+		return "", err
+	}
+	a := &actions.Action{Kind: actions.KindDelete, DraftID: draft.ID, MessageID: draft.MessageID, Subject: draft.Subject, To: draft.To, Reason: "deleted from the report"}
+	if err := applyAction(ctx, m.client, m.cfg, queue, a); err != nil {
+		return "", err
+	}
+	fmt.Printf("Deleted draft %s, as asked from the report\n", draft.ID)
+	return fmt.Sprintf("Deleted draft %q", subject), nil
+}
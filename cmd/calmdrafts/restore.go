@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"calmdrafts/internal/archive"
+	"calmdrafts/internal/audit"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+)
+
+// restoreFromTrash moves drafts CalmDrafts trashed back out of Trash
+func restoreFromTrash(ctx context.Context, cfg *config.Config, ref string) error {
+	if cfg.AuditLogPath == "" {
+		return fmt.Errorf("the audit log is disabled, so trashed drafts aren't tracked")
+	}
+	auditLog := audit.Open(cfg.AuditLogPath)
+	trashed, err := auditLog.Trashed(time.Now(), gmail.TrashRetention)
+	if err != nil {
+		return err
+	}
+
+	restore := []*audit.Entry{}
+	for _, e := range trashed {
+		if ref == "all" || e.ID == ref || e.DraftID == ref {
+			restore = append(restore, e)
+		}
+	}
+	if len(restore) == 0 {
+		if ref == "all" {
+			fmt.Println("No trashed drafts to restore")
+			return nil
+		}
+		return fmt.Errorf("no trashed draft matches %s", ref)
+	}
+
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err != nil {
+		return fmt.Errorf("error creating Gmail client: %v", err)
+	}
+
+	for _, e := range restore {
+		err := client.UntrashMessage(ctx, e.MessageID)
+		if errors.Is(err, gmail.ErrNotFound) {
+			if e.ArchivePath != "" {
+				fmt.Printf("Draft %s was already purged, restore it with --from-archive %s\n", e.DraftID, e.ID)
+			} else {
+				fmt.Printf("Draft %s was already purged\n", e.DraftID)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Moved draft %s out of Trash\n", e.DraftID)
+
+		entry := &audit.Entry{
+			Action:    audit.ActionUntrash,
+			DraftID:   e.DraftID,
+			MessageID: e.MessageID,
+			Subject:   e.Subject,
+			To:        e.To,
+		}
+		if err := auditLog.Append(entry); err != nil {
+			return fmt.Errorf("error writing audit log: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// runRestore re-uploads an archived message as a new draft
+func runRestore(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	from := fs.String("from-archive", "", "Archived .eml file, or audit log entry ID or draft ID to restore")
+	fromTrash := fs.String("from-trash", "", "Audit log entry ID or draft ID of a trashed draft to move back, or \"all\"")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if *fromTrash != "" {
+		return restoreFromTrash(ctx, cfg, *fromTrash)
+	}
+	if *from == "" {
+		return fmt.Errorf("restore requires --from-archive <file|id> or --from-trash <id|all>")
+	}
+
+	// Treat the argument as a file first, then as an audit log reference
+	path := *from
+	if _, err := os.Stat(path); err != nil {
+		if cfg.AuditLogPath == "" {
+			return fmt.Errorf("%s is not a file and the audit log is disabled", *from)
+		}
+		entry, err := audit.Open(cfg.AuditLogPath).Find(*from)
+		if err != nil {
+			return err
+		}
+		if entry.ArchivePath == "" {
+			return fmt.Errorf("audit entry %s has no archived message", entry.ID)
+		}
+		path = entry.ArchivePath
+	}
+
+	raw, err := archive.Load(path)
+	if err != nil {
+		return err
+	}
+
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err != nil {
+		return fmt.Errorf("error creating Gmail client: %v", err)
+	}
+
+	draftID, err := client.CreateDraft(ctx, raw)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s as draft %s\n", path, draftID)
+
+	if cfg.AuditLogPath != "" {
+		entry := &audit.Entry{
+			Action:      audit.ActionRestore,
+			DraftID:     draftID,
+			ArchivePath: path,
+		}
+		if err := audit.Open(cfg.AuditLogPath).Append(entry); err != nil {
+			return fmt.Errorf("error writing audit log: %v", err)
+		}
+	}
+
+	return nil
+}
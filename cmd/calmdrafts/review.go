@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/actions"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/quarantine"
+)
+
+// pendingLabel marks drafts waiting in the pending-delete queue in Gmail
+const pendingLabel = "CalmDrafts/Pending deletion"
+
+// pendingQueuePath returns where the pending-delete queue is stored
+func pendingQueuePath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "pending.json")
+}
+
+// usesPendingQueue reports whether drafts wait in the pending-delete queue
+// before they are deleted, for the grace period or until approved
+func usesPendingQueue(cfg *config.Config) bool {
+	return cfg.GracePeriod.Duration > 0 || quarantined(cfg)
+}
+
+// quarantined reports whether queued drafts are only deleted once approved
+// in review, as with pipeline.action quarantine
+func quarantined(cfg *config.Config) bool {
+	return cfg.Pipeline != nil && cfg.Pipeline.Action == "quarantine"
+}
+
+// pendingLabelAction returns the action adding or removing the
+// pending-delete label on a draft
+func pendingLabelAction(kind actions.Kind, draft *gmail.Draft) *actions.Action {
+	return &actions.Action{Kind: kind, DraftID: draft.ID, MessageID: draft.MessageID, Label: pendingLabel}
+}
+
+// approvePending approves every pending deletion the user hasn't rejected,
+// for the Delete now button of the pending notification. The next check
+// deletes them.
+func approvePending(cfg *config.Config) error {
+	queue, err := quarantine.Open(pendingQueuePath(cfg))
+	if err != nil {
+		return err
+	}
+	for _, entry := range queue.Entries() {
+		if entry.Decision != quarantine.DecisionRejected {
+			entry.Decision = quarantine.DecisionApproved
+		}
+	}
+	return queue.Save()
+}
+
+// runReview lets the user approve or reject each pending deletion
+func runReview(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("review", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	list := fs.Bool("list", false, "Only list pending deletions")
+	approve := fs.String("approve", "", "Delete the pending draft with this ID now")
+	reject := fs.String("reject", "", "Keep the pending draft with this ID")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if !usesPendingQueue(cfg) {
+		return fmt.Errorf("neither grace_period nor pipeline.action quarantine is set, so drafts are deleted without a review queue")
+	}
+
+	queue, err := quarantine.Open(pendingQueuePath(cfg))
+	if err != nil {
+		return err
+	}
+
+	pending := []*quarantine.Entry{}
+	for _, entry := range queue.Entries() {
+		if entry.Decision != quarantine.DecisionRejected {
+			pending = append(pending, entry)
+		}
+	}
+
+	now := time.Now()
+	if *list {
+		if len(pending) == 0 {
+			fmt.Println("No drafts pending deletion")
+		}
+		for _, entry := range pending {
+			printPending(entry, cfg, now)
+		}
+		return nil
+	}
+
+	// Without Gmail, decisions are saved and applied by the next check
+	offline := false
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	var drafts []*gmail.Draft
+	if err == nil {
+		drafts, err = client.ListDrafts(ctx)
+	}
+	if err != nil {
+		fmt.Printf("Offline (%v), decisions will be applied at the next check\n", err)
+		offline = true
+	}
+
+	actionQueue, err := openActionQueue(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Drafts edited or deleted since they were queued are no longer pending
+	current := make(map[string]*gmail.Draft, len(drafts))
+	for _, draft := range drafts {
+		current[draft.ID] = draft
+	}
+	draftFor := func(entry *quarantine.Entry) *gmail.Draft {
+		draft, ok := current[entry.DraftID]
+		if !ok || draft.MessageID != entry.MessageID {
+			fmt.Printf("Draft %s changed since it was queued, removing it from the queue\n", entry.DraftID)
+			queue.Remove(entry.DraftID)
+			return nil
+		}
+		return draft
+	}
+
+	decide := func(entry *quarantine.Entry, approved bool) error {
+		if offline {
+			if approved {
+				entry.Decision = quarantine.DecisionApproved
+				fmt.Printf("Draft %s will be deleted at the next check\n", entry.DraftID)
+			} else {
+				entry.Decision = quarantine.DecisionRejected
+				fmt.Printf("Keeping draft %s\n", entry.DraftID)
+			}
+			return nil
+		}
+
+		draft := draftFor(entry)
+		if draft == nil {
+			return nil
+		}
+		if approved {
+			a := &actions.Action{
+				Kind:      actions.KindDelete,
+				DraftID:   draft.ID,
+				MessageID: draft.MessageID,
+				Subject:   draft.Subject,
+				To:        draft.To,
+				Reason:    entry.Reason,
+			}
+			if err := applyAction(ctx, client, cfg, actionQueue, a); err != nil {
+				return err
+			}
+			queue.Remove(entry.DraftID)
+			fmt.Printf("Deleted draft %s\n", entry.DraftID)
+			return nil
+		}
+		entry.Decision = quarantine.DecisionRejected
+		if err := applyAction(ctx, client, cfg, actionQueue, pendingLabelAction(actions.KindUnlabel, draft)); err != nil {
+			return err
+		}
+		entry.Unlabeled = true
+		fmt.Printf("Keeping draft %s\n", entry.DraftID)
+		return nil
+	}
+
+	// Non-interactive decisions
+	if *approve != "" || *reject != "" {
+		decisions := []struct {
+			id       string
+			approved bool
+		}{{*approve, true}, {*reject, false}}
+		for _, d := range decisions {
+			if d.id == "" {
+				continue
+			}
+			entry := queue.Get(d.id)
+			if entry == nil {
+				return fmt.Errorf("draft %s is not pending deletion", d.id)
+			}
+			if err := decide(entry, d.approved); err != nil {
+				return err
+			}
+		}
+		return queue.Save()
+	}
+
+	if len(pending) == 0 {
+		fmt.Println("No drafts pending deletion")
+		return queue.Save()
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for i, entry := range pending {
+		fmt.Printf("\n(%d/%d) ", i+1, len(pending))
+		printPending(entry, cfg, now)
+		fmt.Print("[a]pprove deletion, [r]eject, [s]kip, [q]uit? ")
+
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			break
+		}
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if answer == "q" {
+			break
+		}
+		if answer != "a" && answer != "r" {
+			continue
+		}
+		if err := decide(entry, answer == "a"); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		// Save after every decision so quitting early loses nothing
+		if err := queue.Save(); err != nil {
+			return err
+		}
+	}
+
+	return queue.Save()
+}
+
+// printPending describes a queued draft and when it will be deleted
+func printPending(entry *quarantine.Entry, cfg *config.Config, now time.Time) {
+	subject := entry.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	when := "at the next check"
+	if due := entry.QueuedAt.Add(cfg.GracePeriod.Duration); due.After(now) && entry.Decision == quarantine.DecisionPending {
+		when = "in " + due.Sub(now).Round(time.Minute).String()
+	}
+	if quarantined(cfg) && entry.Decision == quarantine.DecisionPending {
+		when = "once approved"
+	}
+	fmt.Printf("%s  %q  to: %s  reason: %s  deleted %s\n", entry.DraftID, subject, entry.To, entry.Reason, when)
+}
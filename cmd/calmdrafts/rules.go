@@ -0,0 +1,713 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"calmdrafts/internal/classifier"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/engine"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/plugin"
+	"calmdrafts/internal/script"
+	"calmdrafts/internal/workdays"
+)
+
+// verdict is the outcome of evaluating the rules for one draft
+type verdict struct {
+	action plugin.Action // Keep or Delete when a plugin or the script decided
+	rule   string        // Which rule decided
+	reason string        // Why, as recorded in the audit log
+	stale  bool          // Reported as stale instead of being deleted
+	score  float64       // Abandoned-draft score of stale drafts
+	delete bool
+	trace  []string // Every rule and exclusion considered, in order, for --explain and the audit log
+}
+
+// explain adds a step to the decision trace
+func (v *verdict) explain(format string, args ...any) {
+	v.trace = append(v.trace, fmt.Sprintf(format, args...))
+}
+
+// decision returns the verdict as a decision of the engine
+func (v *verdict) decision() *engine.Decision {
+	return &engine.Decision{
+		Rule:   v.rule,
+		Reason: v.reason,
+		Delete: v.delete,
+		Stale:  v.stale,
+		ByRule: v.action == plugin.ActionDelete,
+		Score:  v.score,
+		Trace:  v.trace,
+	}
+}
+
+// ruleNames lists the rules a verdict can come from that accept options in
+// the rules setting
+var ruleNames = []string{"built-in", "client", "orphan", "plugin", "script", "abandoned model"}
+
+// loadRules loads the rule plugins, classification script and
+// abandoned-draft model configured in cfg
+func loadRules(cfg *config.Config) (*plugin.Manager, *script.Script, *classifier.Model, error) {
+	for rule, opts := range cfg.Rules {
+		if !slices.Contains(ruleNames, rule) {
+			return nil, nil, nil, fmt.Errorf("rules: unknown rule %q (available: %s)", rule, strings.Join(ruleNames, ", "))
+		}
+		if opts.Every.Duration > 0 && cfg.StateDir == "" {
+			return nil, nil, nil, fmt.Errorf("rules.%s.every needs state_dir to remember when the rule last ran", rule)
+		}
+	}
+
+	for i, rule := range cfg.Domains {
+		switch {
+		case len(rule.Domains) == 0:
+			return nil, nil, nil, fmt.Errorf("domains[%d] needs domains", i)
+		case rule.Action != "" && rule.Action != string(plugin.ActionKeep):
+			return nil, nil, nil, fmt.Errorf("domains[%d].action must be %q", i, plugin.ActionKeep)
+		case rule.Action == "" && rule.MinAge.Duration == 0:
+			return nil, nil, nil, fmt.Errorf("domains[%d] needs an action or a min_age", i)
+		}
+	}
+
+	for i, rule := range cfg.Clients {
+		if len(rule.Clients) == 0 {
+			return nil, nil, nil, fmt.Errorf("clients[%d] needs clients", i)
+		}
+		for _, client := range rule.Clients {
+			if client != "*" && client != "unknown" && !slices.Contains(gmail.Clients, client) {
+				return nil, nil, nil, fmt.Errorf("clients[%d]: unknown client %q (available: %s, unknown, *)", i, client, strings.Join(gmail.Clients, ", "))
+			}
+		}
+		if rule.Action != string(plugin.ActionKeep) && rule.Action != string(plugin.ActionDelete) {
+			return nil, nil, nil, fmt.Errorf("clients[%d].action must be %q or %q", i, plugin.ActionKeep, plugin.ActionDelete)
+		}
+	}
+
+	if o := cfg.Orphans; o != nil && o.Action != "" && o.Action != string(plugin.ActionDelete) && o.Action != "stale" {
+		return nil, nil, nil, fmt.Errorf("orphans.action must be %q or %q", plugin.ActionDelete, "stale")
+	}
+
+	if err := validatePipeline(cfg); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateJobs(cfg); err != nil {
+		return nil, nil, nil, err
+	}
+
+	plugins, err := plugin.Load(cfg.PluginsDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	calendar, err := businessCalendar(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var rulesScript *script.Script
+	if cfg.ScriptPath != "" {
+		rulesScript, err = script.Load(cfg.ScriptPath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rulesScript.Age = func(created time.Time) time.Duration {
+			return calendar.Age(created, time.Now())
+		}
+	}
+
+	model := classifier.DefaultModel()
+	if cfg.AbandonedModelPath != "" {
+		model, err = classifier.LoadModel(cfg.AbandonedModelPath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return plugins, rulesScript, model, nil
+}
+
+// calendars caches the business-day calendar of each business_days
+// setting, as holiday files are read once
+var (
+	calendarsMu sync.Mutex
+	calendars   = make(map[*config.BusinessDays]*workdays.Calendar)
+)
+
+// businessCalendar returns the calendar draft ages are counted in, or nil
+// when every day counts
+func businessCalendar(cfg *config.Config) (*workdays.Calendar, error) {
+	b := cfg.BusinessDays
+	if b == nil {
+		return nil, nil
+	}
+	calendarsMu.Lock()
+	defer calendarsMu.Unlock()
+	if calendar, ok := calendars[b]; ok {
+		return calendar, nil
+	}
+
+	holidays := b.Holidays
+	if b.HolidaysPath != "" {
+		days, err := workdays.LoadICS(b.HolidaysPath)
+		if err != nil {
+			return nil, fmt.Errorf("business_days.holidays_path: %v", err)
+		}
+		holidays = append(slices.Clone(holidays), days...)
+	}
+	calendar, err := workdays.New(b.Weekend, holidays)
+	if err != nil {
+		return nil, fmt.Errorf("business_days: %v", err)
+	}
+	calendars[b] = calendar
+	return calendar, nil
+}
+
+// draftAge returns how old a draft is, counting only business days when
+// business_days is set
+func draftAge(cfg *config.Config, draft *gmail.Draft, now time.Time) time.Duration {
+	calendar, err := businessCalendar(cfg)
+	if err != nil {
+		log.Printf("Error loading business days: %v", err)
+	}
+	return calendar.Age(draft.InternalDate, now)
+}
+
+// templatePatterns caches the compiled template_pattern settings
+var templatePatterns sync.Map
+
+// isTemplate reports whether a draft's subject matches template_pattern or
+// starts with the template subject prefix
+func isTemplate(cfg *config.Config, draft *gmail.Draft) (bool, error) {
+	if command, _, _ := subjectCommand(cfg, draft.Subject); command == "template" {
+		return true, nil
+	}
+	if cfg.TemplatePattern == "" {
+		return false, nil
+	}
+	pattern, ok := templatePatterns.Load(cfg.TemplatePattern)
+	if !ok {
+		compiled, err := regexp.Compile(cfg.TemplatePattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid template_pattern: %v", err)
+		}
+		pattern, _ = templatePatterns.LoadOrStore(cfg.TemplatePattern, compiled)
+	}
+	return pattern.(*regexp.Regexp).MatchString(draft.Subject), nil
+}
+
+// markTemplates flags the drafts kept as templates, for the reporters that
+// leave them out. The rules check every draft themselves.
+func markTemplates(cfg *config.Config, drafts []*gmail.Draft) error {
+	for _, draft := range drafts {
+		template, err := isTemplate(cfg, draft)
+		if err != nil {
+			return err
+		}
+		draft.IsTemplate = template
+	}
+	return nil
+}
+
+// subjectCommand returns the command a draft's subject starts with: "keep",
+// "template" or "auto-delete" with its age. A malformed auto-delete prefix
+// is returned with an error, and a subject without a command as "".
+func subjectCommand(cfg *config.Config, subject string) (string, time.Duration, error) {
+	p := cfg.SubjectPrefixes
+	if p == nil {
+		return "", 0, nil
+	}
+	subject = strings.ToLower(strings.TrimSpace(subject))
+	prefix := func(value, fallback string) string {
+		if value == "" {
+			value = fallback
+		}
+		return strings.ToLower(value)
+	}
+
+	switch keep, template, autoDelete := prefix(p.Keep, "[keep]"), prefix(p.Template, "[tpl]"), prefix(p.AutoDelete, "[auto-del"); {
+	case strings.HasPrefix(subject, keep):
+		return "keep", 0, nil
+	case strings.HasPrefix(subject, template):
+		return "template", 0, nil
+	case strings.HasPrefix(subject, autoDelete):
+		rest := subject[len(autoDelete):]
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return "auto-delete", 0, fmt.Errorf("no closing ] after %s", autoDelete)
+		}
+		age, err := config.ParseDuration(strings.TrimSpace(rest[:end]))
+		if err != nil {
+			return "auto-delete", 0, err
+		}
+		return "auto-delete", age, nil
+	}
+	return "", 0, nil
+}
+
+// evaluate decides what to do with a draft, leaving drafts younger than the
+// min_age of the deciding rule or of their domain rule alone
+func evaluate(ctx context.Context, draft *gmail.Draft, plugins *plugin.Manager, rulesScript *script.Script, model *classifier.Model, cfg *config.Config, now time.Time) (*verdict, error) {
+	v, err := applyRules(ctx, draft, plugins, rulesScript, model, cfg, now)
+	if err != nil {
+		return nil, err
+	}
+	minAge := cfg.Rules[v.rule].MinAge.Duration
+	if (v.delete || v.stale) && minAge > 0 && draftAge(cfg, draft, now) < minAge {
+		v.delete, v.stale, v.action = false, false, plugin.ActionKeep
+		v.reason = fmt.Sprintf("%s, but newer than rules.%s.min_age", v.reason, v.rule)
+		v.explain("rules.%s.min_age: %s old, younger than %v, keep", v.rule, formatAge(draftAge(cfg, draft, now)), minAge)
+	}
+	if i, domain := matchDomainRule(cfg, draft); i >= 0 && (v.delete || v.stale) {
+		minAge := cfg.Domains[i].MinAge.Duration
+		if age := draftAge(cfg, draft, now); age < minAge {
+			v.delete, v.stale, v.action = false, false, plugin.ActionKeep
+			v.reason = fmt.Sprintf("%s, but newer than domains[%d].min_age for %s", v.reason, i, domain)
+			v.explain("domains[%d].min_age: to %s, %s old, younger than %v, keep", i, domain, formatAge(age), minAge)
+		}
+	}
+	return v, nil
+}
+
+// matchDomainRule returns the index of the first domain rule matching the
+// recipients of a draft, and the domain that matched, or -1
+func matchDomainRule(cfg *config.Config, draft *gmail.Draft) (int, string) {
+	recipients := draft.Recipients()
+	if len(recipients) == 0 {
+		return -1, ""
+	}
+	for i, rule := range cfg.Domains {
+		matched := ""
+		for _, r := range recipients {
+			domain := inDomains(r.Domain(), rule.Domains)
+			if domain == "" && rule.AllRecipients {
+				matched = ""
+				break
+			}
+			if matched == "" {
+				matched = domain
+			}
+		}
+		if matched != "" {
+			return i, matched
+		}
+	}
+	return -1, ""
+}
+
+// inDomains returns the entry of domains that domain is, or is a subdomain
+// of, or ""
+func inDomains(domain string, domains []string) string {
+	if domain == "" {
+		return ""
+	}
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "@"))
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return d
+		}
+	}
+	return ""
+}
+
+// matchClientRule returns the index of the first client rule matching the
+// client that created a draft, or -1
+func matchClientRule(cfg *config.Config, draft *gmail.Draft) int {
+	client := draft.Client
+	if client == "" {
+		client = "unknown"
+	}
+	for i, rule := range cfg.Clients {
+		if slices.Contains(rule.Clients, client) || slices.Contains(rule.Clients, "*") {
+			return i
+		}
+	}
+	return -1
+}
+
+// clientName describes the client of a draft in reasons
+func clientName(draft *gmail.Draft) string {
+	if draft.Client == "" {
+		return "an unknown client"
+	}
+	return draft.Client
+}
+
+// defaultArchivedFor is how long a reply's thread must have been out of the
+// inbox for the reply to count as orphaned, unless orphans.archived_for says
+const defaultArchivedFor = 30 * 24 * time.Hour
+
+// orphanReason describes why a reply draft is orphaned, or returns "" when
+// it isn't
+func orphanReason(cfg *config.Config, draft *gmail.Draft, now time.Time) string {
+	archivedFor := defaultArchivedFor
+	if cfg.Orphans != nil && cfg.Orphans.ArchivedFor.Duration > 0 {
+		archivedFor = cfg.Orphans.ArchivedFor.Duration
+	}
+	switch {
+	case draft.ParentDeleted:
+		return "thread deleted"
+	case draft.ReplyTo != nil && draft.ReplyTo.Archived && now.Sub(draft.ReplyTo.Date) > archivedFor:
+		return "thread archived, last message " + formatAge(now.Sub(draft.ReplyTo.Date)) + " old"
+	}
+	return ""
+}
+
+// applyRules decides what to do with a draft. Templates and drafts matching
+// a domain or client rule with the keep action are always kept, then
+// commands in the subject are obeyed. Otherwise rule plugins are asked
+// first, then the classification script, then the orphan rule, then the
+// abandoned-draft model, and finally the built-in rule deletes empty
+// drafts older than cleanup_age, or than the min_age of their client rule.
+func applyRules(ctx context.Context, draft *gmail.Draft, plugins *plugin.Manager, rulesScript *script.Script, model *classifier.Model, cfg *config.Config, now time.Time) (*verdict, error) {
+	v := &verdict{}
+	age := draftAge(cfg, draft, now)
+	scoredAt := draft.InternalDate.Add(age) // When the model sees the draft as age old
+
+	// Templates are kept whatever the other rules say, even if no caller
+	// marked them
+	template, err := isTemplate(cfg, draft)
+	if err != nil {
+		return nil, err
+	}
+	if draft.IsTemplate || template {
+		v.action, v.rule, v.reason = plugin.ActionKeep, "template", "template"
+		v.explain("template: subject matches template_pattern or the template prefix, keep")
+		return v, nil
+	}
+
+	// So are drafts to domains that must never be touched
+	if i, domain := matchDomainRule(cfg, draft); i >= 0 && cfg.Domains[i].Action == string(plugin.ActionKeep) {
+		v.action, v.rule, v.reason = plugin.ActionKeep, "domain", "to "+domain
+		v.explain("domains[%d]: to %s, keep", i, domain)
+		return v, nil
+	}
+
+	// And drafts from clients whose drafts are to be kept
+	clientRule := matchClientRule(cfg, draft)
+	if clientRule >= 0 && cfg.Clients[clientRule].Action == string(plugin.ActionKeep) {
+		v.action, v.rule, v.reason = plugin.ActionKeep, "client", "created by "+clientName(draft)
+		v.explain("clients[%d]: created by %s, keep", clientRule, clientName(draft))
+		return v, nil
+	}
+
+	// As are drafts kept with the triage report's keep link
+	if draft.IsKept {
+		v.action, v.rule, v.reason = plugin.ActionKeep, "report", "kept from the report"
+		v.explain("report: kept with the keep link, keep")
+		return v, nil
+	}
+
+	// Commands typed in the subject come next, as the user asked for them
+	switch command, deleteAge, err := subjectCommand(cfg, draft.Subject); {
+	case err != nil:
+		v.explain("subject prefix: %s %v, ignored", command, err)
+	case command == "keep":
+		v.action, v.rule, v.reason = plugin.ActionKeep, "subject prefix", "keep prefix"
+		v.explain("subject prefix: keep")
+		return v, nil
+	case command == "auto-delete":
+		v.rule = "subject prefix"
+		if age > deleteAge {
+			v.action, v.delete, v.reason = plugin.ActionDelete, true, "auto-delete prefix"
+			v.explain("subject prefix: auto-delete after %v, %s old, delete", deleteAge, formatAge(age))
+		} else {
+			v.action, v.reason = plugin.ActionKeep, "auto-delete prefix, not due yet"
+			v.explain("subject prefix: auto-delete after %v, %s old, keep", deleteAge, formatAge(age))
+		}
+		return v, nil
+	}
+
+	action, reason, err := plugins.Decide(ctx, draft)
+	if err != nil {
+		return nil, fmt.Errorf("rule plugins failed for draft %s: %v", draft.ID, err)
+	}
+	if action != plugin.ActionNone {
+		v.action, v.rule, v.reason = action, "plugin", reason
+		v.explain("plugin: %s (%s)", action, reason)
+	} else if len(plugins.Plugins(plugin.KindRule)) > 0 {
+		v.explain("plugin: no decision")
+	}
+
+	// Fall back to the classification script when no plugin decided
+	if v.action == plugin.ActionNone && rulesScript != nil {
+		result, err := rulesScript.Classify(draft)
+		if err != nil {
+			return nil, fmt.Errorf("script failed for draft %s: %v", draft.ID, err)
+		}
+		switch result {
+		case script.VerdictKeep:
+			v.action, v.rule, v.reason = plugin.ActionKeep, "script", "script"
+		case script.VerdictDelete:
+			v.action, v.rule, v.reason = plugin.ActionDelete, "script", "script"
+		case script.VerdictStale:
+			v.stale, v.rule, v.reason = true, "script", "script"
+			v.score = model.Score(draft, scoredAt)
+			v.explain("script: stale")
+			return v, nil
+		}
+		if result == script.VerdictNone {
+			v.explain("script: no decision")
+		} else {
+			v.explain("script: %s", result)
+		}
+	}
+
+	// Replies whose thread is gone are almost always abandoned
+	if v.action == plugin.ActionNone && cfg.Orphans != nil {
+		if why := orphanReason(cfg, draft, now); why != "" {
+			v.rule, v.reason = "orphan", "orphaned reply, "+why
+			if cfg.Orphans.Action == "stale" {
+				v.stale, v.score = true, model.Score(draft, scoredAt)
+				v.explain("orphan: %s, stale", why)
+				return v, nil
+			}
+			v.action = plugin.ActionDelete
+			v.explain("orphan: %s, delete", why)
+		}
+	}
+
+	// Report non-empty drafts the model considers abandoned
+	if v.action == plugin.ActionNone && !draft.IsEmpty && cfg.AbandonedThreshold > 0 {
+		score := model.Score(draft, scoredAt)
+		if score >= cfg.AbandonedThreshold {
+			v.stale, v.score, v.rule = true, score, "abandoned model"
+			v.reason = fmt.Sprintf("score %.2f >= abandoned_threshold %.2f", score, cfg.AbandonedThreshold)
+			v.explain("abandoned model: %s, stale", v.reason)
+			return v, nil
+		}
+		v.explain("abandoned model: score %.2f < abandoned_threshold %.2f", score, cfg.AbandonedThreshold)
+	}
+
+	switch v.action {
+	case plugin.ActionKeep:
+		v.delete = false
+	case plugin.ActionDelete:
+		v.delete = true
+	default:
+		v.rule = "built-in"
+		cleanupAge, setting := cfg.CleanupAge.Duration, "cleanup_age"
+		if minAge := cfg.Rules[v.rule].MinAge.Duration; minAge > 0 {
+			cleanupAge, setting = minAge, "rules.built-in.min_age"
+		}
+		// A client rule replaces the age for the empty drafts of its clients
+		if clientRule >= 0 && cfg.Clients[clientRule].Action == string(plugin.ActionDelete) {
+			v.rule = "client"
+			if minAge := cfg.Clients[clientRule].MinAge.Duration; minAge > 0 {
+				cleanupAge, setting = minAge, fmt.Sprintf("clients[%d].min_age", clientRule)
+			}
+		}
+		v.delete = draft.IsEmpty && age > cleanupAge
+		switch {
+		case v.delete:
+			v.reason = "empty"
+			v.explain("%s: empty and %s old, over %s %v, delete", v.rule, formatAge(age), setting, cleanupAge)
+		case draft.IsEmpty:
+			v.reason = "empty, but newer than " + setting
+			v.explain("%s: empty but %s old, under %s %v, keep", v.rule, formatAge(age), setting, cleanupAge)
+		default:
+			v.reason = "not empty"
+			v.explain("%s: not empty, keep", v.rule)
+		}
+		if v.rule == "client" {
+			v.reason += ", created by " + clientName(draft)
+		}
+	}
+
+	return v, nil
+}
+
+// ruleRunsPath returns where the last run of each scheduled rule is stored
+func ruleRunsPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "rules.json")
+}
+
+// loadRuleRuns returns when each rule with an every option last acted
+func loadRuleRuns(cfg *config.Config) (map[string]time.Time, error) {
+	runs := make(map[string]time.Time)
+	data, err := os.ReadFile(ruleRunsPath(cfg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return runs, nil
+		}
+		return nil, fmt.Errorf("unable to read rule runs: %v", err)
+	}
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("unable to parse rule runs: %v", err)
+	}
+	return runs, nil
+}
+
+// dueRules returns the rules with an every option that may act in this
+// check, and records that they did. Rules without one are always due.
+func dueRules(cfg *config.Config, now time.Time) (map[string]bool, error) {
+	scheduled := false
+	for _, opts := range cfg.Rules {
+		scheduled = scheduled || opts.Every.Duration > 0
+	}
+	runs := map[string]time.Time{}
+	if scheduled {
+		var err error
+		if runs, err = loadRuleRuns(cfg); err != nil {
+			return nil, err
+		}
+	}
+	due := rulesDue(cfg, runs, now)
+	if !scheduled || cfg.DryRun {
+		return due, nil
+	}
+
+	data, err := json.Marshal(runs)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create state directory: %v", err)
+	}
+	if err := os.WriteFile(ruleRunsPath(cfg), data, 0600); err != nil {
+		return nil, fmt.Errorf("unable to write rule runs: %v", err)
+	}
+	return due, nil
+}
+
+// rulesDue returns which rules may act at now, given when each rule with an
+// every option last ran, and records in runs the ones that do
+func rulesDue(cfg *config.Config, runs map[string]time.Time, now time.Time) map[string]bool {
+	due := make(map[string]bool, len(ruleNames))
+	for _, rule := range ruleNames {
+		due[rule] = true
+	}
+	for rule, opts := range cfg.Rules {
+		if opts.Every.Duration <= 0 {
+			continue
+		}
+		// A little slack keeps a rule due every 1w from slipping by one
+		// check interval each week
+		if last, ok := runs[rule]; ok && now.Sub(last) < opts.Every.Duration-time.Minute {
+			due[rule] = false
+			continue
+		}
+		runs[rule] = now
+	}
+	return due
+}
+
+// runRules dispatches the rules subcommands
+func runRules(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		return fmt.Errorf("usage: calmdrafts rules test [--fixture drafts.json]")
+	}
+
+	fs := flag.NewFlagSet("rules test", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	fixture := fs.String("fixture", "", "JSON file of drafts, in the plugin draft format, to test instead of the mailbox")
+	fs.Parse(args[1:])
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	plugins, rulesScript, model, err := loadRules(cfg)
+	if err != nil {
+		return err
+	}
+
+	var drafts []*gmail.Draft
+	if *fixture != "" {
+		drafts, err = loadDraftFixture(*fixture)
+	} else {
+		var client *gmail.Client
+		client, err = gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+		if err != nil {
+			return fmt.Errorf("error creating Gmail client: %v", err)
+		}
+		drafts, err = client.ListDrafts(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := markTemplates(cfg, drafts); err != nil {
+		return err
+	}
+	if *fixture == "" {
+		if err := markKept(cfg, drafts); err != nil {
+			return err
+		}
+		countEdits(cfg, drafts)
+	}
+
+	// Nothing is changed, so every draft is shown with the rule that matched
+	now := time.Now()
+	for _, draft := range drafts {
+		if empty, ok, err := plugins.Classify(ctx, draft); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running classifier plugins for draft %s: %v\n", draft.ID, err)
+		} else if ok {
+			draft.IsEmpty = empty
+		}
+
+		subject := draft.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		v, err := evaluate(ctx, draft, plugins, rulesScript, model, cfg, now)
+		if err != nil {
+			fmt.Printf("%s  %q  error: %v\n", draft.ID, subject, err)
+			continue
+		}
+
+		outcome := "keep"
+		switch {
+		case v.stale:
+			outcome = fmt.Sprintf("stale (score %.2f)", v.score)
+		case v.delete:
+			outcome = "delete"
+		}
+		fmt.Printf("%s  %q  -> %s  rule: %s  reason: %s\n", draft.ID, subject, outcome, v.rule, v.reason)
+	}
+
+	return nil
+}
+
+// loadDraftFixture reads drafts from a JSON array in the plugin draft format
+func loadDraftFixture(path string) ([]*gmail.Draft, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []*plugin.DraftInfo{}
+	if err := json.Unmarshal(data, &infos); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+
+	drafts := make([]*gmail.Draft, 0, len(infos))
+	for _, d := range infos {
+		drafts = append(drafts, &gmail.Draft{
+			ID:            d.ID,
+			MessageID:     d.MessageID,
+			Subject:       d.Subject,
+			To:            d.To,
+			ToAddresses:   d.ToAddresses,
+			Cc:            d.Cc,
+			Bcc:           d.Bcc,
+			InternalDate:  d.InternalDate,
+			IsEmpty:       d.IsEmpty,
+			IsReply:       d.IsReply,
+			BodyLength:    d.BodyLength,
+			Labels:        d.Labels,
+			Client:        d.Client,
+			ReplyTo:       d.ReplyTo,
+			ParentDeleted: d.ParentDeleted,
+		})
+	}
+	return drafts, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/runs"
+)
+
+// runsPath returns where the results of checks are recorded
+func runsPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "runs.jsonl")
+}
+
+// weeklyCalls returns the API calls the checks of the past week made and
+// how many failed, or nil without a run history
+func weeklyCalls(cfg *config.Config, now time.Time) (*runs.CallStats, error) {
+	if cfg.StateDir == "" {
+		return nil, nil
+	}
+	results, err := runs.OpenHistory(runsPath(cfg)).Results()
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	return runs.Calls(results, now.Add(-7*24*time.Hour)), nil
+}
+
+// reportDeletions prints and notifies what a check deleted. However many
+// deletions failed there is one notification, and the action queue
+// retries them.
+func reportDeletions(notif *notifier.Notifier, result *runs.Result, retry bool) {
+	c := result.Counts
+	if result.DryRun {
+		if c.Deleted > 0 {
+			fmt.Printf("Dry run: would have deleted %d draft(s)\n", c.Deleted)
+		}
+		return
+	}
+	if c.Deleted == 0 && c.Failed == 0 {
+		return
+	}
+	fmt.Printf("Deleted %d old empty draft(s)\n", c.Deleted)
+	if c.Failed > 0 {
+		fmt.Printf("%d deletion(s) failed: %s\n", c.Failed, strings.Join(result.Causes, ", "))
+	}
+	if err := notif.NotifyCleanupFailures(c.Deleted, c.Failed, result.Causes, retry); err != nil {
+		result.Logf("Error sending cleanup notification: %v", err)
+	}
+}
+
+// finishRun completes the result of a check, failed or not, records it in
+// the run history and sends it to webhooks
+func finishRun(cfg *config.Config, notif *notifier.Notifier, result *runs.Result, err error) {
+	result.Finish(err)
+	fmt.Printf("Run %s finished in %v\n", result.ID, result.Duration())
+	if cfg.StateDir != "" {
+		if err := runs.OpenHistory(runsPath(cfg)).Append(result); err != nil {
+			log.Printf("Error recording run: %v", err)
+		}
+	}
+	if err := notif.NotifyRun(result); err != nil {
+		log.Printf("Error sending run result: %v", err)
+	}
+	if err == nil {
+		recoverError(cfg, notif)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/runs"
+)
+
+// runRuns lists recent checks from the run history, or shows one in full
+func runRuns(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) > 0 && args[0] == "show" {
+		return runRunsShow(cfg, args[1:])
+	}
+
+	fs := flag.NewFlagSet("runs", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	limit := fs.Int("limit", 20, "Show at most this many runs, most recent last; 0 shows all")
+	failed := fs.Bool("failed", false, "Only show runs that failed or logged errors")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so no runs are recorded")
+	}
+
+	results, err := runs.OpenHistory(runsPath(cfg)).Results()
+	if err != nil {
+		return err
+	}
+	shown := []*runs.Result{}
+	for _, r := range results {
+		if *failed && r.Error == "" && len(r.Errors) == 0 {
+			continue
+		}
+		shown = append(shown, r)
+	}
+	if *limit > 0 && len(shown) > *limit {
+		shown = shown[len(shown)-*limit:]
+	}
+	if len(shown) == 0 {
+		fmt.Println("No runs recorded")
+		return nil
+	}
+
+	if !cfg.Accessible {
+		fmt.Printf("%-16s  %-8s  %8s  %6s  %-28s  %s\n", "Started", "Run", "Took", "Drafts", "Actions", "Errors")
+	}
+	for _, r := range shown {
+		started := r.Started.Local().Format("2006-01-02 15:04")
+		if cfg.Accessible {
+			fmt.Printf("Run %s, %s, took %v: %d draft(s), %s. %s.\n", r.ID, started, r.Duration(), r.Counts.Drafts, runActions(r), runErrors(r))
+			continue
+		}
+		fmt.Printf("%-16s  %-8s  %8v  %6d  %-28s  %s\n", started, r.ID, r.Duration(), r.Counts.Drafts, runActions(r), truncate(runErrors(r), 60))
+	}
+	return nil
+}
+
+// runRunsShow prints everything recorded about one run, with the decision
+// trace of every draft it acted on
+func runRunsShow(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("runs show", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	asJSON := fs.Bool("json", false, "Print the run as recorded, in JSON")
+
+	// Accept the run ID before or after the flags
+	id := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		id, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+	if id == "" {
+		id = fs.Arg(0)
+	}
+	if id == "" {
+		return fmt.Errorf("usage: calmdrafts runs show <run-id> [--json]")
+	}
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so no runs are recorded")
+	}
+
+	r, err := runs.OpenHistory(runsPath(cfg)).Find(id)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	fmt.Printf("Run %s\n", r.ID)
+	if r.Account != "" {
+		fmt.Printf("Account:  %s\n", r.Account)
+	}
+	fmt.Printf("Started:  %s\n", r.Started.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("Took:     %v\n", r.Duration())
+	if r.DryRun {
+		fmt.Println("Dry run:  nothing was changed")
+	}
+	c := r.Counts
+	fmt.Printf("Drafts:   %d, %d empty, %d stale, %d pending\n", c.Drafts, c.Empty, c.Stale, c.Pending)
+	fmt.Printf("Actions:  %s\n", runActions(r))
+	if len(r.Causes) > 0 {
+		fmt.Printf("Causes:   %s\n", strings.Join(r.Causes, ", "))
+	}
+	if names := r.RuleNames(); len(names) > 0 {
+		rules := make([]string, len(names))
+		for i, name := range names {
+			rules[i] = fmt.Sprintf("%s (%d)", name, r.Rules[name])
+		}
+		fmt.Printf("Rules:    %s\n", strings.Join(rules, ", "))
+	}
+	if len(r.Stages) > 0 {
+		fmt.Println("Stages:")
+		for _, stage := range r.Stages {
+			line := fmt.Sprintf("  %-9s %8v  %s", stage.Name, time.Duration(stage.DurationMS)*time.Millisecond, stageCalls(stage))
+			fmt.Println(strings.TrimRight(line, " "))
+		}
+	}
+	if r.Error != "" {
+		fmt.Printf("Failed:   %s\n", r.Error)
+	}
+	if len(r.Errors) > 0 {
+		fmt.Println("Errors:")
+		for _, e := range r.Errors {
+			fmt.Printf("  %s\n", e)
+		}
+	}
+
+	for _, a := range r.Actions {
+		subject := a.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		fmt.Printf("\nDraft %s  %q\n", a.DraftID, subject)
+		for _, step := range a.Trace {
+			fmt.Printf("  %s\n", step)
+		}
+		outcome := a.Outcome
+		if a.Reason != "" {
+			outcome += ": " + a.Reason
+		}
+		fmt.Printf("  => %s\n", outcome)
+		if a.Error != "" {
+			fmt.Printf("  Error: %s\n", a.Error)
+		}
+	}
+	return nil
+}
+
+// runActions summarizes what a run did with the drafts, e.g. "4 deleted,
+// 1 failed"
+func runActions(r *runs.Result) string {
+	c := r.Counts
+	deleted := "deleted"
+	if r.DryRun {
+		deleted = "would delete"
+	}
+	parts := []string{}
+	for _, n := range []struct {
+		count int
+		label string
+	}{{c.Deleted, deleted}, {c.Queued, "queued"}, {c.Failed, "failed"}, {c.Retried, "retried"}} {
+		if n.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n.count, n.label))
+		}
+	}
+	if len(parts) == 0 {
+		return "no actions"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runErrors describes what went wrong in a run: why it failed, or how many
+// errors it logged
+func runErrors(r *runs.Result) string {
+	switch {
+	case r.Error != "":
+		return "FAILED: " + r.Error
+	case len(r.Errors) > 0:
+		return fmt.Sprintf("%d error(s)", len(r.Errors))
+	}
+	return "no errors"
+}
+
+// stageCalls describes the API calls of a stage, e.g. "6 call(s), 1 failed
+// (500)"
+func stageCalls(stage *runs.Stage) string {
+	if stage.Calls == 0 {
+		return ""
+	}
+	if len(stage.Failed) == 0 {
+		return fmt.Sprintf("%d call(s)", stage.Calls)
+	}
+	failed := 0
+	causes := make([]string, 0, len(stage.Failed))
+	for cause, n := range stage.Failed {
+		failed += n
+		causes = append(causes, cause)
+	}
+	sort.Strings(causes)
+	return fmt.Sprintf("%d call(s), %d failed (%s)", stage.Calls, failed, strings.Join(causes, ", "))
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"calmdrafts/internal/cache"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/power"
+)
+
+// deferRetry is how soon a check put off to save battery or data is tried
+// again, unless checks are more frequent anyway
+const deferRetry = 15 * time.Minute
+
+// interval decides how long the daemon waits between checks
+type interval struct {
+	fixed    time.Duration
+	adaptive bool
+	align    bool
+	min, max time.Duration
+	current  time.Duration
+}
+
+// newInterval returns the check interval of a config
+func newInterval(cfg *config.Config) (*interval, error) {
+	i := &interval{fixed: cfg.CheckInterval.Duration}
+	s := cfg.Schedule
+	if s == nil {
+		return i, nil
+	}
+	i.align = s.Align
+	if (s.MinBattery > 0 || s.SkipMetered) && cfg.StateDir == "" {
+		return nil, fmt.Errorf("schedule.min_battery and schedule.skip_metered need state_dir to track put-off checks")
+	}
+	if !s.Adaptive {
+		return i, nil
+	}
+	if cfg.StateDir == "" {
+		return nil, fmt.Errorf("schedule.adaptive needs state_dir to notice draft changes")
+	}
+	i.adaptive = true
+	i.min, i.max = 5*time.Minute, 4*time.Hour
+	if s.MinInterval.Duration > 0 {
+		i.min = s.MinInterval.Duration
+	}
+	if s.MaxInterval.Duration > 0 {
+		i.max = s.MaxInterval.Duration
+	}
+	if i.min > i.max {
+		return nil, fmt.Errorf("schedule.min_interval (%v) is longer than schedule.max_interval (%v)", i.min, i.max)
+	}
+	return i, nil
+}
+
+// String describes the interval for the startup message
+func (i *interval) String() string {
+	text := i.fixed.String()
+	if i.adaptive {
+		text = fmt.Sprintf("%v to %v depending on activity", i.min, i.max)
+	}
+	if i.align {
+		text += ", aligned to the clock"
+	}
+	return text
+}
+
+// next returns the wait until the next check. An adaptive interval starts
+// over at its minimum when drafts changed, and doubles otherwise.
+func (i *interval) next(changed bool) time.Duration {
+	if !i.adaptive {
+		return i.fixed
+	}
+	if changed || i.current == 0 {
+		i.current = i.min
+	} else {
+		i.current = min(2*i.current, i.max)
+	}
+	return i.current
+}
+
+// due returns when to check next, about wait after the check due at prev.
+// Aligned checks are due at the next multiple of wait since midnight. Others
+// are due wait after prev, so slow checks don't push the schedule back,
+// unless that time already passed, e.g. during sleep. The time has no
+// monotonic reading, so it is compared with the wall clock, which keeps
+// running while the computer sleeps.
+func (i *interval) due(prev, now time.Time, wait time.Duration) time.Time {
+	now = now.Round(0)
+	if !i.align {
+		if next := prev.Round(0).Add(wait); next.After(now) {
+			return next
+		}
+		return now.Add(wait)
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return midnight.Add((now.Sub(midnight)/wait + 1) * wait)
+}
+
+// retry returns the wait before trying a put-off check again
+func (i *interval) retry() time.Duration {
+	if i.adaptive {
+		return min(deferRetry, i.min)
+	}
+	return min(deferRetry, i.fixed)
+}
+
+// draftsFingerprint identifies the drafts and their versions seen by the
+// last check, so the daemon can tell whether anything changed since the
+// check before. It is empty when nothing is cached.
+func draftsFingerprint(cfg *config.Config) string {
+	snap, err := cache.Load(draftCachePath(cfg))
+	if err != nil {
+		return ""
+	}
+	versions := make([]string, len(snap.Drafts))
+	for i, d := range snap.Drafts {
+		versions[i] = d.ID + ":" + d.MessageID
+	}
+	sort.Strings(versions)
+	h := sha256.New()
+	for _, v := range versions {
+		h.Write([]byte(v + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// deferral records checks put off to save battery or data
+type deferral struct {
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason"`
+}
+
+// deferralPath returns where put-off checks are recorded
+func deferralPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "deferral.json")
+}
+
+// loadDeferral returns the recorded deferral, or nil when checks aren't
+// being put off
+func loadDeferral(cfg *config.Config) (*deferral, error) {
+	data, err := os.ReadFile(deferralPath(cfg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read deferral: %v", err)
+	}
+	d := &deferral{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, fmt.Errorf("unable to parse deferral: %v", err)
+	}
+	return d, nil
+}
+
+// deferCheck decides whether to put off a check because the battery is low
+// or the connection metered, recording the deferral for status. It returns
+// why the check is put off, or "" to check now. Checks put off for longer
+// than schedule.max_deferral run anyway.
+func deferCheck(cfg *config.Config, now time.Time) string {
+	s := cfg.Schedule
+	if s == nil || (s.MinBattery <= 0 && !s.SkipMetered) {
+		return ""
+	}
+
+	reason := ""
+	if s.MinBattery > 0 {
+		battery, err := power.ReadBattery()
+		if err != nil {
+			log.Printf("Error reading battery state: %v", err)
+		} else if battery != nil && battery.Discharging && battery.Percent >= 0 && battery.Percent < s.MinBattery {
+			reason = fmt.Sprintf("on battery at %d%%", battery.Percent)
+		}
+	}
+	if reason == "" && s.SkipMetered {
+		metered, err := power.Metered()
+		if err != nil {
+			log.Printf("Error detecting a metered connection: %v", err)
+		} else if metered {
+			reason = "on a metered connection"
+		}
+	}
+
+	d, err := loadDeferral(cfg)
+	if err != nil {
+		log.Printf("Error loading deferral: %v", err)
+	}
+	if reason == "" {
+		if d != nil {
+			os.Remove(deferralPath(cfg))
+		}
+		return ""
+	}
+	if d == nil {
+		d = &deferral{Since: now}
+	}
+	maxDeferral := 24 * time.Hour
+	if s.MaxDeferral.Duration > 0 {
+		maxDeferral = s.MaxDeferral.Duration
+	}
+	if now.Sub(d.Since) >= maxDeferral {
+		fmt.Printf("Checking although %s: checks were put off for %v\n", reason, now.Sub(d.Since).Round(time.Minute))
+		os.Remove(deferralPath(cfg))
+		return ""
+	}
+
+	d.Reason = reason
+	data, err := json.Marshal(d)
+	if err == nil {
+		err = os.MkdirAll(cfg.StateDir, 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(deferralPath(cfg), data, 0600)
+	}
+	if err != nil {
+		log.Printf("Error recording deferral: %v", err)
+	}
+	fmt.Printf("[%s] Putting off the check: %s\n", now.Format("2006-01-02 15:04:05"), reason)
+	return reason
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+)
+
+// runSearch finds drafts with a Gmail search query, narrowed down by local
+// filters that Gmail's syntax can't express
+func runSearch(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	var olderThan, newerThan time.Duration
+	fs.Func("older-than", "Only drafts older than this (e.g. 7d)", durationFlag(&olderThan))
+	fs.Func("newer-than", "Only drafts newer than this (e.g. 12h)", durationFlag(&newerThan))
+	emptyOnly := fs.Bool("empty", false, "Only empty drafts")
+	nonEmptyOnly := fs.Bool("non-empty", false, "Only drafts with content")
+	asJSON := fs.Bool("json", false, "Print matches as JSON")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if *emptyOnly && *nonEmptyOnly {
+		return fmt.Errorf("--empty and --non-empty can't be combined")
+	}
+	query := strings.Join(fs.Args(), " ")
+	if query == "" && olderThan == 0 && newerThan == 0 && !*emptyOnly && !*nonEmptyOnly {
+		return fmt.Errorf("usage: calmdrafts search [flags] \"<gmail query>\"")
+	}
+
+	client, err := gmail.NewClient(ctx, cfg.CredentialsPath, cfg.TokenPath, gmailOptions(cfg))
+	if err != nil {
+		return fmt.Errorf("error creating Gmail client: %v", err)
+	}
+	drafts, err := client.SearchDrafts(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	matches := []*gmail.Draft{}
+	for _, d := range drafts {
+		age := now.Sub(d.InternalDate)
+		switch {
+		case olderThan > 0 && age < olderThan:
+		case newerThan > 0 && age >= newerThan:
+		case *emptyOnly && !d.IsEmpty:
+		case *nonEmptyOnly && d.IsEmpty:
+		default:
+			matches = append(matches, d)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].InternalDate.Before(matches[j].InternalDate)
+	})
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(matches)
+	}
+	printDrafts(matches, now, cfg.Accessible)
+	return nil
+}
+
+// durationFlag parses a flag value with config.ParseDuration, which also
+// accepts days and weeks
+func durationFlag(d *time.Duration) func(string) error {
+	return func(s string) error {
+		v, err := config.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = v
+		return nil
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"calmdrafts/internal/auth"
+	"calmdrafts/internal/classifier"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/jobs"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/plugin"
+	"calmdrafts/internal/script"
+	"calmdrafts/internal/stats"
+	"calmdrafts/internal/tenant"
+)
+
+// oauthStateTTL is how long a consent flow may take before its state expires
+const oauthStateTTL = 10 * time.Minute
+
+// server onboards tenants and exposes their settings and reports
+type server struct {
+	cfg   *config.Config
+	store *tenant.Store
+	oauth *oauth2.Config
+	auth  *auth.Authenticator
+
+	mu     sync.Mutex
+	states map[string]time.Time // Pending consent flows and when they started
+
+	jobs *jobs.Scheduler
+}
+
+// runServe hosts CalmDrafts for every tenant who connected their mailbox
+func runServe(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	newToken := fs.Bool("new-token", false, "Print a new API token and the sha256 to add to server.auth.tokens, then exit")
+	readOnly := fs.Bool("read-only", false, "Serve only the endpoints that don't change anything, like server.read_only")
+	fs.Parse(args)
+	if err := flagOverrides.applyAny(cfg); err != nil {
+		return err
+	}
+
+	if *newToken {
+		token, hash, err := auth.NewToken()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Token:  %s\nSHA256: %s\n", token, hash)
+		return nil
+	}
+
+	if cfg.Server == nil || cfg.Server.BaseURL == "" {
+		return fmt.Errorf("server.base_url is not set")
+	}
+	// Tokens and their key live in DataDir, apart from each other, never in
+	// whatever directory the server happens to be started from
+	dir, keyPath, listen := cfg.Server.Dir, cfg.Server.KeyPath, cfg.Server.Listen
+	if dir == "" {
+		dir = filepath.Join(config.DataDir(), "tenants")
+	}
+	if keyPath == "" {
+		keyPath = filepath.Join(config.DataDir(), "tenant.key")
+	}
+	if listen == "" {
+		listen = "127.0.0.1:8090"
+	}
+
+	store, err := tenant.Open(dir, keyPath)
+	if err != nil {
+		return err
+	}
+	oauthConfig, err := gmail.OAuthConfig(cfg.CredentialsPath, strings.TrimSuffix(cfg.Server.BaseURL, "/")+"/oauth/callback", gmailOptions(cfg).Scopes)
+	if err != nil {
+		return err
+	}
+	authenticator, err := newAuthenticator(cfg.Server.Auth)
+	if err != nil {
+		return err
+	}
+	if !authenticator.Enabled() {
+		fmt.Println("No API credentials in server.auth, the API will refuse every request")
+	}
+	s := &server{cfg: cfg, store: store, oauth: oauthConfig, auth: authenticator, states: make(map[string]time.Time)}
+
+	plugins, rulesScript, model, err := loadRules(cfg)
+	if err != nil {
+		return fmt.Errorf("error loading rules: %v", err)
+	}
+	notif, err := newNotifier(cfg, plugins, false)
+	if err != nil {
+		return err
+	}
+
+	// Tenants are checked by a job, whose schedule is kept with them
+	s.jobs = jobs.New(filepath.Join(dir, "jobs.json"))
+	s.jobs.SkipMissed = cfg.Schedule != nil && cfg.Schedule.SkipMissed
+	s.jobs.Add(&jobs.Job{
+		Name: "tenants",
+		Run: func(ctx context.Context) error {
+			s.checkTenants(ctx, notif, plugins, rulesScript, model)
+			return nil
+		},
+		Next: jobs.Every(cfg.CheckInterval.Duration),
+	}, time.Now())
+
+	httpServers := []*http.Server{listenHTTP(listen, s.routes(*readOnly || cfg.Server.ReadOnly))}
+	if cfg.Server.DashboardListen != "" {
+		httpServers = append(httpServers, listenHTTP(cfg.Server.DashboardListen, s.dashboardRoutes()))
+		fmt.Printf("Read-only API on %s\n", cfg.Server.DashboardListen)
+	}
+	fmt.Printf("%s serving tenants on %s. Checking drafts every %v\n", appName, listen, cfg.CheckInterval)
+
+	sigChan := make(chan os.Signal, 1)
+	defer handleShutdown(sigChan)()
+
+	if err := s.jobs.Start(ctx); err != nil {
+		return err
+	}
+	defer s.jobs.Stop()
+	sig := <-sigChan
+	fmt.Printf("\nReceived signal %v, shutting down gracefully...\n", sig)
+	shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	for _, httpServer := range httpServers {
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listenHTTP serves handler on addr in the background
+func listenHTTP(addr string, handler http.Handler) *http.Server {
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server stopped: %v", err)
+		}
+	}()
+	return httpServer
+}
+
+// routes returns the onboarding pages and the REST API. A read-only server
+// leaves out the endpoints that change settings or remove tenants.
+func (s *server) routes(readOnly bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /oauth/start", s.handleOAuthStart)
+	mux.HandleFunc("GET /oauth/callback", s.handleOAuthCallback)
+	s.readRoutes(mux)
+	if !readOnly {
+		mux.HandleFunc("PUT /api/tenants/{email}/settings", s.auth.Require(auth.RoleAdmin, s.handlePutSettings))
+		mux.HandleFunc("DELETE /api/tenants/{email}", s.auth.Require(auth.RoleAdmin, s.handleDeleteTenant))
+	}
+	return mux
+}
+
+// dashboardRoutes returns only the read-only API, for the dashboard address
+func (s *server) dashboardRoutes() http.Handler {
+	mux := http.NewServeMux()
+	s.readRoutes(mux)
+	return mux
+}
+
+// readRoutes adds the API endpoints that don't change anything
+func (s *server) readRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/tenants", s.auth.Require(auth.RoleRead, s.handleListTenants))
+	mux.HandleFunc("GET /api/tenants/{email}", s.auth.Require(auth.RoleRead, s.handleGetTenant))
+	mux.HandleFunc("GET /api/tenants/{email}/report", s.auth.Require(auth.RoleRead, s.handleReport))
+	mux.HandleFunc("GET /api/tenants/{email}/stats", s.auth.Require(auth.RoleRead, s.handleStats))
+	mux.HandleFunc("GET /api/jobs", s.auth.Require(auth.RoleRead, s.handleJobs))
+}
+
+// newAuthenticator converts the configured API credentials
+func newAuthenticator(cfg *config.ServerAuth) (*auth.Authenticator, error) {
+	a := &auth.Authenticator{Members: make(map[string]auth.Role)}
+	if cfg == nil {
+		return a, nil
+	}
+	for _, t := range cfg.Tokens {
+		role, err := auth.ParseRole(t.Role)
+		if err != nil {
+			return nil, fmt.Errorf("token %q: %v", t.Name, err)
+		}
+		if len(t.SHA256) != 64 {
+			return nil, fmt.Errorf("token %q: sha256 must be 64 hex characters", t.Name)
+		}
+		a.Tokens = append(a.Tokens, auth.Token{Name: t.Name, SHA256: t.SHA256, Role: role})
+	}
+	a.Audience = cfg.OIDCAudience
+	for member, r := range cfg.Members {
+		role, err := auth.ParseRole(r)
+		if err != nil {
+			return nil, fmt.Errorf("member %q: %v", member, err)
+		}
+		a.Members[strings.ToLower(member)] = role
+	}
+	return a, nil
+}
+
+// tenantConfig returns the policy for a tenant, with its overrides applied
+// and local data kept in its own directory
+func (s *server) tenantConfig(t *tenant.Tenant) (*config.Config, error) {
+	tenantCfg := perUserConfig(s.cfg, s.store.Dir(t.Email))
+	if len(t.Settings) > 0 {
+		if err := json.Unmarshal(t.Settings, tenantCfg); err != nil {
+			return nil, fmt.Errorf("invalid settings for %s: %v", t.Email, err)
+		}
+	}
+	return tenantCfg, nil
+}
+
+// checkTenants checks every tenant's mailbox in turn
+func (s *server) checkTenants(ctx context.Context, notif *notifier.Notifier, plugins *plugin.Manager, rulesScript *script.Script, model *classifier.Model) {
+	tenants, err := s.store.List()
+	if err != nil {
+		log.Printf("Error listing tenants: %v", err)
+		return
+	}
+	for _, t := range tenants {
+		fmt.Printf("== %s\n", t.Email)
+		tenantCfg, err := s.tenantConfig(t)
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		token, err := s.store.Token(t.Email)
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		client, err := gmail.NewTokenClient(ctx, s.oauth, token, gmailOptions(tenantCfg))
+		if err != nil {
+			log.Printf("Error creating Gmail client for %s: %v", t.Email, err)
+			continue
+		}
+		// One tenant's bad draft mustn't stop the checks of the others
+		err = recovered("check of "+t.Email, func() error {
+			_, err := checkAndCleanDrafts(ctx, client, notif, plugins, rulesScript, model, tenantCfg)
+			return err
+		})
+		if err != nil {
+			if !reportPanic(tenantCfg, notif, err) {
+				log.Printf("Error checking %s: %v", t.Email, err)
+			}
+			continue
+		}
+		if !tenantCfg.DryRun {
+			remindTrashPurge(tenantCfg, notif, time.Now())
+		}
+	}
+	if err := notif.Retry(); err != nil {
+		log.Printf("Error retrying notifications: %v", err)
+	}
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html><title>%[1]s</title><h1>%[1]s</h1><p>%[1]s deletes your old empty Gmail drafts.</p><p><a href=\"/oauth/start\">Connect your Gmail account</a></p>\n", html.EscapeString(appName))
+}
+
+// handleOAuthStart redirects to Google's consent screen
+func (s *server) handleOAuthStart(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "unable to start sign-in", http.StatusInternalServerError)
+		return
+	}
+	state := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	now := time.Now()
+	for st, started := range s.states {
+		if now.Sub(started) > oauthStateTTL {
+			delete(s.states, st)
+		}
+	}
+	s.states[state] = now
+	s.mu.Unlock()
+
+	// Force consent so Google always returns a refresh token
+	url := s.oauth.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "consent"))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// handleOAuthCallback stores the token of a tenant who granted access
+func (s *server) handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	s.mu.Lock()
+	started, ok := s.states[state]
+	delete(s.states, state)
+	s.mu.Unlock()
+	if !ok || time.Since(started) > oauthStateTTL {
+		http.Error(w, "sign-in expired, please start again", http.StatusBadRequest)
+		return
+	}
+	if e := r.URL.Query().Get("error"); e != "" {
+		http.Error(w, "access was not granted: "+e, http.StatusBadRequest)
+		return
+	}
+
+	token, err := s.oauth.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		log.Printf("Error exchanging authorization code: %v", err)
+		http.Error(w, "unable to complete sign-in", http.StatusBadGateway)
+		return
+	}
+	client, err := gmail.NewTokenClient(r.Context(), s.oauth, token, gmailOptions(s.cfg))
+	if err == nil {
+		var email string
+		email, err = client.Profile(r.Context())
+		if err == nil {
+			err = s.onboard(strings.ToLower(email), token)
+		}
+	}
+	if err != nil {
+		log.Printf("Error onboarding tenant: %v", err)
+		http.Error(w, "unable to connect your mailbox", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html><title>%[1]s</title><p>Your mailbox is connected. %[1]s will check your drafts from now on.</p>\n", html.EscapeString(appName))
+}
+
+// onboard stores a new tenant, or replaces the token of an existing one
+func (s *server) onboard(email string, token *oauth2.Token) error {
+	t, err := s.store.Get(email)
+	if err != nil {
+		t = &tenant.Tenant{Email: email}
+	}
+	t.ConnectedAt = time.Now()
+	if err := s.store.SaveToken(email, token); err != nil {
+		return err
+	}
+	if err := s.store.Save(t); err != nil {
+		return err
+	}
+	fmt.Printf("Connected tenant %s\n", email)
+	return nil
+}
+
+func (s *server) handleListTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := s.store.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, tenants)
+}
+
+// handleJobs lists the server's jobs with their schedule and last outcome
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.jobs.Statuses())
+}
+
+func (s *server) handleGetTenant(w http.ResponseWriter, r *http.Request) {
+	t, err := s.store.Get(r.PathValue("email"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, t)
+}
+
+// handlePutSettings replaces a tenant's policy overrides
+func (s *server) handlePutSettings(w http.ResponseWriter, r *http.Request) {
+	t, err := s.store.Get(r.PathValue("email"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := tenant.ValidateSettings(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t.Settings = body
+	if _, err := s.tenantConfig(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.store.Save(t); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Settings of %s changed by %s", t.Email, auth.FromContext(r.Context()).Name)
+	writeJSON(w, t)
+}
+
+// handleReport returns the tenant's latest triage report as Markdown
+func (s *server) handleReport(w http.ResponseWriter, r *http.Request) {
+	t, err := s.store.Get(r.PathValue("email"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(s.store.Dir(t.Email), "report.md"))
+	if err != nil {
+		http.Error(w, "no report yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Write(data)
+}
+
+// handleStats returns the counts recorded by the tenant's latest check
+func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
+	t, err := s.store.Get(r.PathValue("email"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	tenantCfg, err := s.tenantConfig(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	observations, err := stats.OpenHistory(historyPath(tenantCfg)).Observations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(observations) == 0 {
+		http.Error(w, "no checks recorded yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, observations[len(observations)-1])
+}
+
+// handleDeleteTenant offboards a tenant, deleting its token and state
+func (s *server) handleDeleteTenant(w http.ResponseWriter, r *http.Request) {
+	email := r.PathValue("email")
+	if _, err := s.store.Get(email); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := s.store.Remove(email); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Tenant %s removed by %s", email, auth.FromContext(r.Context()).Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON sends v as an indented JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleShutdown delivers the signals asking the daemon to stop on c. It
+// returns a function to call once the daemon has shut down.
+func handleShutdown(c chan<- os.Signal) func() {
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	return func() {}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceStopTimeout is how long the service manager is kept waiting for
+// the daemon to shut down
+const serviceStopTimeout = 20 * time.Second
+
+// handleShutdown delivers the requests asking the daemon to stop on c. Go
+// turns Ctrl+C and Ctrl+Break into os.Interrupt, and closing the console
+// window, logging off and shutting down into SIGTERM. When running as a
+// Windows service, stop and shutdown requests from the service manager are
+// delivered as SIGTERM too. It returns a function to call once the daemon
+// has shut down, which tells the service manager it stopped.
+func handleShutdown(c chan<- os.Signal) func() {
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		log.Printf("Error detecting the Windows service manager: %v", err)
+	}
+	if !isService {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		if err := svc.Run(appName, &windowsService{stop: c, done: done}); err != nil {
+			log.Printf("Error running as a Windows service: %v", err)
+		}
+	}()
+	return func() {
+		close(done)
+		select {
+		case <-exited:
+		case <-time.After(serviceStopTimeout):
+		}
+	}
+}
+
+// windowsService answers the Windows service manager
+type windowsService struct {
+	stop chan<- os.Signal
+	done <-chan struct{} // Closed once the daemon has shut down
+}
+
+// Execute reports the service running until the service manager asks it to
+// stop, or the daemon exits by itself
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopTimeout / time.Millisecond)}
+				select {
+				case s.stop <- syscall.SIGTERM:
+				default:
+				}
+				<-s.done
+				return false, 0
+			}
+		case <-s.done:
+			return false, 0
+		}
+	}
+}
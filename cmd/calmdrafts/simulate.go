@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"calmdrafts/internal/cache"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+)
+
+// draftHistoryPath returns where every change to the drafts folder seen by
+// a check is recorded
+func draftHistoryPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "drafts-history.jsonl")
+}
+
+// simulatedDeletion is a draft a policy deleted during a simulation
+type simulatedDeletion struct {
+	draft  *gmail.Draft
+	at     time.Time
+	reason string
+}
+
+// runSimulate replays the recorded draft history under the current policy
+// and a proposed one, and reports which drafts each would have deleted
+func runSimulate(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	rulesPath := fs.String("rules", "", "Policy file to simulate instead of the current policy")
+	since := fs.String("since", "90d", "How far back to replay the draft history")
+	step := fs.String("step", "", "Time between simulated checks (default: check_interval, at least 1h)")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if *rulesPath == "" {
+		return fmt.Errorf("usage: calmdrafts simulate --rules <policy.yaml> [--since 90d]")
+	}
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so no draft history is recorded")
+	}
+	window, err := config.ParseDuration(*since)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("invalid --since %q", *since)
+	}
+	interval := max(cfg.CheckInterval.Duration, time.Hour)
+	if *step != "" {
+		if interval, err = config.ParseDuration(*step); err != nil || interval <= 0 {
+			return fmt.Errorf("invalid --step %q", *step)
+		}
+	}
+
+	policy, err := config.LoadPolicy(*rulesPath)
+	if err != nil {
+		return err
+	}
+	proposedCfg := *cfg
+	proposedCfg.ApplyPolicy(policy)
+
+	events, err := cache.OpenHistory(draftHistoryPath(cfg)).Events()
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("no draft history recorded yet in %s; it builds up as the daemon checks drafts", draftHistoryPath(cfg))
+	}
+
+	end := time.Now()
+	start := end.Add(-window)
+	if first := events[0].Time; first.After(start) {
+		start = first
+	}
+	fmt.Printf("Replaying draft history from %s to %s, one check every %v\n\n", start.Local().Format("2006-01-02 15:04"), end.Local().Format("2006-01-02 15:04"), interval)
+
+	current, err := simulatePolicy(ctx, cfg, events, start, end, interval)
+	if err != nil {
+		return fmt.Errorf("error simulating the current policy: %v", err)
+	}
+	proposed, err := simulatePolicy(ctx, &proposedCfg, events, start, end, interval)
+	if err != nil {
+		return fmt.Errorf("error simulating %s: %v", *rulesPath, err)
+	}
+
+	fmt.Printf("Current policy:  %d draft(s) deleted\n", len(current))
+	fmt.Printf("Proposed policy: %d draft(s) deleted\n", len(proposed))
+	printSimulatedDeletions("Only deleted under the proposed policy", proposed, current)
+	printSimulatedDeletions("Only deleted under the current policy", current, proposed)
+	return nil
+}
+
+// simulatePolicy steps through the draft history from start to end as the
+// daemon would, applying the rules of cfg, and returns the drafts deleted.
+// The grace period, min_age, recent_edit_guard, max_deletions and per-rule
+// schedules are honoured; nothing is sent to Gmail.
+func simulatePolicy(ctx context.Context, cfg *config.Config, events []*cache.Event, start, end time.Time, step time.Duration) (map[string]*simulatedDeletion, error) {
+	plugins, rulesScript, model, err := loadRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	calendar, err := businessCalendar(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scripts see draft ages as of the simulated check, not as of today
+	var now time.Time
+	if rulesScript != nil {
+		rulesScript.Age = func(created time.Time) time.Duration {
+			return calendar.Age(created, now)
+		}
+	}
+
+	type pending struct {
+		messageID string
+		since     time.Time
+	}
+	timeline := cache.NewTimeline(events)
+	deleted := make(map[string]*simulatedDeletion)
+	queue := make(map[string]*pending)
+	runs := make(map[string]time.Time)
+
+	for now = start; ; now = now.Add(step) {
+		// The last check is at the end of the window
+		if now.After(end) {
+			now = end
+		}
+		drafts := timeline.Advance(now)
+		for _, draft := range drafts {
+			if empty, ok, err := plugins.Classify(ctx, draft); err != nil {
+				fmt.Fprintf(os.Stderr, "Error running classifier plugins for draft %s: %v\n", draft.ID, err)
+			} else if ok {
+				draft.IsEmpty = empty
+			}
+		}
+		if err := markTemplates(cfg, drafts); err != nil {
+			return nil, err
+		}
+
+		due := rulesDue(cfg, runs, now)
+		count := 0
+		for _, draft := range drafts {
+			if deleted[draft.ID] != nil {
+				continue
+			}
+			v, err := evaluate(ctx, draft, plugins, rulesScript, model, cfg, now)
+			if err != nil {
+				return nil, err
+			}
+			if !v.delete || v.stale {
+				delete(queue, draft.ID)
+				continue
+			}
+			if !due[v.rule] || (cfg.MaxDeletions > 0 && count >= cfg.MaxDeletions) ||
+				belowMinAge(cfg, draft, now) || recentlyEdited(draft, timeline.Changed(draft.ID), now, cfg.RecentEditGuard.Duration) {
+				continue
+			}
+
+			if cfg.GracePeriod.Duration > 0 {
+				entry := queue[draft.ID]
+				if entry == nil || entry.messageID != draft.MessageID {
+					queue[draft.ID] = &pending{messageID: draft.MessageID, since: now}
+					continue
+				}
+				if now.Sub(entry.since) < cfg.GracePeriod.Duration {
+					continue
+				}
+			}
+
+			deleted[draft.ID] = &simulatedDeletion{draft: draft, at: now, reason: v.reason}
+			count++
+		}
+		if now.Equal(end) {
+			break
+		}
+	}
+	return deleted, nil
+}
+
+// printSimulatedDeletions lists the deletions in a that are missing from b,
+// oldest first
+func printSimulatedDeletions(title string, a, b map[string]*simulatedDeletion) {
+	only := []*simulatedDeletion{}
+	for id, d := range a {
+		if b[id] == nil {
+			only = append(only, d)
+		}
+	}
+	if len(only) == 0 {
+		return
+	}
+	sort.Slice(only, func(i, j int) bool {
+		if !only[i].at.Equal(only[j].at) {
+			return only[i].at.Before(only[j].at)
+		}
+		return only[i].draft.ID < only[j].draft.ID
+	})
+
+	fmt.Printf("\n%s (%d):\n", title, len(only))
+	for _, d := range only {
+		subject := d.draft.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		fmt.Printf("- %s  %q  deleted %s at age %s  reason: %s\n", d.draft.ID, subject, d.at.Local().Format("2006-01-02"), formatAge(d.at.Sub(d.draft.InternalDate)), d.reason)
+	}
+}
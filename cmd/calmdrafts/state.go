@@ -0,0 +1,283 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"calmdrafts/internal/buildinfo"
+	"calmdrafts/internal/config"
+)
+
+// stateFormat is the version of the state archive layout
+const stateFormat = 1
+
+// stateManifest describes a state archive. It is stored as manifest.json
+// at the top of the zip file.
+type stateManifest struct {
+	Format     int       `json:"format"`
+	Version    string    `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Account    string    `json:"account,omitempty"`
+	Files      []string  `json:"files"`
+}
+
+// auditArchiveName is the name of the audit log inside a state archive
+const auditArchiveName = "audit.log"
+
+// stateFiles lists the files in state_dir that make up the history and
+// pending work of an account. Diagnostics such as the log file and crash
+// reports are left out, as they describe the old machine.
+func stateFiles(cfg *config.Config) []string {
+	return []string{
+		actionQueuePath(cfg),
+		deferralPath(cfg),
+		digestStatePath(cfg),
+		draftCachePath(cfg),
+		draftHistoryPath(cfg),
+		followUpsPath(cfg),
+		historyPath(cfg),
+		jobsPath(cfg),
+		notificationsPath(cfg),
+		nudgesPath(cfg),
+		observationPath(cfg),
+		ongoingErrorPath(cfg),
+		pendingQueuePath(cfg),
+		planKeyPath(cfg),
+		ruleRunsPath(cfg),
+		runsPath(cfg),
+		trashReminderPath(cfg),
+		webhookQueuePath(cfg),
+	}
+}
+
+// runState exports the local state to a zip file or imports it from one
+func runState(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: state export|import [flags]")
+	}
+	switch args[0] {
+	case "export":
+		return runStateExport(cfg, args[1:])
+	case "import":
+		return runStateImport(cfg, args[1:])
+	}
+	return fmt.Errorf("unknown state command %q, use export or import", args[0])
+}
+
+// runStateExport writes the state files and audit log to a zip file
+func runStateExport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("state export", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	out := fs.String("out", "", "Zip file to write (default: calmdrafts-state-<time>.zip)")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so there is no state to export")
+	}
+	now := time.Now()
+	if *out == "" {
+		*out = fmt.Sprintf("calmdrafts-state-%s.zip", now.Format("20060102-150405"))
+	}
+
+	type entry struct{ name, path string }
+	var entries []entry
+	for _, p := range stateFiles(cfg) {
+		entries = append(entries, entry{path.Join("state", filepath.Base(p)), p})
+	}
+	if cfg.AuditLogPath != "" {
+		entries = append(entries, entry{auditArchiveName, cfg.AuditLogPath})
+	}
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	manifest := &stateManifest{Format: stateFormat, Version: buildinfo.Get().Version, ExportedAt: now, Account: cfg.Account}
+	for _, e := range entries {
+		data, err := os.ReadFile(e.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %v", e.path, err)
+		}
+		w, err := zw.Create(e.name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, e.name)
+		fmt.Printf("Added %s\n", e.name)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nWrote %s. It holds draft subjects and addresses, so keep it private.\n", *out)
+	return nil
+}
+
+// runStateImport restores the state files and audit log from a zip file
+// written by state export
+func runStateImport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("state import", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	force := fs.Bool("force", false, "Replace existing state files")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: state import [--force] <file.zip>")
+	}
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so there is nowhere to import to")
+	}
+
+	zr, err := zip.OpenReader(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	manifest, err := readStateManifest(&zr.Reader)
+	if err != nil {
+		return err
+	}
+	if manifest.Format != stateFormat {
+		return fmt.Errorf("%s has state format %d, this version reads format %d", fs.Arg(0), manifest.Format, stateFormat)
+	}
+	if manifest.Account != "" && manifest.Account != cfg.Account {
+		fmt.Printf("Note: the archive was exported from account %q\n", manifest.Account)
+	}
+
+	// Only names this version writes are accepted, so an archive can never
+	// place files outside state_dir
+	targets := make(map[string]string)
+	for _, p := range stateFiles(cfg) {
+		targets[path.Join("state", filepath.Base(p))] = p
+	}
+	if cfg.AuditLogPath != "" {
+		targets[auditArchiveName] = cfg.AuditLogPath
+	}
+
+	files := make(map[string]*zip.File)
+	for _, zf := range zr.File {
+		files[zf.Name] = zf
+	}
+	var restore []*zip.File
+	for _, name := range manifest.Files {
+		zf, ok := files[name]
+		if !ok {
+			return fmt.Errorf("%s is listed in the manifest but missing from the archive", name)
+		}
+		if _, ok := targets[name]; !ok {
+			if name == auditArchiveName {
+				fmt.Printf("Skipping %s: audit_log_path is not set\n", name)
+				continue
+			}
+			return fmt.Errorf("unexpected file %s in the archive", name)
+		}
+		restore = append(restore, zf)
+	}
+
+	if !*force {
+		for _, zf := range restore {
+			if _, err := os.Stat(targets[zf.Name]); err == nil {
+				return fmt.Errorf("%s already exists, use --force to replace the existing state", targets[zf.Name])
+			}
+		}
+	}
+
+	if err := os.MkdirAll(cfg.StateDir, 0700); err != nil {
+		return err
+	}
+	for _, zf := range restore {
+		if err := restoreStateFile(zf, targets[zf.Name]); err != nil {
+			return fmt.Errorf("unable to restore %s: %v", zf.Name, err)
+		}
+		fmt.Printf("Restored %s\n", targets[zf.Name])
+	}
+
+	fmt.Printf("\nImported %d files exported %s by %s\n", len(restore), manifest.ExportedAt.Format("2006-01-02 15:04"), manifest.Version)
+	return nil
+}
+
+// readStateManifest decodes manifest.json from a state archive
+func readStateManifest(zr *zip.Reader) (*stateManifest, error) {
+	for _, zf := range zr.File {
+		if zf.Name != "manifest.json" {
+			continue
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		var manifest stateManifest
+		if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("unable to read manifest.json: %v", err)
+		}
+		return &manifest, nil
+	}
+	return nil, fmt.Errorf("not a state archive: manifest.json is missing")
+}
+
+// restoreStateFile writes one file from the archive atomically, so an
+// interrupted import never leaves a truncated state file behind
+func restoreStateFile(zf *zip.File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	r, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".calmdrafts-import-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"calmdrafts/internal/audit"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/export"
+	"calmdrafts/internal/stats"
+)
+
+// historyPath returns where observations recorded after each check are stored
+func historyPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "history.jsonl")
+}
+
+// runStats prints draft counts and an age histogram for the mailbox
+func runStats(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) > 0 && args[0] == "export" {
+		return runStatsExport(cfg, args[1:])
+	}
+
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	compare := fs.Bool("compare", false, "Compare the latest check of every configured account")
+	markdown := fs.Bool("markdown", false, "Print the --compare table as Markdown")
+	fs.Parse(args)
+	apply := flagOverrides.apply
+	if *compare {
+		apply = flagOverrides.applyAny
+	}
+	if err := apply(cfg); err != nil {
+		return err
+	}
+
+	if *compare {
+		accounts, err := configuredAccounts(cfg)
+		if err != nil {
+			return err
+		}
+		stats.SortAccounts(accounts)
+		switch {
+		case *markdown:
+			fmt.Print(stats.ComparisonMarkdown(accounts))
+			return nil
+		case cfg.Accessible:
+			return stats.WriteComparisonList(os.Stdout, accounts)
+		}
+		return stats.WriteComparison(os.Stdout, accounts)
+	}
+
+	drafts, _, err := fetchDrafts(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	empty := 0
+	for _, draft := range drafts {
+		if draft.IsEmpty {
+			empty++
+		}
+	}
+	fmt.Printf("%d draft(s), %d empty, %d non-empty, %s in total\n\n", len(drafts), empty, len(drafts)-empty, stats.FormatBytes(stats.TotalSize(drafts)))
+
+	histogram := stats.NewHistogram(drafts, time.Now())
+	write := histogram.WriteText
+	if cfg.Accessible {
+		write = histogram.WriteList
+	}
+	if err := write(os.Stdout); err != nil {
+		return err
+	}
+
+	orphaned := 0
+	for _, d := range drafts {
+		if orphanReason(cfg, d, time.Now()) != "" {
+			orphaned++
+		}
+	}
+	if orphaned > 0 {
+		fmt.Printf("\n%d orphaned reply draft(s), whose thread was deleted or archived long ago. Run \"calmdrafts list --orphaned\" to see them.\n", orphaned)
+	}
+
+	if clients := stats.ByClient(drafts); len(clients) > 1 || (len(clients) == 1 && clients[0].Client != "unknown") {
+		fmt.Printf("\nBy client:\n")
+		for _, c := range clients {
+			if cfg.Accessible {
+				fmt.Printf("%s: %d draft(s), %d empty.\n", c.Client, c.Drafts, c.Empty)
+				continue
+			}
+			fmt.Printf("%-18s %5d  %5d empty\n", c.Client, c.Drafts, c.Empty)
+		}
+	}
+
+	if large := stats.Large(drafts, cfg.LargeDraftSize); len(large) > 0 {
+		fmt.Printf("\nLarge drafts (at least %s):\n", stats.FormatBytes(cfg.LargeDraftSize))
+		for _, d := range large {
+			if cfg.Accessible {
+				fmt.Printf("%q, %s. ID %s.\n", d.Subject, stats.FormatBytes(d.Size), d.ID)
+				continue
+			}
+			fmt.Printf("%-18s %10s  %s\n", d.ID, stats.FormatBytes(d.Size), truncate(d.Subject, 50))
+		}
+	}
+
+	calls, err := weeklyCalls(cfg, time.Now())
+	if err != nil {
+		return err
+	}
+	if calls != nil && calls.Calls > 0 {
+		fmt.Printf("\n%s.\n", calls.Summary("this week"))
+		if advice := calls.Advice(); advice != "" {
+			fmt.Printf("%s.\n", advice)
+		}
+	}
+	return nil
+}
+
+// configuredAccounts returns the latest observation of each account: the
+// top-level config, every profile with its own state_dir, the accounts
+// listed in the config and the users of a fleet
+func configuredAccounts(cfg *config.Config) ([]*stats.Account, error) {
+	base, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []*stats.Account{}
+	seen := make(map[string]bool)
+	add := func(name string, accountCfg *config.Config) error {
+		path := historyPath(accountCfg)
+		if seen[path] {
+			return nil
+		}
+		seen[path] = true
+		observations, err := stats.OpenHistory(path).Observations()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		account := &stats.Account{Name: name}
+		if len(observations) > 0 {
+			account.Obs = observations[len(observations)-1]
+		}
+		if account.Calls, err = weeklyCalls(accountCfg, time.Now()); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		accounts = append(accounts, account)
+		return nil
+	}
+
+	// With accounts listed, the top-level config is not a mailbox of its own
+	accountNames, err := base.AccountNames()
+	if err != nil {
+		return nil, err
+	}
+	if len(accountNames) == 0 {
+		if err := add("(default)", base); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(base.Profiles))
+	for name := range base.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		profileCfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := profileCfg.ApplyProfile(name); err != nil {
+			return nil, err
+		}
+		if err := add(name, profileCfg); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range accountNames {
+		accountCfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := accountCfg.ApplyAccount(name); err != nil {
+			return nil, err
+		}
+		if err := add(name, accountCfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Fleet != nil {
+		users, err := fleetUsers(cfg.Fleet)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			userCfg := perUserConfig(cfg, filepath.Join(fleetDir(cfg), user))
+			if err := add(user, userCfg); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(accounts) < 2 {
+		return nil, fmt.Errorf("only one account is configured; list them under accounts, or give each a profile with its own state_dir")
+	}
+	return accounts, nil
+}
+
+// runStatsExport dumps recorded observations or the audit log for analysis
+// in external tools
+func runStatsExport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("stats export", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	formatName := fs.String("format", "csv", "Output format: csv or parquet")
+	data := fs.String("data", "observations", "What to export: observations or actions")
+	output := fs.String("output", "", "Output file (default: standard output)")
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	switch *data {
+	case "observations":
+		observations, err := stats.OpenHistory(historyPath(cfg)).Observations()
+		if err != nil {
+			return err
+		}
+		return export.Write(out, format, export.ObservationRows(observations))
+	case "actions":
+		if cfg.AuditLogPath == "" {
+			return fmt.Errorf("the audit log is disabled")
+		}
+		entries, err := audit.Open(cfg.AuditLogPath).Entries()
+		if err != nil {
+			return err
+		}
+		return export.Write(out, format, export.ActionRows(entries))
+	}
+	return fmt.Errorf("unknown data %q (use observations or actions)", *data)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"calmdrafts/internal/actions"
+	"calmdrafts/internal/cache"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/jobs"
+	"calmdrafts/internal/notifier"
+	"calmdrafts/internal/quarantine"
+	"calmdrafts/internal/stats"
+)
+
+// runStatus summarizes the last check from local state, without contacting
+// Gmail
+func runStatus(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	flagOverrides := addOverrideFlags(fs)
+	fs.Parse(args)
+	if err := flagOverrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if cfg.StateDir == "" {
+		return fmt.Errorf("state_dir is not set, so no status is kept")
+	}
+
+	now := time.Now()
+	observations, err := stats.OpenHistory(historyPath(cfg)).Observations()
+	if err != nil {
+		return err
+	}
+	if len(observations) == 0 {
+		fmt.Println("No checks recorded yet")
+	} else {
+		last := observations[len(observations)-1]
+		fmt.Printf("Last check:  %s (%s ago)\n", last.Time.Format("2006-01-02 15:04"), now.Sub(last.Time).Round(time.Minute))
+		fmt.Printf("Drafts:      %d (%d empty, %s)\n", last.Drafts, last.Empty, stats.FormatBytes(last.Bytes))
+		fmt.Printf("Deleted:     %d\n", last.Deleted)
+		fmt.Printf("Stale:       %d\n", last.Stale)
+	}
+
+	if e := loadOngoingError(cfg); e != nil {
+		fmt.Printf("Failing:     since %s (%d check(s)): %s\n", e.Since.Local().Format("2006-01-02 15:04"), e.Count, e.Message)
+	}
+
+	if d, err := loadDeferral(cfg); err == nil && d != nil {
+		fmt.Printf("Deferred:    checks put off since %s (%s)\n", d.Since.Format("2006-01-02 15:04"), d.Reason)
+	}
+
+	if err := printJobs(cfg, now); err != nil {
+		return err
+	}
+
+	if snap, err := cache.Load(draftCachePath(cfg)); err == nil {
+		fmt.Printf("Cached list: %d draft(s) from %s\n", len(snap.Drafts), snap.Time.Format("2006-01-02 15:04"))
+	}
+
+	actionQueue, err := openActionQueue(cfg)
+	if err != nil {
+		return err
+	}
+	if queued := actionQueue.Actions(); len(queued) > 0 {
+		fmt.Printf("Retrying:    %d action(s), next at %s\n", len(queued), nextAttempt(queued).Format("2006-01-02 15:04"))
+	}
+
+	webhooks, err := (&notifier.Webhook{QueuePath: webhookQueuePath(cfg)}).Pending()
+	if err != nil {
+		return err
+	}
+	if len(webhooks) > 0 {
+		next := webhooks[0].NextAttempt
+		for _, d := range webhooks[1:] {
+			if d.NextAttempt.Before(next) {
+				next = d.NextAttempt
+			}
+		}
+		fmt.Printf("Webhooks:    %d failed delivery(s) to retry, next at %s\n", len(webhooks), next.Format("2006-01-02 15:04"))
+	}
+
+	if expiring, days, err := trashCountdown(cfg, now); err == nil && len(expiring) > 0 {
+		fmt.Printf("Trash:       %d trashed draft(s) will be purged in %d day(s)\n", len(expiring), days)
+	}
+
+	if usesPendingQueue(cfg) {
+		queue, err := quarantine.Open(pendingQueuePath(cfg))
+		if err != nil {
+			return err
+		}
+		pending, decided := 0, 0
+		for _, entry := range queue.Entries() {
+			switch {
+			case entry.Decision == quarantine.DecisionPending:
+				pending++
+			case entry.Decision == quarantine.DecisionApproved || !entry.Unlabeled:
+				decided++
+			}
+		}
+		fmt.Printf("Pending:     %d draft(s) awaiting deletion\n", pending)
+		if decided > 0 {
+			fmt.Printf("Queued:      %d review decision(s) to apply at the next check\n", decided)
+		}
+	}
+
+	return nil
+}
+
+// printJobs shows the daemon's jobs as last saved: when each runs next
+// and how its last run went
+func printJobs(cfg *config.Config, now time.Time) error {
+	path := jobsPath(cfg)
+	if _, err := os.Stat(path); os.IsNotExist(err) && cfg.Account != "" {
+		// The daemon keeps one schedule for all accounts, in the top-level state_dir
+		path = filepath.Join(filepath.Dir(cfg.StateDir), filepath.Base(path))
+	}
+	statuses, err := jobs.Load(path)
+	if err != nil {
+		return err
+	}
+
+	label := "Jobs:"
+	for _, j := range statuses {
+		line := fmt.Sprintf("%-7s next %s", j.Name, j.Next.Local().Format("2006-01-02 15:04"))
+		if j.Next.Before(now) {
+			line += " (overdue)"
+		}
+		switch {
+		case j.Runs == 0:
+			line += ", not run yet"
+		case j.LastError != "":
+			line += fmt.Sprintf(", last run %s failed: %s", j.LastRun.Local().Format("2006-01-02 15:04"), j.LastError)
+		default:
+			line += fmt.Sprintf(", last run %s", j.LastRun.Local().Format("2006-01-02 15:04"))
+		}
+		if j.Failures > 0 {
+			line += fmt.Sprintf(", %d of %d run(s) failed", j.Failures, j.Runs)
+		}
+		if j.Missed > 0 {
+			line += fmt.Sprintf(", missed %d time(s) while stopped", j.Missed)
+		}
+		fmt.Printf("%-12s %s\n", label, line)
+		label = ""
+	}
+	return nil
+}
+
+// nextAttempt returns the earliest retry time of the queued actions
+func nextAttempt(queued []*actions.Action) time.Time {
+	next := queued[0].NextAttempt
+	for _, a := range queued[1:] {
+		if a.NextAttempt.Before(next) {
+			next = a.NextAttempt
+		}
+	}
+	return next
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/audit"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/notifier"
+)
+
+// trashCountdown returns the trashed drafts Gmail will purge within the
+// reminder window, and the number of days until the first of them goes
+func trashCountdown(cfg *config.Config, now time.Time) ([]*audit.Entry, int, error) {
+	if cfg.AuditLogPath == "" || cfg.TrashReminder.Duration <= 0 {
+		return nil, 0, nil
+	}
+	trashed, err := audit.Open(cfg.AuditLogPath).Trashed(now, gmail.TrashRetention)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	expiring := []*audit.Entry{}
+	var soonest time.Duration
+	for _, e := range trashed {
+		left := e.Time.Add(gmail.TrashRetention).Sub(now)
+		if left > cfg.TrashReminder.Duration {
+			continue
+		}
+		if len(expiring) == 0 || left < soonest {
+			soonest = left
+		}
+		expiring = append(expiring, e)
+	}
+	days := int((soonest + 24*time.Hour - 1) / (24 * time.Hour))
+	return expiring, days, nil
+}
+
+// trashReminderPath returns where the day of the last trash reminder is kept
+func trashReminderPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "trash-reminder")
+}
+
+// remindTrashPurge notifies about trashed drafts that are about to be
+// purged, at most once a day
+func remindTrashPurge(cfg *config.Config, notif *notifier.Notifier, now time.Time) {
+	expiring, days, err := trashCountdown(cfg, now)
+	if err != nil {
+		log.Printf("Error reading trashed drafts: %v", err)
+		return
+	}
+	if len(expiring) == 0 || cfg.StateDir == "" {
+		return
+	}
+
+	path := trashReminderPath(cfg)
+	today := now.Format(time.DateOnly)
+	if last, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(last)) == today {
+		return
+	}
+
+	if err := notif.NotifyTrashPurge(len(expiring), days); err != nil {
+		log.Printf("Error sending trash reminder: %v", err)
+		return
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0700); err == nil {
+		os.WriteFile(path, []byte(today+"\n"), 0600)
+	}
+}
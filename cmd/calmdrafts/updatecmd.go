@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"calmdrafts/internal/buildinfo"
+	"calmdrafts/internal/config"
+	"calmdrafts/internal/update"
+)
+
+// runUpdate replaces the running binary with the latest release
+func runUpdate(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	checkOnly := fs.Bool("check", false, "Only report whether an update is available")
+	insecure := fs.Bool("insecure", false, "Install even though this build can't verify the release signature, trusting the checksums from the release alone")
+	fs.Parse(args)
+
+	release, err := update.Latest()
+	if err != nil {
+		return err
+	}
+
+	version := buildinfo.Get().Version
+	if !release.IsNewer(version) {
+		fmt.Printf("%s %s is up to date\n", appName, version)
+		return nil
+	}
+	fmt.Printf("Update available: %s -> %s\n", version, release.Version)
+	if *checkOnly {
+		return nil
+	}
+
+	if err := release.Install(*insecure); err != nil {
+		return err
+	}
+	fmt.Printf("Updated to %s. Restart any running %s processes to use it.\n", release.Version, appName)
+	return nil
+}
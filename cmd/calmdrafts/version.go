@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"calmdrafts/internal/buildinfo"
+	"calmdrafts/internal/config"
+)
+
+// runVersion prints build information
+func runVersion(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print build information as JSON")
+	fs.Parse(args)
+
+	info := buildinfo.Get()
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	fmt.Println(info)
+	return nil
+}
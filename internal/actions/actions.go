@@ -0,0 +1,253 @@
+package actions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Kind is the type of change an action makes in Gmail
+type Kind string
+
+const (
+	KindDelete  Kind = "delete"  // Archive and delete a draft
+	KindLabel   Kind = "label"   // Add a label to a draft
+	KindUnlabel Kind = "unlabel" // Remove a label from a draft
+)
+
+// Retry limits
+const (
+	MaxAttempts = 10
+	baseBackoff = time.Minute
+	maxBackoff  = time.Hour
+)
+
+// Action is an intended change, persisted before it is applied so it
+// survives crashes and restarts
+type Action struct {
+	ID          string    `json:"id"`
+	Kind        Kind      `json:"kind"`
+	DraftID     string    `json:"draft_id"`
+	MessageID   string    `json:"message_id"`
+	Subject     string    `json:"subject,omitempty"`
+	To          string    `json:"to,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Explanation []string  `json:"explanation,omitempty"` // Decision trace of a rule-driven deletion, for the audit log
+	Label       string    `json:"label,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Attempts    int       `json:"attempts,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Queue holds actions that have not been applied yet, stored as a JSON file.
+// The daemon, `apply`, `review` and `nudge` can all hold it open, so Save
+// merges its changes into what is on disk rather than overwriting it.
+type Queue struct {
+	path    string
+	actions map[string]*Action
+	base    map[string]string // The actions as last read or written, encoded, to tell which ones changed here
+}
+
+// Open loads the queue stored at path. A missing file is an empty queue.
+func Open(path string) (*Queue, error) {
+	actions, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{path: path, actions: actions}
+	q.snapshot()
+	return q, nil
+}
+
+// load reads the actions stored at path, by ID
+func load(path string) (map[string]*Action, error) {
+	actions := make(map[string]*Action)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return actions, nil
+		}
+		return nil, fmt.Errorf("unable to read action queue: %v", err)
+	}
+
+	list := []*Action{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("unable to parse action queue: %v", err)
+	}
+	for _, a := range list {
+		actions[a.ID] = a
+	}
+	return actions, nil
+}
+
+// snapshot records the current actions as the base for the next merge
+func (q *Queue) snapshot() {
+	q.base = make(map[string]string, len(q.actions))
+	for id, a := range q.actions {
+		q.base[id] = encode(a)
+	}
+}
+
+// encode returns a as JSON, to compare actions
+func encode(a *Action) string {
+	b, _ := json.Marshal(a)
+	return string(b)
+}
+
+// Add queues an action, filling in its ID and creation time when unset
+func (q *Queue) Add(a *Action) error {
+	if a.ID == "" {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("unable to generate action ID: %v", err)
+		}
+		a.ID = hex.EncodeToString(b)
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	q.actions[a.ID] = a
+	return nil
+}
+
+// Has reports whether an action of the given kind is queued for a draft
+func (q *Queue) Has(kind Kind, draftID string) bool {
+	for _, a := range q.actions {
+		if a.Kind == kind && a.DraftID == draftID {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove drops an applied action
+func (q *Queue) Remove(id string) {
+	delete(q.actions, id)
+}
+
+// Failed records a failed attempt and schedules a retry with exponential
+// backoff. It reports whether the action was given up on and removed.
+func (q *Queue) Failed(a *Action, err error, now time.Time) bool {
+	a.Attempts++
+	a.LastError = err.Error()
+	if a.Attempts >= MaxAttempts {
+		q.Remove(a.ID)
+		return true
+	}
+
+	backoff := baseBackoff << (a.Attempts - 1)
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	a.NextAttempt = now.Add(backoff)
+	return false
+}
+
+// Actions returns all queued actions, oldest first
+func (q *Queue) Actions() []*Action {
+	actions := make([]*Action, 0, len(q.actions))
+	for _, a := range q.actions {
+		actions = append(actions, a)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		if !actions[i].CreatedAt.Equal(actions[j].CreatedAt) {
+			return actions[i].CreatedAt.Before(actions[j].CreatedAt)
+		}
+		return actions[i].ID < actions[j].ID
+	})
+	return actions
+}
+
+// Due returns the actions whose next attempt is not in the future
+func (q *Queue) Due(now time.Time) []*Action {
+	due := []*Action{}
+	for _, a := range q.Actions() {
+		if !a.NextAttempt.After(now) {
+			due = append(due, a)
+		}
+	}
+	return due
+}
+
+// Save writes the queue atomically. Actions added, changed or removed since
+// the queue was opened or last saved replace those on disk; the others are
+// taken from disk, so changes saved by another process in the meantime are
+// kept.
+func (q *Queue) Save() error {
+	if err := q.merge(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(q.Actions(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), ".actions-*")
+	if err != nil {
+		return fmt.Errorf("unable to write action queue: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write action queue: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write action queue: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("unable to write action queue: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), q.path); err != nil {
+		return fmt.Errorf("unable to write action queue: %v", err)
+	}
+	q.snapshot()
+	return nil
+}
+
+// merge re-reads the queue on disk and takes from it every action that
+// wasn't changed here. Actions are updated in place, so pointers handed out
+// by Actions and Due stay valid.
+func (q *Queue) merge() error {
+	disk, err := load(q.path)
+	if err != nil {
+		return err
+	}
+
+	ids := make(map[string]bool, len(q.actions)+len(disk))
+	for id := range q.actions {
+		ids[id] = true
+	}
+	for id := range q.base {
+		ids[id] = true
+	}
+	for id := range disk {
+		ids[id] = true
+	}
+
+	for id := range ids {
+		ours, inOurs := q.actions[id]
+		base, inBase := q.base[id]
+		if inOurs != inBase || (inOurs && encode(ours) != base) {
+			continue // Changed here
+		}
+		theirs, onDisk := disk[id]
+		switch {
+		case !onDisk:
+			delete(q.actions, id)
+		case inOurs:
+			*ours = *theirs
+		default:
+			q.actions[id] = theirs
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package actions
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveMerges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actions.json")
+	now := time.Now()
+
+	seed, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"kept", "applied", "retried", "theirs"} {
+		seed.Add(&Action{ID: id, Kind: KindDelete, DraftID: "d-" + id, Explanation: []string{"rule"}})
+	}
+	if err := seed.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The daemon and another process open the queue at the same time
+	daemon, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other.Add(&Action{ID: "added", Kind: KindLabel, DraftID: "d-added", Label: "Pending"})
+	other.Remove("theirs")
+	other.Failed(other.actions["kept"], errors.New("rate limited"), now)
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	daemon.Remove("applied")
+	daemon.Failed(daemon.actions["retried"], errors.New("timeout"), now)
+	if err := daemon.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, a := range saved.Actions() {
+		got[a.ID] = a.Attempts
+	}
+	want := map[string]int{"kept": 1, "retried": 1, "added": 0}
+	if len(got) != len(want) {
+		t.Errorf("saved actions %v, want %v", got, want)
+	}
+	for id, attempts := range want {
+		if a, ok := got[id]; !ok || a != attempts {
+			t.Errorf("saved actions %v, want %s with %d attempts", got, id, attempts)
+		}
+	}
+
+	// The daemon's copy picked up the other process's changes in place
+	if daemon.actions["kept"].Attempts != 1 || daemon.actions["added"] == nil || daemon.actions["theirs"] != nil {
+		t.Errorf("daemon queue has %d actions after saving, want the 3 merged ones", len(daemon.actions))
+	}
+}
@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Save writes a raw RFC 822 message to dir as an .eml file and returns its path
+func Save(dir, draftID string, raw []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("unable to create archive directory: %v", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), draftID)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		return "", fmt.Errorf("unable to archive draft %s: %v", draftID, err)
+	}
+
+	return path, nil
+}
+
+// Load reads an archived message
+func Load(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read archived message: %v", err)
+	}
+	return raw, nil
+}
+
+// Prune deletes archived messages older than maxAge, then the oldest
+// remaining ones until the archive fits in maxBytes. A zero limit is ignored.
+// It returns the number of files removed and the bytes freed.
+func Prune(dir string, maxAge time.Duration, maxBytes int64) (int, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("unable to read archive directory: %v", err)
+	}
+
+	files := []os.FileInfo{}
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".eml") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return 0, 0, fmt.Errorf("unable to stat %s: %v", entry.Name(), err)
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+
+	// Oldest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	removed := 0
+	var freed int64
+	cutoff := time.Now().Add(-maxAge)
+	for _, info := range files {
+		tooOld := maxAge > 0 && info.ModTime().Before(cutoff)
+		tooBig := maxBytes > 0 && total > maxBytes
+		if !tooOld && !tooBig {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil {
+			return removed, freed, fmt.Errorf("unable to remove %s: %v", info.Name(), err)
+		}
+		removed++
+		freed += info.Size()
+		total -= info.Size()
+	}
+
+	return removed, freed, nil
+}
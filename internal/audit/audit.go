@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"calmdrafts/internal/jsonl"
+)
+
+// Action is the kind of change recorded in the audit log
+type Action string
+
+const (
+	ActionDelete         Action = "delete"
+	ActionAlreadyDeleted Action = "already_deleted" // The draft was gone before CalmDrafts deleted it
+	ActionTrash          Action = "trash"           // Moved to Gmail's Trash instead of being deleted
+	ActionUntrash        Action = "untrash"
+	ActionRestore        Action = "restore"
+	ActionSend           Action = "send" // Sent after the user confirmed a nudge
+)
+
+// Entry is a single audit log record
+type Entry struct {
+	ID          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	Action      Action    `json:"action"`
+	DraftID     string    `json:"draft_id"`
+	MessageID   string    `json:"message_id,omitempty"`
+	Subject     string    `json:"subject,omitempty"`
+	To          string    `json:"to,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	ArchivePath string    `json:"archive_path,omitempty"`
+	Explanation []string  `json:"explanation,omitempty"` // How the rules decided, for automatic deletions
+}
+
+// Log is an append-only JSON-lines audit log
+type Log struct {
+	path string
+}
+
+// Open returns the audit log stored at path. The file is created on first write.
+func Open(path string) *Log {
+	return &Log{path: path}
+}
+
+// Append writes an entry, filling in its ID and time when unset
+func (l *Log) Append(entry *Entry) error {
+	if entry.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		entry.ID = id
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	return jsonl.Append(l.path, entry)
+}
+
+// Entries reads all entries in the order they were written
+func (l *Log) Entries() ([]*Entry, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	entries := []*Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("unable to parse audit log: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read audit log: %v", err)
+	}
+
+	return entries, nil
+}
+
+// Find returns the most recent entry whose ID or draft ID matches id
+func (l *Log) Find(id string) (*Entry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].ID == id || entries[i].DraftID == id {
+			return entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no audit entry found for %s", id)
+}
+
+// Trashed returns the drafts moved to Trash that Gmail hasn't purged yet,
+// given its retention period, and that haven't been moved back
+func (l *Log) Trashed(now time.Time, retention time.Duration) ([]*Entry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	trashed := []*Entry{}
+	index := make(map[string]int)
+	for _, e := range entries {
+		switch e.Action {
+		case ActionTrash:
+			if now.Before(e.Time.Add(retention)) {
+				index[e.MessageID] = len(trashed)
+				trashed = append(trashed, e)
+			}
+		case ActionUntrash:
+			if i, ok := index[e.MessageID]; ok {
+				trashed[i] = nil
+				delete(index, e.MessageID)
+			}
+		}
+	}
+
+	result := []*Entry{}
+	for _, e := range trashed {
+		if e != nil {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// Prune drops entries older than maxAge, then the oldest remaining entries
+// until the log fits in maxBytes. A zero limit is ignored. It returns the
+// number of entries dropped.
+func (l *Log) Prune(maxAge time.Duration, maxBytes int64) (int, error) {
+	return jsonl.Prune(l.path, maxAge, maxBytes, func(e *Entry) time.Time { return e.Time })
+}
+
+// newID returns a short random identifier for an audit entry
+func newID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate audit entry ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/idtoken"
+)
+
+// Role is what an authenticated caller may do
+type Role string
+
+const (
+	RoleRead  Role = "read"  // List tenants and read settings and reports
+	RoleAdmin Role = "admin" // Also change settings and remove tenants
+)
+
+// ParseRole validates a role name
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleRead, RoleAdmin:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown role %q (use read or admin)", s)
+}
+
+// Allows reports whether the role grants the required one
+func (r Role) Allows(required Role) bool {
+	return r == RoleAdmin || r == required
+}
+
+// Token is an API token, stored only as the hex SHA-256 of its value
+type Token struct {
+	Name   string
+	SHA256 string
+	Role   Role
+}
+
+// Identity is an authenticated caller
+type Identity struct {
+	Name string // Token name or email address
+	Role Role
+}
+
+// Authenticator checks bearer credentials: API tokens first, then Google
+// OIDC ID tokens when an audience is set
+type Authenticator struct {
+	Tokens   []Token
+	Audience string          // Expected audience of OIDC ID tokens; empty disables OIDC
+	Members  map[string]Role // Role per OIDC email address, or per "@domain"
+
+	// validate checks a Google-signed ID token, idtoken.Validate unless a
+	// test replaces it
+	validate func(ctx context.Context, token, audience string) (*idtoken.Payload, error)
+}
+
+// Enabled reports whether any credential can be accepted
+func (a *Authenticator) Enabled() bool {
+	return len(a.Tokens) > 0 || (a.Audience != "" && len(a.Members) > 0)
+}
+
+// Authenticate returns the caller of a request
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || bearer == "" {
+		return nil, fmt.Errorf("missing bearer token")
+	}
+
+	sum := sha256.Sum256([]byte(bearer))
+	hash := hex.EncodeToString(sum[:])
+	for _, t := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(strings.ToLower(t.SHA256))) == 1 {
+			return &Identity{Name: t.Name, Role: t.Role}, nil
+		}
+	}
+
+	if a.Audience == "" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	validate := a.validate
+	if validate == nil {
+		validate = idtoken.Validate
+	}
+	payload, err := validate(r.Context(), bearer, a.Audience)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+	email, _ := payload.Claims["email"].(string)
+	verified, _ := payload.Claims["email_verified"].(bool)
+	if email == "" || !verified {
+		return nil, fmt.Errorf("token has no verified email")
+	}
+	email = strings.ToLower(email)
+	role, ok := a.Members[email]
+	if !ok {
+		if at := strings.LastIndex(email, "@"); at >= 0 {
+			role, ok = a.Members[email[at:]]
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s is not a member", email)
+	}
+	return &Identity{Name: email, Role: role}, nil
+}
+
+// Require wraps a handler so it only runs for callers with the role
+func (a *Authenticator) Require(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !id.Role.Allows(role) {
+			http.Error(w, fmt.Sprintf("%s needs the %s role", id.Name, role), http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	}
+}
+
+// identityKey stores the caller in the request context
+type identityKey struct{}
+
+// FromContext returns the caller stored by Require, or nil
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// NewToken returns a random API token and the hash to configure for it
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	sum := sha256.Sum256([]byte(token))
+	return token, hex.EncodeToString(sum[:]), nil
+}
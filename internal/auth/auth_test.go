@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/idtoken"
+)
+
+// fakeValidate accepts the ID tokens "<email>" and "<email> unverified"
+// for the audience "https://drafts.example.com"
+func fakeValidate(ctx context.Context, token, audience string) (*idtoken.Payload, error) {
+	if audience != "https://drafts.example.com" || token == "forged" {
+		return nil, fmt.Errorf("idtoken: invalid token")
+	}
+	email, unverified := strings.CutSuffix(token, " unverified")
+	return &idtoken.Payload{Audience: audience, Claims: map[string]interface{}{"email": email, "email_verified": !unverified}}, nil
+}
+
+func TestParseRole(t *testing.T) {
+	for s, ok := range map[string]bool{"read": true, "admin": true, "": false, "Admin": false, "write": false} {
+		if _, err := ParseRole(s); (err == nil) != ok {
+			t.Errorf("ParseRole(%q) returned %v, want ok %v", s, err, ok)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		role, required Role
+		ok             bool
+	}{
+		{RoleRead, RoleRead, true},
+		{RoleRead, RoleAdmin, false},
+		{RoleAdmin, RoleRead, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleRead, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.ok {
+			t.Errorf("%q allows %q: %v, want %v", tt.role, tt.required, got, tt.ok)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	readToken, readHash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminToken, adminHash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Authenticator{
+		Tokens: []Token{
+			{Name: "dashboard", SHA256: readHash, Role: RoleRead},
+			{Name: "ops", SHA256: strings.ToUpper(adminHash), Role: RoleAdmin},
+		},
+		Audience: "https://drafts.example.com",
+		Members:  map[string]Role{"boss@example.com": RoleAdmin, "@example.com": RoleRead},
+		validate: fakeValidate,
+	}
+	tokensOnly := &Authenticator{Tokens: a.Tokens, validate: fakeValidate}
+
+	tests := []struct {
+		name   string
+		auth   *Authenticator
+		role   Role
+		bearer string
+		status int
+		caller string
+	}{
+		{"read token reads", a, RoleRead, readToken, http.StatusOK, "dashboard"},
+		{"read token can't change", a, RoleAdmin, readToken, http.StatusForbidden, ""},
+		{"admin token reads", a, RoleRead, adminToken, http.StatusOK, "ops"},
+		{"admin token changes", a, RoleAdmin, adminToken, http.StatusOK, "ops"},
+		{"no token", a, RoleRead, "", http.StatusUnauthorized, ""},
+		{"unknown token", a, RoleRead, "guess", http.StatusUnauthorized, ""},
+		{"token hash as token", a, RoleRead, readHash, http.StatusUnauthorized, ""},
+		{"admin member", a, RoleAdmin, "Boss@Example.com", http.StatusOK, "boss@example.com"},
+		{"domain member reads", a, RoleRead, "jo@example.com", http.StatusOK, "jo@example.com"},
+		{"domain member can't change", a, RoleAdmin, "jo@example.com", http.StatusForbidden, ""},
+		{"other domain", a, RoleRead, "jo@evil.example.org", http.StatusUnauthorized, ""},
+		{"subdomain", a, RoleRead, "jo@mail.example.com", http.StatusUnauthorized, ""},
+		{"unverified email", a, RoleRead, "boss@example.com unverified", http.StatusUnauthorized, ""},
+		{"forged ID token", a, RoleRead, "forged", http.StatusUnauthorized, ""},
+		{"ID token without audience", tokensOnly, RoleRead, "boss@example.com", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		caller := ""
+		handler := tt.auth.Require(tt.role, func(w http.ResponseWriter, r *http.Request) {
+			caller = FromContext(r.Context()).Name
+		})
+		r := httptest.NewRequest("GET", "/api/tenants", nil)
+		if tt.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.bearer)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.status || caller != tt.caller {
+			t.Errorf("%s: status %d as %q, want %d as %q", tt.name, w.Code, caller, tt.status, tt.caller)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X calmdrafts/internal/buildinfo.Version=v1.2.3 \
+//	  -X calmdrafts/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X calmdrafts/internal/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info describes the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a dirty working tree
+}
+
+// Get returns the build information, falling back to the VCS details the Go
+// toolchain embeds when ldflags were not used
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	return info
+}
+
+// String returns a one-line human readable description
+func (i Info) String() string {
+	s := "calmdrafts " + i.Version
+	if i.Commit != "" {
+		commit := i.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if i.Modified {
+			commit += "-dirty"
+		}
+		s += fmt.Sprintf(" (commit %s", commit)
+		if i.Date != "" {
+			s += ", built " + i.Date
+		}
+		s += ")"
+	}
+	return s + fmt.Sprintf(" %s %s", i.GoVersion, i.Platform)
+}
+
+// UserAgent identifies CalmDrafts in requests to Google APIs
+func UserAgent() string {
+	i := Get()
+	return fmt.Sprintf("calmdrafts/%s (%s; %s)", i.Version, i.Platform, i.GoVersion)
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"calmdrafts/internal/gmail"
+)
+
+// Snapshot is the last draft list fetched from Gmail, used when Gmail is
+// unreachable
+type Snapshot struct {
+	Time   time.Time      `json:"time"`
+	Drafts []*gmail.Draft `json:"drafts"`
+
+	// When each draft was last seen to change, keyed by draft ID. Drafts
+	// that haven't changed since the first snapshot are missing.
+	Changed map[string]time.Time `json:"changed,omitempty"`
+}
+
+// Update stores drafts as the current snapshot, replacing the file
+// atomically. A draft whose content differs from the previous snapshot, or
+// that wasn't in it, is recorded as changed now, and its Edits are counted
+// with CountEdits. It returns when each draft last changed.
+func Update(path string, drafts []*gmail.Draft, now time.Time) (map[string]time.Time, error) {
+	snap := &Snapshot{Time: now, Drafts: drafts, Changed: make(map[string]time.Time)}
+
+	if prev, err := Load(path); err == nil {
+		CountEdits(prev, drafts)
+		before := make(map[string]*gmail.Draft, len(prev.Drafts))
+		for _, d := range prev.Drafts {
+			before[d.ID] = d
+		}
+		for _, d := range drafts {
+			if old, ok := before[d.ID]; !ok || changed(old, d) {
+				snap.Changed[d.ID] = now
+			} else if t, ok := prev.Changed[d.ID]; ok {
+				snap.Changed[d.ID] = t
+			}
+		}
+	}
+
+	return snap.Changed, save(path, snap)
+}
+
+// CountEdits sets the Edits of drafts from a previous snapshot: the count
+// there, plus one when the content changed since. Drafts that weren't in it
+// have none.
+func CountEdits(prev *Snapshot, drafts []*gmail.Draft) {
+	before := make(map[string]*gmail.Draft, len(prev.Drafts))
+	for _, d := range prev.Drafts {
+		before[d.ID] = d
+	}
+	for _, d := range drafts {
+		old, ok := before[d.ID]
+		if !ok {
+			continue
+		}
+		d.Edits = old.Edits
+		if changed(old, d) {
+			d.Edits++
+		}
+	}
+}
+
+// changed reports whether a draft's content differs between two fetches.
+// Content hashes ignore label changes and Gmail saving a draft again without
+// edits. Drafts cached before hashes were stored are compared by message ID,
+// which changes whenever a draft is saved.
+func changed(before, after *gmail.Draft) bool {
+	if before.ContentHash != "" && after.ContentHash != "" {
+		return before.ContentHash != after.ContentHash
+	}
+	return before.MessageID != after.MessageID
+}
+
+// save writes a snapshot atomically
+func save(path string, snap *Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("unable to write draft cache: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("unable to write draft cache: %v", err)
+	}
+	return nil
+}
+
+// Load reads the snapshot stored at path
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no cached drafts")
+		}
+		return nil, fmt.Errorf("unable to read draft cache: %v", err)
+	}
+
+	snap := &Snapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, fmt.Errorf("unable to parse draft cache: %v", err)
+	}
+	return snap, nil
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"calmdrafts/internal/gmail"
+)
+
+func TestUpdateCountsEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drafts.json")
+	now := time.Now()
+	checks := [][]*gmail.Draft{
+		{{ID: "a", ContentHash: "1"}, {ID: "b", ContentHash: "1"}},
+		{{ID: "a", ContentHash: "2"}, {ID: "b", ContentHash: "1", Labels: []string{"Pending"}}},
+		{{ID: "a", ContentHash: "3"}, {ID: "b", ContentHash: "1"}, {ID: "c", ContentHash: "1"}},
+	}
+	for i, drafts := range checks {
+		if _, err := Update(path, drafts, now.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]int{"a": 2, "b": 0, "c": 0}
+	for _, d := range checks[2] {
+		if d.Edits != want[d.ID] {
+			t.Errorf("draft %s has %d edits, want %d", d.ID, d.Edits, want[d.ID])
+		}
+	}
+
+	// Counting again without a change keeps the counts, as commands that
+	// don't update the cache see them
+	snap, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := []*gmail.Draft{{ID: "a", ContentHash: "3"}, {ID: "c", ContentHash: "2"}}
+	CountEdits(snap, again)
+	if again[0].Edits != 2 || again[1].Edits != 1 {
+		t.Errorf("counted %d and %d edits, want 2 and 1", again[0].Edits, again[1].Edits)
+	}
+}
@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/jsonl"
+)
+
+// Event is a change to the drafts folder seen by a check: a draft that
+// appeared or changed, or one that disappeared
+type Event struct {
+	Time    time.Time    `json:"time"`
+	Draft   *gmail.Draft `json:"draft,omitempty"`   // Draft as it was after appearing or changing
+	Removed string       `json:"removed,omitempty"` // ID of a draft that disappeared
+}
+
+// History is an append-only JSON-lines log of changes to the drafts folder,
+// from which the folder can be rebuilt as it was at any check
+type History struct {
+	path string
+}
+
+// OpenHistory returns the draft history stored at path. The file is created
+// on first write.
+func OpenHistory(path string) *History {
+	return &History{path: path}
+}
+
+// Record appends the differences between the previous snapshot, nil for the
+// first check, and the drafts seen now
+func (h *History) Record(prev *Snapshot, drafts []*gmail.Draft, now time.Time) error {
+	before := make(map[string]*gmail.Draft)
+	if prev != nil {
+		for _, d := range prev.Drafts {
+			before[d.ID] = d
+		}
+	}
+
+	events := []*Event{}
+	for _, d := range drafts {
+		if old, ok := before[d.ID]; !ok || changed(old, d) {
+			events = append(events, &Event{Time: now, Draft: d})
+		}
+		delete(before, d.ID)
+	}
+	removed := make([]string, 0, len(before))
+	for id := range before {
+		removed = append(removed, id)
+	}
+	sort.Strings(removed)
+	for _, id := range removed {
+		events = append(events, &Event{Time: now, Removed: id})
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	for _, e := range events {
+		if err := jsonl.Append(h.path, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events reads all events, oldest first
+func (h *History) Events() ([]*Event, error) {
+	f, err := os.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to open draft history: %v", err)
+	}
+	defer f.Close()
+
+	events := []*Event{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("unable to parse draft history: %v", err)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read draft history: %v", err)
+	}
+	return events, nil
+}
+
+// Prune folds events older than maxAge into the state of the drafts folder
+// at that time, so the folder can still be rebuilt from then on. Once the
+// newer events alone exceed maxBytes, the oldest of those are folded too;
+// the folded snapshot itself is always kept. Zero limits are ignored. It
+// returns the number of events dropped.
+func (h *History) Prune(maxAge time.Duration, maxBytes int64) (int, error) {
+	if maxAge <= 0 && maxBytes <= 0 {
+		return 0, nil
+	}
+
+	dropped := 0
+	err := jsonl.Rewrite(h.path, func(lines [][]byte) ([][]byte, bool, error) {
+		events := make([]*Event, len(lines))
+		for i, line := range lines {
+			events[i] = &Event{}
+			if err := json.Unmarshal(line, events[i]); err != nil {
+				return nil, false, fmt.Errorf("unable to parse draft history: %v", err)
+			}
+		}
+
+		cutoff := time.Time{}
+		if maxAge > 0 {
+			cutoff = time.Now().Add(-maxAge)
+		}
+		if maxBytes > 0 {
+			var total int64
+			for i := len(lines) - 1; i >= 0; i-- {
+				total += int64(len(lines[i])) + 1
+				if total > maxBytes {
+					if events[i].Time.After(cutoff) {
+						cutoff = events[i].Time
+					}
+					break
+				}
+			}
+		}
+		if cutoff.IsZero() {
+			return nil, false, nil
+		}
+
+		timeline := NewTimeline(events)
+		baseline := timeline.Advance(cutoff)
+		old := timeline.next
+		if old == 0 || old == len(baseline) {
+			return nil, false, nil
+		}
+
+		kept := make([][]byte, 0, len(baseline)+len(lines)-old)
+		for _, d := range baseline {
+			b, err := json.Marshal(&Event{Time: cutoff, Draft: d})
+			if err != nil {
+				return nil, false, fmt.Errorf("unable to encode draft history: %v", err)
+			}
+			kept = append(kept, b)
+		}
+		kept = append(kept, lines[old:]...)
+		dropped = old - len(baseline)
+		return kept, true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return dropped, nil
+}
+
+// Timeline rebuilds the drafts folder from its history, moving forward in
+// time
+type Timeline struct {
+	events  []*Event
+	next    int
+	drafts  map[string]*gmail.Draft
+	changed map[string]time.Time
+}
+
+// NewTimeline returns a timeline of events, oldest first, starting before
+// the first one
+func NewTimeline(events []*Event) *Timeline {
+	return &Timeline{events: events, drafts: make(map[string]*gmail.Draft), changed: make(map[string]time.Time)}
+}
+
+// Advance applies the events up to t and returns the drafts in the folder
+// at that time, sorted by ID
+func (tl *Timeline) Advance(t time.Time) []*gmail.Draft {
+	for ; tl.next < len(tl.events) && !tl.events[tl.next].Time.After(t); tl.next++ {
+		e := tl.events[tl.next]
+		if e.Draft != nil {
+			tl.drafts[e.Draft.ID] = e.Draft
+			tl.changed[e.Draft.ID] = e.Time
+		} else {
+			delete(tl.drafts, e.Removed)
+			delete(tl.changed, e.Removed)
+		}
+	}
+
+	drafts := make([]*gmail.Draft, 0, len(tl.drafts))
+	for _, d := range tl.drafts {
+		copied := *d
+		drafts = append(drafts, &copied)
+	}
+	sort.Slice(drafts, func(i, j int) bool { return drafts[i].ID < drafts[j].ID })
+	return drafts
+}
+
+// Changed returns when a draft was last seen to change, up to the time the
+// timeline was advanced to
+func (tl *Timeline) Changed(id string) time.Time {
+	return tl.changed[id]
+}
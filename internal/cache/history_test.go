@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"calmdrafts/internal/gmail"
+)
+
+func TestHistoryPrune(t *testing.T) {
+	h := OpenHistory(filepath.Join(t.TempDir(), "drafts-history.jsonl"))
+	now := time.Now()
+	day := func(i int) time.Time {
+		return now.Add(time.Duration(i-4) * 24 * time.Hour)
+	}
+	checks := [][]*gmail.Draft{
+		{{ID: "a", Subject: "Hello", ContentHash: "Hello"}, {ID: "b", Subject: "Lunch", ContentHash: "Lunch"}},
+		{{ID: "a", Subject: "Hello again", ContentHash: "Hello again"}, {ID: "b", Subject: "Lunch", ContentHash: "Lunch"}},
+		{{ID: "a", Subject: "Hello again", ContentHash: "Hello again"}, {ID: "c", Subject: "Invoice", ContentHash: "Invoice"}},
+		{{ID: "a", Subject: "Hello again", ContentHash: "Hello again"}, {ID: "c", Subject: "Invoice, final", ContentHash: "Invoice, final"}},
+	}
+	var prev *Snapshot
+	for i, drafts := range checks {
+		if err := h.Record(prev, drafts, day(i)); err != nil {
+			t.Fatal(err)
+		}
+		prev = &Snapshot{Time: day(i), Drafts: drafts}
+	}
+
+	// The first three checks recorded five events, folded into two
+	dropped, err := h.Prune(36*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 3 {
+		t.Errorf("dropped %d events, want 3", dropped)
+	}
+
+	events, err := h.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeline := NewTimeline(events)
+	for _, tt := range []struct {
+		at      time.Time
+		drafts  []string
+		subject string
+	}{
+		{day(2), nil, ""},
+		{day(3).Add(-time.Hour), []string{"a", "c"}, "Invoice"},
+		{day(3), []string{"a", "c"}, "Invoice, final"},
+	} {
+		drafts := timeline.Advance(tt.at)
+		ids := []string{}
+		for _, d := range drafts {
+			ids = append(ids, d.ID)
+		}
+		if len(ids) != len(tt.drafts) || (len(ids) == 2 && (ids[0] != "a" || ids[1] != "c" || drafts[0].Subject != "Hello again" || drafts[1].Subject != tt.subject)) {
+			t.Errorf("at %v the folder is %+v, want %v with c as %q", tt.at.Sub(now), drafts, tt.drafts, tt.subject)
+		}
+	}
+
+	if dropped, err := h.Prune(36*time.Hour, 0); err != nil || dropped != 0 {
+		t.Errorf("pruning again dropped %d events, %v", dropped, err)
+	}
+}
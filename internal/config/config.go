@@ -2,31 +2,482 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"time"
 )
 
 // Config holds the application configuration
 type Config struct {
-	CheckInterval    time.Duration `json:"check_interval"`    // How often to check drafts (e.g., "1h", "30m")
-	CleanupAge       time.Duration `json:"cleanup_age"`       // Age threshold for deleting empty drafts (default: 7 days)
-	CredentialsPath  string        `json:"credentials_path"`  // Path to Google OAuth credentials JSON
-	TokenPath        string        `json:"token_path"`        // Path to store OAuth token
+	Version int `json:"version"` // Config schema version, see CurrentVersion
+
+	CheckInterval     Duration `json:"check_interval"`                 // How often to check drafts (e.g., "1h", "30m")
+	CleanupAge        Duration `json:"cleanup_age"`                    // Age threshold for deleting empty drafts (default: 7 days)
+	CredentialsPath   string   `json:"credentials_path" secret:"file"` // Path to Google OAuth credentials JSON, or a secret reference to its contents
+	TokenPath         string   `json:"token_path"`                     // Path to store OAuth token
+	Mailbox           string   `json:"mailbox"`                        // Address of a mailbox you are a delegate of; empty for your own
+	PluginsDir        string   `json:"plugins_dir"`                    // Directory containing classifier/, rule/ and notifier/ plugins
+	PolicyPath        string   `json:"policy_path"`                    // Optional YAML policy file whose settings override this config
+	ScriptPath        string   `json:"script_path"`                    // Optional Starlark script deciding keep/delete/stale per draft
+	ReportPath        string   `json:"report_path"`                    // Optional Markdown file rewritten with a triage report after each check
+	ArchiveDir        string   `json:"archive_dir"`                    // Directory where drafts are saved as .eml before deletion; empty disables archiving
+	AuditLogPath      string   `json:"audit_log_path"`                 // JSON-lines log of every deletion and restore; empty disables it
+	StateDir          string   `json:"state_dir"`                      // Directory for local state such as the pending-delete queue
+	GracePeriod       Duration `json:"grace_period"`                   // How long drafts wait in the pending-delete queue before deletion; 0 deletes immediately
+	UserAgent         string   `json:"user_agent"`                     // Extra text appended to the User-Agent sent to Google, e.g. "acme-it-fleet"
+	QuotaProject      string   `json:"quota_project"`                  // Google Cloud project billed for Gmail API quota
+	Locale            string   `json:"locale"`                         // Language of notifications and reports, e.g. "fr" or "ja_JP"; empty uses LANG
+	DryRun            bool     `json:"dry_run"`                        // Report what would be deleted without deleting anything
+	Accessible        bool     `json:"accessible"`                     // Print linear, screen-reader-friendly output without tables, charts or banners
+	ObservationPeriod Duration `json:"observation_period"`             // Only report what would be deleted for this long after the first check, or until "calmdrafts enable-cleanup"; 0 disables
+	MaxDeletions      int      `json:"max_deletions"`                  // Maximum drafts deleted per check; 0 means unlimited
+	UseTrash          bool     `json:"use_trash"`                      // Move drafts to Gmail's Trash, purged after 30 days, instead of deleting them permanently
+	BatchDelete       bool     `json:"batch_delete"`                   // Delete many drafts with one request per 1000 instead of one each; needs the full https://mail.google.com/ scope
+	TrashReminder     Duration `json:"trash_reminder"`                 // Remind about trashed drafts this long before Gmail purges them; 0 disables
+	RecentEditGuard   Duration `json:"recent_edit_guard"`              // Never delete a draft that changed within this period, e.g. while it is open in a compose window
+	MinAge            Duration `json:"min_age"`                        // Never delete a draft younger than this automatically, whatever the rules say; 0 disables
+	DigestDraft       bool     `json:"digest_draft"`                   // Keep a draft listing the stale drafts in Gmail itself, for those who never see desktop notifications
+	TemplatePattern   string   `json:"template_pattern"`               // Regular expression matching the subjects of drafts kept as templates, which are never cleaned up; empty disables
+	Boilerplate       []string `json:"boilerplate,omitempty"`          // Regular expressions for extra signature lines, like mobile signatures, that don't make a draft non-empty
+
+	LargeDraftSize int64 `json:"large_draft_size"` // Drafts of at least this many bytes are flagged in stats and reports; 0 disables
+
+	AbandonedThreshold float64 `json:"abandoned_threshold"`  // Score (0-1) above which non-empty drafts are reported as stale; 0 disables
+	AbandonedModelPath string  `json:"abandoned_model_path"` // Optional JSON weights replacing the built-in abandoned-draft model
+
+	Retention Retention `json:"retention"` // Limits on how much local data is kept
+
+	// Optional business-day ages: weekends and holidays don't count toward
+	// the age of a draft
+	BusinessDays *BusinessDays `json:"business_days,omitempty"`
+
+	// Optional age and schedule per rule: "built-in" (empty drafts),
+	// "plugin", "script" or "abandoned model", e.g. {"built-in": {"min_age":
+	// "3d"}, "abandoned model": {"every": "1w"}}
+	Rules map[string]RuleOptions `json:"rules,omitempty"`
+
+	// Optional rules by recipient domain, e.g. never touching drafts to a
+	// customer, checked in order before every other rule
+	Domains []DomainRule `json:"domains,omitempty"`
+
+	// Optional rules by the mail client that created a draft, e.g. deleting
+	// the empty drafts one buggy client leaves behind sooner
+	Clients []ClientRule `json:"clients,omitempty"`
+
+	// Optional rule for reply drafts whose thread was deleted, or archived
+	// long ago, which are almost always abandoned
+	Orphans *Orphans `json:"orphans,omitempty"`
+
+	// Optional composition of the stages of a check: which classifiers,
+	// action and reporters run, and in what order
+	Pipeline *Pipeline `json:"pipeline,omitempty"`
+
+	// Optional Google Tasks items or Calendar reminders for stale drafts
+	FollowUps *FollowUps `json:"follow_ups,omitempty"`
+
+	// Optional settings for the notification channels
+	Notifications *Notifications `json:"notifications,omitempty"`
+
+	// Optional hard limits on the number of drafts, as a backstop for runaway clients
+	Alarm *Alarm `json:"alarm,omitempty"`
+
+	// Optional send-or-delete nudges for drafts that look ready to send
+	Nudge *Nudge `json:"nudge,omitempty"`
+
+	// Optional commands typed at the start of a draft's subject in Gmail
+	SubjectPrefixes *SubjectPrefixes `json:"subject_prefixes,omitempty"`
+
+	// Optional adaptive timing of the daemon's checks
+	Schedule *Schedule `json:"schedule,omitempty"`
+
+	// Optional settings of the daemon's jobs other than the drafts check,
+	// by name: "trash", "gc" and "watch"
+	Jobs map[string]*Job `json:"jobs,omitempty"`
+
+	// Optional HTTP endpoint receiving Gmail push notifications via Pub/Sub
+	Push *Push `json:"push,omitempty"`
+
+	// Optional Workspace fleet checked with "calmdrafts fleet"
+	Fleet *Fleet `json:"fleet,omitempty"`
+
+	// Optional HTTP endpoint serving the check history to Grafana
+	Grafana *Grafana `json:"grafana,omitempty"`
+
+	// Optional one-click delete and keep links in the triage report
+	ReportActions *ReportActions `json:"report_actions,omitempty"`
+
+	// Optional multi-tenant server started with "calmdrafts serve"
+	Server *Server `json:"server,omitempty"`
+
+	// Optional centrally managed config layered on top of this file
+	RemoteConfig *RemoteSource `json:"remote_config,omitempty"`
+
+	// Mailboxes checked with this config. Each account is a partial config
+	// with a "name", selected with --account. The daemon checks them all;
+	// every other command needs --account.
+	Accounts []json.RawMessage `json:"accounts,omitempty"`
+
+	// Name of the account applied with ApplyAccount, empty when none is
+	Account string `json:"-"`
+
+	// Named sets of overrides selected with --profile. Each profile is a
+	// partial config whose fields replace the top-level values.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+
+	// Settings resolved by ResolveSecrets, with the references they came from
+	secretRefs map[*string]secretRef
+}
+
+// Retention caps the age and size of local data. Zero values mean unlimited.
+type Retention struct {
+	ArchiveMaxAge   Duration `json:"archive_max_age"`   // Delete archived drafts older than this
+	ArchiveMaxBytes int64    `json:"archive_max_bytes"` // Delete the oldest archived drafts once the directory exceeds this size
+	AuditMaxAge     Duration `json:"audit_max_age"`     // Drop audit log entries older than this
+	AuditMaxBytes   int64    `json:"audit_max_bytes"`   // Drop the oldest audit log entries once the file exceeds this size
+	StateMaxAge     Duration `json:"state_max_age"`     // Drop entries older than this from the histories in state_dir
+	StateMaxBytes   int64    `json:"state_max_bytes"`   // Drop the oldest entries once a history in state_dir exceeds this size
+}
+
+// Schedule adapts how often the daemon checks. With Adaptive, checks run
+// every MinInterval while drafts are changing and back off, doubling the wait
+// after each quiet check, up to MaxInterval. check_interval is then unused.
+// On laptops, checks can also be put off while the battery is low or the
+// connection is metered.
+type Schedule struct {
+	Adaptive    bool     `json:"adaptive"`
+	MinInterval Duration `json:"min_interval,omitempty"` // Default: 5m
+	MaxInterval Duration `json:"max_interval,omitempty"` // Default: 4h
+	Align       bool     `json:"align,omitempty"`        // Check at multiples of the interval since midnight, e.g. on the hour with 1h
+
+	MinBattery  int      `json:"min_battery,omitempty"`  // Put off checks while on battery below this percentage; 0 disables
+	SkipMetered bool     `json:"skip_metered,omitempty"` // Put off checks while the connection is metered
+	MaxDeferral Duration `json:"max_deferral,omitempty"` // Check anyway once checks were put off this long. Default: 24h
+
+	SkipMissed bool `json:"skip_missed,omitempty"` // Don't run jobs missed while the daemon was stopped at startup, wait for their next time
+}
+
+// BusinessDays lists the days that don't count toward draft ages
+type BusinessDays struct {
+	Weekend      []string `json:"weekend,omitempty"`       // Default: ["saturday", "sunday"]
+	Holidays     []string `json:"holidays,omitempty"`      // Dates such as "2026-12-25"
+	HolidaysPath string   `json:"holidays_path,omitempty"` // iCalendar (.ics) file whose all-day events are holidays
+}
+
+// RuleOptions limits when a rule acts on a draft
+type RuleOptions struct {
+	MinAge Duration `json:"min_age,omitempty"` // Only act on drafts at least this old; for "built-in", replaces cleanup_age
+	Every  Duration `json:"every,omitempty"`   // Only act this often, e.g. "1w" for weekly stale reports; needs state_dir
+}
+
+// DomainRule applies to drafts addressed to one of its domains. Subdomains
+// match too, so "client.com" covers "eu.client.com".
+type DomainRule struct {
+	Domains       []string `json:"domains"`                  // e.g. ["client.com"]
+	AllRecipients bool     `json:"all_recipients,omitempty"` // Only match when every recipient is in the domains, e.g. internal-only drafts
+	Action        string   `json:"action,omitempty"`         // "keep" excludes the drafts from any automated action
+	MinAge        Duration `json:"min_age,omitempty"`        // No rule acts on the drafts before they are this old
+}
+
+// ClientRule applies to drafts created by one of its mail clients, as
+// detected from their X-Mailer, User-Agent and Message-ID headers
+type ClientRule struct {
+	Clients []string `json:"clients"`           // e.g. ["outlook-connector"]; "unknown" for drafts whose client isn't known, "*" for any
+	Action  string   `json:"action"`            // "keep" excludes the drafts from any automated action; "delete" deletes them once empty and older than min_age
+	MinAge  Duration `json:"min_age,omitempty"` // With "delete", how old an empty draft must be (default: cleanup_age)
+}
+
+// Orphans configures the orphan rule. A reply draft is orphaned when the
+// rest of its thread is deleted, or when none of it is in the inbox and its
+// latest message is older than ArchivedFor.
+type Orphans struct {
+	Action      string   `json:"action,omitempty"`       // "delete" (default), or "stale" to report orphaned replies instead
+	ArchivedFor Duration `json:"archived_for,omitempty"` // Default: 30d
+}
+
+// Pipeline composes a check. A missing list runs every stage of its kind
+// in the default order; an empty one runs none.
+type Pipeline struct {
+	Classifiers []string `json:"classifiers"`      // "plugins", "templates" and "rules"
+	Action      string   `json:"action,omitempty"` // "delete" (default), "quarantine" or "report"
+	Reporters   []string `json:"reporters"`        // "notify", "reminders", "triage" and "stats"
+
+	// Optional timeout and API call budget of each stage: "scan",
+	// "classify", "clean" and "report"
+	Limits map[string]StageLimit `json:"limits,omitempty"`
+}
+
+// StageLimit bounds one stage of a check. Zero means no limit.
+type StageLimit struct {
+	Timeout Duration `json:"timeout,omitempty"`
+	Calls   int      `json:"calls,omitempty"` // Most Gmail and other Google API requests
+}
+
+// Job changes how often one of the daemon's jobs runs
+type Job struct {
+	Every    Duration `json:"every,omitempty"`    // Default depends on the job
+	Disabled bool     `json:"disabled,omitempty"` // Never run the job
+}
+
+// Push configures the webhook receiver for Pub/Sub push subscriptions. A
+// notification triggers a check instead of waiting for the next interval.
+type Push struct {
+	Listen         string `json:"listen"`                    // Address to listen on, e.g. ":8080"
+	Path           string `json:"path,omitempty"`            // URL path of the endpoint (default: /gmail/push)
+	Topic          string `json:"topic,omitempty"`           // Pub/Sub topic Gmail publishes to, e.g. "projects/p/topics/drafts"; empty if the watch is managed elsewhere
+	Token          string `json:"token,omitempty"`           // Shared secret expected in the push endpoint's ?token= parameter
+	Audience       string `json:"audience,omitempty"`        // Expected audience of the OIDC token sent by authenticated push subscriptions
+	ServiceAccount string `json:"service_account,omitempty"` // Email of the service account authenticated push subscriptions use; required with audience
+}
+
+// Grafana configures the endpoint for the Grafana JSON and Infinity
+// datasources, serving draft counts and deletions from the local state
+type Grafana struct {
+	Listen string `json:"listen"`          // Address to listen on, e.g. "127.0.0.1:8092"
+	Token  string `json:"token,omitempty"` // Bearer token Grafana must send; empty accepts every request, and is only allowed on a loopback address
+}
+
+// ReportActions adds links that delete or keep each draft to the triage
+// report. The daemon serves them on a loopback address, so they work in a
+// browser on the same machine while it is running.
+type ReportActions struct {
+	Listen string `json:"listen,omitempty"` // Loopback address to listen on (default: 127.0.0.1:8093)
+}
+
+// FollowUps turns stale drafts into follow-ups, such as a task "Finish email
+// to Bob re: Q3 budget" linking to the draft. Each draft gets at most one.
+// Creating them needs extra OAuth scopes, so the token must be authorized
+// again after enabling this.
+type FollowUps struct {
+	Rules      map[string]string `json:"rules"`                 // Target per stale rule ("script", "abandoned model", or "*" for any): "tasks", "calendar" or "none"
+	TaskList   string            `json:"task_list,omitempty"`   // Google Tasks list ID (default: "@default")
+	CalendarID string            `json:"calendar_id,omitempty"` // Google Calendar ID (default: "primary")
+	Due        Duration          `json:"due"`                   // When the follow-up is due, counted from the check (default: 1d)
+}
+
+// Notifications configures the notification channels
+type Notifications struct {
+	// Events each channel ("desktop", "plugins", "smtp", ...) is limited to, e.g.
+	// {"desktop": ["error", "auth"]}. Channels not listed get every event.
+	Events map[string][]string `json:"events,omitempty"`
+
+	// Identity desktop notifications are shown under: on macOS, the bundle
+	// ID of an installed app, e.g. "com.google.Chrome"
+	AppID string `json:"app_id,omitempty"`
+
+	// Broadcast notifications with wall when there is neither a desktop nor
+	// a terminal to show them in
+	Wall bool `json:"wall,omitempty"`
+
+	// Icons and sounds by channel and event, e.g. {"desktop": {"alarm":
+	// {"sound": "Sosumi"}, "*": {"sound": "none"}}}. "*" matches every
+	// channel or event.
+	Styles map[string]map[string]NotificationStyle `json:"styles,omitempty"`
+
+	// Most notifications each channel gets per hour, e.g. {"plugins": 4}.
+	// Extra ones are dropped and counted in the next one delivered.
+	RateLimits map[string]int `json:"rate_limits,omitempty"`
+
+	// Optional email delivery through an SMTP server, the "smtp" channel
+	SMTP *SMTP `json:"smtp,omitempty"`
+
+	// Optional Matrix room receiving notifications, the "matrix" channel
+	Matrix *Matrix `json:"matrix,omitempty"`
+
+	// Optional MQTT broker receiving events and draft counts, the "mqtt"
+	// channel
+	MQTT *MQTT `json:"mqtt,omitempty"`
+
+	// Optional Apprise URLs reaching any service Apprise supports, the
+	// "apprise" channel
+	Apprise *Apprise `json:"apprise,omitempty"`
+
+	// Optional URL receiving every event as signed JSON, the "webhook"
+	// channel
+	Webhook *Webhook `json:"webhook,omitempty"`
+}
+
+// Webhook posts events as JSON to a URL, retrying failed deliveries
+type Webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"` // Key of the HMAC-SHA256 signature header; best given as an env: or keyring: reference
+	Format string `json:"format,omitempty"` // "calmdrafts" (default), "flat" (alias "zapier" or "make") or "ifttt"
+}
+
+// Apprise delivers notifications to Apprise URLs, through the apprise
+// command or an Apprise API server
+type Apprise struct {
+	URLs    []string `json:"urls"`              // e.g. ["tgram://bottoken/ChatID", "ntfy://topic"]; env: and keyring: work here too
+	Command string   `json:"command,omitempty"` // Default: "apprise" from PATH
+	Server  string   `json:"server,omitempty"`  // Apprise API server, e.g. "http://apprise:8000", instead of the command
 }
 
-// DefaultConfig returns default configuration
+// MQTT publishes events and draft counts to an MQTT broker, for
+// home-automation setups
+type MQTT struct {
+	Broker   string `json:"broker"`              // e.g. "tcp://homeassistant.local:1883" or "ssl://..."
+	Topic    string `json:"topic,omitempty"`     // Topic prefix. Default: "calmdrafts"
+	Username string `json:"username,omitempty"`  // Empty for brokers without authentication
+	Password string `json:"password,omitempty"`  // Best given as an env: or keyring: reference
+	ClientID string `json:"client_id,omitempty"` // Default: "calmdrafts-" and the host name
+}
+
+// Matrix posts notifications to a Matrix room
+type Matrix struct {
+	Homeserver  string `json:"homeserver"`   // e.g. "https://matrix.example.org"
+	AccessToken string `json:"access_token"` // Best given as an env: or keyring: reference
+	RoomID      string `json:"room_id"`      // e.g. "!abcdef:example.org"
+}
+
+// SMTP sends notifications by email through any SMTP server
+type SMTP struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port,omitempty"`     // Default: 465 with "tls", 587 otherwise
+	TLS      string   `json:"tls,omitempty"`      // "starttls" (default), "tls" or "none"
+	Username string   `json:"username,omitempty"` // Empty for relays without authentication
+	Password string   `json:"password,omitempty"` // Best given as an env: or keyring: reference
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// NotificationStyle is how notifications look and sound
+type NotificationStyle struct {
+	Icon  string `json:"icon,omitempty"`  // Path to a PNG icon; empty for the bundled one
+	Sound string `json:"sound,omitempty"` // Sound name, or "none" for silence; empty for the default
+}
+
+// Alarm raises an urgent notification on every channel when the drafts
+// folder grows past a limit, e.g. because a client creates drafts in a loop
+type Alarm struct {
+	MaxDrafts int `json:"max_drafts"` // Alarm when there are more drafts than this; 0 disables
+	MaxEmpty  int `json:"max_empty"`  // Alarm when there are more empty drafts than this; 0 disables
+}
+
+// Nudge asks about drafts that have a recipient and a body but haven't
+// changed in a while: send now, snooze or delete, answered with
+// "calmdrafts nudge"
+type Nudge struct {
+	After  Duration `json:"after"`  // Nudge about drafts unchanged this long (default: 3d)
+	Snooze Duration `json:"snooze"` // How long snoozing postpones the next nudge (default: 1d)
+}
+
+// SubjectPrefixes lets users control CalmDrafts from Gmail by starting a
+// draft's subject with a command. Prefixes are matched ignoring case.
+type SubjectPrefixes struct {
+	Keep       string `json:"keep"`        // Never delete the draft (default: "[keep]")
+	Template   string `json:"template"`    // Keep the draft as a template (default: "[tpl]")
+	AutoDelete string `json:"auto_delete"` // Followed by an age and "]", delete the draft once that old (default: "[auto-del", as in "[auto-del 3d]")
+}
+
+// Fleet lists the Workspace users an admin cleans through a service account
+// with domain-wide delegation. The rest of the config is the policy applied to
+// every user.
+type Fleet struct {
+	ServiceAccountPath string   `json:"service_account_path" secret:"file"` // Service account key JSON with domain-wide delegation for the Gmail scopes
+	Users              []string `json:"users,omitempty"`                    // Addresses of the users to check
+	UsersFile          string   `json:"users_file,omitempty"`               // File with one address per line, added to users
+	OptOutLabel        string   `json:"opt_out_label,omitempty"`            // Users with this Gmail label are skipped (default: "CalmDrafts/Opt out")
+	Dir                string   `json:"dir,omitempty"`                      // Directory for per-user state, archives, audit logs and reports (default: fleet)
+}
+
+// Server hosts CalmDrafts for several end users who connect their mailbox
+// through a hosted OAuth consent flow. The rest of the config is the default
+// policy, which tenants can partly override.
+type Server struct {
+	Listen  string `json:"listen,omitempty"`   // Address to listen on (default: 127.0.0.1:8090)
+	BaseURL string `json:"base_url"`           // Public URL of the server, used for the OAuth redirect, e.g. "https://drafts.example.com"
+	Dir     string `json:"dir,omitempty"`      // Directory for tenant tokens, settings and state (default: tenants in DataDir)
+	KeyPath string `json:"key_path,omitempty"` // 32-byte key encrypting tenant tokens, generated if missing; must be outside Dir (default: tenant.key in DataDir)
+
+	// ReadOnly drops the endpoints that change settings or remove tenants
+	ReadOnly bool `json:"read_only,omitempty"`
+	// DashboardListen is a second address serving only the read-only API,
+	// e.g. for a home dashboard. Onboarding isn't offered there either.
+	DashboardListen string `json:"dashboard_listen,omitempty"`
+
+	// Credentials accepted by the API. Without any, the API refuses every request.
+	Auth *ServerAuth `json:"auth,omitempty"`
+}
+
+// ServerAuth lists who may call the server API and with which role, "read"
+// or "admin"
+type ServerAuth struct {
+	Tokens       []APIToken        `json:"tokens,omitempty"`
+	OIDCAudience string            `json:"oidc_audience,omitempty"` // Accept Google ID tokens issued for this audience
+	Members      map[string]string `json:"members,omitempty"`       // Role per ID token email, e.g. "alice@example.com", or per domain, e.g. "@example.com"
+}
+
+// APIToken is a bearer token for the API, configured by its SHA-256 so the
+// config file doesn't hold the secret
+type APIToken struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Role   string `json:"role"`
+}
+
+// DataDir returns the private per-user directory where the archive, the
+// audit log and the local state are kept unless the config says otherwise:
+// $XDG_STATE_HOME/calmdrafts (by default ~/.local/state/calmdrafts) on Linux
+// and BSD, ~/Library/Application Support/calmdrafts on macOS and
+// %LocalAppData%\calmdrafts on Windows. It is "" when the home directory
+// is unknown.
+func DataDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return filepath.Join(dir, "calmdrafts")
+		}
+	case "darwin":
+		if dir, err := os.UserConfigDir(); err == nil {
+			return filepath.Join(dir, "calmdrafts")
+		}
+	default:
+		if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+			return filepath.Join(dir, "calmdrafts")
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".local", "state", "calmdrafts")
+		}
+	}
+	return ""
+}
+
+// DefaultConfig returns default configuration. The archive, audit log and
+// state live in DataDir, never in whatever directory CalmDrafts happens to
+// be started from.
 func DefaultConfig() *Config {
+	dataDir := DataDir()
 	return &Config{
-		CheckInterval:   1 * time.Hour,
-		CleanupAge:      7 * 24 * time.Hour, // 7 days
+		Version:         CurrentVersion,
+		CheckInterval:   Duration{1 * time.Hour},
+		CleanupAge:      Duration{7 * 24 * time.Hour}, // 7 days
 		CredentialsPath: "credentials.json",
 		TokenPath:       "token.json",
+		PluginsDir:      "plugins",
+		ArchiveDir:      filepath.Join(dataDir, "archive"),
+		AuditLogPath:    filepath.Join(dataDir, "audit.log"),
+		StateDir:        filepath.Join(dataDir, "state"),
+		RecentEditGuard: Duration{15 * time.Minute},
+		TrashReminder:   Duration{5 * 24 * time.Hour},
+		LargeDraftSize:  10 << 20, // 10 MiB
+		TemplatePattern: `(?i)^\[(tpl|template)\]`,
+		Retention: Retention{
+			ArchiveMaxAge:   Duration{90 * 24 * time.Hour},
+			ArchiveMaxBytes: 100 << 20, // 100 MiB
+			AuditMaxAge:     Duration{365 * 24 * time.Hour},
+			AuditMaxBytes:   10 << 20, // 10 MiB
+			StateMaxAge:     Duration{365 * 24 * time.Hour},
+			StateMaxBytes:   10 << 20, // 10 MiB
+		},
 	}
 }
 
 // LoadConfig loads configuration from a JSON file
 func LoadConfig(path string) (*Config, error) {
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		// Return default config if file doesn't exist
 		if os.IsNotExist(err) {
@@ -34,19 +485,124 @@ func LoadConfig(path string) (*Config, error) {
 		}
 		return nil, err
 	}
-	defer file.Close()
 
-	config := &Config{}
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(config); err != nil {
+	// Upgrade files written by older releases
+	data, err = migrateFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start from defaults so fields missing from the file keep sensible values
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+
+	if config.RemoteConfig != nil {
+		if err := config.applyRemote(); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.PolicyPath != "" {
+		policy, err := LoadPolicy(config.PolicyPath)
+		if err != nil {
+			return nil, err
+		}
+		config.ApplyPolicy(policy)
+	}
+
+	if err := config.ResolveSecrets(); err != nil {
 		return nil, err
 	}
 
 	return config, nil
 }
 
+// ApplyProfile overrides the configuration with the fields of a named profile
+func (c *Config) ApplyProfile(name string) error {
+	raw, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+
+	// Decoding into the existing config only replaces fields the profile sets
+	profiles := c.Profiles
+	if err := json.Unmarshal(raw, c); err != nil {
+		return fmt.Errorf("invalid profile %q: %v", name, err)
+	}
+	c.Profiles = profiles
+
+	return c.ResolveSecrets()
+}
+
+// AccountNames returns the names of the configured accounts, in config order
+func (c *Config) AccountNames() ([]string, error) {
+	names := make([]string, 0, len(c.Accounts))
+	seen := make(map[string]bool)
+	for i, raw := range c.Accounts {
+		var account struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(raw, &account); err != nil {
+			return nil, fmt.Errorf("invalid account %d: %v", i+1, err)
+		}
+		if account.Name == "" {
+			return nil, fmt.Errorf("account %d has no name", i+1)
+		}
+		if seen[account.Name] {
+			return nil, fmt.Errorf("account %q is listed twice", account.Name)
+		}
+		seen[account.Name] = true
+		names = append(names, account.Name)
+	}
+	return names, nil
+}
+
+// ApplyAccount overrides the configuration with the fields of a named
+// account. An account that doesn't set state_dir, archive_dir or
+// audit_log_path keeps them in a subdirectory named after it, so accounts
+// never share queues, history, archived drafts or deletions.
+func (c *Config) ApplyAccount(name string) error {
+	names, err := c.AccountNames()
+	if err != nil {
+		return err
+	}
+	for i, n := range names {
+		if n != name {
+			continue
+		}
+		accounts, profiles := c.Accounts, c.Profiles
+		stateDir, archiveDir, auditLogPath := c.StateDir, c.ArchiveDir, c.AuditLogPath
+		if err := json.Unmarshal(c.Accounts[i], c); err != nil {
+			return fmt.Errorf("invalid account %q: %v", name, err)
+		}
+		c.Accounts, c.Profiles, c.Account = accounts, profiles, name
+
+		if c.StateDir == stateDir && stateDir != "" {
+			c.StateDir = filepath.Join(stateDir, name)
+		}
+		if c.ArchiveDir == archiveDir && archiveDir != "" {
+			c.ArchiveDir = filepath.Join(archiveDir, name)
+		}
+		if c.AuditLogPath == auditLogPath && auditLogPath != "" {
+			c.AuditLogPath = filepath.Join(filepath.Dir(auditLogPath), name, filepath.Base(auditLogPath))
+		}
+		return c.ResolveSecrets()
+	}
+	return fmt.Errorf("unknown account %q (available: %s)", name, strings.Join(names, ", "))
+}
+
 // SaveConfig saves configuration to a JSON file
 func SaveConfig(path string, config *Config) error {
+	config.Version = CurrentVersion
+	defer config.withSecretRefs()()
+
 	file, err := os.Create(path)
 	if err != nil {
 		return err
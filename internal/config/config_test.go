@@ -0,0 +1,42 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyAccountKeepsAccountsApart(t *testing.T) {
+	c := DefaultConfig()
+	data := `{
+		"state_dir": "data/state",
+		"archive_dir": "data/archive",
+		"audit_log_path": "data/audit.log",
+		"accounts": [{"name": "work"}, {"name": "personal", "audit_log_path": "personal.log"}]
+	}`
+	if err := json.Unmarshal([]byte(data), c); err != nil {
+		t.Fatal(err)
+	}
+
+	work := *c
+	if err := work.ApplyAccount("work"); err != nil {
+		t.Fatal(err)
+	}
+	for want, got := range map[string]string{
+		filepath.Join("data", "state", "work"):     work.StateDir,
+		filepath.Join("data", "archive", "work"):   work.ArchiveDir,
+		filepath.Join("data", "work", "audit.log"): work.AuditLogPath,
+	} {
+		if got != want {
+			t.Errorf("work account uses %s, want %s", got, want)
+		}
+	}
+
+	personal := *c
+	if err := personal.ApplyAccount("personal"); err != nil {
+		t.Fatal(err)
+	}
+	if personal.AuditLogPath != "personal.log" {
+		t.Errorf("personal account logs to %s, want its own personal.log", personal.AuditLogPath)
+	}
+}
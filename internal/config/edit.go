@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// object is a JSON object that remembers the order of its keys so edited
+// files keep their layout
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// SetValue sets a single field in the config file at path, creating the file
+// if needed. Nested fields use dots (retention.archive_max_age). The value
+// is parsed as JSON when possible and treated as a string otherwise, so both
+// "0.7" and "14d" work. The result must still load as a valid config.
+func SetValue(path, key, value string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	root := &object{values: make(map[string]interface{})}
+	if len(bytes.TrimSpace(data)) > 0 {
+		data, err = migrateFile(path, data)
+		if err != nil {
+			return err
+		}
+		decoded, err := decodeOrdered(json.NewDecoder(bytes.NewReader(data)))
+		if err != nil {
+			return fmt.Errorf("unable to parse %s: %v", path, err)
+		}
+		obj, ok := decoded.(*object)
+		if !ok {
+			return fmt.Errorf("%s does not contain a JSON object", path)
+		}
+		root = obj
+	} else {
+		root.set("version", json.Number(fmt.Sprint(CurrentVersion)))
+	}
+
+	var parsed interface{} = value
+	if json.Valid([]byte(value)) {
+		parsed, _ = decodeOrdered(json.NewDecoder(strings.NewReader(value)))
+	}
+
+	// Walk to the parent object, creating intermediate objects
+	parts := strings.Split(key, ".")
+	obj := root
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := obj.values[part].(*object)
+		if !ok {
+			child = &object{values: make(map[string]interface{})}
+			obj.set(part, child)
+		}
+		obj = child
+	}
+	obj.set(parts[len(parts)-1], parsed)
+
+	var buf bytes.Buffer
+	writeOrdered(&buf, root, "")
+	buf.WriteString("\n")
+
+	// Refuse to write a file that would no longer load
+	check := DefaultConfig()
+	decoder := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(check); err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// GetValue returns the effective value of a field, including defaults, as
+// JSON. An empty key returns the whole config.
+func GetValue(config *Config, key string) (string, error) {
+	// Never print resolved secrets
+	restore := config.withSecretRefs()
+	data, err := json.Marshal(config)
+	restore()
+	if err != nil {
+		return "", err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return "", err
+	}
+
+	if key != "" {
+		for _, part := range strings.Split(key, ".") {
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("unknown config key %q", key)
+			}
+			if value, ok = m[part]; !ok {
+				return "", fmt.Errorf("unknown config key %q", key)
+			}
+		}
+	}
+
+	// Print plain strings without quotes
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	out, err := json.MarshalIndent(value, "", "  ")
+	return string(out), err
+}
+
+// set assigns a value, appending the key if it is new
+func (o *object) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// decodeOrdered reads the next JSON value, keeping object key order and
+// numbers as written
+func decodeOrdered(d *json.Decoder) (interface{}, error) {
+	d.UseNumber()
+	tok, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := &object{values: make(map[string]interface{})}
+		for d.More() {
+			keyTok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(keyTok.(string), value)
+		}
+		_, err := d.Token() // closing brace
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for d.More() {
+			value, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err := d.Token() // closing bracket
+		return arr, err
+	default:
+		return tok, nil
+	}
+}
+
+// writeOrdered encodes a value decoded by decodeOrdered with two-space indentation
+func writeOrdered(buf *bytes.Buffer, value interface{}, indent string) {
+	switch v := value.(type) {
+	case *object:
+		if len(v.keys) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{\n")
+		for i, key := range v.keys {
+			k, _ := json.Marshal(key)
+			buf.WriteString(indent + "  ")
+			buf.Write(k)
+			buf.WriteString(": ")
+			writeOrdered(buf, v.values[key], indent+"  ")
+			if i < len(v.keys)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteString("[\n")
+		for i, item := range v {
+			buf.WriteString(indent + "  ")
+			writeOrdered(buf, item, indent+"  ")
+			if i < len(v)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	default:
+		b, _ := json.Marshal(v)
+		buf.Write(b)
+	}
+}
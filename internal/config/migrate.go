@@ -0,0 +1,141 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// CurrentVersion is the config schema version written by this release.
+// Files without a version field are treated as version 1.
+const CurrentVersion = 2
+
+// migration upgrades a decoded config document from one version to the next
+type migration func(doc *object) error
+
+// migrations maps a schema version to the function upgrading it to the next
+// version. Add an entry here whenever a field is renamed or restructured.
+var migrations = map[int]migration{
+	1: migrateV1,
+}
+
+// durationFields lists config fields holding durations
+var durationFields = []string{"check_interval", "cleanup_age"}
+
+// migrateV1 rewrites durations that older releases saved as nanosecond
+// numbers into strings like "168h", at the top level and in every profile
+// and account
+func migrateV1(doc *object) error {
+	convert := func(o *object) error {
+		for _, field := range durationFields {
+			if n, ok := o.values[field].(json.Number); ok {
+				f, err := n.Float64()
+				if err != nil {
+					return fmt.Errorf("%s: %v", field, err)
+				}
+				o.values[field] = time.Duration(f).String()
+			}
+		}
+		return nil
+	}
+
+	if err := convert(doc); err != nil {
+		return err
+	}
+	if profiles, ok := doc.values["profiles"].(*object); ok {
+		for _, name := range profiles.keys {
+			if profile, ok := profiles.values[name].(*object); ok {
+				if err := convert(profile); err != nil {
+					return fmt.Errorf("profiles.%s.%v", name, err)
+				}
+			}
+		}
+	}
+	if accounts, ok := doc.values["accounts"].([]interface{}); ok {
+		for i, a := range accounts {
+			if account, ok := a.(*object); ok {
+				if err := convert(account); err != nil {
+					return fmt.Errorf("accounts[%d].%v", i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// migrateData upgrades a config document to CurrentVersion and returns it
+// along with the version the document started at. The keys keep their
+// order, so a migrated file still reads like the one its owner wrote.
+func migrateData(data []byte) ([]byte, int, error) {
+	decoded, err := decodeOrdered(json.NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		return nil, 0, err
+	}
+	doc, ok := decoded.(*object)
+	if !ok {
+		return nil, 0, fmt.Errorf("the config is not a JSON object")
+	}
+
+	version := 1
+	if v, ok := doc.values["version"].(json.Number); ok {
+		n, err := v.Int64()
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid version %s", v)
+		}
+		version = int(n)
+	}
+	if version > CurrentVersion {
+		return nil, version, fmt.Errorf("config version %d is newer than supported version %d; please upgrade CalmDrafts", version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return data, version, nil
+	}
+
+	for v := version; v < CurrentVersion; v++ {
+		if m, ok := migrations[v]; ok {
+			if err := m(doc); err != nil {
+				return nil, version, fmt.Errorf("unable to migrate config from version %d: %v", v, err)
+			}
+		}
+	}
+	if _, ok := doc.values["version"]; !ok {
+		doc.keys = append([]string{"version"}, doc.keys...)
+	}
+	doc.values["version"] = json.Number(strconv.Itoa(CurrentVersion))
+
+	var buf bytes.Buffer
+	writeOrdered(&buf, doc, "")
+	buf.WriteString("\n")
+	return buf.Bytes(), version, nil
+}
+
+// migrateFile upgrades the config file at path, keeping a backup of the
+// original next to it, and returns the migrated contents. Saving is best
+// effort: a config in a read-only location is migrated in memory on every
+// start instead.
+func migrateFile(path string, data []byte) ([]byte, error) {
+	migrated, version, err := migrateData(data)
+	if err != nil {
+		return nil, err
+	}
+	if version == CurrentVersion {
+		return data, nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backup, data, 0600); err != nil {
+		log.Printf("Warning: using %s migrated from version %d to %d without saving it, since it can't be backed up: %v", path, version, CurrentVersion, err)
+		return migrated, nil
+	}
+	if err := os.WriteFile(path, migrated, 0600); err != nil {
+		log.Printf("Warning: using %s migrated from version %d to %d without saving it: %v", path, version, CurrentVersion, err)
+		return migrated, nil
+	}
+	fmt.Printf("Migrated %s from version %d to %d (backup: %s)\n", path, version, CurrentVersion, backup)
+
+	return migrated, nil
+}
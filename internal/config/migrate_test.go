@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		want   string
+		backup string // Name of the backup written, empty for none
+	}{
+		{
+			name: "durations",
+			in:   `{"check_interval": 3600000000000, "cleanup_age": 604800000000000, "dry_run": true}`,
+			want: `{
+  "version": 2,
+  "check_interval": "1h0m0s",
+  "cleanup_age": "168h0m0s",
+  "dry_run": true
+}
+`,
+			backup: "config.json.v1.bak",
+		},
+		{
+			name: "profiles and accounts",
+			in:   `{"version": 1, "cleanup_age": "72h", "profiles": {"travel": {"check_interval": 21600000000000}}, "accounts": [{"name": "work", "cleanup_age": 1209600000000000}, {"name": "home", "mailbox": "me@example.com"}]}`,
+			want: `{
+  "version": 2,
+  "cleanup_age": "72h",
+  "profiles": {
+    "travel": {
+      "check_interval": "6h0m0s"
+    }
+  },
+  "accounts": [
+    {
+      "name": "work",
+      "cleanup_age": "336h0m0s"
+    },
+    {
+      "name": "home",
+      "mailbox": "me@example.com"
+    }
+  ]
+}
+`,
+			backup: "config.json.v1.bak",
+		},
+		{
+			name: "current version",
+			in:   `{"version": 2, "accounts": [{"name": "work", "cleanup_age": 1209600000000000}]}`,
+			want: `{"version": 2, "accounts": [{"name": "work", "cleanup_age": 1209600000000000}]}`,
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(path, []byte(tt.in), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		migrated, err := migrateFile(path, []byte(tt.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(migrated) != tt.want {
+			t.Errorf("%s: migrated to\n%s\nwant\n%s", tt.name, migrated, tt.want)
+		}
+		if saved, _ := os.ReadFile(path); string(saved) != tt.want {
+			t.Errorf("%s: saved\n%s\nwant\n%s", tt.name, saved, tt.want)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backups := []string{}
+		for _, entry := range entries {
+			if entry.Name() != "config.json" {
+				backups = append(backups, entry.Name())
+			}
+		}
+		if tt.backup == "" {
+			if len(backups) != 0 {
+				t.Errorf("%s: wrote %v, want no backup", tt.name, backups)
+			}
+			continue
+		}
+		if len(backups) != 1 || backups[0] != tt.backup {
+			t.Errorf("%s: wrote %v, want the backup %s", tt.name, backups, tt.backup)
+			continue
+		}
+		if backup, _ := os.ReadFile(filepath.Join(dir, tt.backup)); string(backup) != tt.in {
+			t.Errorf("%s: backed up %q, want the original %q", tt.name, backup, tt.in)
+		}
+	}
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := []byte(`{"version": 99}`)
+	if _, err := migrateFile(path, data); err == nil {
+		t.Error("migrated a config from a newer release")
+	}
+}
+
+func TestMigratedAccountsLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := []byte(`{"accounts": [{"name": "work", "cleanup_age": 1209600000000000}]}`)
+	migrated, err := migrateFile(path, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := DefaultConfig()
+	if err := json.Unmarshal(migrated, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ApplyAccount("work"); err != nil {
+		t.Fatal(err)
+	}
+	if c.CleanupAge.Duration != 14*24*time.Hour {
+		t.Errorf("cleanup_age of the migrated account is %v, want 336h", c.CleanupAge.Duration)
+	}
+}
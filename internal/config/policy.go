@@ -0,0 +1,229 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentPolicyVersion is the policy file format version
+const CurrentPolicyVersion = 1
+
+// PolicySchema is the JSON Schema of policy files, for editors and CI
+//
+//go:embed policy.schema.json
+var PolicySchema []byte
+
+// Policy is the cleanup policy kept in its own YAML file, separate from
+// machine-local settings such as token paths, so it can be versioned and
+// reviewed in git. Unset fields leave the config unchanged.
+type Policy struct {
+	Version            int      `yaml:"version"`
+	CleanupAge         string   `yaml:"cleanup_age,omitempty"`
+	GracePeriod        string   `yaml:"grace_period,omitempty"`
+	RecentEditGuard    string   `yaml:"recent_edit_guard,omitempty"`
+	MinAge             string   `yaml:"min_age,omitempty"`
+	TrashReminder      string   `yaml:"trash_reminder,omitempty"`
+	MaxDeletions       *int     `yaml:"max_deletions,omitempty"`
+	AbandonedThreshold *float64 `yaml:"abandoned_threshold,omitempty"`
+	UseTrash           *bool    `yaml:"use_trash,omitempty"`
+	DryRun             *bool    `yaml:"dry_run,omitempty"`
+	Script             string   `yaml:"script,omitempty"`          // Starlark rules, relative to the policy file
+	AbandonedModel     string   `yaml:"abandoned_model,omitempty"` // Model weights, relative to the policy file
+}
+
+// PolicyProblem is an error or warning found by LintPolicy
+type PolicyProblem struct {
+	Line    int
+	Message string
+	Warning bool
+}
+
+func (p PolicyProblem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", p.Line, level, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", level, p.Message)
+}
+
+// policyFields lists the known fields and the YAML kind of their values
+var policyFields = map[string]string{
+	"version":             "!!int",
+	"cleanup_age":         "duration",
+	"grace_period":        "duration",
+	"recent_edit_guard":   "duration",
+	"min_age":             "duration",
+	"trash_reminder":      "duration",
+	"max_deletions":       "!!int",
+	"abandoned_threshold": "number",
+	"use_trash":           "!!bool",
+	"dry_run":             "!!bool",
+	"script":              "path",
+	"abandoned_model":     "path",
+}
+
+// LintPolicy checks a policy file and returns every problem found
+func LintPolicy(path string) []PolicyProblem {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []PolicyProblem{{Message: err.Error()}}
+	}
+
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(data, root); err != nil {
+		return []PolicyProblem{{Message: err.Error()}}
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return []PolicyProblem{{Line: 1, Message: "policy must be a mapping of settings"}}
+	}
+	doc := root.Content[0]
+
+	problems := []PolicyProblem{}
+	add := func(line int, warning bool, format string, args ...any) {
+		problems = append(problems, PolicyProblem{Line: line, Message: fmt.Sprintf(format, args...), Warning: warning})
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		kind, ok := policyFields[key.Value]
+		if !ok {
+			add(key.Line, false, "unknown setting %q", key.Value)
+			continue
+		}
+		if seen[key.Value] {
+			add(key.Line, false, "%s is set twice", key.Value)
+		}
+		seen[key.Value] = true
+
+		if value.Kind != yaml.ScalarNode {
+			add(value.Line, false, "%s must be a single value", key.Value)
+			continue
+		}
+		switch kind {
+		case "duration":
+			d, err := ParseDuration(value.Value)
+			if err != nil {
+				add(value.Line, false, "%s: %v", key.Value, err)
+			} else if d < 0 {
+				add(value.Line, false, "%s must not be negative", key.Value)
+			} else if key.Value == "cleanup_age" && d < time.Hour {
+				add(value.Line, true, "cleanup_age %s deletes drafts that are barely started", value.Value)
+			}
+		case "number":
+			var f float64
+			if err := value.Decode(&f); err != nil {
+				add(value.Line, false, "%s must be a number", key.Value)
+			} else if f < 0 || f > 1 {
+				add(value.Line, false, "%s must be between 0 and 1", key.Value)
+			}
+		case "path":
+			if value.Tag != "!!str" || value.Value == "" {
+				add(value.Line, false, "%s must be a file path", key.Value)
+			} else if _, err := os.Stat(resolvePolicyPath(path, value.Value)); err != nil {
+				add(value.Line, false, "%s: %v", key.Value, err)
+			}
+		default:
+			if value.Tag != kind {
+				add(value.Line, false, "%s must be %s", key.Value, strings.TrimPrefix(kind, "!!"))
+			} else if key.Value == "max_deletions" {
+				var n int
+				if value.Decode(&n) == nil && n < 0 {
+					add(value.Line, false, "max_deletions must not be negative")
+				}
+			}
+		}
+
+		if key.Value == "version" && value.Value != fmt.Sprint(CurrentPolicyVersion) {
+			add(value.Line, false, "unsupported policy version %s (expected %d)", value.Value, CurrentPolicyVersion)
+		}
+	}
+	if !seen["version"] {
+		add(doc.Line, false, "version is missing (use version: %d)", CurrentPolicyVersion)
+	}
+	if !seen["cleanup_age"] && !seen["script"] {
+		add(doc.Line, true, "neither cleanup_age nor script is set, so the policy keeps the local defaults")
+	}
+
+	return problems
+}
+
+// LoadPolicy reads a policy file, refusing it if LintPolicy finds errors
+func LoadPolicy(path string) (*Policy, error) {
+	for _, p := range LintPolicy(path) {
+		if !p.Warning {
+			return nil, fmt.Errorf("invalid policy %s: %s", path, p)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", path, err)
+	}
+	if policy.Script != "" {
+		policy.Script = resolvePolicyPath(path, policy.Script)
+	}
+	if policy.AbandonedModel != "" {
+		policy.AbandonedModel = resolvePolicyPath(path, policy.AbandonedModel)
+	}
+	return policy, nil
+}
+
+// ApplyPolicy overrides the config with the fields the policy sets
+func (c *Config) ApplyPolicy(p *Policy) {
+	durations := []struct {
+		value  string
+		target *Duration
+	}{
+		{p.CleanupAge, &c.CleanupAge},
+		{p.GracePeriod, &c.GracePeriod},
+		{p.RecentEditGuard, &c.RecentEditGuard},
+		{p.MinAge, &c.MinAge},
+		{p.TrashReminder, &c.TrashReminder},
+	}
+	for _, d := range durations {
+		if d.value != "" {
+			// Already validated by LoadPolicy
+			d.target.Duration, _ = ParseDuration(d.value)
+		}
+	}
+	if p.MaxDeletions != nil {
+		c.MaxDeletions = *p.MaxDeletions
+	}
+	if p.AbandonedThreshold != nil {
+		c.AbandonedThreshold = *p.AbandonedThreshold
+	}
+	if p.UseTrash != nil {
+		c.UseTrash = *p.UseTrash
+	}
+	if p.DryRun != nil {
+		c.DryRun = *p.DryRun
+	}
+	if p.Script != "" {
+		c.ScriptPath = p.Script
+	}
+	if p.AbandonedModel != "" {
+		c.AbandonedModelPath = p.AbandonedModel
+	}
+}
+
+// resolvePolicyPath makes a path in a policy relative to the policy file
+func resolvePolicyPath(policyPath, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(policyPath), path)
+}
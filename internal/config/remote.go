@@ -0,0 +1,285 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RemoteSource describes a centrally managed config that is layered on top of
+// the local file. Exactly one of URL or GitDir must be set.
+type RemoteSource struct {
+	URL       string `json:"url,omitempty"`        // HTTPS URL of a JSON config
+	GitDir    string `json:"git_dir,omitempty"`    // Local clone of a git repository, pulled before reading
+	File      string `json:"file,omitempty"`       // Config file inside GitDir (default: config.json)
+	SHA256    string `json:"sha256,omitempty"`     // Expected hex SHA-256 of the remote config
+	PublicKey string `json:"public_key,omitempty"` // Base64 Ed25519 key verifying a detached signature (<url>.sig or <file>.sig)
+	CacheDir  string `json:"cache_dir,omitempty"`  // Where the last good copy is kept (default: user cache directory)
+}
+
+// remoteTimeout bounds how long fetching a remote config may take
+const remoteTimeout = 30 * time.Second
+
+// applyRemote fetches the remote config, verifies it, and decodes it on top of
+// c. Machine-local settings such as credential paths are never overridden,
+// see keepLocal.
+// When the source is unreachable the last verified copy is used.
+func (c *Config) applyRemote() error {
+	src := c.RemoteConfig
+	if (src.URL == "") == (src.GitDir == "") {
+		return fmt.Errorf("remote_config needs exactly one of url or git_dir")
+	}
+	if src.SHA256 == "" && src.PublicKey == "" {
+		return fmt.Errorf("remote_config needs sha256 or public_key to verify the remote config")
+	}
+
+	cachePath, err := src.cachePath()
+	if err != nil {
+		return err
+	}
+
+	data, sig, fetchErr := src.fetch()
+	if fetchErr == nil {
+		if err := src.verify(data, sig); err != nil {
+			return fmt.Errorf("remote config rejected: %v", err)
+		}
+		if err := writeCache(cachePath, data, sig); err != nil {
+			return err
+		}
+	} else {
+		// Fall back to the cached copy, verifying it again in case the pin changed
+		data, sig, err = readCache(cachePath)
+		if err != nil {
+			return fmt.Errorf("unable to fetch remote config (%v) and no cached copy is available", fetchErr)
+		}
+		if err := src.verify(data, sig); err != nil {
+			return fmt.Errorf("cached remote config rejected: %v", err)
+		}
+	}
+
+	return c.layerRemote(data)
+}
+
+// layerRemote decodes a verified remote config on top of c, keeping the
+// settings listed in keepLocal
+func (c *Config) layerRemote(data []byte) error {
+	data, _, err := migrateData(data)
+	if err != nil {
+		return fmt.Errorf("invalid remote config: %v", err)
+	}
+
+	local := *c
+	c.detachLocal()
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("invalid remote config: %v", err)
+	}
+	c.keepLocal(&local)
+
+	return nil
+}
+
+// detachLocal drops the references c shares with its local copy before the
+// remote config is decoded, since decoding writes into existing pointers,
+// maps and slices. Settings kept local are cleared, as keepLocal restores
+// them whole; business_days is copied, as only its holidays_path is kept.
+func (c *Config) detachLocal() {
+	c.RemoteConfig = nil
+	c.Notifications = nil
+	c.Push = nil
+	c.Fleet = nil
+	c.Grafana = nil
+	c.ReportActions = nil
+	c.Server = nil
+	c.Accounts = nil
+	c.Profiles = nil
+	if c.BusinessDays != nil {
+		days := *c.BusinessDays
+		c.BusinessDays = &days
+	}
+}
+
+// keepLocal restores the settings a remote config may not change: the
+// credentials, every path CalmDrafts reads, writes or runs code from, and
+// everything that sends data elsewhere or listens on the network, so a
+// compromised source can't redirect drafts or run code on every machine.
+// Which mailboxes are cleaned and which project is billed stay local as
+// well. Accounts and profiles stay local too, since they can set all of
+// these.
+func (c *Config) keepLocal(local *Config) {
+	c.CredentialsPath = local.CredentialsPath
+	c.TokenPath = local.TokenPath
+	c.Mailbox = local.Mailbox
+	c.QuotaProject = local.QuotaProject
+	c.RemoteConfig = local.RemoteConfig
+	c.PluginsDir = local.PluginsDir
+	c.PolicyPath = local.PolicyPath
+	c.ScriptPath = local.ScriptPath
+	c.ReportPath = local.ReportPath
+	c.ArchiveDir = local.ArchiveDir
+	c.AuditLogPath = local.AuditLogPath
+	c.StateDir = local.StateDir
+	c.AbandonedModelPath = local.AbandonedModelPath
+	c.Notifications = local.Notifications
+	c.Push = local.Push
+	c.Fleet = local.Fleet
+	c.Grafana = local.Grafana
+	c.ReportActions = local.ReportActions
+	c.Server = local.Server
+	c.Accounts = local.Accounts
+	c.Profiles = local.Profiles
+	if c.BusinessDays != nil {
+		c.BusinessDays.HolidaysPath = ""
+		if local.BusinessDays != nil {
+			c.BusinessDays.HolidaysPath = local.BusinessDays.HolidaysPath
+		}
+	}
+}
+
+// fetch retrieves the remote config and, when a public key is configured,
+// its detached signature
+func (s *RemoteSource) fetch() (data, sig []byte, err error) {
+	if s.GitDir != "" {
+		return s.fetchGit()
+	}
+
+	if !strings.HasPrefix(s.URL, "https://") {
+		return nil, nil, fmt.Errorf("remote config URL must use https")
+	}
+
+	data, err = httpGet(s.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.PublicKey != "" {
+		sig, err = httpGet(s.URL + ".sig")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return data, sig, nil
+}
+
+// fetchGit pulls the repository and reads the config file from it
+func (s *RemoteSource) fetchGit() (data, sig []byte, err error) {
+	cmd := exec.Command("git", "-C", s.GitDir, "pull", "--ff-only", "--quiet")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("git pull failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	file := s.File
+	if file == "" {
+		file = "config.json"
+	}
+	path := filepath.Join(s.GitDir, file)
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.PublicKey != "" {
+		sig, err = os.ReadFile(path + ".sig")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return data, sig, nil
+}
+
+// verify checks the pinned hash and signature, whichever are configured.
+// A source without either is rejected.
+func (s *RemoteSource) verify(data, sig []byte) error {
+	if s.SHA256 == "" && s.PublicKey == "" {
+		return fmt.Errorf("neither sha256 nor public_key is set")
+	}
+	if s.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), s.SHA256) {
+			return fmt.Errorf("sha256 mismatch")
+		}
+	}
+
+	if s.PublicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(s.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid public_key")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil {
+			return fmt.Errorf("invalid signature encoding")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key), data, decoded) {
+			return fmt.Errorf("signature verification failed")
+		}
+	}
+
+	return nil
+}
+
+// cachePath returns where the last verified copy of this source is stored
+func (s *RemoteSource) cachePath() (string, error) {
+	dir := s.CacheDir
+	if dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to locate cache directory: %v", err)
+		}
+		dir = filepath.Join(userCache, "calmdrafts")
+	}
+
+	key := sha256.Sum256([]byte(s.URL + "|" + s.GitDir + "|" + s.File))
+	return filepath.Join(dir, "remote-config-"+hex.EncodeToString(key[:8])+".json"), nil
+}
+
+// writeCache stores a verified config and its signature
+func writeCache(path string, data, sig []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create cache directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("unable to cache remote config: %v", err)
+	}
+	if sig != nil {
+		if err := os.WriteFile(path+".sig", sig, 0600); err != nil {
+			return fmt.Errorf("unable to cache remote config signature: %v", err)
+		}
+	}
+	return nil
+}
+
+// readCache loads a previously cached config and its signature, if any
+func readCache(path string) (data, sig []byte, err error) {
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err = os.ReadFile(path + ".sig")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	return data, sig, nil
+}
+
+// httpGet downloads a URL, treating non-200 responses as errors
+func httpGet(url string) ([]byte, error) {
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRemoteKeepsLocalSettings(t *testing.T) {
+	c := DefaultConfig()
+	local := `{
+		"credentials_path": "credentials.json",
+		"token_path": "token.json",
+		"mailbox": "me@example.com",
+		"quota_project": "my-project",
+		"plugins_dir": "plugins",
+		"policy_path": "policy.yaml",
+		"script_path": "rules.star",
+		"report_path": "report.md",
+		"archive_dir": "archive",
+		"audit_log_path": "audit.log",
+		"state_dir": "state",
+		"abandoned_model_path": "model.json",
+		"business_days": {"holidays_path": "holidays.ics"},
+		"notifications": {"webhooks": [{"url": "https://hooks.example.com/mine"}]},
+		"push": {"listen": "127.0.0.1:8080", "token": "local"},
+		"fleet": {"service_account_path": "sa.json", "users": ["a@example.com"], "users_file": "users.txt", "dir": "fleet"},
+		"grafana": {"listen": "127.0.0.1:3001", "token": "local"},
+		"report_actions": {"listen": "127.0.0.1:8093"},
+		"server": {"listen": "127.0.0.1:8090", "dir": "tenants"},
+		"remote_config": {"url": "https://config.example.com/calmdrafts.json", "sha256": "00"},
+		"accounts": [{"name": "work"}],
+		"profiles": {"travel": {"dry_run": true}}
+	}`
+	if err := json.Unmarshal([]byte(local), c); err != nil {
+		t.Fatal(err)
+	}
+	before := keptSettings(t, c)
+
+	remote := `{
+		"cleanup_age": "3d",
+		"credentials_path": "/tmp/evil.json",
+		"token_path": "/tmp/evil-token.json",
+		"mailbox": "ceo@example.com",
+		"quota_project": "someone-else",
+		"plugins_dir": "/tmp/plugins",
+		"policy_path": "/tmp/policy.yaml",
+		"script_path": "/tmp/rules.star",
+		"report_path": "/etc/report.md",
+		"archive_dir": "/tmp/archive",
+		"audit_log_path": "/tmp/audit.log",
+		"state_dir": "/tmp/state",
+		"abandoned_model_path": "/tmp/model.json",
+		"business_days": {"weekend": ["friday"], "holidays_path": "/etc/shadow"},
+		"notifications": {"webhooks": [{"url": "https://evil.example.com/"}]},
+		"push": {"listen": "0.0.0.0:80", "token": "evil"},
+		"fleet": {"service_account_path": "/tmp/sa.json", "users": ["ceo@example.com"], "users_file": "/etc/passwd", "dir": "/tmp/fleet"},
+		"grafana": {"listen": "0.0.0.0:3000", "token": "evil"},
+		"report_actions": {"listen": "0.0.0.0:80"},
+		"server": {"listen": "0.0.0.0:80", "dir": "/tmp/tenants"},
+		"remote_config": {"url": "https://evil.example.com/config.json", "sha256": "11"},
+		"accounts": [{"name": "ceo", "mailbox": "ceo@example.com"}],
+		"profiles": {"travel": {"dry_run": false}, "evil": {}}
+	}`
+	if err := c.layerRemote([]byte(remote)); err != nil {
+		t.Fatal(err)
+	}
+
+	after := keptSettings(t, c)
+	for key, want := range before {
+		if after[key] != want {
+			t.Errorf("remote config changed %s to %s, want %s", key, after[key], want)
+		}
+	}
+	if c.CleanupAge.Duration != 3*24*time.Hour {
+		t.Errorf("cleanup_age is %v, want the remote 72h", c.CleanupAge.Duration)
+	}
+	if c.BusinessDays == nil || len(c.BusinessDays.Weekend) != 1 || c.BusinessDays.Weekend[0] != "friday" {
+		t.Errorf("business_days.weekend is %+v, want the remote [friday]", c.BusinessDays)
+	}
+}
+
+// keptSettings encodes every setting a remote config must not change
+func keptSettings(t *testing.T, c *Config) map[string]string {
+	holidays := ""
+	if c.BusinessDays != nil {
+		holidays = c.BusinessDays.HolidaysPath
+	}
+	fields := map[string]any{
+		"credentials_path":            c.CredentialsPath,
+		"token_path":                  c.TokenPath,
+		"mailbox":                     c.Mailbox,
+		"quota_project":               c.QuotaProject,
+		"plugins_dir":                 c.PluginsDir,
+		"policy_path":                 c.PolicyPath,
+		"script_path":                 c.ScriptPath,
+		"report_path":                 c.ReportPath,
+		"archive_dir":                 c.ArchiveDir,
+		"audit_log_path":              c.AuditLogPath,
+		"state_dir":                   c.StateDir,
+		"abandoned_model_path":        c.AbandonedModelPath,
+		"business_days.holidays_path": holidays,
+		"notifications":               c.Notifications,
+		"push":                        c.Push,
+		"fleet":                       c.Fleet,
+		"grafana":                     c.Grafana,
+		"report_actions":              c.ReportActions,
+		"server":                      c.Server,
+		"remote_config":               c.RemoteConfig,
+		"accounts":                    c.Accounts,
+		"profiles":                    c.Profiles,
+	}
+	encoded := make(map[string]string, len(fields))
+	for key, value := range fields {
+		b, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded[key] = string(b)
+	}
+	return encoded
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Secret reference prefixes accepted in any string setting
+const (
+	envPrefix     = "env:"     // env:NAME reads an environment variable
+	keyringPrefix = "keyring:" // keyring:service/account reads the OS keyring
+)
+
+// secretRef is a resolved setting: the reference from the config file and
+// the value it resolved to
+type secretRef struct {
+	ref   string
+	value string
+}
+
+// IsSecretRef reports whether a setting refers to a secret instead of
+// holding it
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, envPrefix) || strings.HasPrefix(value, keyringPrefix)
+}
+
+// ResolveSecrets replaces secret references in string settings, such as
+// "env:SLACK_WEBHOOK" or "keyring:calmdrafts/work-client", with the secrets
+// they point to, so the config file itself holds no secrets. Settings tagged
+// secret:"file" expect a path, so their secret is written to a private file
+// whose path is used instead.
+func (c *Config) ResolveSecrets() error {
+	if c.secretRefs == nil {
+		c.secretRefs = make(map[*string]secretRef)
+	}
+	return resolveSecrets(reflect.ValueOf(c).Elem(), "", c.secretRefs)
+}
+
+// resolveSecrets walks the exported fields of a struct, recording the
+// original reference of every resolved field in refs
+func resolveSecrets(v reflect.Value, prefix string, refs map[*string]secretRef) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		name = prefix + name
+
+		switch value.Kind() {
+		case reflect.String:
+			if err := resolveSecret(value, field, name, refs); err != nil {
+				return err
+			}
+		case reflect.Struct:
+			if err := resolveSecrets(value, name+".", refs); err != nil {
+				return err
+			}
+		case reflect.Pointer:
+			if !value.IsNil() && value.Elem().Kind() == reflect.Struct {
+				if err := resolveSecrets(value.Elem(), name+".", refs); err != nil {
+					return err
+				}
+			}
+		case reflect.Slice:
+			switch value.Type().Elem().Kind() {
+			case reflect.String:
+				for j := 0; j < value.Len(); j++ {
+					if err := resolveSecret(value.Index(j), field, fmt.Sprintf("%s[%d]", name, j), refs); err != nil {
+						return err
+					}
+				}
+			case reflect.Struct:
+				for j := 0; j < value.Len(); j++ {
+					if err := resolveSecrets(value.Index(j), fmt.Sprintf("%s[%d].", name, j), refs); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSecret resolves a string setting holding a secret reference
+func resolveSecret(value reflect.Value, field reflect.StructField, name string, refs map[*string]secretRef) error {
+	ref := value.String()
+	if !IsSecretRef(ref) {
+		return nil
+	}
+	secret, err := lookupSecret(ref)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	if field.Tag.Get("secret") == "file" {
+		if secret, err = secretFile(ref, secret); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	value.SetString(secret)
+	refs[value.Addr().Interface().(*string)] = secretRef{ref: ref, value: secret}
+	return nil
+}
+
+// withSecretRefs puts the references back in place of resolved secrets, so
+// the config can be shown or saved without leaking them, and returns a
+// function restoring the secrets. Settings changed since they were resolved
+// keep their new value.
+func (c *Config) withSecretRefs() func() {
+	secrets := make(map[*string]string, len(c.secretRefs))
+	for field, r := range c.secretRefs {
+		if *field != r.value {
+			continue
+		}
+		secrets[field] = *field
+		*field = r.ref
+	}
+	return func() {
+		for field, secret := range secrets {
+			*field = secret
+		}
+	}
+}
+
+// lookupSecret returns the secret a reference points to
+func lookupSecret(ref string) (string, error) {
+	if name, ok := strings.CutPrefix(ref, envPrefix); ok {
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	}
+
+	name, _ := strings.CutPrefix(ref, keyringPrefix)
+	service, account, ok := strings.Cut(name, "/")
+	if !ok || service == "" || account == "" {
+		return "", fmt.Errorf("invalid keyring reference %q (want keyring:service/account)", ref)
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", fmt.Errorf("the keyring is not supported on %s, use env: instead", runtime.GOOS)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s from the keyring: %v", name, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// secretFile writes a secret to a private file in the user cache directory,
+// named after its reference, and returns the file's path
+func secretFile(ref, secret string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "calmdrafts", "secrets")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(ref))
+	path := filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+	if err := os.WriteFile(path, []byte(secret), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
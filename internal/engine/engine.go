@@ -0,0 +1,269 @@
+// Package engine runs a check of the drafts folder as a pipeline of
+// stages: a Scanner lists the drafts, Classifiers decide what to do with
+// each, a Cleaner acts on the decisions and Reporters tell the user. Each
+// stage is an interface, so it can be tested on its own, replaced, or
+// reused outside the daemon. Each stage can be given its own timeout and
+// API call budget, see Limit.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/runs"
+)
+
+// Scanner lists the drafts of a check into Check.Drafts, along with when
+// each was last seen to change
+type Scanner interface {
+	Scan(ctx context.Context, c *Check) error
+}
+
+// Classifier decides what to do with the drafts of a check, or prepares
+// them for the classifiers after it, filling Check.Decisions
+type Classifier interface {
+	Classify(ctx context.Context, c *Check) error
+}
+
+// Cleaner acts on the decisions of a check: it deletes or queues drafts and
+// collects the stale ones, setting the outcome of every decision
+type Cleaner interface {
+	Clean(ctx context.Context, c *Check) error
+}
+
+// Reporter tells the user what a check found and did. Its error is
+// recorded, but doesn't stop the reporters after it.
+type Reporter interface {
+	Report(ctx context.Context, c *Check) error
+}
+
+// Check is one check of a drafts folder as it goes through the stages
+type Check struct {
+	Now     time.Time
+	DryRun  bool // Report what would be deleted without deleting it
+	Account string
+
+	Drafts    []*gmail.Draft
+	Changed   map[string]time.Time // When each draft was last seen to change, by draft ID
+	Decisions map[string]*Decision // By draft ID
+	Deleted   map[string]bool      // Drafts deleted by this check, or that a dry run would delete
+	Retried   map[string]bool      // Drafts deleted by retrying an earlier check's deletion
+	Stale     []*gmail.Draft       // Most likely abandoned first
+	Failures  map[string]error     // Deletions that failed, by draft ID
+
+	Result *runs.Result
+}
+
+// NewCheck starts a check at now
+func NewCheck(account string, now time.Time, dryRun bool) *Check {
+	result := runs.New(account, now)
+	result.DryRun = dryRun
+	return &Check{
+		Now:       now,
+		DryRun:    dryRun,
+		Account:   account,
+		Changed:   make(map[string]time.Time),
+		Decisions: make(map[string]*Decision),
+		Deleted:   make(map[string]bool),
+		Retried:   make(map[string]bool),
+		Failures:  make(map[string]error),
+		Result:    result,
+	}
+}
+
+// Decision is what the classifier decided for one draft, and what the
+// cleaner then did with it
+type Decision struct {
+	Rule   string  // Which rule decided
+	Reason string  // Why, as recorded in the audit log
+	Delete bool    // The draft qualifies for deletion
+	Stale  bool    // Reported as stale instead of being deleted
+	ByRule bool    // A plugin or the script asked for the deletion, rather than the built-in rule
+	Score  float64 // Abandoned-draft score of stale drafts
+	Trace  []string
+
+	Outcome string // What the check did with the draft, for --explain
+}
+
+// Explain adds a step to the decision trace
+func (d *Decision) Explain(format string, args ...any) {
+	d.Trace = append(d.Trace, fmt.Sprintf(format, args...))
+}
+
+// The stages of a check, in the order they run
+const (
+	StageScan     = "scan"
+	StageClassify = "classify"
+	StageClean    = "clean"
+	StageReport   = "report"
+)
+
+// Stages lists the stages of a check in the order they run
+var Stages = []string{StageScan, StageClassify, StageClean, StageReport}
+
+// Limit bounds one stage of a check, so a slow stage can't use up the
+// time and API quota of those after it
+type Limit struct {
+	Timeout time.Duration // Zero for no timeout
+	Calls   int           // Most API calls the stage may make, zero for no limit
+}
+
+// LimitError is a stage that ran out of time or API calls
+type LimitError struct {
+	Stage string
+	Limit Limit
+	Err   error // context.DeadlineExceeded or gmail.ErrBudgetExhausted
+}
+
+func (e *LimitError) Error() string {
+	if errors.Is(e.Err, gmail.ErrBudgetExhausted) {
+		return fmt.Sprintf("%s stage used up its budget of %d API calls", e.Stage, e.Limit.Calls)
+	}
+	return fmt.Sprintf("%s stage ran out of its %v timeout", e.Stage, e.Limit.Timeout)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// Stopped returns why a stage should stop early: its timeout passed, the
+// check was cancelled or its API call budget is used up. Stages that loop
+// over the drafts check it between drafts.
+func Stopped(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if b := gmail.CallBudgetFrom(ctx); b != nil {
+		return b.Err()
+	}
+	return nil
+}
+
+// Engine runs the stages of a check in order
+type Engine struct {
+	Scanner     Scanner
+	Classifiers []Classifier // In order, each seeing the decisions of those before
+	Cleaner     Cleaner
+	Reporters   []Reporter
+	Limits      map[string]Limit // By stage name, see Stages
+}
+
+// Run runs a check through every stage, timing each and counting its API
+// calls in the check's result. An error in the scanner, classifier or
+// cleaner stops the check; errors of reporters are recorded in the result.
+// A classifier or cleaner that runs out of its limit is recorded too, and
+// the check goes on with the decisions and deletions made so far, so the
+// stages after it still run.
+func (e *Engine) Run(ctx context.Context, c *Check) error {
+	start := time.Now()
+	err := e.stage(ctx, c, StageScan, start, func(ctx context.Context) error {
+		return e.Scanner.Scan(ctx, c)
+	})
+	if err != nil {
+		return err
+	}
+
+	start = time.Now()
+	err = e.stage(ctx, c, StageClassify, start, func(ctx context.Context) error {
+		for _, cl := range e.Classifiers {
+			if err := Stopped(ctx); err != nil {
+				return err
+			}
+			if err := cl.Classify(ctx, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err := overrun(c, err); err != nil {
+		return err
+	}
+
+	start = time.Now()
+	err = e.stage(ctx, c, StageClean, start, func(ctx context.Context) error {
+		return e.Cleaner.Clean(ctx, c)
+	})
+	if err := overrun(c, err); err != nil {
+		return err
+	}
+	c.record()
+
+	err = e.stage(ctx, c, StageReport, time.Now(), func(ctx context.Context) error {
+		for _, r := range e.Reporters {
+			if err := r.Report(ctx, c); err != nil {
+				c.Result.Logf("Error reporting: %v", err)
+			}
+		}
+		return nil
+	})
+	return overrun(c, err)
+}
+
+// stage runs one stage within its limit and records it in the check's
+// result. It returns a LimitError if the stage ran out of its limit.
+func (e *Engine) stage(ctx context.Context, c *Check, name string, start time.Time, run func(ctx context.Context) error) error {
+	limit := e.Limits[name]
+	ctx, budget := gmail.WithCallBudget(ctx, limit.Calls)
+	if limit.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limit.Timeout)
+		defer cancel()
+	}
+
+	err := run(ctx)
+	c.Result.Time(name, start, budget.Calls(), budget.Failures())
+	if budget.Err() != nil {
+		return &LimitError{Stage: name, Limit: limit, Err: budget.Err()}
+	}
+	if limit.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &LimitError{Stage: name, Limit: limit, Err: ctx.Err()}
+	}
+	return err
+}
+
+// overrun records a stage that ran out of its limit and lets the check go
+// on. Other errors are returned.
+func overrun(c *Check, err error) error {
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		c.Result.Logf("Stopped early: %v", err)
+		return nil
+	}
+	return err
+}
+
+// record adds the totals of the check, what it did with each draft and
+// the rules that matched to its result
+func (c *Check) record() {
+	r := c.Result
+	r.Counts.Drafts = len(c.Drafts)
+	r.Counts.Stale = len(c.Stale)
+	r.Counts.Failed = len(c.Failures)
+	r.Counts.Retried = len(c.Retried)
+	for _, draft := range c.Drafts {
+		if draft.IsEmpty {
+			r.Counts.Empty++
+		}
+		if c.Retried[draft.ID] {
+			r.Actions = append(r.Actions, &runs.Action{DraftID: draft.ID, Subject: draft.Subject, Outcome: "deleted, retried from the action queue"})
+			continue
+		}
+		d, ok := c.Decisions[draft.ID]
+		if !ok {
+			continue
+		}
+		if d.Rule != "" && (d.Stale || d.Delete) {
+			r.Rules[d.Rule]++
+		}
+		a := &runs.Action{DraftID: draft.ID, Subject: draft.Subject, Rule: d.Rule, Outcome: d.Outcome, Reason: d.Reason, Trace: d.Trace}
+		if err := c.Failures[draft.ID]; err != nil {
+			a.Outcome, a.Error = "delete failed", err.Error()
+		} else if d.Outcome == "keep" {
+			continue
+		}
+		r.Actions = append(r.Actions, a)
+	}
+}
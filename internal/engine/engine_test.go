@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"calmdrafts/internal/gmail"
+)
+
+// stage is a fake of every stage that runs a function
+type stage struct {
+	fn func(c *Check) error
+}
+
+func (s *stage) Scan(ctx context.Context, c *Check) error     { return s.fn(c) }
+func (s *stage) Classify(ctx context.Context, c *Check) error { return s.fn(c) }
+func (s *stage) Clean(ctx context.Context, c *Check) error    { return s.fn(c) }
+func (s *stage) Report(ctx context.Context, c *Check) error   { return s.fn(c) }
+
+func TestRun(t *testing.T) {
+	scanner := &stage{func(c *Check) error {
+		c.Drafts = []*gmail.Draft{{ID: "r1", IsEmpty: true}, {ID: "r2", Subject: "Offsite"}, {ID: "r3"}, {ID: "r4"}}
+		return nil
+	}}
+	classifier := &stage{func(c *Check) error {
+		c.Decisions["r1"] = &Decision{Rule: "built-in", Delete: true, Reason: "empty"}
+		c.Decisions["r2"] = &Decision{Rule: "abandoned model", Stale: true, Score: 0.9}
+		c.Decisions["r3"] = &Decision{Rule: "built-in", Delete: true}
+		c.Decisions["r4"] = &Decision{}
+		return nil
+	}}
+	cleaner := &stage{func(c *Check) error {
+		c.Decisions["r1"].Outcome = "deleted"
+		c.Deleted["r1"] = true
+		c.Decisions["r2"].Outcome = "stale"
+		c.Stale = append(c.Stale, c.Drafts[1])
+		c.Decisions["r3"].Outcome = "delete failed: quota"
+		c.Failures["r3"] = errors.New("quota")
+		c.Decisions["r4"].Outcome = "keep"
+		return nil
+	}}
+	reported := 0
+	failing := &stage{func(c *Check) error { return errors.New("unreachable") }}
+	reporter := &stage{func(c *Check) error {
+		reported++
+		return nil
+	}}
+
+	c := NewCheck("", time.Now(), false)
+	e := &Engine{Scanner: scanner, Classifiers: []Classifier{classifier}, Cleaner: cleaner, Reporters: []Reporter{failing, reporter}}
+	if err := e.Run(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+
+	if reported != 1 {
+		t.Errorf("reporter ran %d times after a failing reporter, want 1", reported)
+	}
+	if len(c.Result.Errors) != 1 {
+		t.Errorf("recorded errors %q, want the failing reporter's", c.Result.Errors)
+	}
+	counts := c.Result.Counts
+	if counts.Drafts != 4 || counts.Empty != 1 || counts.Stale != 1 || counts.Failed != 1 {
+		t.Errorf("counts %+v, want 4 drafts, 1 empty, 1 stale, 1 failed", counts)
+	}
+	if c.Result.Rules["built-in"] != 2 || c.Result.Rules["abandoned model"] != 1 {
+		t.Errorf("rules %v, want 2 built-in and 1 abandoned model", c.Result.Rules)
+	}
+	outcomes := map[string]string{}
+	for _, a := range c.Result.Actions {
+		outcomes[a.DraftID] = a.Outcome
+	}
+	want := map[string]string{"r1": "deleted", "r2": "stale", "r3": "delete failed"}
+	if len(outcomes) != len(want) {
+		t.Errorf("actions %v, want %v", outcomes, want)
+	}
+	for id, outcome := range want {
+		if outcomes[id] != outcome {
+			t.Errorf("outcome of %s is %q, want %q", id, outcomes[id], outcome)
+		}
+	}
+	if len(c.Result.Stages) != 4 {
+		t.Errorf("timed %d stages, want 4", len(c.Result.Stages))
+	}
+}
+
+func TestRunStopsOnError(t *testing.T) {
+	failed := errors.New("unable to list drafts")
+	ran := false
+	e := &Engine{
+		Scanner:     &stage{func(c *Check) error { return failed }},
+		Classifiers: []Classifier{&stage{func(c *Check) error { ran = true; return nil }}},
+		Cleaner:     &stage{func(c *Check) error { ran = true; return nil }},
+	}
+	if err := e.Run(context.Background(), NewCheck("", time.Now(), false)); err != failed {
+		t.Errorf("Run returned %v, want the scanner's error", err)
+	}
+	if ran {
+		t.Error("later stages ran after the scanner failed")
+	}
+}
+
+func TestRunLimitsStage(t *testing.T) {
+	cleaned, reported := false, false
+	e := &Engine{
+		Scanner: &stage{func(c *Check) error { return nil }},
+		Classifiers: []Classifier{classifierFunc(func(ctx context.Context, c *Check) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})},
+		Cleaner:   &stage{func(c *Check) error { cleaned = true; return nil }},
+		Reporters: []Reporter{&stage{func(c *Check) error { reported = true; return nil }}},
+		Limits:    map[string]Limit{StageClassify: {Timeout: 10 * time.Millisecond}},
+	}
+	c := NewCheck("", time.Now(), false)
+	if err := e.Run(context.Background(), c); err != nil {
+		t.Fatalf("Run returned %v after the classifier ran out of time, want nil", err)
+	}
+	if !cleaned || !reported {
+		t.Errorf("cleaned %v and reported %v after the classifier ran out of time, want both", cleaned, reported)
+	}
+	if len(c.Result.Errors) != 1 {
+		t.Errorf("recorded errors %q, want the classifier's timeout", c.Result.Errors)
+	}
+}
+
+// classifierFunc is a classifier that sees the stage's context
+type classifierFunc func(ctx context.Context, c *Check) error
+
+func (f classifierFunc) Classify(ctx context.Context, c *Check) error { return f(ctx, c) }
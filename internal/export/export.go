@@ -0,0 +1,181 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"calmdrafts/internal/audit"
+	"calmdrafts/internal/stats"
+)
+
+// Format is an export file format
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatParquet Format = "parquet"
+)
+
+// ParseFormat validates a format name
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatCSV, FormatParquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (use csv or parquet)", s)
+}
+
+// row is a record with a fixed column schema. The CSV header must list the
+// same columns, in the same order, as the parquet tags.
+type row interface {
+	csvHeader() []string
+	csvRecord() []string
+}
+
+// ObservationRow is one observation with the age histogram flattened into
+// columns. New columns are only ever appended.
+type ObservationRow struct {
+	Time            int64 `parquet:"time,timestamp"`
+	Drafts          int64 `parquet:"drafts"`
+	Empty           int64 `parquet:"empty"`
+	Deleted         int64 `parquet:"deleted"`
+	Stale           int64 `parquet:"stale"`
+	Pending         int64 `parquet:"pending"`
+	Empty0To1d      int64 `parquet:"empty_0_1d"`
+	Empty1To7d      int64 `parquet:"empty_1_7d"`
+	Empty7To30d     int64 `parquet:"empty_7_30d"`
+	Empty30dPlus    int64 `parquet:"empty_30d_plus"`
+	NonEmpty0To1d   int64 `parquet:"non_empty_0_1d"`
+	NonEmpty1To7d   int64 `parquet:"non_empty_1_7d"`
+	NonEmpty7To30d  int64 `parquet:"non_empty_7_30d"`
+	NonEmpty30dPlus int64 `parquet:"non_empty_30d_plus"`
+	Bytes           int64 `parquet:"bytes"`
+}
+
+// ActionRow is one audit log entry. New columns are only ever appended.
+type ActionRow struct {
+	ID          string `parquet:"id"`
+	Time        int64  `parquet:"time,timestamp"`
+	Action      string `parquet:"action"`
+	DraftID     string `parquet:"draft_id"`
+	MessageID   string `parquet:"message_id"`
+	Subject     string `parquet:"subject"`
+	To          string `parquet:"to"`
+	Reason      string `parquet:"reason"`
+	ArchivePath string `parquet:"archive_path"`
+}
+
+// ObservationRows converts recorded observations to rows
+func ObservationRows(observations []*stats.Observation) []ObservationRow {
+	rows := make([]ObservationRow, 0, len(observations))
+	for _, o := range observations {
+		r := ObservationRow{
+			Time:    o.Time.UnixMilli(),
+			Drafts:  int64(o.Drafts),
+			Empty:   int64(o.Empty),
+			Deleted: int64(o.Deleted),
+			Stale:   int64(o.Stale),
+			Pending: int64(o.Pending),
+			Bytes:   o.Bytes,
+		}
+		if o.Ages != nil {
+			empty := []*int64{&r.Empty0To1d, &r.Empty1To7d, &r.Empty7To30d, &r.Empty30dPlus}
+			nonEmpty := []*int64{&r.NonEmpty0To1d, &r.NonEmpty1To7d, &r.NonEmpty7To30d, &r.NonEmpty30dPlus}
+			for i := range min(len(o.Ages.Empty), len(empty)) {
+				*empty[i] = int64(o.Ages.Empty[i])
+			}
+			for i := range min(len(o.Ages.NonEmpty), len(nonEmpty)) {
+				*nonEmpty[i] = int64(o.Ages.NonEmpty[i])
+			}
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// ActionRows converts audit log entries to rows
+func ActionRows(entries []*audit.Entry) []ActionRow {
+	rows := make([]ActionRow, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, ActionRow{
+			ID:          e.ID,
+			Time:        e.Time.UnixMilli(),
+			Action:      string(e.Action),
+			DraftID:     e.DraftID,
+			MessageID:   e.MessageID,
+			Subject:     e.Subject,
+			To:          e.To,
+			Reason:      e.Reason,
+			ArchivePath: e.ArchivePath,
+		})
+	}
+	return rows
+}
+
+// Write encodes rows in the given format
+func Write[T row](w io.Writer, format Format, rows []T) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, rows)
+	case FormatParquet:
+		pw := parquet.NewGenericWriter[T](w)
+		if _, err := pw.Write(rows); err != nil {
+			return fmt.Errorf("unable to write parquet: %v", err)
+		}
+		if err := pw.Close(); err != nil {
+			return fmt.Errorf("unable to write parquet: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// writeCSV writes a header line followed by one line per row
+func writeCSV[T row](w io.Writer, rows []T) error {
+	cw := csv.NewWriter(w)
+	var zero T
+	if err := cw.Write(zero.csvHeader()); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write(r.csvRecord()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (ObservationRow) csvHeader() []string {
+	return []string{"time", "drafts", "empty", "deleted", "stale", "pending",
+		"empty_0_1d", "empty_1_7d", "empty_7_30d", "empty_30d_plus",
+		"non_empty_0_1d", "non_empty_1_7d", "non_empty_7_30d", "non_empty_30d_plus", "bytes"}
+}
+
+func (r ObservationRow) csvRecord() []string {
+	record := []string{formatTime(r.Time)}
+	for _, n := range []int64{r.Drafts, r.Empty, r.Deleted, r.Stale, r.Pending,
+		r.Empty0To1d, r.Empty1To7d, r.Empty7To30d, r.Empty30dPlus,
+		r.NonEmpty0To1d, r.NonEmpty1To7d, r.NonEmpty7To30d, r.NonEmpty30dPlus, r.Bytes} {
+		record = append(record, strconv.FormatInt(n, 10))
+	}
+	return record
+}
+
+func (ActionRow) csvHeader() []string {
+	return []string{"id", "time", "action", "draft_id", "message_id", "subject", "to", "reason", "archive_path"}
+}
+
+func (r ActionRow) csvRecord() []string {
+	return []string{r.ID, formatTime(r.Time), r.Action, r.DraftID, r.MessageID, r.Subject, r.To, r.Reason, r.ArchivePath}
+}
+
+// formatTime renders a millisecond timestamp as RFC 3339 in UTC
+func formatTime(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
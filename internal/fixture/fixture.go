@@ -0,0 +1,246 @@
+package fixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Response is a recorded API response, stored as one JSON file per request
+type Response struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// emailPattern matches email addresses in recorded bodies
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// Recorder is a RoundTripper that saves every response in Dir with email
+// addresses replaced by stable placeholders, in the body, in the message
+// sources and parts Gmail returns base64-encoded, and in the URL. Message
+// bodies are kept so fixtures reproduce classification problems.
+type Recorder struct {
+	Dir  string
+	Base http.RoundTripper
+
+	mu      sync.Mutex
+	aliases map[string]string
+}
+
+// RoundTrip performs the request and records the response
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := &Response{
+		Method:      req.Method,
+		URL:         r.sanitizeURL(req.URL),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        r.sanitizeBody(body),
+	}
+	if err := r.save(rec, normalizeURL(req.URL)); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// sanitize replaces each distinct email address with userN@example.com
+func (r *Recorder) sanitize(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.aliases == nil {
+		r.aliases = make(map[string]string)
+	}
+	return emailPattern.ReplaceAllStringFunc(s, func(addr string) string {
+		alias, ok := r.aliases[addr]
+		if !ok {
+			alias = fmt.Sprintf("user%d@example.com", len(r.aliases)+1)
+			r.aliases[addr] = alias
+		}
+		return alias
+	})
+}
+
+// sanitizeBody replaces the email addresses of a response. In JSON
+// responses the "raw" message sources and "data" of message parts are
+// base64url-decoded first, so the addresses in their headers and text are
+// replaced too.
+func (r *Recorder) sanitizeBody(body []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return r.sanitize(string(body))
+	}
+	doc = r.sanitizeEncoded(doc, "")
+	sanitized, err := json.Marshal(doc)
+	if err != nil {
+		return r.sanitize(string(body))
+	}
+	return r.sanitize(string(sanitized))
+}
+
+// sanitizeEncoded walks a decoded JSON value and sanitizes the
+// base64url-encoded "raw" and "data" strings in it
+func (r *Recorder) sanitizeEncoded(v any, key string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = r.sanitizeEncoded(child, k)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = r.sanitizeEncoded(child, "")
+		}
+	case string:
+		if key != "raw" && key != "data" {
+			return v
+		}
+		for _, enc := range []*base64.Encoding{base64.URLEncoding, base64.RawURLEncoding} {
+			if decoded, err := enc.DecodeString(v); err == nil {
+				return enc.EncodeToString([]byte(r.sanitize(string(decoded))))
+			}
+		}
+	}
+	return v
+}
+
+// sanitizeURL returns the request URL with the mailbox in its path, such as
+// users/ana@example.com for a delegated mailbox, replaced by "me" and the
+// email addresses in its query replaced like those in bodies
+func (r *Recorder) sanitizeURL(u *url.URL) string {
+	sanitized := withoutMailbox(u)
+	query := sanitized.Query()
+	for name, values := range query {
+		for i, value := range values {
+			values[i] = r.sanitize(value)
+		}
+		query[name] = values
+	}
+	sanitized.RawQuery = query.Encode()
+	return sanitized.String()
+}
+
+// normalizeURL returns the URL a fixture is stored under: the request URL
+// with the mailbox in its path replaced by "me" and any email address in
+// its query by one placeholder, so the file name reveals no address and a
+// replay finds it whichever mailbox the replaying config names
+func normalizeURL(u *url.URL) string {
+	normalized := withoutMailbox(u)
+	if emailPattern.MatchString(normalized.RawQuery) || strings.Contains(normalized.RawQuery, "%40") {
+		query := normalized.Query()
+		for name, values := range query {
+			for i, value := range values {
+				values[i] = emailPattern.ReplaceAllString(value, "user@example.com")
+			}
+			query[name] = values
+		}
+		normalized.RawQuery = query.Encode()
+	}
+	return normalized.String()
+}
+
+// withoutMailbox returns a copy of a Gmail API URL whose users/<mailbox>
+// path segment names "me"
+func withoutMailbox(u *url.URL) *url.URL {
+	c := *u
+	parts := strings.Split(c.Path, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == "users" && parts[i+1] != "me" {
+			parts[i+1] = "me"
+			c.Path = strings.Join(parts, "/")
+			c.RawPath = ""
+			break
+		}
+	}
+	return &c
+}
+
+// save writes a recorded response to the file of the normalized URL
+func (r *Recorder) save(rec *Response, normalized string) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.Dir, 0700); err != nil {
+		return fmt.Errorf("unable to create fixture directory: %v", err)
+	}
+	path := filepath.Join(r.Dir, fileName(rec.Method, normalized))
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("unable to write fixture: %v", err)
+	}
+	return nil
+}
+
+// Replayer is a RoundTripper that answers requests from fixtures recorded
+// in Dir without using the network. Changes such as deletions that were
+// not recorded succeed with an empty response.
+type Replayer struct {
+	Dir string
+}
+
+// RoundTrip returns the recorded response for the request
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	rec := &Response{}
+	data, err := os.ReadFile(filepath.Join(r.Dir, fileName(req.Method, normalizeURL(req.URL))))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, rec); err != nil {
+			return nil, fmt.Errorf("invalid fixture for %s %s: %v", req.Method, req.URL, err)
+		}
+	case os.IsNotExist(err) && req.Method != http.MethodGet:
+		rec = &Response{Status: http.StatusOK, ContentType: "application/json", Body: "{}"}
+	case os.IsNotExist(err):
+		return nil, fmt.Errorf("no fixture recorded for %s %s", req.Method, req.URL)
+	default:
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {rec.ContentType}},
+		Body:          io.NopCloser(bytes.NewReader([]byte(rec.Body))),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}, nil
+}
+
+// fileName derives a stable file name from the request, given its
+// normalized URL
+func fileName(method, url string) string {
+	sum := sha256.Sum256([]byte(method + " " + url))
+	return fmt.Sprintf("%s-%s.json", method, hex.EncodeToString(sum[:8]))
+}
@@ -0,0 +1,224 @@
+package followup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+	"google.golang.org/api/tasks/v1"
+)
+
+// Target is where the follow-up for a stale draft is created
+type Target string
+
+const (
+	TargetNone     Target = "none"
+	TargetTasks    Target = "tasks"    // A Google Tasks item
+	TargetCalendar Target = "calendar" // A Google Calendar event with a reminder
+)
+
+// Scopes lists the OAuth scopes needed on top of the Gmail ones
+var Scopes = []string{tasks.TasksScope, calendar.CalendarEventsScope}
+
+// eventLength is how long calendar reminders block
+const eventLength = 30 * time.Minute
+
+// ParseTarget checks a target name from the config
+func ParseTarget(s string) (Target, error) {
+	switch t := Target(s); t {
+	case TargetNone, TargetTasks, TargetCalendar:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown follow-up target %q (use tasks, calendar or none)", s)
+}
+
+// Item is a follow-up to create for a draft
+type Item struct {
+	Title string
+	Notes string
+	Due   time.Time
+}
+
+// NewItem describes a stale draft as an action, e.g. "Finish email to Bob
+// re: Q3 budget", with the link that opens it
+func NewItem(to, subject, link string, due time.Time) *Item {
+	title := "Finish email"
+	if name := firstRecipient(to); name != "" {
+		title += " to " + name
+	}
+	if subject != "" {
+		title += " re: " + subject
+	}
+	return &Item{Title: title, Notes: "Open the draft: " + link, Due: due}
+}
+
+// firstRecipient returns the display name, or address, of the first recipient
+func firstRecipient(to string) string {
+	addrs, err := mail.ParseAddressList(to)
+	if err != nil || len(addrs) == 0 {
+		return strings.TrimSpace(to)
+	}
+	if addrs[0].Name != "" {
+		return addrs[0].Name
+	}
+	return addrs[0].Address
+}
+
+// Creator creates follow-ups in Google Tasks and Calendar
+type Creator struct {
+	tasks      *tasks.Service
+	calendar   *calendar.Service
+	taskList   string
+	calendarID string
+}
+
+// NewCreator creates the Tasks and Calendar services on top of an HTTP
+// client authorized for Scopes
+func NewCreator(ctx context.Context, httpClient *http.Client, taskList, calendarID string) (*Creator, error) {
+	tasksService, err := tasks.NewService(ctx, option.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Tasks service: %v", err)
+	}
+	calendarService, err := calendar.NewService(ctx, option.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Calendar service: %v", err)
+	}
+	if taskList == "" {
+		taskList = "@default"
+	}
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	return &Creator{tasks: tasksService, calendar: calendarService, taskList: taskList, calendarID: calendarID}, nil
+}
+
+// Create adds the item to target and returns the ID of the created task or
+// event
+func (c *Creator) Create(ctx context.Context, target Target, item *Item) (string, error) {
+	switch target {
+	case TargetTasks:
+		task := &tasks.Task{
+			Title: item.Title,
+			Notes: item.Notes,
+			Due:   item.Due.UTC().Format(time.RFC3339),
+		}
+		created, err := c.tasks.Tasks.Insert(c.taskList, task).Context(ctx).Do()
+		if err != nil {
+			return "", fmt.Errorf("unable to create task: %v", err)
+		}
+		return created.Id, nil
+	case TargetCalendar:
+		event := &calendar.Event{
+			Summary:     item.Title,
+			Description: item.Notes,
+			Start:       &calendar.EventDateTime{DateTime: item.Due.Format(time.RFC3339)},
+			End:         &calendar.EventDateTime{DateTime: item.Due.Add(eventLength).Format(time.RFC3339)},
+			Reminders: &calendar.EventReminders{
+				Overrides:       []*calendar.EventReminder{{Method: "popup", ForceSendFields: []string{"Minutes"}}},
+				ForceSendFields: []string{"UseDefault"},
+			},
+		}
+		created, err := c.calendar.Events.Insert(c.calendarID, event).Context(ctx).Do()
+		if err != nil {
+			return "", fmt.Errorf("unable to create calendar event: %v", err)
+		}
+		return created.Id, nil
+	}
+	return "", fmt.Errorf("no follow-up for target %q", target)
+}
+
+// Entry records the follow-up created for a draft
+type Entry struct {
+	DraftID   string    `json:"draft_id"`
+	Subject   string    `json:"subject,omitempty"`
+	Target    Target    `json:"target"`
+	ID        string    `json:"id"` // Task or event ID
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store remembers which drafts already have a follow-up, so each stale
+// draft gets at most one, stored as a JSON file
+type Store struct {
+	path    string
+	entries map[string]*Entry
+}
+
+// Open loads the store at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, entries: make(map[string]*Entry)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unable to read follow-ups: %v", err)
+	}
+
+	entries := []*Entry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("unable to parse follow-ups: %v", err)
+	}
+	for _, e := range entries {
+		s.entries[e.DraftID] = e
+	}
+	return s, nil
+}
+
+// Get returns the follow-up of a draft, or nil if it has none
+func (s *Store) Get(draftID string) *Entry {
+	return s.entries[draftID]
+}
+
+// Add records a follow-up, setting CreatedAt when unset
+func (s *Store) Add(entry *Entry) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	s.entries[entry.DraftID] = entry
+}
+
+// Prune forgets the follow-ups of drafts that no longer exist
+func (s *Store) Prune(exists func(draftID string) bool) {
+	for id := range s.entries {
+		if !exists(id) {
+			delete(s.entries, id)
+		}
+	}
+}
+
+// Save writes the store atomically
+func (s *Store) Save() error {
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].DraftID < entries[j].DraftID
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("unable to write follow-ups: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("unable to write follow-ups: %v", err)
+	}
+	return nil
+}
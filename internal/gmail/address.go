@@ -0,0 +1,84 @@
+package gmail
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// Address is one recipient of a draft
+type Address struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+// String returns the address as it would appear in a header, e.g.
+// "Ana Lima <ana@example.com>"
+func (a Address) String() string {
+	if a.Name == "" {
+		return a.Email
+	}
+	return a.Name + " <" + a.Email + ">"
+}
+
+// Domain returns the lower-case domain of the address, or "" when it has none
+func (a Address) Domain() string {
+	i := strings.LastIndex(a.Email, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(a.Email[i+1:])
+}
+
+// ParseAddresses splits a To, Cc or Bcc header into addresses. Drafts are
+// often half-written, so when the header isn't a valid address list each
+// comma-separated part is kept as typed.
+func ParseAddresses(header string) []Address {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+	if list, err := mail.ParseAddressList(header); err == nil {
+		addresses := make([]Address, 0, len(list))
+		for _, a := range list {
+			addresses = append(addresses, Address{Name: a.Name, Email: a.Address})
+		}
+		return addresses
+	}
+
+	addresses := []Address{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if a, err := mail.ParseAddress(part); err == nil {
+			addresses = append(addresses, Address{Name: a.Name, Email: a.Address})
+		} else {
+			addresses = append(addresses, Address{Email: part})
+		}
+	}
+	return addresses
+}
+
+// Recipients returns the To, Cc and Bcc addresses of the draft, each once.
+// Drafts cached before the headers were parsed only have the raw To header,
+// which is parsed instead.
+func (d *Draft) Recipients() []Address {
+	to := d.ToAddresses
+	if to == nil {
+		to = ParseAddresses(d.To)
+	}
+
+	recipients := []Address{}
+	seen := make(map[string]bool)
+	for _, list := range [][]Address{to, d.Cc, d.Bcc} {
+		for _, a := range list {
+			key := strings.ToLower(a.Email)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			recipients = append(recipients, a)
+		}
+	}
+	return recipients
+}
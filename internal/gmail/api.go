@@ -0,0 +1,244 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// api is the part of the Gmail API CalmDrafts uses. The rest of the package
+// calls Gmail only through it, so a new version of the generated client
+// library, or a change in how the API behaves, is handled in libraryAPI
+// instead of everywhere Gmail is called. Errors are already translated.
+type api interface {
+	ListDrafts(ctx context.Context, user, query, pageToken string) (ids []string, nextPageToken string, err error)
+	GetDraft(ctx context.Context, user, id, format string) (*gmail.Draft, error)
+	CreateDraft(ctx context.Context, user string, draft *gmail.Draft) (*gmail.Draft, error)
+	UpdateDraft(ctx context.Context, user, id string, draft *gmail.Draft) error
+	DeleteDraft(ctx context.Context, user, id string) error
+	SendDraft(ctx context.Context, user, id string) error
+	TrashMessage(ctx context.Context, user, id string) error
+	BatchDeleteMessages(ctx context.Context, user string, ids []string) error
+	UntrashMessage(ctx context.Context, user, id string) error
+	ModifyMessage(ctx context.Context, user, id string, add, remove []string) error
+	GetAttachment(ctx context.Context, user, messageID, id string) (*gmail.MessagePartBody, error)
+	GetThread(ctx context.Context, user, id string, headers []string) (*gmail.Thread, error)
+	ListLabels(ctx context.Context, user string) ([]*gmail.Label, error)
+	CreateLabel(ctx context.Context, user string, label *gmail.Label) (*gmail.Label, error)
+	Watch(ctx context.Context, user string, req *gmail.WatchRequest) (*gmail.WatchResponse, error)
+	ListHistory(ctx context.Context, user string, startHistoryID uint64, labelID, pageToken string) (*gmail.ListHistoryResponse, error)
+	GetProfile(ctx context.Context, user string) (*gmail.Profile, error)
+}
+
+// libraryAPI implements api with the generated client library pinned in go.mod
+type libraryAPI struct {
+	service *gmail.Service
+}
+
+func (l *libraryAPI) ListDrafts(ctx context.Context, user, query, pageToken string) ([]string, string, error) {
+	call := l.service.Users.Drafts.List(user).Context(ctx)
+	if query != "" {
+		call = call.Q(query)
+	}
+	if pageToken != "" {
+		call = call.PageToken(pageToken)
+	}
+	resp, err := call.Do()
+	if err != nil {
+		return nil, "", translateError(err)
+	}
+	ids := make([]string, 0, len(resp.Drafts))
+	for _, d := range resp.Drafts {
+		ids = append(ids, d.Id)
+	}
+	return ids, resp.NextPageToken, nil
+}
+
+func (l *libraryAPI) GetDraft(ctx context.Context, user, id, format string) (*gmail.Draft, error) {
+	draft, err := l.service.Users.Drafts.Get(user, id).Format(format).Context(ctx).Do()
+	if err != nil {
+		return nil, translateError(err)
+	}
+	// Older responses could leave the message out of a draft being saved
+	if draft.Message == nil {
+		draft.Message = &gmail.Message{}
+	}
+	if draft.Message.Payload == nil {
+		draft.Message.Payload = &gmail.MessagePart{}
+	}
+	return draft, nil
+}
+
+func (l *libraryAPI) CreateDraft(ctx context.Context, user string, draft *gmail.Draft) (*gmail.Draft, error) {
+	created, err := l.service.Users.Drafts.Create(user, draft).Context(ctx).Do()
+	return created, translateError(err)
+}
+
+func (l *libraryAPI) UpdateDraft(ctx context.Context, user, id string, draft *gmail.Draft) error {
+	_, err := l.service.Users.Drafts.Update(user, id, draft).Context(ctx).Do()
+	return translateError(err)
+}
+
+func (l *libraryAPI) DeleteDraft(ctx context.Context, user, id string) error {
+	return translateError(l.service.Users.Drafts.Delete(user, id).Context(ctx).Do())
+}
+
+func (l *libraryAPI) SendDraft(ctx context.Context, user, id string) error {
+	_, err := l.service.Users.Drafts.Send(user, &gmail.Draft{Id: id}).Context(ctx).Do()
+	return translateError(err)
+}
+
+func (l *libraryAPI) TrashMessage(ctx context.Context, user, id string) error {
+	_, err := l.service.Users.Messages.Trash(user, id).Context(ctx).Do()
+	return translateError(err)
+}
+
+func (l *libraryAPI) BatchDeleteMessages(ctx context.Context, user string, ids []string) error {
+	req := &gmail.BatchDeleteMessagesRequest{Ids: ids}
+	return translateError(l.service.Users.Messages.BatchDelete(user, req).Context(ctx).Do())
+}
+
+func (l *libraryAPI) UntrashMessage(ctx context.Context, user, id string) error {
+	_, err := l.service.Users.Messages.Untrash(user, id).Context(ctx).Do()
+	return translateError(err)
+}
+
+func (l *libraryAPI) ModifyMessage(ctx context.Context, user, id string, add, remove []string) error {
+	req := &gmail.ModifyMessageRequest{AddLabelIds: add, RemoveLabelIds: remove}
+	_, err := l.service.Users.Messages.Modify(user, id, req).Context(ctx).Do()
+	return translateError(err)
+}
+
+func (l *libraryAPI) GetAttachment(ctx context.Context, user, messageID, id string) (*gmail.MessagePartBody, error) {
+	body, err := l.service.Users.Messages.Attachments.Get(user, messageID, id).Context(ctx).Do()
+	return body, translateError(err)
+}
+
+func (l *libraryAPI) GetThread(ctx context.Context, user, id string, headers []string) (*gmail.Thread, error) {
+	thread, err := l.service.Users.Threads.Get(user, id).Format("metadata").MetadataHeaders(headers...).Context(ctx).Do()
+	return thread, translateError(err)
+}
+
+func (l *libraryAPI) ListLabels(ctx context.Context, user string) ([]*gmail.Label, error) {
+	resp, err := l.service.Users.Labels.List(user).Context(ctx).Do()
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return resp.Labels, nil
+}
+
+func (l *libraryAPI) CreateLabel(ctx context.Context, user string, label *gmail.Label) (*gmail.Label, error) {
+	created, err := l.service.Users.Labels.Create(user, label).Context(ctx).Do()
+	return created, translateError(err)
+}
+
+func (l *libraryAPI) Watch(ctx context.Context, user string, req *gmail.WatchRequest) (*gmail.WatchResponse, error) {
+	resp, err := l.service.Users.Watch(user, req).Context(ctx).Do()
+	return resp, translateError(err)
+}
+
+func (l *libraryAPI) ListHistory(ctx context.Context, user string, startHistoryID uint64, labelID, pageToken string) (*gmail.ListHistoryResponse, error) {
+	call := l.service.Users.History.List(user).StartHistoryId(startHistoryID).LabelId(labelID).Context(ctx)
+	if pageToken != "" {
+		call = call.PageToken(pageToken)
+	}
+	resp, err := call.Do()
+	return resp, translateError(err)
+}
+
+func (l *libraryAPI) GetProfile(ctx context.Context, user string) (*gmail.Profile, error) {
+	profile, err := l.service.Users.GetProfile(user).Context(ctx).Do()
+	return profile, translateError(err)
+}
+
+// ErrRateLimited is matched by errors from Gmail refusing a request because
+// a quota or rate limit was exceeded
+var ErrRateLimited = errors.New("Gmail rate limit exceeded")
+
+// ErrUnavailable is matched by errors from features Gmail doesn't offer for
+// this mailbox or no longer offers at all
+var ErrUnavailable = errors.New("not available")
+
+// APIError is an error response from Gmail, translated from the client
+// library so callers don't depend on its error types
+type APIError struct {
+	Code    int    // HTTP status code
+	Reason  string // Reason of the first error detail, e.g. "rateLimitExceeded"
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("Gmail API Error %d: %s (%s)", e.Code, e.Message, e.Reason)
+	}
+	return fmt.Sprintf("Gmail API Error %d: %s", e.Code, e.Message)
+}
+
+// Is matches ErrNotFound, ErrRateLimited and ErrUnavailable
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == http.StatusNotFound
+	case ErrRateLimited:
+		return e.Code == http.StatusTooManyRequests || e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded"
+	case ErrUnavailable:
+		return unavailable(e)
+	}
+	return false
+}
+
+// OpError is a failed change to one draft or message. It keeps the error
+// Gmail returned, so callers can tell the cause with errors.Is.
+type OpError struct {
+	Op  string // e.g. "delete draft"
+	ID  string
+	Err error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("unable to %s %s: %v", e.Op, e.ID, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// unavailable reports whether Gmail refused a request because the method,
+// or what it does, isn't offered: it was removed (410) or isn't implemented
+// (501), the mailbox doesn't allow it (failedPrecondition), or the granted
+// scopes don't cover it
+func unavailable(e *APIError) bool {
+	switch e.Code {
+	case http.StatusGone, http.StatusNotImplemented:
+		return true
+	case http.StatusBadRequest:
+		return e.Reason == "failedPrecondition"
+	case http.StatusForbidden:
+		return e.Reason == "insufficientPermissions" || e.Reason == "forbidden"
+	}
+	return false
+}
+
+// translateError turns client library errors into APIError. Other errors,
+// such as network and token errors, are returned as they are.
+func translateError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	e := &APIError{Code: apiErr.Code, Message: apiErr.Message}
+	if len(apiErr.Errors) > 0 {
+		e.Reason = apiErr.Errors[0].Reason
+		if e.Message == "" {
+			e.Message = apiErr.Errors[0].Message
+		}
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(e.Code)
+	}
+	return e
+}
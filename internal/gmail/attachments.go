@@ -0,0 +1,73 @@
+package gmail
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// Attachment is a file attached to a draft
+type Attachment struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+// Attachments downloads every attachment of a draft. Large attachments are
+// fetched separately through the Attachments API.
+func (c *Client) Attachments(ctx context.Context, draftID string) ([]*Attachment, error) {
+	user := c.user
+	draft, err := c.api.GetDraft(ctx, user, draftID, "full")
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch draft %s: %v", draftID, err)
+	}
+
+	attachments := []*Attachment{}
+	var walk func(part *gmail.MessagePart) error
+	walk = func(part *gmail.MessagePart) error {
+		if part == nil {
+			return nil
+		}
+		if part.Filename != "" && part.Body != nil {
+			encoded := part.Body.Data
+			if part.Body.AttachmentId != "" {
+				body, err := c.api.GetAttachment(ctx, user, draft.Message.Id, part.Body.AttachmentId)
+				if err != nil {
+					return fmt.Errorf("unable to download %s: %v", part.Filename, err)
+				}
+				encoded = body.Data
+			}
+			data, err := decodeBase64URL(encoded)
+			if err != nil {
+				return fmt.Errorf("unable to decode %s: %v", part.Filename, err)
+			}
+			attachments = append(attachments, &Attachment{Filename: part.Filename, MimeType: part.MimeType, Data: data})
+		}
+		for _, p := range part.Parts {
+			if err := walk(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(draft.Message.Payload); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// decodeBase64URL decodes Gmail's base64url data, with or without padding
+func decodeBase64URL(s string) ([]byte, error) {
+	data, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		data, err = base64.RawURLEncoding.DecodeString(s)
+	}
+	return data, err
+}
@@ -0,0 +1,72 @@
+package gmail
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// MailScope is the OAuth scope messages.batchDelete needs on top of
+// RequiredScopes, see DeleteDrafts
+const MailScope = gmail.MailGoogleComScope
+
+// batchDeleteSize is the most messages one batchDelete request takes
+const batchDeleteSize = 1000
+
+// deleteWorkers bounds the concurrent requests of DeleteDrafts without
+// batch deletion, well below the per-user rate limit
+const deleteWorkers = 4
+
+// DeleteDrafts deletes many drafts and returns the error of each draft that
+// couldn't be deleted, by draft ID. Drafts that were already gone have
+// ErrNotFound.
+//
+// With batch, the drafts' messages are deleted with messages.batchDelete,
+// up to 1000 per request, which needs MailScope. When Gmail refuses it, the
+// drafts are deleted one request each as without batch, a few at a time. A
+// batch request that fails for another reason is retried draft by draft,
+// so one bad draft doesn't fail the rest.
+func (c *Client) DeleteDrafts(ctx context.Context, drafts []*Draft, batch bool) map[string]error {
+	errs := make(map[string]error)
+	if batch {
+		remaining := []*Draft{}
+		for start := 0; start < len(drafts); start += batchDeleteSize {
+			chunk := drafts[start:min(start+batchDeleteSize, len(drafts))]
+			ids := make([]string, 0, len(chunk))
+			for _, d := range chunk {
+				ids = append(ids, d.MessageID)
+			}
+			err := c.useFeature(FeatureBatch, func() error {
+				return c.api.BatchDeleteMessages(ctx, c.user, ids)
+			})
+			if err != nil {
+				remaining = append(remaining, chunk...)
+			}
+		}
+		drafts = remaining
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan *Draft)
+	for range min(deleteWorkers, len(drafts)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range work {
+				if err := c.DeleteDraft(ctx, d.ID); err != nil {
+					mu.Lock()
+					errs[d.ID] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, d := range drafts {
+		work <- d
+	}
+	close(work)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,91 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// deleteAPI records deletions, refusing batch deletes when batchErr is set
+// and failing the drafts in fail
+type deleteAPI struct {
+	api
+	batchErr error
+	fail     map[string]error
+
+	mu      sync.Mutex
+	batches [][]string
+	deleted []string
+}
+
+func (a *deleteAPI) BatchDeleteMessages(ctx context.Context, user string, ids []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.batches = append(a.batches, ids)
+	return a.batchErr
+}
+
+func (a *deleteAPI) DeleteDraft(ctx context.Context, user, id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.fail[id]; err != nil {
+		return err
+	}
+	a.deleted = append(a.deleted, id)
+	return nil
+}
+
+func numberedDrafts(n int) []*Draft {
+	drafts := make([]*Draft, n)
+	for i := range drafts {
+		drafts[i] = &Draft{ID: fmt.Sprintf("r%d", i), MessageID: fmt.Sprintf("m%d", i)}
+	}
+	return drafts
+}
+
+func TestDeleteDraftsBatch(t *testing.T) {
+	fake := &deleteAPI{}
+	c := &Client{api: fake, user: "me"}
+
+	errs := c.DeleteDrafts(context.Background(), numberedDrafts(2500), true)
+	if len(errs) != 0 {
+		t.Fatalf("errors %v, want none", errs)
+	}
+	if len(fake.batches) != 3 || len(fake.batches[0]) != 1000 || len(fake.batches[2]) != 500 {
+		t.Errorf("batches of %d, want 1000, 1000 and 500", len(fake.batches))
+	}
+	if len(fake.deleted) != 0 {
+		t.Errorf("deleted %d drafts one by one, want none", len(fake.deleted))
+	}
+}
+
+func TestDeleteDraftsFallback(t *testing.T) {
+	fake := &deleteAPI{
+		batchErr: &APIError{Code: http.StatusForbidden, Reason: "insufficientPermissions", Message: "Insufficient Permission"},
+		fail: map[string]error{
+			"r3": &APIError{Code: http.StatusNotFound, Message: "Not Found"},
+			"r7": &APIError{Code: http.StatusInternalServerError, Message: "Backend Error"},
+		},
+	}
+	c := &Client{api: fake, user: "me"}
+
+	errs := c.DeleteDrafts(context.Background(), numberedDrafts(10), true)
+	if !errors.Is(errs["r3"], ErrNotFound) {
+		t.Errorf("r3: %v, want ErrNotFound", errs["r3"])
+	}
+	if errs["r7"] == nil || errors.Is(errs["r7"], ErrNotFound) {
+		t.Errorf("r7: %v, want a deletion error", errs["r7"])
+	}
+	if len(errs) != 2 || len(fake.deleted) != 8 {
+		t.Errorf("%d errors and %d deleted, want 2 and 8", len(errs), len(fake.deleted))
+	}
+
+	// Gmail refused batch deletion, so it isn't tried again
+	c.DeleteDrafts(context.Background(), numberedDrafts(2), true)
+	if len(fake.batches) != 1 {
+		t.Errorf("%d batch requests, want 1", len(fake.batches))
+	}
+}
@@ -0,0 +1,137 @@
+package gmail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// benchmarkSizes are the mailbox sizes benchmarks run against
+var benchmarkSizes = []int{100, 1000, 10000}
+
+// syntheticDraft returns the nth draft of a synthetic mailbox: a mix of
+// empty drafts, plain replies and HTML drafts with an attachment
+func syntheticDraft(n int) *gmail.Draft {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(n) * time.Hour)
+	message := &gmail.Message{Id: fmt.Sprintf("m%d", n), InternalDate: created.UnixMilli(), SizeEstimate: 512}
+	text := func(mimeType, s string) *gmail.MessagePart {
+		return &gmail.MessagePart{MimeType: mimeType, Body: &gmail.MessagePartBody{Size: int64(len(s)), Data: base64.URLEncoding.EncodeToString([]byte(s))}}
+	}
+
+	switch n % 3 {
+	case 0:
+		message.Payload = &gmail.MessagePart{MimeType: "text/plain", Body: &gmail.MessagePartBody{}}
+	case 1:
+		message.Payload = &gmail.MessagePart{
+			MimeType: "multipart/alternative",
+			Headers: []*gmail.MessagePartHeader{
+				{Name: "Subject", Value: fmt.Sprintf("Re: meeting %d", n)},
+				{Name: "To", Value: "alice@example.com"},
+				{Name: "In-Reply-To", Value: "<abc@example.com>"},
+			},
+			Parts: []*gmail.MessagePart{
+				text("text/plain", strings.Repeat("Sounds good. ", 20)),
+				text("text/html", "<div>"+strings.Repeat("Sounds good. ", 20)+"</div>"),
+			},
+		}
+	default:
+		message.Payload = &gmail.MessagePart{
+			MimeType: "multipart/mixed",
+			Headers:  []*gmail.MessagePartHeader{{Name: "Subject", Value: "Report"}},
+			Parts: []*gmail.MessagePart{
+				text("text/html", "<p>See attached</p>"),
+				{MimeType: "application/pdf", Filename: "report.pdf", Body: &gmail.MessagePartBody{Size: 40000, AttachmentId: "a1"}},
+			},
+		}
+	}
+	return &gmail.Draft{Id: fmt.Sprintf("r%d", n), Message: message}
+}
+
+// syntheticMailbox answers drafts.list and drafts.get for size synthetic
+// drafts without network, in pages of 100 like Gmail
+type syntheticMailbox struct {
+	size   int
+	drafts map[string][]byte
+}
+
+func newSyntheticMailbox(size int) *syntheticMailbox {
+	m := &syntheticMailbox{size: size, drafts: make(map[string][]byte, size)}
+	for n := 0; n < size; n++ {
+		d := syntheticDraft(n)
+		data, _ := json.Marshal(d)
+		m.drafts[d.Id] = data
+	}
+	return m
+}
+
+func (m *syntheticMailbox) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if id, ok := strings.CutPrefix(req.URL.Path, "/gmail/v1/users/me/drafts/"); ok {
+		body = m.drafts[id]
+	} else {
+		start, _ := strconv.Atoi(req.URL.Query().Get("pageToken"))
+		page := &gmail.ListDraftsResponse{}
+		for n := start; n < m.size && n < start+100; n++ {
+			page.Drafts = append(page.Drafts, &gmail.Draft{Id: fmt.Sprintf("r%d", n)})
+		}
+		if start+100 < m.size {
+			page.NextPageToken = strconv.Itoa(start + 100)
+		}
+		body, _ = json.Marshal(page)
+	}
+	if body == nil {
+		return &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(bytes.NewReader(body)), Request: req}, nil
+}
+
+func BenchmarkListDrafts(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range benchmarkSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			client, err := NewClient(ctx, "", "", Options{Replay: newSyntheticMailbox(size)})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				drafts, err := client.ListDrafts(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(drafts) != size {
+					b.Fatalf("listed %d drafts, want %d", len(drafts), size)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkClassify(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			payloads := make([]*gmail.MessagePart, size)
+			for n := range payloads {
+				payloads[n] = syntheticDraft(n).Message.Payload
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				for _, payload := range payloads {
+					isEmpty(payload)
+					bodyText(payload)
+				}
+			}
+		})
+	}
+}
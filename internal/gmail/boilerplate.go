@@ -0,0 +1,94 @@
+package gmail
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// Boilerplate lists lines that mail clients add to every new message, such
+// as mobile signatures. A draft whose text is nothing else was never
+// written by anyone. Lines are matched ignoring case, after whitespace is
+// collapsed and trailing punctuation trimmed.
+var Boilerplate = []string{
+	`sent from my .+`,
+	`sent from (outlook|mail|yahoo mail|gmail|aol) (for|on) .+`,
+	`sent from (outlook|mail|yahoo mail|gmail mobile|the gmail app)`,
+	`get outlook for .+`,
+	`sent with proton ?mail( secure email)?`,
+	`sent via .+ (app|mobile)`,
+	`envoyé de mon .+`,
+	`envoyé depuis (mon|l'application) .+`,
+	`enviado desde mi .+`,
+	`von meinem .+ gesendet`,
+	`gesendet von meinem .+`,
+	`.+から送信`,
+}
+
+// boilerplateMatcher decides whether a body is only boilerplate
+type boilerplateMatcher []*regexp.Regexp
+
+// newBoilerplateMatcher compiles the built-in boilerplate with extra
+// patterns, such as a company's mobile signature
+func newBoilerplateMatcher(extra []string) (boilerplateMatcher, error) {
+	m := boilerplateMatcher{}
+	for _, pattern := range append(Boilerplate, extra...) {
+		re, err := regexp.Compile(`^(?i:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boilerplate pattern %q: %v", pattern, err)
+		}
+		m = append(m, re)
+	}
+	return m, nil
+}
+
+// only reports whether every line of a payload's text is boilerplate. A
+// payload with an attachment is never only boilerplate.
+func (m boilerplateMatcher) only(payload *gmail.MessagePart) bool {
+	if hasAttachment(payload) {
+		return false
+	}
+	text := bodyText(payload)
+	if strings.TrimSpace(text) == "" {
+		return false
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(strings.Join(strings.Fields(line), " "), ".!")
+		// Blank lines and signature separators don't count
+		if line == "" || line == "--" || line == "-" || line == "__" {
+			continue
+		}
+		if !m.matchLine(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLine reports whether a line matches a boilerplate pattern
+func (m boilerplateMatcher) matchLine(line string) bool {
+	for _, re := range m {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAttachment reports whether any part of a payload is an attachment
+func hasAttachment(payload *gmail.MessagePart) bool {
+	if payload == nil {
+		return false
+	}
+	if payload.Filename != "" || (payload.Body != nil && payload.Body.AttachmentId != "") {
+		return true
+	}
+	for _, part := range payload.Parts {
+		if hasAttachment(part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrBudgetExhausted is matched by errors from requests refused because
+// the call budget of their context was used up
+var ErrBudgetExhausted = errors.New("API call budget exhausted")
+
+// CallBudget counts the API requests made with a context and those that
+// failed, and refuses them once a limit is reached. Requests to other
+// Google APIs through HTTPClient count too.
+type CallBudget struct {
+	limit   int64 // Zero for no limit
+	calls   atomic.Int64
+	refused atomic.Bool
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+type callBudgetKey struct{}
+
+// WithCallBudget returns a context whose requests count toward a new
+// budget of limit calls. A zero limit only counts them.
+func WithCallBudget(ctx context.Context, limit int) (context.Context, *CallBudget) {
+	b := &CallBudget{limit: int64(limit)}
+	return context.WithValue(ctx, callBudgetKey{}, b), b
+}
+
+// CallBudgetFrom returns the budget requests made with ctx count toward,
+// or nil if there is none
+func CallBudgetFrom(ctx context.Context) *CallBudget {
+	b, _ := ctx.Value(callBudgetKey{}).(*CallBudget)
+	return b
+}
+
+// Calls returns the number of requests made, not counting refused ones
+func (b *CallBudget) Calls() int {
+	return int(b.calls.Load())
+}
+
+// Err returns ErrBudgetExhausted once a request was refused
+func (b *CallBudget) Err() error {
+	if b.refused.Load() {
+		return ErrBudgetExhausted
+	}
+	return nil
+}
+
+// Failures returns the number of failed requests by cause: the HTTP status
+// of the response, e.g. "429", or "network" if there was none. Retried
+// requests count every time they fail.
+func (b *CallBudget) Failures() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failures := make(map[string]int, len(b.failures))
+	for cause, n := range b.failures {
+		failures[cause] = n
+	}
+	return failures
+}
+
+// fail counts a failed request
+func (b *CallBudget) fail(cause string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures == nil {
+		b.failures = make(map[string]int)
+	}
+	b.failures[cause]++
+}
+
+// spend counts a request, or reports false if the budget is used up
+func (b *CallBudget) spend() bool {
+	if b.calls.Add(1) > b.limit && b.limit > 0 {
+		b.calls.Add(-1)
+		b.refused.Store(true)
+		return false
+	}
+	return true
+}
+
+// budgetTransport charges every request to the call budget of its context
+type budgetTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip refuses the request if its budget is used up, and counts it
+// as failed if it gets an error status or no response. Requests cancelled
+// by their context aren't counted as failed.
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := CallBudgetFrom(req.Context())
+	if b != nil && !b.spend() {
+		return nil, ErrBudgetExhausted
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	switch {
+	case b == nil:
+	case err != nil && req.Context().Err() == nil:
+		b.fail("network")
+	case err == nil && resp.StatusCode >= 400:
+		b.fail(strconv.Itoa(resp.StatusCode))
+	}
+	return resp, err
+}
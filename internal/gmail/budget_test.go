@@ -0,0 +1,42 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBudgetTransportCountsFailures(t *testing.T) {
+	statuses := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusInternalServerError}
+	next := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[next])
+		next++
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &budgetTransport{}}
+	ctx, budget := WithCallBudget(context.Background(), len(statuses))
+	for range statuses {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("request over the budget: %v, want ErrBudgetExhausted", err)
+	}
+
+	if budget.Calls() != 4 {
+		t.Errorf("%d calls, want 4", budget.Calls())
+	}
+	failures := budget.Failures()
+	if len(failures) != 2 || failures["429"] != 2 || failures["500"] != 1 {
+		t.Errorf("failures %v, want 2 429s and a 500", failures)
+	}
+}
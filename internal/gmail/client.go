@@ -2,9 +2,13 @@ package gmail
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -15,22 +19,61 @@ import (
 
 // Client wraps the Gmail API client
 type Client struct {
-	service *gmail.Service
+	api         api
+	httpClient  *http.Client
+	user        string // Mailbox the requests act on, "me" for the authenticated user
+	labels      labelCache
+	features    features
+	boilerplate boilerplateMatcher // Bodies that count as empty, see Options.Boilerplate
 }
 
 // Draft represents a Gmail draft with relevant information
 type Draft struct {
-	ID           string
-	MessageID    string
-	Subject      string
-	To           string
-	InternalDate time.Time
-	IsEmpty      bool
+	ID            string    `json:"id"`
+	MessageID     string    `json:"message_id"`
+	Subject       string    `json:"subject"`
+	To            string    `json:"to"`                     // Raw To header, as shown in lists and logs
+	ToAddresses   []Address `json:"to_addresses,omitempty"` // To header split into addresses
+	Cc            []Address `json:"cc,omitempty"`
+	Bcc           []Address `json:"bcc,omitempty"`
+	InternalDate  time.Time `json:"internal_date"`
+	IsEmpty       bool      `json:"is_empty"`
+	IsReply       bool      `json:"is_reply"`               // Draft replies to an existing message
+	BodyLength    int       `json:"body_length"`            // Length of the decoded text body in bytes
+	Size          int64     `json:"size"`                   // Estimated size of the whole message, including attachments, in bytes
+	IsTemplate    bool      `json:"is_template"`            // Reusable canned response, never cleaned up
+	IsKept        bool      `json:"is_kept,omitempty"`      // Kept with the triage report's keep link, never cleaned up or reported stale
+	Labels        []string  `json:"labels,omitempty"`       // Names of the labels on the draft's message, other than DRAFT
+	Snippet       string    `json:"snippet,omitempty"`      // Start of the text body, with HTML rendered as text
+	ContentHash   string    `json:"content_hash,omitempty"` // Hash of the normalized subject, recipients, text and attachments, unchanged by label changes
+	Edits         int       `json:"edits,omitempty"`        // Times the content was seen to change since the draft appeared, counted by the draft cache
+	Client        string    `json:"client,omitempty"`       // Mail client that created the draft, such as "gmail" or "ios-mail", see DetectClient; empty when unknown
+	ThreadID      string    `json:"thread_id,omitempty"`
+	ReplyTo       *Parent   `json:"reply_to,omitempty"`       // Latest message of the thread a reply draft answers, when it could be fetched
+	ParentDeleted bool      `json:"parent_deleted,omitempty"` // Reply draft whose thread has no messages left other than drafts and deleted ones
+}
+
+// Options customizes how the client identifies itself to Google
+type Options struct {
+	UserAgent    string   // Appended to the API library's User-Agent header
+	QuotaProject string   // Google Cloud project billed for API quota (X-Goog-User-Project)
+	Mailbox      string   // Address of a mailbox the user is a delegate of; empty for their own
+	Scopes       []string // OAuth scopes requested on top of RequiredScopes, e.g. for other Google APIs
+	Boilerplate  []string // Regular expressions for lines, on top of Boilerplate, that don't make a draft non-empty
+
+	// Transport optionally wraps the authorized transport, e.g. to record responses
+	Transport func(http.RoundTripper) http.RoundTripper
+	// Replay, when set, answers every request without credentials or network
+	Replay http.RoundTripper
 }
 
 // NewClient creates a new Gmail API client with OAuth2 authentication
-func NewClient(ctx context.Context, credentialsPath, tokenPath string) (*Client, error) {
-	config, err := getOAuthConfig(credentialsPath)
+func NewClient(ctx context.Context, credentialsPath, tokenPath string, opts Options) (*Client, error) {
+	if opts.Replay != nil {
+		return newService(ctx, &http.Client{Transport: opts.Replay}, opts)
+	}
+
+	config, err := getOAuthConfig(credentialsPath, opts.Scopes)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse credentials: %v", err)
 	}
@@ -40,23 +83,115 @@ func NewClient(ctx context.Context, credentialsPath, tokenPath string) (*Client,
 		return nil, fmt.Errorf("unable to get token: %v", err)
 	}
 
-	httpClient := config.Client(ctx, token)
+	return newClient(ctx, config, token, opts)
+}
+
+// OAuthConfig loads the OAuth client from the credentials file for a hosted
+// consent flow redirecting to redirectURL, asking for the extra scopes too
+func OAuthConfig(credentialsPath, redirectURL string, scopes []string) (*oauth2.Config, error) {
+	config, err := getOAuthConfig(credentialsPath, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials: %v", err)
+	}
+	config.RedirectURL = redirectURL
+	return config, nil
+}
+
+// NewTokenClient creates a client for a token obtained elsewhere, such as
+// through a hosted consent flow
+func NewTokenClient(ctx context.Context, config *oauth2.Config, token *oauth2.Token, opts Options) (*Client, error) {
+	if opts.Replay != nil {
+		return newService(ctx, &http.Client{Transport: opts.Replay}, opts)
+	}
+	return newClient(ctx, config, token, opts)
+}
+
+// NewServiceAccountClient creates a client acting as subject through a
+// service account with domain-wide delegation, for Workspace admins
+func NewServiceAccountClient(ctx context.Context, keyPath, subject string, opts Options) (*Client, error) {
+	if opts.Replay != nil {
+		return newService(ctx, &http.Client{Transport: opts.Replay}, opts)
+	}
+
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account key: %v", err)
+	}
+	config, err := google.JWTConfigFromJSON(key, append(RequiredScopes, opts.Scopes...)...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse service account key: %v", err)
+	}
+	config.Subject = subject
+
+	return authorizedClient(ctx, config.Client(ctx), opts)
+}
+
+// newClient creates the Gmail service for an authorized token
+func newClient(ctx context.Context, config *oauth2.Config, token *oauth2.Token, opts Options) (*Client, error) {
+	return authorizedClient(ctx, config.Client(ctx, token), opts)
+}
+
+// authorizedClient adds the optional transports to an authorized HTTP client
+// and creates the Gmail service on top of it
+func authorizedClient(ctx context.Context, httpClient *http.Client, opts Options) (*Client, error) {
+	if opts.QuotaProject != "" {
+		httpClient.Transport = &quotaProjectTransport{base: httpClient.Transport, project: opts.QuotaProject}
+	}
+	if opts.Transport != nil {
+		httpClient.Transport = opts.Transport(httpClient.Transport)
+	}
+
+	return newService(ctx, httpClient, opts)
+}
+
+// newService creates the Gmail service on top of an HTTP client
+func newService(ctx context.Context, httpClient *http.Client, opts Options) (*Client, error) {
+	httpClient.Transport = &budgetTransport{base: httpClient.Transport}
 	service, err := gmail.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Gmail service: %v", err)
 	}
+	service.UserAgent = opts.UserAgent
+
+	boilerplate, err := newBoilerplateMatcher(opts.Boilerplate)
+	if err != nil {
+		return nil, err
+	}
+
+	user := opts.Mailbox
+	if user == "" {
+		user = "me"
+	}
+	return &Client{api: &libraryAPI{service: service}, httpClient: httpClient, user: user, boilerplate: boilerplate}, nil
+}
+
+// HTTPClient returns the authorized HTTP client, for calling other Google
+// APIs covered by Options.Scopes
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// quotaProjectTransport attributes every request to a quota project
+type quotaProjectTransport struct {
+	base    http.RoundTripper
+	project string
+}
 
-	return &Client{service: service}, nil
+// RoundTrip adds the X-Goog-User-Project header to a copy of the request
+func (t *quotaProjectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Goog-User-Project", t.project)
+	return t.base.RoundTrip(req)
 }
 
 // getOAuthConfig loads OAuth configuration from credentials file
-func getOAuthConfig(credentialsPath string) (*oauth2.Config, error) {
+func getOAuthConfig(credentialsPath string, scopes []string) (*oauth2.Config, error) {
 	b, err := os.ReadFile(credentialsPath)
 	if err != nil {
 		return nil, err
 	}
 
-	config, err := google.ConfigFromJSON(b, gmail.GmailReadonlyScope, gmail.GmailModifyScope)
+	config, err := google.ConfigFromJSON(b, append(RequiredScopes, scopes...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -129,20 +264,45 @@ func saveToken(path string, token *oauth2.Token) error {
 
 // ListDrafts retrieves all drafts from Gmail
 func (c *Client) ListDrafts(ctx context.Context) ([]*Draft, error) {
-	user := "me"
+	return c.listDrafts(ctx, "")
+}
+
+// SearchDrafts retrieves the drafts matching a Gmail search query, such as
+// "to:alice budget"
+func (c *Client) SearchDrafts(ctx context.Context, query string) ([]*Draft, error) {
+	return c.listDrafts(ctx, query)
+}
+
+// listDrafts retrieves the drafts matching query, or all drafts when it is empty
+func (c *Client) listDrafts(ctx context.Context, query string) ([]*Draft, error) {
+	user := c.user
 	drafts := []*Draft{}
 
-	err := c.service.Users.Drafts.List(user).Pages(ctx, func(response *gmail.ListDraftsResponse) error {
-		for _, draft := range response.Drafts {
-			draftDetail, err := c.service.Users.Drafts.Get(user, draft.Id).Format("full").Do()
+	pageToken := ""
+	for {
+		ids, next, err := c.api.ListDrafts(ctx, user, query, pageToken)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve drafts: %v", err)
+		}
+		for _, id := range ids {
+			draftDetail, err := c.api.GetDraft(ctx, user, id, "full")
 			if err != nil {
-				fmt.Printf("Error fetching draft %s: %v\n", draft.Id, err)
+				fmt.Printf("Error fetching draft %s: %v\n", id, err)
 				continue
 			}
 
 			d := &Draft{
-				ID:        draft.Id,
+				ID:        id,
 				MessageID: draftDetail.Message.Id,
+				ThreadID:  draftDetail.Message.ThreadId,
+				Size:      draftDetail.Message.SizeEstimate,
+			}
+
+			// Keep the label IDs, resolved to names once every draft is fetched
+			for _, labelID := range draftDetail.Message.LabelIds {
+				if labelID != "DRAFT" {
+					d.Labels = append(d.Labels, labelID)
+				}
 			}
 
 			// Parse internal date
@@ -150,40 +310,77 @@ func (c *Client) ListDrafts(ctx context.Context) ([]*Draft, error) {
 				d.InternalDate = time.Unix(draftDetail.Message.InternalDate/1000, 0)
 			}
 
-			// Extract subject and to fields
+			// Extract subject and to fields, and what identifies the client
+			var xMailer, userAgent, messageID string
 			for _, header := range draftDetail.Message.Payload.Headers {
+				switch {
+				case strings.EqualFold(header.Name, "X-Mailer"):
+					xMailer = header.Value
+				case strings.EqualFold(header.Name, "User-Agent"):
+					userAgent = header.Value
+				case strings.EqualFold(header.Name, "Message-ID"):
+					messageID = header.Value
+				}
 				switch header.Name {
 				case "Subject":
 					d.Subject = header.Value
 				case "To":
 					d.To = header.Value
+					d.ToAddresses = ParseAddresses(header.Value)
+				case "Cc":
+					d.Cc = ParseAddresses(header.Value)
+				case "Bcc":
+					d.Bcc = ParseAddresses(header.Value)
+				case "In-Reply-To":
+					d.IsReply = header.Value != ""
 				}
 			}
+			d.Client = DetectClient(xMailer, userAgent, messageID)
+
+			text := bodyText(draftDetail.Message.Payload)
+			d.BodyLength = len(text)
+			d.Snippet = Snippet(text, snippetLength)
+			d.ContentHash = contentHash(d, text, draftDetail.Message.Payload)
 
-			// Check if draft is empty (no subject, no recipient, no body)
-			d.IsEmpty = d.Subject == "" && d.To == "" && isEmpty(draftDetail.Message.Payload)
+			// Check if draft is empty (no subject, no recipient, no body).
+			// A body that is only a client's signature counts as no body.
+			payload := draftDetail.Message.Payload
+			d.IsEmpty = d.Subject == "" && len(d.Recipients()) == 0 && (isEmpty(payload) || c.boilerplate.only(payload))
 
 			drafts = append(drafts, d)
 		}
-		return nil
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve drafts: %v", err)
+		if next == "" {
+			break
+		}
+		pageToken = next
 	}
 
+	c.resolveLabels(ctx, drafts)
+	c.resolveParents(ctx, drafts)
 	return drafts, nil
 }
 
+// snippetLength is how many characters of the body snippets show
+const snippetLength = 100
+
 // isEmpty checks if a message payload has any content
 func isEmpty(payload *gmail.MessagePart) bool {
 	if payload == nil {
 		return true
 	}
 
-	// Check if body has data
-	if payload.Body != nil && payload.Body.Size > 0 {
-		return false
+	// Check if body has data. A missing size alone doesn't make a body
+	// empty, as deleting real content is worse than keeping an empty draft.
+	// HTML only counts when it renders as text, as Gmail saves markup such
+	// as "<div><br></div>" for a draft nobody typed in.
+	if payload.Body != nil && (payload.Body.Size > 0 || payload.Body.Data != "" || payload.Body.AttachmentId != "") {
+		if payload.MimeType != "text/html" || payload.Body.AttachmentId != "" || payload.Body.Data == "" {
+			return false
+		}
+		data, ok := decodeBody(payload.Body.Data)
+		if !ok || HTMLText(string(data)) != "" {
+			return false
+		}
 	}
 
 	// Check parts recursively
@@ -196,12 +393,187 @@ func isEmpty(payload *gmail.MessagePart) bool {
 	return true
 }
 
-// DeleteDraft deletes a draft by ID
+// bodyText returns the decoded text of a message payload, preferring
+// text/plain parts and falling back to text/html
+func bodyText(payload *gmail.MessagePart) string {
+	if text := partText(payload, "text/plain"); text != "" {
+		return text
+	}
+	return HTMLText(partText(payload, "text/html"))
+}
+
+// decodeBody decodes the base64 data of a message part
+func decodeBody(data string) ([]byte, bool) {
+	decoded, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		// Gmail sometimes omits padding
+		decoded, err = base64.RawURLEncoding.DecodeString(data)
+	}
+	return decoded, err == nil
+}
+
+// partText concatenates the decoded bodies of all parts with the given MIME type
+func partText(payload *gmail.MessagePart, mimeType string) string {
+	if payload == nil {
+		return ""
+	}
+
+	text := ""
+	if payload.MimeType == mimeType && payload.Body != nil && payload.Body.Data != "" {
+		if data, ok := decodeBody(payload.Body.Data); ok {
+			text += string(data)
+		}
+	}
+
+	for _, part := range payload.Parts {
+		text += partText(part, mimeType)
+	}
+
+	return text
+}
+
+// ErrNotFound is returned when a draft no longer exists, e.g. because the
+// user deleted or sent it
+var ErrNotFound = errors.New("draft not found")
+
+// IsAuthError reports whether an error means the user has to authorize
+// CalmDrafts again, e.g. because the token was revoked or expired. Errors
+// wrapped with %v only keep their text, so that is checked too.
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusUnauthorized
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return true
+	}
+	return err != nil && (strings.Contains(err.Error(), "invalid_grant") || strings.Contains(err.Error(), "Error 401"))
+}
+
+// DeleteDraft deletes a draft by ID. It returns ErrNotFound if the draft is
+// already gone.
 func (c *Client) DeleteDraft(ctx context.Context, draftID string) error {
-	user := "me"
-	err := c.service.Users.Drafts.Delete(user, draftID).Do()
+	user := c.user
+	err := c.api.DeleteDraft(ctx, user, draftID)
+	if errors.Is(err, ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return &OpError{Op: "delete draft", ID: draftID, Err: err}
+	}
+	return nil
+}
+
+// TrashRetention is how long Gmail keeps messages in Trash before purging them
+const TrashRetention = 30 * 24 * time.Hour
+
+// TrashMessage moves a draft's message to Trash, removing it from the
+// drafts. It returns ErrNotFound if the message is already gone, and a
+// FeatureError if the mailbox doesn't allow Trash.
+func (c *Client) TrashMessage(ctx context.Context, messageID string) error {
+	user := c.user
+	err := c.useFeature(FeatureTrash, func() error {
+		return c.api.TrashMessage(ctx, user, messageID)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrNotFound
+	}
+	if errors.Is(err, ErrUnavailable) {
+		return err
+	}
+	if err != nil {
+		return &OpError{Op: "trash message", ID: messageID, Err: err}
+	}
+	return nil
+}
+
+// UntrashMessage moves a message out of Trash. It returns ErrNotFound once
+// Gmail has purged the message.
+func (c *Client) UntrashMessage(ctx context.Context, messageID string) error {
+	user := c.user
+	err := c.useFeature(FeatureTrash, func() error {
+		return c.api.UntrashMessage(ctx, user, messageID)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrNotFound
+	}
+	if errors.Is(err, ErrUnavailable) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("unable to untrash message %s: %v", messageID, err)
+	}
+	return nil
+}
+
+// GetRawDraft retrieves the full RFC 822 message of a draft, including
+// attachments. It returns ErrNotFound if the draft is gone.
+func (c *Client) GetRawDraft(ctx context.Context, draftID string) ([]byte, error) {
+	user := c.user
+	draft, err := c.api.GetDraft(ctx, user, draftID, "raw")
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch draft %s: %v", draftID, err)
+	}
+
+	raw, err := base64.URLEncoding.DecodeString(draft.Message.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode draft %s: %v", draftID, err)
+	}
+	return raw, nil
+}
+
+// CreateDraft creates a new draft from a raw RFC 822 message and returns its ID
+func (c *Client) CreateDraft(ctx context.Context, raw []byte) (string, error) {
+	user := c.user
+	draft := &gmail.Draft{
+		Message: &gmail.Message{Raw: base64.URLEncoding.EncodeToString(raw)},
+	}
+
+	created, err := c.api.CreateDraft(ctx, user, draft)
+	if err != nil {
+		return "", fmt.Errorf("unable to create draft: %v", err)
+	}
+	return created.Id, nil
+}
+
+// SendDraft sends a draft to its recipients, removing it from the drafts. It
+// returns ErrNotFound if the draft is gone.
+func (c *Client) SendDraft(ctx context.Context, draftID string) error {
+	user := c.user
+	err := c.useFeature(FeatureSend, func() error {
+		return c.api.SendDraft(ctx, user, draftID)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrNotFound
+	}
+	if errors.Is(err, ErrUnavailable) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("unable to send draft %s: %v", draftID, err)
+	}
+	return nil
+}
+
+// UpdateDraft replaces the message of a draft with a raw RFC 822 message. It
+// returns ErrNotFound if the draft is gone.
+func (c *Client) UpdateDraft(ctx context.Context, draftID string, raw []byte) error {
+	user := c.user
+	draft := &gmail.Draft{
+		Id:      draftID,
+		Message: &gmail.Message{Raw: base64.URLEncoding.EncodeToString(raw)},
+	}
+
+	err := c.api.UpdateDraft(ctx, user, draftID, draft)
+	if errors.Is(err, ErrNotFound) {
+		return ErrNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("unable to delete draft %s: %v", draftID, err)
+		return fmt.Errorf("unable to update draft %s: %v", draftID, err)
 	}
 	return nil
 }
@@ -0,0 +1,107 @@
+package gmail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// RequiredScopes lists the OAuth scopes CalmDrafts needs
+var RequiredScopes = []string{gmail.GmailReadonlyScope, gmail.GmailModifyScope}
+
+// TokenStatus describes a stored OAuth token
+type TokenStatus struct {
+	Expiry          time.Time // Expiry of the current access token
+	HasRefreshToken bool      // Whether the token can be refreshed without the user
+	Scopes          []string  // Scopes granted to the token, as reported by Google
+}
+
+// ValidateCredentials checks that the credentials file is a usable OAuth client
+func ValidateCredentials(credentialsPath string) error {
+	_, err := getOAuthConfig(credentialsPath, nil)
+	return err
+}
+
+// OpenClient creates a client from a stored token without ever prompting for
+// authorization, for use in non-interactive contexts
+func OpenClient(ctx context.Context, credentialsPath, tokenPath string, opts Options) (*Client, error) {
+	if opts.Replay != nil {
+		return newService(ctx, &http.Client{Transport: opts.Replay}, opts)
+	}
+
+	config, err := getOAuthConfig(credentialsPath, opts.Scopes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials: %v", err)
+	}
+
+	token, err := tokenFromFile(tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token: %v", err)
+	}
+
+	return newClient(ctx, config, token, opts)
+}
+
+// InspectToken refreshes the stored token if needed and asks Google which
+// scopes it grants
+func InspectToken(ctx context.Context, credentialsPath, tokenPath string) (*TokenStatus, error) {
+	config, err := getOAuthConfig(credentialsPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials: %v", err)
+	}
+
+	stored, err := tokenFromFile(tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token: %v", err)
+	}
+
+	token, err := config.TokenSource(ctx, stored).Token()
+	if err != nil {
+		return nil, fmt.Errorf("unable to refresh token: %v", err)
+	}
+
+	status := &TokenStatus{
+		Expiry:          token.Expiry,
+		HasRefreshToken: token.RefreshToken != "",
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://oauth2.googleapis.com/tokeninfo?access_token="+url.QueryEscape(token.AccessToken), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query token info: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token info request failed: %s", resp.Status)
+	}
+
+	info := struct {
+		Scope string `json:"scope"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("unable to parse token info: %v", err)
+	}
+	status.Scopes = strings.Fields(info.Scope)
+
+	return status, nil
+}
+
+// Profile returns the email address of the mailbox the client acts on
+func (c *Client) Profile(ctx context.Context) (string, error) {
+	profile, err := c.api.GetProfile(ctx, c.user)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch profile: %v", err)
+	}
+	return profile.EmailAddress, nil
+}
@@ -0,0 +1,191 @@
+package gmail
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// payloadCase is a message payload from testdata/payloads with how it must
+// be classified. Add a file there for every MIME structure a client was
+// seen to produce.
+type payloadCase struct {
+	Description string             `json:"description"`
+	Empty       bool               `json:"empty"`
+	Text        string             `json:"text"`
+	Payload     *gmail.MessagePart `json:"payload"`
+}
+
+// loadPayloadCases reads the payload corpus
+func loadPayloadCases(t testing.TB) map[string]*payloadCase {
+	paths, err := filepath.Glob(filepath.Join("testdata", "payloads", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no payloads in testdata/payloads")
+	}
+
+	cases := make(map[string]*payloadCase, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &payloadCase{}
+		if err := json.Unmarshal(data, c); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		cases[strings.TrimSuffix(filepath.Base(path), ".json")] = c
+	}
+	return cases
+}
+
+func TestPayloadCorpus(t *testing.T) {
+	for name, c := range loadPayloadCases(t) {
+		t.Run(name, func(t *testing.T) {
+			if got := isEmpty(c.Payload); got != c.Empty {
+				t.Errorf("%s: isEmpty = %v, want %v", c.Description, got, c.Empty)
+			}
+			if got := bodyText(c.Payload); got != c.Text {
+				t.Errorf("%s: bodyText = %q, want %q", c.Description, got, c.Text)
+			}
+		})
+	}
+}
+
+// checkPayloadProperties checks what must hold for any payload, whatever
+// its structure
+func checkPayloadProperties(t *testing.T, payload *gmail.MessagePart) {
+	empty, text := isEmpty(payload), bodyText(payload)
+
+	// Text that can be decoded is content
+	if empty && text != "" {
+		t.Fatalf("isEmpty is true for a payload with text %q", text)
+	}
+
+	// Wrapping a payload in a multipart container changes nothing
+	wrapped := &gmail.MessagePart{MimeType: "multipart/mixed", Body: &gmail.MessagePartBody{}, Parts: []*gmail.MessagePart{payload}}
+	if isEmpty(wrapped) != empty || bodyText(wrapped) != text {
+		t.Fatalf("wrapping the payload changed isEmpty from %v or bodyText from %q", empty, text)
+	}
+
+	// An empty sibling part changes nothing, content always counts
+	sibling := &gmail.MessagePart{MimeType: "text/plain", Body: &gmail.MessagePartBody{}}
+	withEmpty := &gmail.MessagePart{MimeType: "multipart/alternative", Parts: []*gmail.MessagePart{payload, sibling}}
+	if isEmpty(withEmpty) != empty {
+		t.Fatalf("an empty sibling changed isEmpty from %v", empty)
+	}
+	sibling = &gmail.MessagePart{MimeType: "text/plain", Body: &gmail.MessagePartBody{Size: 1, Data: "eA"}}
+	withContent := &gmail.MessagePart{MimeType: "multipart/alternative", Parts: []*gmail.MessagePart{payload, sibling}}
+	if isEmpty(withContent) {
+		t.Fatal("a payload with a non-empty part is empty")
+	}
+}
+
+// FuzzPayload decodes arbitrary JSON as a Gmail payload, seeded with the
+// corpus, and checks the properties every classification must have
+func FuzzPayload(f *testing.F) {
+	for _, c := range loadPayloadCases(f) {
+		data, err := json.Marshal(c.Payload)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		payload := &gmail.MessagePart{}
+		if err := json.Unmarshal(data, payload); err != nil {
+			t.Skip()
+		}
+		checkPayloadProperties(t, payload)
+	})
+}
+
+// FuzzBody builds MIME trees around a body: nested depth deep, as HTML or
+// plain text, with padded or unpadded base64, next to an empty plain part
+// or not, and checks it is decoded exactly, HTML rendered as text, and
+// classified by the length of its text
+func FuzzBody(f *testing.F) {
+	f.Add("", false, false, uint8(0), false)
+	f.Add("Hi", false, false, uint8(0), false)
+	f.Add("<div><br></div>", true, true, uint8(2), true)
+	f.Add("Grüße 👋", false, true, uint8(5), true)
+
+	f.Fuzz(func(t *testing.T, text string, html, unpadded bool, depth uint8, alternative bool) {
+		encoding := base64.URLEncoding
+		if unpadded {
+			encoding = base64.RawURLEncoding
+		}
+		mimeType := "text/plain"
+		if html {
+			mimeType = "text/html"
+		}
+		body := &gmail.MessagePartBody{Size: int64(len(text))}
+		if text != "" {
+			body.Data = encoding.EncodeToString([]byte(text))
+		}
+		payload := &gmail.MessagePart{MimeType: mimeType, Body: body}
+		if html && alternative {
+			// The plain version is empty, so the HTML is used
+			empty := &gmail.MessagePart{MimeType: "text/plain", Body: &gmail.MessagePartBody{}}
+			payload = &gmail.MessagePart{MimeType: "multipart/alternative", Body: &gmail.MessagePartBody{}, Parts: []*gmail.MessagePart{empty, payload}}
+		}
+		for range depth % 8 {
+			payload = &gmail.MessagePart{MimeType: "multipart/mixed", Body: &gmail.MessagePartBody{}, Parts: []*gmail.MessagePart{payload}}
+		}
+
+		want := text
+		if html {
+			want = HTMLText(text)
+		}
+		if got := bodyText(payload); got != want {
+			t.Fatalf("bodyText = %q, want %q", got, want)
+		}
+		if got := isEmpty(payload); got != (want == "") {
+			t.Fatalf("isEmpty = %v for text %q", got, text)
+		}
+		checkPayloadProperties(t, payload)
+	})
+}
+
+func TestBoilerplate(t *testing.T) {
+	m, err := newBoilerplateMatcher([]string{`sent from my fairphone, please excuse typos`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := func(text string) *gmail.MessagePart {
+		return &gmail.MessagePart{MimeType: "text/plain", Body: &gmail.MessagePartBody{Size: int64(len(text)), Data: base64.URLEncoding.EncodeToString([]byte(text))}}
+	}
+
+	for text, want := range map[string]bool{
+		"\r\n\r\nSent from my iPhone":                  true,
+		"-- \nSent from Outlook for Android.":          true,
+		"Von meinem iPad gesendet":                     true,
+		"iPhoneから送信":                                   true,
+		"Sent from my Fairphone, please excuse typos":  true,
+		"Call me\n\nSent from my iPhone":               false,
+		"Sent from my iPhone\n> On Monday, Ana wrote:": false,
+		"I sent from my desk the report you asked for": false,
+		"": false,
+	} {
+		if got := m.only(plain(text)); got != want {
+			t.Errorf("only(%q) = %v, want %v", text, got, want)
+		}
+	}
+
+	// An attachment is content, whatever the text says
+	withFile := &gmail.MessagePart{MimeType: "multipart/mixed", Parts: []*gmail.MessagePart{
+		plain("Sent from my iPhone"),
+		{MimeType: "image/jpeg", Filename: "IMG_0001.jpg", Body: &gmail.MessagePartBody{Size: 1024, AttachmentId: "a1"}},
+	}}
+	if m.only(withFile) {
+		t.Error("a signature with an attachment is only boilerplate")
+	}
+}
@@ -0,0 +1,73 @@
+package gmail
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Feature is an optional part of the Gmail API that a mailbox may not offer,
+// e.g. because of Workspace settings, the granted scopes or a deprecation
+type Feature string
+
+const (
+	FeatureTrash  Feature = "Trash"
+	FeatureLabels Feature = "labels"
+	FeatureSend   Feature = "sending"
+	FeatureWatch  Feature = "push notifications"
+	FeatureBatch  Feature = "batch deletion"
+)
+
+// FeatureError reports that Gmail doesn't offer a feature for this mailbox.
+// It matches ErrUnavailable.
+type FeatureError struct {
+	Feature Feature
+	Err     error // Error Gmail returned when the feature was first used
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("%s not available for this mailbox: %v", e.Feature, e.Err)
+}
+
+func (e *FeatureError) Unwrap() []error {
+	return []error{ErrUnavailable, e.Err}
+}
+
+// features remembers which features Gmail refused, so they aren't tried on
+// every check
+type features struct {
+	mu          sync.Mutex
+	unavailable map[Feature]*FeatureError
+}
+
+// Supports reports whether a feature is available, as far as is known:
+// features are assumed available until Gmail refuses them
+func (c *Client) Supports(f Feature) bool {
+	c.features.mu.Lock()
+	defer c.features.mu.Unlock()
+	return c.features.unavailable[f] == nil
+}
+
+// useFeature runs call unless Gmail already refused f, and remembers when
+// it does
+func (c *Client) useFeature(f Feature, call func() error) error {
+	c.features.mu.Lock()
+	known := c.features.unavailable[f]
+	c.features.mu.Unlock()
+	if known != nil {
+		return known
+	}
+
+	err := call()
+	if !errors.Is(err, ErrUnavailable) {
+		return err
+	}
+	featureErr := &FeatureError{Feature: f, Err: err}
+	c.features.mu.Lock()
+	if c.features.unavailable == nil {
+		c.features.unavailable = make(map[Feature]*FeatureError)
+	}
+	c.features.unavailable[f] = featureErr
+	c.features.mu.Unlock()
+	return featureErr
+}
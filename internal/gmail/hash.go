@@ -0,0 +1,52 @@
+package gmail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// contentHash returns a stable hash of what the user wrote in a draft: the
+// subject, recipients, body text and attachments, normalized so that
+// whitespace, the order of recipients and the MIME structure don't matter.
+// Label changes and Gmail saving the draft again don't change it.
+func contentHash(d *Draft, text string, payload *gmail.MessagePart) string {
+	recipients := []string{}
+	for _, r := range d.Recipients() {
+		recipients = append(recipients, strings.ToLower(r.Email))
+	}
+	sort.Strings(recipients)
+
+	attachments := []string{}
+	var walk func(part *gmail.MessagePart)
+	walk = func(part *gmail.MessagePart) {
+		if part == nil {
+			return
+		}
+		if part.Filename != "" && part.Body != nil {
+			attachments = append(attachments, fmt.Sprintf("%s:%d", part.Filename, part.Body.Size))
+		}
+		for _, p := range part.Parts {
+			walk(p)
+		}
+	}
+	walk(payload)
+	sort.Strings(attachments)
+
+	h := sha256.New()
+	for _, field := range []string{
+		"v1",
+		strings.Join(strings.Fields(d.Subject), " "),
+		strings.Join(recipients, ","),
+		strings.Join(strings.Fields(text), " "),
+		strings.Join(attachments, ","),
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
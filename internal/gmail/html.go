@@ -0,0 +1,118 @@
+package gmail
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// blockElements start a new line in the text of an HTML body
+var blockElements = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "br": true, "div": true, "dl": true, "dt": true, "dd": true,
+	"footer": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"hr": true, "li": true, "ol": true, "p": true, "pre": true, "section": true, "table": true, "td": true,
+	"th": true, "tr": true, "ul": true,
+}
+
+// hiddenElements have content that is never rendered as text
+var hiddenElements = map[string]bool{"head": true, "script": true, "style": true, "title": true, "template": true}
+
+// HTMLText renders an HTML body as plain text: tags are stripped, block
+// elements become line breaks, whitespace is collapsed and blank lines are
+// dropped. Images become their alt text, or "[image]", except tracking
+// pixels, which are dropped. Markup that renders as nothing, such as
+// Gmail's "<div><br></div>", gives "".
+func HTMLText(s string) string {
+	var b strings.Builder
+	hidden := 0
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return collapseLines(b.String())
+		case html.TextToken:
+			// Line breaks in the source are only whitespace
+			if hidden == 0 {
+				b.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(string(z.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			switch {
+			case hiddenElements[token.Data]:
+				if token.Type == html.StartTagToken {
+					hidden++
+				}
+			case token.Data == "img" && hidden == 0:
+				if !trackingPixel(token) {
+					b.WriteString(" " + imageText(token) + " ")
+				}
+			case blockElements[token.Data]:
+				b.WriteString("\n")
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch {
+			case hiddenElements[string(name)]:
+				hidden = max(hidden-1, 0)
+			case blockElements[string(name)]:
+				b.WriteString("\n")
+			}
+		}
+	}
+}
+
+// trackingPixel reports whether an image is invisible, as used by mail
+// clients and newsletters to track when a message is read
+func trackingPixel(img html.Token) bool {
+	for _, attr := range img.Attr {
+		value := strings.ToLower(strings.ReplaceAll(attr.Val, " ", ""))
+		switch attr.Key {
+		case "width", "height":
+			if value == "0" || value == "1" || value == "0px" || value == "1px" {
+				return true
+			}
+		case "style":
+			if strings.Contains(value, "display:none") || strings.Contains(value, "visibility:hidden") ||
+				strings.Contains(value, "width:1px") || strings.Contains(value, "height:1px") ||
+				strings.Contains(value, "width:0") || strings.Contains(value, "height:0") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// imageText returns what an image stands for in text
+func imageText(img html.Token) string {
+	for _, attr := range img.Attr {
+		if attr.Key == "alt" && strings.TrimSpace(attr.Val) != "" {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+	return "[image]"
+}
+
+// collapseLines collapses the whitespace in each line of text and drops
+// blank lines. Zero-width characters some editors insert count as
+// whitespace.
+func collapseLines(text string) string {
+	text = strings.NewReplacer("\u200b", " ", "\u200c", " ", "\u200d", " ", "\ufeff", " ").Replace(text)
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Snippet returns the start of a draft's text on a single line, at most n
+// characters long
+func Snippet(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	r := []rune(text)
+	if len(r) <= n {
+		return text
+	}
+	return strings.TrimSpace(string(r[:n-1])) + "…"
+}
@@ -0,0 +1,172 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// Label is a Gmail label
+type Label struct {
+	ID   string
+	Name string
+	Type string // "system" or "user"
+}
+
+// labelCache maps label names to IDs and back so repeated lookups don't hit
+// the API
+type labelCache struct {
+	mu     sync.Mutex
+	byName map[string]string
+	byID   map[string]string
+}
+
+// ListLabels retrieves all labels in the mailbox and refreshes the cache.
+// Like the other label methods, it returns a FeatureError if the mailbox
+// doesn't allow labels.
+func (c *Client) ListLabels(ctx context.Context) ([]*Label, error) {
+	user := c.user
+	var list []*gmail.Label
+	err := c.useFeature(FeatureLabels, func() (err error) {
+		list, err = c.api.ListLabels(ctx, user)
+		return err
+	})
+	if errors.Is(err, ErrUnavailable) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to list labels: %v", err)
+	}
+
+	labels := make([]*Label, 0, len(list))
+	byName := make(map[string]string, len(list))
+	byID := make(map[string]string, len(list))
+	for _, l := range list {
+		labels = append(labels, &Label{ID: l.Id, Name: l.Name, Type: l.Type})
+		byName[l.Name] = l.Id
+		byID[l.Id] = l.Name
+	}
+
+	c.labels.mu.Lock()
+	c.labels.byName = byName
+	c.labels.byID = byID
+	c.labels.mu.Unlock()
+
+	return labels, nil
+}
+
+// LabelID returns the ID of the label with the given name, or "" if it
+// doesn't exist
+func (c *Client) LabelID(ctx context.Context, name string) (string, error) {
+	c.labels.mu.Lock()
+	cached := c.labels.byName
+	c.labels.mu.Unlock()
+
+	if cached == nil {
+		if _, err := c.ListLabels(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	c.labels.mu.Lock()
+	defer c.labels.mu.Unlock()
+	return c.labels.byName[name], nil
+}
+
+// resolveLabels replaces the label IDs of drafts with label names. System
+// labels such as STARRED are named by their ID, so the labels are only
+// listed when a draft has a user label. When they can't be listed, the IDs
+// are kept.
+func (c *Client) resolveLabels(ctx context.Context, drafts []*Draft) {
+	userLabels := false
+	for _, d := range drafts {
+		for _, id := range d.Labels {
+			userLabels = userLabels || strings.HasPrefix(id, "Label_")
+		}
+	}
+	if !userLabels {
+		return
+	}
+
+	c.labels.mu.Lock()
+	byID := c.labels.byID
+	c.labels.mu.Unlock()
+	if byID == nil {
+		if _, err := c.ListLabels(ctx); err != nil {
+			return
+		}
+		c.labels.mu.Lock()
+		byID = c.labels.byID
+		c.labels.mu.Unlock()
+	}
+
+	for _, d := range drafts {
+		for i, id := range d.Labels {
+			if name, ok := byID[id]; ok {
+				d.Labels[i] = name
+			}
+		}
+	}
+}
+
+// EnsureLabel returns the ID of the named label, creating it if needed
+func (c *Client) EnsureLabel(ctx context.Context, name string) (string, error) {
+	id, err := c.LabelID(ctx, name)
+	if err != nil || id != "" {
+		return id, err
+	}
+
+	user := c.user
+	label := &gmail.Label{
+		Name:                  name,
+		LabelListVisibility:   "labelShow",
+		MessageListVisibility: "show",
+	}
+	var created *gmail.Label
+	err = c.useFeature(FeatureLabels, func() (err error) {
+		created, err = c.api.CreateLabel(ctx, user, label)
+		return err
+	})
+	if errors.Is(err, ErrUnavailable) {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to create label %q: %v", name, err)
+	}
+
+	c.labels.mu.Lock()
+	c.labels.byName[name] = created.Id
+	c.labels.byID[created.Id] = name
+	c.labels.mu.Unlock()
+
+	return created.Id, nil
+}
+
+// ApplyLabel adds a label to a message
+func (c *Client) ApplyLabel(ctx context.Context, messageID, labelID string) error {
+	return c.modifyLabels(ctx, messageID, []string{labelID}, nil)
+}
+
+// RemoveLabel removes a label from a message
+func (c *Client) RemoveLabel(ctx context.Context, messageID, labelID string) error {
+	return c.modifyLabels(ctx, messageID, nil, []string{labelID})
+}
+
+// modifyLabels adds and removes labels on a message
+func (c *Client) modifyLabels(ctx context.Context, messageID string, add, remove []string) error {
+	user := c.user
+	err := c.useFeature(FeatureLabels, func() error {
+		return c.api.ModifyMessage(ctx, user, messageID, add, remove)
+	})
+	if errors.Is(err, ErrUnavailable) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("unable to modify labels on message %s: %v", messageID, err)
+	}
+	return nil
+}
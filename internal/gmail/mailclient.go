@@ -0,0 +1,63 @@
+package gmail
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Mail clients a draft can be attributed to, see DetectClient
+const (
+	ClientGmail            = "gmail"             // Gmail on the web or its mobile apps
+	ClientAppleMail        = "apple-mail"        // Mail on macOS
+	ClientIOSMail          = "ios-mail"          // Mail on iPhone and iPad
+	ClientOutlook          = "outlook"           // Outlook on Windows, Mac, the web or mobile
+	ClientOutlookConnector = "outlook-connector" // Google Workspace Sync for Microsoft Outlook
+	ClientThunderbird      = "thunderbird"
+	ClientOther            = "other" // A client that names itself but isn't one of the above
+)
+
+// Clients lists the clients DetectClient knows, in the order shown to users
+var Clients = []string{ClientGmail, ClientAppleMail, ClientIOSMail, ClientOutlook, ClientOutlookConnector, ClientThunderbird, ClientOther}
+
+// clientPatterns attribute a draft by the header that gives its client
+// away. The first match wins, so more specific patterns come first, and
+// Message-ID patterns come last.
+var clientPatterns = []struct {
+	header  string // "x-mailer", "user-agent" or "message-id"
+	pattern *regexp.Regexp
+	client  string
+}{
+	{"x-mailer", regexp.MustCompile(`(?i)google workspace sync|g suite sync|google apps sync`), ClientOutlookConnector},
+	{"x-mailer", regexp.MustCompile(`(?i)^(iphone|ipad) mail\b`), ClientIOSMail},
+	{"x-mailer", regexp.MustCompile(`(?i)^apple mail\b`), ClientAppleMail},
+	{"x-mailer", regexp.MustCompile(`(?i)outlook`), ClientOutlook},
+	{"user-agent", regexp.MustCompile(`(?i)outlook`), ClientOutlook},
+	{"user-agent", regexp.MustCompile(`(?i)thunderbird`), ClientThunderbird},
+	{"message-id", regexp.MustCompile(`(?i)\.outlook\.com>?$`), ClientOutlook},
+	{"message-id", regexp.MustCompile(`(?i)@mail\.gmail\.com>?$`), ClientGmail},
+}
+
+// DetectClient returns the client that created a message from its
+// X-Mailer, User-Agent and Message-ID headers, or "" when they don't tell
+func DetectClient(xMailer, userAgent, messageID string) string {
+	values := map[string]string{
+		"x-mailer":   strings.TrimSpace(xMailer),
+		"user-agent": strings.TrimSpace(userAgent),
+		"message-id": strings.TrimSpace(messageID),
+	}
+	named := values["x-mailer"] != "" || values["user-agent"] != ""
+	for _, p := range clientPatterns {
+		// A client that names itself is trusted over the Message-ID, which
+		// may have been assigned by the server it saved the draft through
+		if p.header == "message-id" && named {
+			return ClientOther
+		}
+		if v := values[p.header]; v != "" && p.pattern.MatchString(v) {
+			return p.client
+		}
+	}
+	if named {
+		return ClientOther
+	}
+	return ""
+}
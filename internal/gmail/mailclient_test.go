@@ -0,0 +1,26 @@
+package gmail
+
+import "testing"
+
+func TestDetectClient(t *testing.T) {
+	for _, tt := range []struct {
+		xMailer, userAgent, messageID string
+		want                          string
+	}{
+		{"", "", "<CAB3x+Qd8kq@mail.gmail.com>", ClientGmail},
+		{"iPhone Mail (21E236)", "", "<6F1C2E7A-9B3D@example.com>", ClientIOSMail},
+		{"iPad Mail (20G75)", "", "", ClientIOSMail},
+		{"Apple Mail (2.3774.500.171.1.1)", "", "", ClientAppleMail},
+		{"Microsoft Outlook 16.0", "", "", ClientOutlook},
+		{"", "", "<AM9PR01MB1234@AM9PR01MB1234.eurprd01.prod.outlook.com>", ClientOutlook},
+		{"Google Workspace Sync for Microsoft Outlook", "", "", ClientOutlookConnector},
+		{"", "Mozilla/5.0 (X11; Linux x86_64; rv:115.0) Gecko/20100101 Thunderbird/115.9.0", "", ClientThunderbird},
+		{"Evolution 3.50", "", "<CAB3x@mail.gmail.com>", ClientOther},
+		{"", "", "<20261016.abc@example.com>", ""},
+		{"", "", "", ""},
+	} {
+		if got := DetectClient(tt.xMailer, tt.userAgent, tt.messageID); got != tt.want {
+			t.Errorf("DetectClient(%q, %q, %q) = %q, want %q", tt.xMailer, tt.userAgent, tt.messageID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"slices"
+	"time"
+)
+
+// Parent is the message a reply draft answers: the latest message in its
+// thread other than drafts and deleted messages
+type Parent struct {
+	From     string    `json:"from"` // Raw From header
+	Subject  string    `json:"subject"`
+	Date     time.Time `json:"date"`
+	Archived bool      `json:"archived,omitempty"` // No message of the thread is in the inbox
+}
+
+// Sender names who sent the message: the display name of its From address,
+// or the address when it has none
+func (p *Parent) Sender() string {
+	addresses := ParseAddresses(p.From)
+	switch {
+	case len(addresses) == 0:
+		return p.From
+	case addresses[0].Name != "":
+		return addresses[0].Name
+	}
+	return addresses[0].Email
+}
+
+// parentHeaders are the headers fetched for the messages of a thread
+var parentHeaders = []string{"From", "Subject", "Date"}
+
+// resolveParents sets ReplyTo, or ParentDeleted, on reply drafts from their
+// threads. Each thread is fetched once, with headers only. A thread that
+// can't be fetched for another reason leaves both unset.
+func (c *Client) resolveParents(ctx context.Context, drafts []*Draft) {
+	type result struct {
+		parent  *Parent
+		deleted bool
+	}
+	results := make(map[string]result)
+	for _, d := range drafts {
+		if !d.IsReply || d.ThreadID == "" {
+			continue
+		}
+		r, ok := results[d.ThreadID]
+		if !ok {
+			r.parent, r.deleted = c.threadParent(ctx, d.ThreadID)
+			results[d.ThreadID] = r
+		}
+		d.ReplyTo, d.ParentDeleted = r.parent, r.deleted
+	}
+}
+
+// threadParent returns the latest message of a thread that isn't a draft or
+// in Trash or Spam. deleted reports that the thread has no such message
+// left, or is gone altogether.
+func (c *Client) threadParent(ctx context.Context, threadID string) (parent *Parent, deleted bool) {
+	thread, err := c.api.GetThread(ctx, c.user, threadID, parentHeaders)
+	if errors.Is(err, ErrNotFound) {
+		return nil, true
+	}
+	if err != nil || thread == nil {
+		return nil, false
+	}
+
+	var latest int64
+	inbox := false
+	for _, m := range thread.Messages {
+		if slices.ContainsFunc(m.LabelIds, func(l string) bool { return l == "DRAFT" || l == "TRASH" || l == "SPAM" }) {
+			continue
+		}
+		inbox = inbox || slices.Contains(m.LabelIds, "INBOX")
+		if m.InternalDate < latest {
+			continue
+		}
+		latest = m.InternalDate
+		parent = &Parent{Date: time.UnixMilli(m.InternalDate)}
+		if m.Payload == nil {
+			continue
+		}
+		for _, header := range m.Payload.Headers {
+			switch header.Name {
+			case "From":
+				parent.From = header.Value
+			case "Subject":
+				parent.Subject = header.Value
+			case "Date":
+				// The Date header is when it was sent, which is what
+				// people remember; InternalDate is when Gmail received it
+				if t, err := mail.ParseDate(header.Value); err == nil {
+					parent.Date = t
+				}
+			}
+		}
+	}
+	if parent == nil {
+		return nil, true
+	}
+	parent.Archived = !inbox
+	return parent, false
+}
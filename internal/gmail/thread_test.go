@@ -0,0 +1,86 @@
+package gmail
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// threadAPI answers GetThread from a fixed set of threads and counts calls
+type threadAPI struct {
+	api
+	threads map[string]*gmail.Thread
+	calls   int
+}
+
+func (a *threadAPI) GetThread(ctx context.Context, user, id string, headers []string) (*gmail.Thread, error) {
+	a.calls++
+	if thread, ok := a.threads[id]; ok {
+		return thread, nil
+	}
+	return nil, &APIError{Code: 404, Message: "Requested entity was not found."}
+}
+
+func threadMessage(date time.Time, from string, labels ...string) *gmail.Message {
+	return &gmail.Message{
+		InternalDate: date.UnixMilli(),
+		LabelIds:     labels,
+		Payload: &gmail.MessagePart{Headers: []*gmail.MessagePartHeader{
+			{Name: "From", Value: from},
+			{Name: "Subject", Value: "Budget"},
+		}},
+	}
+}
+
+func TestResolveParents(t *testing.T) {
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	fake := &threadAPI{threads: map[string]*gmail.Thread{
+		"t1": {Messages: []*gmail.Message{
+			threadMessage(start, "Bob <bob@example.com>", "INBOX"),
+			threadMessage(start.Add(48*time.Hour), "Alice Smith <alice@example.com>", "INBOX"),
+			threadMessage(start.Add(72*time.Hour), "me@example.com", "DRAFT"),
+		}},
+		"t5": {Messages: []*gmail.Message{
+			threadMessage(start, "Bob <bob@example.com>", "TRASH"),
+			threadMessage(start.Add(time.Hour), "me@example.com", "DRAFT"),
+		}},
+	}}
+	c := &Client{api: fake, user: "me"}
+
+	drafts := []*Draft{
+		{ID: "r1", ThreadID: "t1", IsReply: true},
+		{ID: "r2", ThreadID: "t1", IsReply: true},
+		{ID: "r3", ThreadID: "gone", IsReply: true},
+		{ID: "r4", ThreadID: "t4"},
+		{ID: "r5", ThreadID: "t5", IsReply: true},
+	}
+	c.resolveParents(context.Background(), drafts)
+
+	if fake.calls != 3 {
+		t.Errorf("fetched threads %d times, want 3", fake.calls)
+	}
+	for _, d := range drafts[:2] {
+		if d.ReplyTo == nil {
+			t.Fatalf("%s: no parent", d.ID)
+		}
+		if got := d.ReplyTo.Sender(); got != "Alice Smith" {
+			t.Errorf("%s: sender %q, want %q", d.ID, got, "Alice Smith")
+		}
+		if !d.ReplyTo.Date.Equal(start.Add(48 * time.Hour)) {
+			t.Errorf("%s: date %v, want %v", d.ID, d.ReplyTo.Date, start.Add(48*time.Hour))
+		}
+		if d.ReplyTo.Archived || d.ParentDeleted {
+			t.Errorf("%s: archived %v, parent deleted %v, want neither", d.ID, d.ReplyTo.Archived, d.ParentDeleted)
+		}
+	}
+	for _, d := range drafts[2:] {
+		if d.ReplyTo != nil {
+			t.Errorf("%s: parent %+v, want none", d.ID, d.ReplyTo)
+		}
+		if want := d.IsReply; d.ParentDeleted != want {
+			t.Errorf("%s: parent deleted %v, want %v", d.ID, d.ParentDeleted, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// Watch asks Gmail to publish a notification to the Pub/Sub topic whenever
+// drafts change. The watch must be renewed before the returned expiry. It
+// returns a FeatureError if Gmail doesn't offer push for this mailbox.
+func (c *Client) Watch(ctx context.Context, topic string) (uint64, time.Time, error) {
+	user := c.user
+	req := &gmail.WatchRequest{
+		TopicName:           topic,
+		LabelIds:            []string{"DRAFT"},
+		LabelFilterBehavior: "include",
+	}
+	var resp *gmail.WatchResponse
+	err := c.useFeature(FeatureWatch, func() (err error) {
+		resp, err = c.api.Watch(ctx, user, req)
+		return err
+	})
+	if errors.Is(err, ErrUnavailable) {
+		return 0, time.Time{}, err
+	}
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("unable to watch mailbox: %v", err)
+	}
+	return resp.HistoryId, time.UnixMilli(resp.Expiration), nil
+}
+
+// DraftChanges reports whether drafts changed after the history ID since,
+// and returns the mailbox's latest history ID to pass next time. When Gmail
+// no longer keeps history that old, it reports a change so the caller
+// checks all drafts.
+func (c *Client) DraftChanges(ctx context.Context, since uint64) (bool, uint64, error) {
+	pageToken := ""
+	for {
+		resp, err := c.api.ListHistory(ctx, c.user, since, "DRAFT", pageToken)
+		if errors.Is(err, ErrNotFound) {
+			return true, 0, nil
+		}
+		if err != nil {
+			return false, 0, fmt.Errorf("unable to list mailbox history: %v", err)
+		}
+		if len(resp.History) > 0 {
+			return true, resp.HistoryId, nil
+		}
+		if resp.NextPageToken == "" {
+			return false, resp.HistoryId, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
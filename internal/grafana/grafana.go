@@ -0,0 +1,332 @@
+package grafana
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"calmdrafts/internal/stats"
+)
+
+// Metrics are the targets offered for time series, each a field of the
+// observation recorded after every check
+var Metrics = []string{"drafts", "empty", "stale", "pending", "deleted", "bytes"}
+
+// value returns a metric of an observation
+func value(obs *stats.Observation, metric string) (float64, bool) {
+	switch metric {
+	case "drafts":
+		return float64(obs.Drafts), true
+	case "empty":
+		return float64(obs.Empty), true
+	case "stale":
+		return float64(obs.Stale), true
+	case "pending":
+		return float64(obs.Pending), true
+	case "deleted":
+		return float64(obs.Deleted), true
+	case "bytes":
+		return float64(obs.Bytes), true
+	}
+	return 0, false
+}
+
+// Event is a change to a draft, shown as an annotation
+type Event struct {
+	Time    time.Time
+	Action  string
+	Subject string
+	Reason  string
+}
+
+// Source is the recorded history of one mailbox
+type Source struct {
+	Account      string // Empty for a single mailbox
+	Observations func() ([]*stats.Observation, error)
+	Events       func() ([]Event, error) // Nil when there is no audit log
+}
+
+// Handler serves the history of the sources to Grafana. It implements the
+// JSON datasource protocol (POST /metrics, /search, /query and /annotations)
+// and plain GET endpoints returning rows for the Infinity datasource
+// (/series and /events). When Token is set, requests must carry it as a
+// bearer token.
+type Handler struct {
+	Token   string
+	Sources []*Source
+
+	once sync.Once
+	mux  *http.ServeMux
+}
+
+// maxBody bounds the size of a query
+const maxBody = 64 << 10
+
+// ServeHTTP checks the token and dispatches the request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Token != "" {
+		bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(h.Token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	h.once.Do(func() {
+		h.mux = http.NewServeMux()
+		h.mux.HandleFunc("GET /{$}", h.handleHealth)
+		h.mux.HandleFunc("POST /search", h.handleSearch)
+		h.mux.HandleFunc("POST /metrics", h.handleMetrics)
+		h.mux.HandleFunc("POST /query", h.handleQuery)
+		h.mux.HandleFunc("POST /annotations", h.handleAnnotations)
+		h.mux.HandleFunc("GET /series", h.handleSeries)
+		h.mux.HandleFunc("GET /events", h.handleEvents)
+	})
+	h.mux.ServeHTTP(w, r)
+}
+
+// handleHealth answers the datasource's connection test
+func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "OK\n")
+}
+
+// handleSearch lists the metrics in the format of older plugin versions
+func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, Metrics)
+}
+
+// handleMetrics lists the metrics for the query editor
+func (h *Handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	type metric struct {
+		Label string `json:"label"`
+		Value string `json:"value"`
+	}
+	metrics := make([]metric, 0, len(Metrics))
+	for _, m := range Metrics {
+		metrics = append(metrics, metric{Label: m, Value: m})
+	}
+	writeJSON(w, metrics)
+}
+
+// timeRange is the dashboard's time range in a JSON datasource request
+type timeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// contains reports whether t lies in the range. A zero bound is open.
+func (tr timeRange) contains(t time.Time) bool {
+	return (tr.From.IsZero() || !t.Before(tr.From)) && (tr.To.IsZero() || !t.After(tr.To))
+}
+
+// series is a time series in the JSON datasource format
+type series struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"` // Value and Unix milliseconds
+}
+
+// handleQuery returns a time series per target and mailbox
+func (h *Handler) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Range   timeRange `json:"range"`
+		Targets []struct {
+			Target string `json:"target"`
+			Hide   bool   `json:"hide"`
+		} `json:"targets"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBody)).Decode(&query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, t := range query.Targets {
+		if _, ok := value(&stats.Observation{}, t.Target); !ok && t.Target != "" {
+			http.Error(w, "unknown target "+t.Target, http.StatusBadRequest)
+			return
+		}
+	}
+
+	result := []*series{}
+	for _, src := range h.Sources {
+		observations, err := src.Observations()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, t := range query.Targets {
+			if t.Hide || t.Target == "" {
+				continue
+			}
+			s := &series{Target: t.Target, Datapoints: [][2]float64{}}
+			if src.Account != "" {
+				s.Target += " " + src.Account
+			}
+			for _, obs := range observations {
+				if query.Range.contains(obs.Time) {
+					v, _ := value(obs, t.Target)
+					s.Datapoints = append(s.Datapoints, [2]float64{v, float64(obs.Time.UnixMilli())})
+				}
+			}
+			result = append(result, s)
+		}
+	}
+	writeJSON(w, result)
+}
+
+// handleAnnotations returns the draft changes in the range as annotations
+func (h *Handler) handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Range timeRange `json:"range"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBody)).Decode(&query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type annotation struct {
+		Time  int64    `json:"time"`
+		Title string   `json:"title"`
+		Text  string   `json:"text"`
+		Tags  []string `json:"tags"`
+	}
+	annotations := []annotation{}
+	err := h.eachEvent(query.Range, func(account string, e Event) {
+		tags := []string{e.Action}
+		if account != "" {
+			tags = append(tags, account)
+		}
+		subject := e.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		annotations = append(annotations, annotation{Time: e.Time.UnixMilli(), Title: e.Action + ": " + subject, Text: e.Reason, Tags: tags})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, annotations)
+}
+
+// handleSeries returns one row per check, with every metric, for the
+// Infinity datasource. The optional from and to parameters are RFC 3339
+// times or Unix milliseconds, as sent by ${__from} and ${__to}.
+func (h *Handler) handleSeries(w http.ResponseWriter, r *http.Request) {
+	tr, err := parseRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows := []map[string]any{}
+	for _, src := range h.Sources {
+		observations, err := src.Observations()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, obs := range observations {
+			if !tr.contains(obs.Time) {
+				continue
+			}
+			row := map[string]any{"time": obs.Time.UTC().Format(time.RFC3339)}
+			if src.Account != "" {
+				row["account"] = src.Account
+			}
+			for _, m := range Metrics {
+				row[m], _ = value(obs, m)
+			}
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i]["time"].(string) < rows[j]["time"].(string) })
+	writeJSON(w, rows)
+}
+
+// handleEvents returns one row per draft change, for the Infinity datasource
+func (h *Handler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	tr, err := parseRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type row struct {
+		Time    string `json:"time"`
+		Account string `json:"account,omitempty"`
+		Action  string `json:"action"`
+		Subject string `json:"subject"`
+		Reason  string `json:"reason,omitempty"`
+	}
+	rows := []row{}
+	err = h.eachEvent(tr, func(account string, e Event) {
+		rows = append(rows, row{Time: e.Time.UTC().Format(time.RFC3339), Account: account, Action: e.Action, Subject: e.Subject, Reason: e.Reason})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Time < rows[j].Time })
+	writeJSON(w, rows)
+}
+
+// eachEvent calls fn for every event of every source in the range
+func (h *Handler) eachEvent(tr timeRange, fn func(account string, e Event)) error {
+	for _, src := range h.Sources {
+		if src.Events == nil {
+			continue
+		}
+		events, err := src.Events()
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if tr.contains(e.Time) {
+				fn(src.Account, e)
+			}
+		}
+	}
+	return nil
+}
+
+// parseRange reads the from and to query parameters
+func parseRange(r *http.Request) (timeRange, error) {
+	var tr timeRange
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &tr.From}, {"to", &tr.To}} {
+		s := r.URL.Query().Get(p.name)
+		if s == "" {
+			continue
+		}
+		t, err := parseTime(s)
+		if err != nil {
+			return tr, err
+		}
+		*p.t = t
+	}
+	return tr, nil
+}
+
+// parseTime accepts RFC 3339 or Unix milliseconds
+func parseTime(s string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// writeJSON sends v as a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package i18n
+
+// catalog maps the English format strings of notifications and reports to
+// their translations. Counts are passed already formatted, hence %s.
+var catalog = map[string]map[string]string{
+	"fr": {
+		// Notifications
+		"You have %s draft(s) in your Gmail":            "Vous avez %s brouillon(s) dans Gmail",
+		"No drafts in your Gmail":                       "Aucun brouillon dans Gmail",
+		"You have 1 draft in your Gmail":                "Vous avez 1 brouillon dans Gmail",
+		" (%s empty)":                                   " (%s vide(s))",
+		"Deleted %s old empty draft(s)":                 "%s ancien(s) brouillon(s) vide(s) supprimé(s)",
+		"Deleted %s draft(s), %s failed: %s":            "%s brouillon(s) supprimé(s), %s en échec : %s",
+		". They will be retried at the next check":      ". Ils seront réessayés à la prochaine vérification",
+		"Checked %s draft(s): %s deleted, %s stale":     "%s brouillon(s) vérifié(s) : %s supprimé(s), %s abandonné(s)",
+		", %s failed":                                   ", %s en échec",
+		"quota":                                         "quota",
+		"not found":                                     "introuvable",
+		"server error":                                  "erreur du serveur",
+		"not allowed":                                   "non autorisé",
+		"archive":                                       "archivage",
+		"stage limit":                                   "limite d'étape",
+		"other":                                         "autre",
+		"%s stale draft(s) need your attention":         "%s brouillon(s) en attente demandent votre attention",
+		", starting with %q":                            ", à commencer par %q",
+		"%s draft(s) look ready to send.":               "%s brouillon(s) semblent prêts à être envoyés.",
+		"Send or delete %q?":                            "Envoyer ou supprimer %q ?",
+		"Send %q to %s now?":                            "Envoyer %q à %s maintenant ?",
+		" (and %s more)":                                " (et %s autre(s))",
+		"%s - Alarm":                                    "%s - Alarme",
+		"%s - Error":                                    "%s - Erreur",
+		"Error: %v":                                     "Erreur : %v",
+		" (ongoing since %s, %s time(s))":               " (en cours depuis le %s, %s fois)",
+		"%s - Working again":                            "%s - Rétabli",
+		"Checks work again after failing since %s: %s":  "Les vérifications fonctionnent à nouveau après des échecs depuis le %s : %s",
+		"%s - Sign in again":                            "%s - Reconnectez-vous",
+		"Gmail access needs to be authorized again: %v": "L'accès à Gmail doit être autorisé à nouveau : %v",
+		"Test notification - notifications are working": "Notification de test - les notifications fonctionnent",
+		" Run \"calmdrafts nudge\" to send now, snooze or delete":                                                        " Lancez « calmdrafts nudge » pour envoyer maintenant, reporter ou supprimer",
+		"%s draft(s) will be deleted after the grace period. Run \"calmdrafts review\" to approve or reject them":        "%s brouillon(s) seront supprimés après le délai de grâce. Lancez « calmdrafts review » pour les approuver ou les refuser",
+		"%s trashed draft(s) will be permanently purged in %s. Run \"calmdrafts restore --from-trash all\" to keep them": "%s brouillon(s) de la corbeille seront définitivement supprimés dans %s. Lancez « calmdrafts restore --from-trash all » pour les garder",
+
+		// Reports
+		"CalmDrafts report":          "Rapport CalmDrafts",
+		"Generated %s: %s.":          "Généré le %s : %s.",
+		"no drafts":                  "aucun brouillon",
+		"Probably safe to delete":    "Probablement à supprimer",
+		"Needs a decision":           "À décider",
+		"Actively in progress":       "En cours",
+		"Templates":                  "Modèles",
+		"%s probably safe to delete": "%s probablement à supprimer",
+		"%s needs a decision":        "%s à décider",
+		"%s actively in progress":    "%s en cours",
+		"%s templates":               "%s modèles",
+		"(no subject)":               "(sans objet)",
+		" to %s":                     " à %s",
+		" to %s recipients":          " à %s destinataires",
+		", last saved %s":            ", enregistré %s",
+		", reply to %s from %s":      ", en réponse à %s (%s)",
+		", abandoned score %s":       ", score d'abandon %s",
+		"Draft ages":                 "Âge des brouillons",
+		"Total size: %s.":            "Taille totale : %s.",
+		"Large drafts":               "Brouillons volumineux",
+
+		// One-click links of the report
+		" ([delete](%s), [keep](%s))": " ([supprimer](%s), [garder](%s))",
+	},
+	"de": {
+		// Notifications
+		"You have %s draft(s) in your Gmail":            "Sie haben %s Entwürfe in Gmail",
+		"No drafts in your Gmail":                       "Keine Entwürfe in Gmail",
+		"You have 1 draft in your Gmail":                "Sie haben 1 Entwurf in Gmail",
+		" (%s empty)":                                   " (%s leer)",
+		"Deleted %s old empty draft(s)":                 "%s alte leere Entwürfe gelöscht",
+		"Deleted %s draft(s), %s failed: %s":            "%s Entwürfe gelöscht, %s fehlgeschlagen: %s",
+		". They will be retried at the next check":      ". Sie werden bei der nächsten Prüfung erneut versucht",
+		"Checked %s draft(s): %s deleted, %s stale":     "%s Entwürfe geprüft: %s gelöscht, %s veraltet",
+		", %s failed":                                   ", %s fehlgeschlagen",
+		"quota":                                         "Kontingent",
+		"not found":                                     "nicht gefunden",
+		"server error":                                  "Serverfehler",
+		"not allowed":                                   "nicht erlaubt",
+		"archive":                                       "Archivierung",
+		"stage limit":                                   "Stufenlimit",
+		"other":                                         "Sonstiges",
+		"%s stale draft(s) need your attention":         "%s liegengebliebene Entwürfe brauchen Ihre Aufmerksamkeit",
+		", starting with %q":                            ", zuerst %q",
+		"%s draft(s) look ready to send.":               "%s Entwürfe scheinen versandbereit.",
+		"Send or delete %q?":                            "%q senden oder löschen?",
+		"Send %q to %s now?":                            "%q jetzt an %s senden?",
+		" (and %s more)":                                " (und %s weitere)",
+		"%s - Alarm":                                    "%s - Alarm",
+		"%s - Error":                                    "%s - Fehler",
+		"Error: %v":                                     "Fehler: %v",
+		" (ongoing since %s, %s time(s))":               " (besteht seit %s, %s Mal)",
+		"%s - Working again":                            "%s - Funktioniert wieder",
+		"Checks work again after failing since %s: %s":  "Die Prüfungen funktionieren wieder, nachdem sie seit %s fehlschlugen: %s",
+		"%s - Sign in again":                            "%s - Erneut anmelden",
+		"Gmail access needs to be authorized again: %v": "Der Zugriff auf Gmail muss erneut autorisiert werden: %v",
+		"Test notification - notifications are working": "Testbenachrichtigung - Benachrichtigungen funktionieren",
+		" Run \"calmdrafts nudge\" to send now, snooze or delete":                                                        " Führen Sie „calmdrafts nudge“ aus, um jetzt zu senden, zu verschieben oder zu löschen",
+		"%s draft(s) will be deleted after the grace period. Run \"calmdrafts review\" to approve or reject them":        "%s Entwürfe werden nach der Schonfrist gelöscht. Führen Sie „calmdrafts review“ aus, um sie zu bestätigen oder abzulehnen",
+		"%s trashed draft(s) will be permanently purged in %s. Run \"calmdrafts restore --from-trash all\" to keep them": "%s Entwürfe im Papierkorb werden in %s endgültig gelöscht. Führen Sie „calmdrafts restore --from-trash all“ aus, um sie zu behalten",
+
+		// Reports
+		"CalmDrafts report":          "CalmDrafts-Bericht",
+		"Generated %s: %s.":          "Erstellt am %s: %s.",
+		"no drafts":                  "keine Entwürfe",
+		"Probably safe to delete":    "Wahrscheinlich löschbar",
+		"Needs a decision":           "Entscheidung nötig",
+		"Actively in progress":       "In Arbeit",
+		"Templates":                  "Vorlagen",
+		"%s probably safe to delete": "%s wahrscheinlich löschbar",
+		"%s needs a decision":        "%s brauchen eine Entscheidung",
+		"%s actively in progress":    "%s in Arbeit",
+		"%s templates":               "%s Vorlagen",
+		"(no subject)":               "(kein Betreff)",
+		" to %s":                     " an %s",
+		" to %s recipients":          " an %s Empfänger",
+		", last saved %s":            ", zuletzt gespeichert %s",
+		", reply to %s from %s":      ", Antwort an %s (%s)",
+		", abandoned score %s":       ", Abbruchwert %s",
+		"Draft ages":                 "Alter der Entwürfe",
+		"Total size: %s.":            "Gesamtgröße: %s.",
+		"Large drafts":               "Große Entwürfe",
+
+		// One-click links of the report
+		" ([delete](%s), [keep](%s))": " ([löschen](%s), [behalten](%s))",
+	},
+	"es": {
+		// Notifications
+		"You have %s draft(s) in your Gmail":            "Tiene %s borrador(es) en Gmail",
+		"No drafts in your Gmail":                       "No hay borradores en Gmail",
+		"You have 1 draft in your Gmail":                "Tiene 1 borrador en Gmail",
+		" (%s empty)":                                   " (%s vacío(s))",
+		"Deleted %s old empty draft(s)":                 "Se eliminaron %s borrador(es) vacío(s) antiguo(s)",
+		"Deleted %s draft(s), %s failed: %s":            "Se eliminaron %s borrador(es), %s fallaron: %s",
+		". They will be retried at the next check":      ". Se reintentarán en la próxima comprobación",
+		"Checked %s draft(s): %s deleted, %s stale":     "Se comprobaron %s borrador(es): %s eliminado(s), %s abandonado(s)",
+		", %s failed":                                   ", %s fallaron",
+		"quota":                                         "cuota",
+		"not found":                                     "no encontrado",
+		"server error":                                  "error del servidor",
+		"not allowed":                                   "no permitido",
+		"archive":                                       "archivado",
+		"stage limit":                                   "límite de etapa",
+		"other":                                         "otro",
+		"%s stale draft(s) need your attention":         "%s borrador(es) estancado(s) requieren su atención",
+		", starting with %q":                            ", empezando por %q",
+		"%s draft(s) look ready to send.":               "%s borrador(es) parecen listos para enviar.",
+		"Send or delete %q?":                            "¿Enviar o eliminar %q?",
+		"Send %q to %s now?":                            "¿Enviar %q a %s ahora?",
+		" (and %s more)":                                " (y %s más)",
+		"%s - Alarm":                                    "%s - Alarma",
+		"%s - Error":                                    "%s - Error",
+		"Error: %v":                                     "Error: %v",
+		" (ongoing since %s, %s time(s))":               " (persiste desde %s, %s vez/veces)",
+		"%s - Working again":                            "%s - Funciona de nuevo",
+		"Checks work again after failing since %s: %s":  "Las comprobaciones vuelven a funcionar tras fallar desde %s: %s",
+		"%s - Sign in again":                            "%s - Inicie sesión de nuevo",
+		"Gmail access needs to be authorized again: %v": "Hay que volver a autorizar el acceso a Gmail: %v",
+		"Test notification - notifications are working": "Notificación de prueba - las notificaciones funcionan",
+		" Run \"calmdrafts nudge\" to send now, snooze or delete":                                                        " Ejecute \"calmdrafts nudge\" para enviar ahora, posponer o eliminar",
+		"%s draft(s) will be deleted after the grace period. Run \"calmdrafts review\" to approve or reject them":        "%s borrador(es) se eliminarán tras el periodo de gracia. Ejecute \"calmdrafts review\" para aprobarlos o rechazarlos",
+		"%s trashed draft(s) will be permanently purged in %s. Run \"calmdrafts restore --from-trash all\" to keep them": "%s borrador(es) de la papelera se eliminarán definitivamente en %s. Ejecute \"calmdrafts restore --from-trash all\" para conservarlos",
+
+		// Reports
+		"CalmDrafts report":          "Informe de CalmDrafts",
+		"Generated %s: %s.":          "Generado el %s: %s.",
+		"no drafts":                  "ningún borrador",
+		"Probably safe to delete":    "Probablemente se puede eliminar",
+		"Needs a decision":           "Necesita una decisión",
+		"Actively in progress":       "En curso",
+		"Templates":                  "Plantillas",
+		"%s probably safe to delete": "%s probablemente se pueden eliminar",
+		"%s needs a decision":        "%s necesitan una decisión",
+		"%s actively in progress":    "%s en curso",
+		"%s templates":               "%s plantillas",
+		"(no subject)":               "(sin asunto)",
+		" to %s":                     " para %s",
+		" to %s recipients":          " para %s destinatarios",
+		", last saved %s":            ", guardado %s",
+		", reply to %s from %s":      ", respuesta a %s (%s)",
+		", abandoned score %s":       ", puntuación de abandono %s",
+		"Draft ages":                 "Antigüedad de los borradores",
+		"Total size: %s.":            "Tamaño total: %s.",
+		"Large drafts":               "Borradores grandes",
+
+		// One-click links of the report
+		" ([delete](%s), [keep](%s))": " ([eliminar](%s), [conservar](%s))",
+	},
+	"ja": {
+		// Notifications
+		"You have %s draft(s) in your Gmail":            "Gmailに下書きが%s件あります",
+		"No drafts in your Gmail":                       "Gmailに下書きはありません",
+		"You have 1 draft in your Gmail":                "Gmailに下書きが1件あります",
+		" (%s empty)":                                   "（空の下書き%s件）",
+		"Deleted %s old empty draft(s)":                 "古い空の下書きを%s件削除しました",
+		"Deleted %s draft(s), %s failed: %s":            "%s件の下書きを削除、%s件失敗: %s",
+		". They will be retried at the next check":      "。次回のチェックで再試行します",
+		"Checked %s draft(s): %s deleted, %s stale":     "%s件の下書きを確認: 削除%s件、放置%s件",
+		", %s failed":                                   "、失敗%s件",
+		"quota":                                         "割り当て上限",
+		"not found":                                     "見つかりません",
+		"server error":                                  "サーバーエラー",
+		"not allowed":                                   "許可されていません",
+		"archive":                                       "アーカイブ",
+		"stage limit":                                   "ステージの上限",
+		"other":                                         "その他",
+		"%s stale draft(s) need your attention":         "放置された下書きが%s件あります",
+		", starting with %q":                            "（まず%q）",
+		"%s draft(s) look ready to send.":               "%s件の下書きが送信できそうです。",
+		"Send or delete %q?":                            "%qを送信または削除しますか？",
+		"Send %q to %s now?":                            "%qを今すぐ%sに送信しますか？",
+		" (and %s more)":                                "（他%s件）",
+		"%s - Alarm":                                    "%s - アラーム",
+		"%s - Error":                                    "%s - エラー",
+		"Error: %v":                                     "エラー: %v",
+		" (ongoing since %s, %s time(s))":               "（%s から継続中、%s 回）",
+		"%s - Working again":                            "%s - 復旧しました",
+		"Checks work again after failing since %s: %s":  "%s から失敗していたチェックが再び動作しています: %s",
+		"%s - Sign in again":                            "%s - 再ログイン",
+		"Gmail access needs to be authorized again: %v": "Gmailへのアクセスを再度許可する必要があります: %v",
+		"Test notification - notifications are working": "テスト通知 - 通知は正常に動作しています",
+		" Run \"calmdrafts nudge\" to send now, snooze or delete":                                                        "「calmdrafts nudge」で今すぐ送信、スヌーズ、削除ができます",
+		"%s draft(s) will be deleted after the grace period. Run \"calmdrafts review\" to approve or reject them":        "%s件の下書きが猶予期間後に削除されます。「calmdrafts review」で承認または却下できます",
+		"%s trashed draft(s) will be permanently purged in %s. Run \"calmdrafts restore --from-trash all\" to keep them": "ゴミ箱の下書き%s件は%s後に完全に削除されます。「calmdrafts restore --from-trash all」で残せます",
+
+		// Reports
+		"CalmDrafts report":          "CalmDraftsレポート",
+		"Generated %s: %s.":          "%sに作成: %s。",
+		"no drafts":                  "下書きなし",
+		"Probably safe to delete":    "削除してよさそう",
+		"Needs a decision":           "判断が必要",
+		"Actively in progress":       "作業中",
+		"Templates":                  "テンプレート",
+		"%s probably safe to delete": "削除してよさそう%s件",
+		"%s needs a decision":        "判断が必要%s件",
+		"%s actively in progress":    "作業中%s件",
+		"%s templates":               "テンプレート%s件",
+		"(no subject)":               "（件名なし）",
+		" to %s":                     " 宛先: %s",
+		" to %s recipients":          " 宛先: %s人",
+		", last saved %s":            "、最終保存: %s",
+		", reply to %s from %s":      "、%sへの返信（%s）",
+		", abandoned score %s":       "、放置スコア %s",
+		"Draft ages":                 "下書きの経過時間",
+		"Total size: %s.":            "合計サイズ: %s。",
+		"Large drafts":               "大きな下書き",
+
+		// One-click links of the report
+		" ([delete](%s), [keep](%s))": "（[削除](%s)、[保持](%s)）",
+	},
+}
@@ -0,0 +1,188 @@
+// Package i18n formats the text of notifications and reports for the
+// user's language: translated messages, counts with the local digit
+// grouping, and ages such as "il y a 3 jours" or "3日前" instead of Go
+// duration strings.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale formats text for one language. A nil Locale formats English.
+type Locale struct {
+	lang  string
+	style *style
+}
+
+// style is how a language writes numbers and ages
+type style struct {
+	group   string // Digit group separator
+	decimal string // Decimal separator
+	space   string // Between a number and its unit
+	ago     string // Format of a past age, e.g. "%s ago"
+	justNow string
+	units   map[string][4]string // Singular, plural, and the same for ages in the past
+	plural  func(n int) bool
+}
+
+var styles = map[string]*style{
+	"en": {
+		group: ",", decimal: ".", space: " ", ago: "%s ago", justNow: "just now",
+		units: map[string][4]string{
+			"day":    {"day", "days", "day", "days"},
+			"hour":   {"hour", "hours", "hour", "hours"},
+			"minute": {"minute", "minutes", "minute", "minutes"},
+		},
+		plural: func(n int) bool { return n != 1 },
+	},
+	"fr": {
+		group: "\u202f", decimal: ",", space: "\u00a0", ago: "il y a %s", justNow: "à l'instant",
+		units: map[string][4]string{
+			"day":    {"jour", "jours", "jour", "jours"},
+			"hour":   {"heure", "heures", "heure", "heures"},
+			"minute": {"minute", "minutes", "minute", "minutes"},
+		},
+		plural: func(n int) bool { return n > 1 },
+	},
+	"de": {
+		group: ".", decimal: ",", space: " ", ago: "vor %s", justNow: "gerade eben",
+		units: map[string][4]string{
+			"day":    {"Tag", "Tage", "Tag", "Tagen"},
+			"hour":   {"Stunde", "Stunden", "Stunde", "Stunden"},
+			"minute": {"Minute", "Minuten", "Minute", "Minuten"},
+		},
+		plural: func(n int) bool { return n != 1 },
+	},
+	"es": {
+		group: ".", decimal: ",", space: " ", ago: "hace %s", justNow: "ahora mismo",
+		units: map[string][4]string{
+			"day":    {"día", "días", "día", "días"},
+			"hour":   {"hora", "horas", "hora", "horas"},
+			"minute": {"minuto", "minutos", "minuto", "minutos"},
+		},
+		plural: func(n int) bool { return n != 1 },
+	},
+	"ja": {
+		group: ",", decimal: ".", space: "", ago: "%s前", justNow: "たった今",
+		units: map[string][4]string{
+			"day":    {"日", "日", "日", "日"},
+			"hour":   {"時間", "時間", "時間", "時間"},
+			"minute": {"分", "分", "分", "分"},
+		},
+		plural: func(n int) bool { return false },
+	},
+}
+
+// Parse returns the locale for a language tag such as "fr", "de-CH" or
+// "ja_JP.UTF-8". Unsupported languages fall back to English.
+func Parse(tag string) *Locale {
+	lang := strings.ToLower(tag)
+	if i := strings.IndexAny(lang, "_-.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := styles[lang]; !ok {
+		lang = "en"
+	}
+	return &Locale{lang: lang, style: styles[lang]}
+}
+
+// FromEnv returns the locale set by LC_ALL, LC_MESSAGES or LANG
+func FromEnv() *Locale {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if tag := os.Getenv(name); tag != "" {
+			return Parse(tag)
+		}
+	}
+	return Parse("en")
+}
+
+// Lang returns the language code, e.g. "fr"
+func (l *Locale) Lang() string {
+	if l == nil {
+		return "en"
+	}
+	return l.lang
+}
+
+func (l *Locale) get() *style {
+	if l == nil {
+		return styles["en"]
+	}
+	return l.style
+}
+
+// Sprintf formats the translation of an English format string, or the
+// string itself when there is no translation
+func (l *Locale) Sprintf(format string, args ...interface{}) string {
+	if translated, ok := catalog[l.Lang()][format]; ok {
+		format = translated
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Number formats a count with the language's digit grouping, e.g. 12,345
+// or 12.345
+func (l *Locale) Number(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(l.get().group)
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
+
+// Decimal formats a fraction with the language's decimal separator, e.g.
+// 0.75 or 0,75
+func (l *Locale) Decimal(f float64, precision int) string {
+	s := strconv.FormatFloat(f, 'f', precision, 64)
+	return strings.Replace(s, ".", l.get().decimal, 1)
+}
+
+// Duration formats a length of time in its largest whole unit, e.g. "7 days"
+// for 169h
+func (l *Locale) Duration(d time.Duration) string {
+	return l.duration(d, false)
+}
+
+// Ago formats how long ago something happened, e.g. "3 days ago", "il y a
+// 3 jours" or "3日前"
+func (l *Locale) Ago(d time.Duration) string {
+	if d < time.Minute {
+		return l.get().justNow
+	}
+	return fmt.Sprintf(l.get().ago, l.duration(d, true))
+}
+
+// duration formats d in days from two days or a whole number of days, in
+// hours from two hours, and otherwise in minutes
+func (l *Locale) duration(d time.Duration, past bool) string {
+	unit, n := "minute", int(d/time.Minute)
+	switch {
+	case d >= 48*time.Hour, d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		unit, n = "day", int(d/(24*time.Hour))
+	case d >= 2*time.Hour:
+		unit, n = "hour", int(d/time.Hour)
+	}
+
+	s := l.get()
+	forms := s.units[unit]
+	i := 0
+	if s.plural(n) {
+		i = 1
+	}
+	if past {
+		i += 2
+	}
+	return l.Number(n) + s.space + forms[i]
+}
@@ -0,0 +1,307 @@
+// Package jobs runs the periodic tasks of the daemon, such as checking the
+// drafts or pruning local data. Each job has its own schedule and runs in
+// its own goroutine, so a slow or failing job doesn't hold up the others.
+// A job never overlaps itself. The schedule can be kept in a file, so it
+// survives a restart and runs missed while the daemon was stopped are
+// noticed.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// wakeInterval is the longest a job sleeps without looking at the clock,
+// so runs due while the computer was asleep start soon after it wakes
+const wakeInterval = time.Minute
+
+// ErrSkipped is returned by a run that decided not to do anything this
+// time, e.g. to save battery. It isn't counted as a failure.
+var ErrSkipped = errors.New("skipped")
+
+// Job is a periodic task
+type Job struct {
+	Name string
+	Run  func(ctx context.Context) error
+	// Next returns when the job is due again after the run due at due
+	// ended at now with err. Runs started by Trigger don't move the
+	// schedule.
+	Next func(due, now time.Time, err error) time.Time
+}
+
+// Every returns a schedule running a job every d after the run before,
+// skipping the runs missed while the computer slept
+func Every(d time.Duration) func(due, now time.Time, err error) time.Time {
+	return func(due, now time.Time, err error) time.Time {
+		next := due.Round(0).Add(d)
+		if !next.After(now.Round(0)) {
+			next = now.Round(0).Add(d)
+		}
+		return next
+	}
+}
+
+// Status is the state of a job, as shown by "calmdrafts status"
+type Status struct {
+	Name      string    `json:"name"`
+	Next      time.Time `json:"next"`
+	Running   bool      `json:"running,omitempty"`
+	LastRun   time.Time `json:"last_run"`
+	LastError string    `json:"last_error,omitempty"` // Error of the last run, empty if it succeeded
+	Runs      int       `json:"runs"`
+	Failures  int       `json:"failures"`
+	Missed    int       `json:"missed"` // Times the job was due while the daemon was stopped
+}
+
+// Scheduler runs jobs on their schedules
+type Scheduler struct {
+	// SkipMissed moves runs missed while the daemon was stopped to their
+	// next time instead of running them at Start
+	SkipMissed bool
+
+	path    string
+	mu      sync.Mutex
+	entries []*entry
+	stop    chan struct{}
+	running sync.WaitGroup
+}
+
+// entry is a job and its state
+type entry struct {
+	job     *Job
+	trigger chan struct{}
+	status  Status
+}
+
+// New returns a scheduler without jobs. With a path, the schedule and
+// outcome of every job are kept in that file.
+func New(path string) *Scheduler {
+	return &Scheduler{path: path, stop: make(chan struct{})}
+}
+
+// Add adds a job first due at first, unless the saved schedule has it due
+// at another time. Jobs added after Start don't run.
+func (s *Scheduler) Add(job *Job, first time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, &entry{
+		job:     job,
+		trigger: make(chan struct{}, 1),
+		status:  Status{Name: job.Name, Next: first.Round(0)},
+	})
+}
+
+// Start restores the saved schedule and runs every job in its own
+// goroutine until Stop. A job that was due while the daemon was stopped
+// runs right away, or at its next time with SkipMissed.
+func (s *Scheduler) Start(ctx context.Context) error {
+	saved, err := Load(s.path)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]Status, len(saved))
+	for _, status := range saved {
+		byName[status.Name] = status
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Round(0)
+	for _, e := range s.entries {
+		if status, ok := byName[e.job.Name]; ok {
+			status.Running = false
+			e.status = status
+			if status.Next.Before(now) {
+				e.status.Missed++
+				if s.SkipMissed {
+					e.status.Next = e.job.Next(status.Next, now, nil).Round(0)
+					log.Printf("Missed the %s job due at %s, next run at %s", e.job.Name, status.Next.Local().Format("2006-01-02 15:04"), e.status.Next.Local().Format("2006-01-02 15:04"))
+				} else {
+					e.status.Next = now
+					log.Printf("Missed the %s job due at %s, running it now", e.job.Name, status.Next.Local().Format("2006-01-02 15:04"))
+				}
+			}
+		}
+	}
+	s.save()
+	for _, e := range s.entries {
+		s.running.Add(1)
+		go s.loop(ctx, e)
+	}
+	return nil
+}
+
+// Stop stops scheduling runs and waits for the running ones to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.running.Wait()
+}
+
+// Trigger runs a job as soon as it isn't running, outside its schedule.
+// It reports whether the job exists.
+func (s *Scheduler) Trigger(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.job.Name == name {
+			select {
+			case e.trigger <- struct{}{}:
+			default: // already requested
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Statuses returns the state of every job, the next due first
+func (s *Scheduler) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		statuses = append(statuses, e.status)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Next.Before(statuses[j].Next)
+	})
+	return statuses
+}
+
+// loop runs a job whenever it is due or triggered. The due time has no
+// monotonic reading, so it is compared with the wall clock, which keeps
+// running while the computer sleeps.
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	defer s.running.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		due := e.status.Next
+		s.mu.Unlock()
+
+		triggered := false
+		timer.Reset(max(min(time.Until(due), wakeInterval), 0))
+		select {
+		case <-s.stop:
+			return
+		case <-e.trigger:
+			triggered = true
+		case <-timer.C:
+			if time.Now().Before(due) {
+				continue
+			}
+		}
+
+		err := s.run(ctx, e)
+		if !triggered {
+			next := e.job.Next(due, time.Now(), err)
+			s.mu.Lock()
+			e.status.Next = next.Round(0)
+			s.save()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// run runs a job once and records the outcome in its status
+func (s *Scheduler) run(ctx context.Context, e *entry) error {
+	s.mu.Lock()
+	e.status.Running = true
+	s.mu.Unlock()
+
+	start := time.Now()
+	err := e.job.Run(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.status.Running = false
+	if errors.Is(err, ErrSkipped) {
+		return err
+	}
+	e.status.LastRun = start.Round(0)
+	e.status.Runs++
+	e.status.LastError = ""
+	if err != nil {
+		e.status.LastError = err.Error()
+		e.status.Failures++
+	}
+	s.save()
+	return err
+}
+
+// schedule is the file format of the saved schedule
+type schedule struct {
+	Jobs []Status `json:"jobs"`
+}
+
+// Load returns the schedule saved at path, or nothing if there is none
+func Load(path string) ([]Status, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read job schedule: %v", err)
+	}
+	var saved schedule
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("unable to parse job schedule: %v", err)
+	}
+	return saved.Jobs, nil
+}
+
+// save writes the state of every job to the scheduler's file, replacing
+// it atomically. A failure is logged, since it only loses the schedule
+// across a restart. The caller holds s.mu.
+func (s *Scheduler) save() {
+	if s.path == "" {
+		return
+	}
+	saved := schedule{Jobs: make([]Status, 0, len(s.entries))}
+	for _, e := range s.entries {
+		saved.Jobs = append(saved.Jobs, e.status)
+	}
+	if err := writeFile(s.path, saved); err != nil {
+		log.Printf("Error saving job schedule: %v", err)
+	}
+}
+
+// writeFile writes v as JSON to path through a temporary file, so a crash
+// never leaves a truncated file
+func writeFile(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".jobs-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStartRestoresSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	now := time.Now().Round(0)
+	saved := schedule{Jobs: []Status{
+		{Name: "later", Next: now.Add(time.Hour)},
+		{Name: "missed", Next: now.Add(-3 * time.Hour)},
+	}}
+	if err := writeFile(path, saved); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, skip := range []bool{false, true} {
+		s := New(path)
+		s.SkipMissed = skip
+		noop := func(ctx context.Context) error { return nil }
+		s.Add(&Job{Name: "later", Run: noop, Next: Every(time.Hour)}, now)
+		s.Add(&Job{Name: "missed", Run: noop, Next: Every(2 * time.Hour)}, now)
+		s.Add(&Job{Name: "new", Run: noop, Next: Every(time.Hour)}, now.Add(time.Minute))
+		if err := s.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		s.Stop()
+
+		next := make(map[string]Status)
+		for _, status := range s.Statuses() {
+			next[status.Name] = status
+		}
+		if !next["later"].Next.Equal(now.Add(time.Hour)) {
+			t.Errorf("skip %v: later job due at %v, want the saved %v", skip, next["later"].Next, now.Add(time.Hour))
+		}
+		if !next["new"].Next.Equal(now.Add(time.Minute)) {
+			t.Errorf("skip %v: new job due at %v, want %v", skip, next["new"].Next, now.Add(time.Minute))
+		}
+		missed := next["missed"]
+		if missed.Missed != 1 {
+			t.Errorf("skip %v: missed job counted %d missed runs, want 1", skip, missed.Missed)
+		}
+		if skip && (missed.Runs > 0 || !missed.Next.After(now)) {
+			t.Errorf("missed job ran %d time(s) and is due at %v with SkipMissed, want no run and after %v", missed.Runs, missed.Next, now)
+		}
+		if !skip && missed.Runs == 0 && missed.Next.After(time.Now()) {
+			t.Errorf("missed job due at %v without running, want now", missed.Next)
+		}
+
+		// The next start sees the schedule as this one left it
+		if err := writeFile(path, saved); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("schedule not saved: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package jsonl stores records as JSON lines in files that several
+// processes append to and prune at once, such as the audit log and the
+// histories in the state directory
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Append adds v as a line at the end of the file at path, creating the file
+// and its directory when needed
+func Append(path string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to encode %s: %v", filepath.Base(path), err)
+	}
+
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %v", filepath.Base(path), err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("unable to write %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Rewrite replaces the lines of the file at path with those edit returns.
+// Appends wait until it is done, so no line written meanwhile is lost, and
+// the file is replaced atomically, so a crash never leaves it truncated.
+// The lines given to edit have no trailing newline and skip empty lines.
+// When edit reports no change, or the file doesn't exist, nothing is
+// written.
+func Rewrite(path string, edit func(lines [][]byte) ([][]byte, bool, error)) error {
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", filepath.Base(path), err)
+	}
+	lines := [][]byte{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	kept, changed, err := edit(lines)
+	if err != nil || !changed {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("unable to rewrite %s: %v", filepath.Base(path), err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, line := range kept {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to rewrite %s: %v", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to rewrite %s: %v", filepath.Base(path), err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("unable to rewrite %s: %v", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to rewrite %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Prune drops the lines at the start of the file at path that are older
+// than maxAge, as told by the time at returns for a line decoded into a T,
+// then the oldest lines until the file is no larger than maxBytes. Lines
+// are expected oldest first. Zero limits are ignored. It returns the number
+// of lines dropped.
+func Prune[T any](path string, maxAge time.Duration, maxBytes int64, at func(*T) time.Time) (int, error) {
+	dropped := 0
+	err := Rewrite(path, func(lines [][]byte) ([][]byte, bool, error) {
+		var total int64
+		for _, line := range lines {
+			total += int64(len(line)) + 1
+		}
+
+		cutoff := time.Now().Add(-maxAge)
+		for dropped < len(lines) {
+			tooBig := maxBytes > 0 && total > maxBytes
+			tooOld := false
+			if maxAge > 0 && !tooBig {
+				v := new(T)
+				if err := json.Unmarshal(lines[dropped], v); err != nil {
+					return nil, false, fmt.Errorf("unable to parse %s: %v", filepath.Base(path), err)
+				}
+				tooOld = at(v).Before(cutoff)
+			}
+			if !tooOld && !tooBig {
+				break
+			}
+			total -= int64(len(lines[dropped])) + 1
+			dropped++
+		}
+		return lines[dropped:], dropped > 0, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return dropped, nil
+}
+
+// lock takes the lock guarding the file at path, kept in a hidden file next
+// to it since the file itself is replaced by Rewrite, waiting for other
+// processes to release it. The returned function releases it.
+func lock(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("unable to create directory for %s: %v", filepath.Base(path), err)
+	}
+	lockPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lock")
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to lock %s: %v", filepath.Base(path), err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to lock %s: %v", filepath.Base(path), err)
+	}
+	return func() { f.Close() }, nil
+}
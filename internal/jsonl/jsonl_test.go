@@ -0,0 +1,154 @@
+package jsonl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type record struct {
+	N    int       `json:"n"`
+	Time time.Time `json:"time"`
+}
+
+func recordTime(r *record) time.Time {
+	return r.Time
+}
+
+// read decodes the records in the file at path
+func read(t *testing.T, path string) []record {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []record{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		r := record{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("unable to parse %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		maxBytes int64
+		dropped  int
+	}{
+		{"no limits", 0, 0, 0},
+		{"age", 36 * time.Hour, 0, 3},
+		{"age keeps everything", 30 * 24 * time.Hour, 0, 0},
+		{"size", 0, 3 * 50, 2},
+		{"size smaller than a line", 0, 1, 5},
+		{"age then size", 36 * time.Hour, 1 * 50, 4},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		for i := 0; i < 5; i++ {
+			// Every line is 50 bytes with its newline, oldest first
+			if err := Append(path, &record{N: i, Time: now.Add(time.Duration(i-4) * 24 * time.Hour).UTC().Truncate(time.Second)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		dropped, err := Prune(path, tt.maxAge, tt.maxBytes, recordTime)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if dropped != tt.dropped {
+			t.Errorf("%s: dropped %d lines, want %d", tt.name, dropped, tt.dropped)
+		}
+		if tt.dropped == 5 {
+			if data, _ := os.ReadFile(path); len(data) != 0 {
+				t.Errorf("%s: kept %q, want an empty file", tt.name, data)
+			}
+			continue
+		}
+		records := read(t, path)
+		if len(records) != 5-tt.dropped || records[0].N != tt.dropped {
+			t.Errorf("%s: kept %+v, want the newest %d", tt.name, records, 5-tt.dropped)
+		}
+	}
+}
+
+func TestPruneMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	dropped, err := Prune(path, time.Hour, 1, recordTime)
+	if err != nil || dropped != 0 {
+		t.Errorf("pruned a missing file: %d, %v", dropped, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pruning created %s", path)
+	}
+}
+
+func TestPruneKeepsConcurrentAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	const writers, appends = 4, 200
+	wg := sync.WaitGroup{}
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < appends; i++ {
+				if err := Append(path, &record{N: w*appends + i, Time: time.Now()}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// Every prune rewrites the file, racing the appends
+	dropped := 0
+	for pruning := true; pruning; {
+		select {
+		case <-done:
+			pruning = false
+		default:
+		}
+		n, err := Prune(path, 0, 20*50, recordTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dropped += n
+	}
+
+	if kept := len(read(t, path)); kept+dropped != writers*appends {
+		t.Errorf("kept %d lines and dropped %d, want %d in all", kept, dropped, writers*appends)
+	}
+}
+
+func TestRewriteUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := os.WriteFile(path, []byte("{\"n\":1}\n\n{\"n\":2}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err := Rewrite(path, func(lines [][]byte) ([][]byte, bool, error) {
+		if len(lines) != 2 {
+			t.Errorf("got %d lines, want 2 without the empty one", len(lines))
+		}
+		return nil, false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{\"n\":1}\n\n{\"n\":2}\n" {
+		t.Errorf("unchanged rewrite wrote %q", data)
+	}
+}
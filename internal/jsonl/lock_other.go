@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package jsonl
+
+import "os"
+
+// lockFile does nothing where files can't be locked
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,149 @@
+// Package mqtt publishes messages to an MQTT 3.1.1 broker. It implements
+// only what CalmDrafts needs: connect, publish at QoS 0 and disconnect.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Broker is an MQTT broker and the credentials to connect with
+type Broker struct {
+	URL      string // "tcp://host:1883", or "ssl://host:8883" / "mqtts://host:8883" for TLS
+	ClientID string
+	Username string
+	Password string
+}
+
+// Message is published to a topic. Retained messages are kept by the broker
+// and delivered to clients subscribing later.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// connackCodes explains the broker's refusals
+var connackCodes = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Publish connects to the broker, publishes the messages and disconnects
+func (b *Broker) Publish(messages ...*Message) error {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return fmt.Errorf("mqtt: invalid broker URL: %v", err)
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", hostPort(u, "1883"))
+	case "ssl", "tls", "mqtts":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostPort(u, "8883"), &tls.Config{ServerName: u.Hostname()})
+	default:
+		return fmt.Errorf("mqtt: unsupported broker scheme %q (want tcp or ssl)", u.Scheme)
+	}
+	if err != nil {
+		return fmt.Errorf("mqtt: unable to connect to %s: %v", u.Host, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	w := bufio.NewWriter(conn)
+	w.Write(b.connectPacket())
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("mqtt: %v", err)
+	}
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		return fmt.Errorf("mqtt: no CONNACK: %v", err)
+	}
+	if ack[0] != 0x20 || ack[1] != 0x02 {
+		return errors.New("mqtt: invalid CONNACK")
+	}
+	if ack[3] != 0 {
+		reason, ok := connackCodes[ack[3]]
+		if !ok {
+			reason = fmt.Sprintf("code %d", ack[3])
+		}
+		return fmt.Errorf("mqtt: connection refused: %s", reason)
+	}
+
+	for _, m := range messages {
+		w.Write(publishPacket(m))
+	}
+	w.Write([]byte{0xe0, 0x00}) // DISCONNECT
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("mqtt: %v", err)
+	}
+	return nil
+}
+
+// hostPort returns the URL's host with the default port when it has none
+func hostPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// connectPacket returns a CONNECT packet with a clean session
+func (b *Broker) connectPacket() []byte {
+	flags := byte(0x02)
+	payload := appendString(nil, b.ClientID)
+	if b.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, b.Username)
+		if b.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, b.Password)
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags, 0, 60) // Protocol level 3.1.1, keep alive 60s
+	return packet(0x10, append(body, payload...))
+}
+
+// publishPacket returns a QoS 0 PUBLISH packet
+func publishPacket(m *Message) []byte {
+	header := byte(0x30)
+	if m.Retain {
+		header |= 0x01
+	}
+	return packet(header, append(appendString(nil, m.Topic), m.Payload...))
+}
+
+// packet prefixes a body with the fixed header and remaining length
+func packet(header byte, body []byte) []byte {
+	p := []byte{header}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		p = append(p, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(p, body...)
+}
+
+// appendString appends a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
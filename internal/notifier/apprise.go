@@ -0,0 +1,89 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Apprise delivers notifications to Apprise URLs, such as
+// "tgram://bottoken/ChatID" or "ntfy://topic", reaching any of the services
+// Apprise supports. It runs the apprise command, or posts to an Apprise API
+// server when Server is set.
+type Apprise struct {
+	URLs    []string
+	Command string // Default: "apprise" from PATH
+	Server  string // Apprise API server, e.g. "http://apprise:8000"
+	Client  *http.Client
+}
+
+// eventLevels maps events to severity levels, used as Apprise notification
+// types, which services show as colors or icons. Other events are "info".
+var eventLevels = map[Event]string{
+	EventDeletion: "success",
+	EventStale:    "warning",
+	EventNudge:    "warning",
+	EventPending:  "warning",
+	EventTrash:    "warning",
+	EventAlarm:    "failure",
+	EventError:    "failure",
+	EventAuth:     "failure",
+}
+
+// Send delivers a notification to every URL
+func (a *Apprise) Send(msg *Message) error {
+	kind, ok := eventLevels[msg.Event]
+	if !ok {
+		kind = "info"
+	}
+	if a.Server != "" {
+		return a.post(msg, kind)
+	}
+
+	command := a.Command
+	if command == "" {
+		command = "apprise"
+	}
+	args := append([]string{"--title", msg.Title, "--body", msg.Message, "--notification-type", kind}, a.URLs...)
+	out, err := exec.Command(command, args...).CombinedOutput()
+	if err != nil {
+		if detail := strings.TrimSpace(string(out)); detail != "" {
+			return fmt.Errorf("apprise: %v: %s", err, detail)
+		}
+		return fmt.Errorf("apprise: %v", err)
+	}
+	return nil
+}
+
+// post sends a notification through the stateless endpoint of an Apprise
+// API server
+func (a *Apprise) post(msg *Message, kind string) error {
+	body, err := json.Marshal(map[string]string{
+		"urls":  strings.Join(a.URLs, ","),
+		"title": msg.Title,
+		"body":  msg.Message,
+		"type":  kind,
+	})
+	if err != nil {
+		return fmt.Errorf("apprise: %v", err)
+	}
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Post(strings.TrimRight(a.Server, "/")+"/notify/", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("apprise: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("apprise: %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
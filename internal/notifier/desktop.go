@@ -0,0 +1,68 @@
+package notifier
+
+// GmailDraftsURL is opened by the "Open Gmail" action
+const GmailDraftsURL = "https://mail.google.com/mail/u/0/#drafts"
+
+// Action is a button on a desktop notification
+type Action string
+
+const (
+	ActionOpen        Action = "open"         // Open the drafts folder in Gmail
+	ActionSnooze      Action = "snooze"       // Postpone the nudges
+	ActionDelete      Action = "delete"       // Delete the pending drafts without waiting for the grace period
+	ActionSend        Action = "send"         // Ask to confirm sending the draft named in the nudge
+	ActionConfirmSend Action = "confirm-send" // Send the draft named in the confirmation
+)
+
+// actionLabels are the button labels of the actions
+var actionLabels = map[Action]string{
+	ActionOpen:        "Open Gmail",
+	ActionSnooze:      "Snooze",
+	ActionDelete:      "Delete now",
+	ActionSend:        "Send now",
+	ActionConfirmSend: "Confirm send",
+}
+
+// eventActions lists the buttons offered with each event, where the desktop
+// supports them
+var eventActions = map[Event][]Action{
+	EventStale:   {ActionOpen},
+	EventNudge:   {ActionSend, ActionSnooze, ActionOpen},
+	EventPending: {ActionDelete, ActionOpen},
+}
+
+// desktopNotification is a notification shown on the desktop
+type desktopNotification struct {
+	title   string
+	message string
+	event   Event // Empty for notifications about no particular event
+	urgent  bool
+	actions []Action
+	icon    string // Path to the icon, empty for none
+	sound   string // Sound name, SoundNone, or empty for the default
+}
+
+// SetAppID sets the identity desktop notifications are shown under: the
+// bundle ID of an installed app on macOS, the AppUserModelID registered for
+// CalmDrafts on Windows
+func (n *Notifier) SetAppID(id string) {
+	n.appID = id
+}
+
+// SetActionHandler registers a function called when the user clicks an
+// action button CalmDrafts doesn't handle by itself, such as Snooze,
+// Delete now or Send now. It is called from another goroutine.
+func (n *Notifier) SetActionHandler(handle func(Event, Action)) {
+	n.onAction = handle
+}
+
+// handleAction runs the action the user clicked
+func (n *Notifier) handleAction(event Event, action Action) {
+	if action == ActionOpen {
+		openURL(GmailDraftsURL)
+		return
+	}
+	if n.onAction != nil {
+		n.onAction(event, action)
+	}
+}
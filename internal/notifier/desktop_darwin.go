@@ -0,0 +1,92 @@
+package notifier
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/gen2brain/beeep"
+)
+
+// showDesktop posts a notification to Notification Center. With alerter or
+// terminal-notifier installed, notifications carry an app identity, stay in
+// Notification Center, respect Focus modes and replace the previous one of
+// the same event; alerter also offers the action buttons. Without either,
+// beeep's AppleScript toast is used.
+func (n *Notifier) showDesktop(d *desktopNotification) error {
+	group := "calmdrafts"
+	if d.event != "" {
+		group += "." + string(d.event)
+	}
+
+	if path, err := exec.LookPath("alerter"); err == nil {
+		args := []string{"-title", d.title, "-message", d.message, "-group", group, "-timeout", "3600"}
+		args = append(args, d.helperArgs(n.appID)...)
+		if len(d.actions) > 0 {
+			labels := make([]string, len(d.actions))
+			for i, a := range d.actions {
+				labels[i] = actionLabels[a]
+			}
+			args = append(args, "-actions", strings.Join(labels, ","))
+		}
+		cmd := exec.Command(path, args...)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		// alerter waits until the notification is answered
+		go func() {
+			if cmd.Wait() != nil {
+				return
+			}
+			answer := strings.TrimSpace(out.String())
+			if answer == "@CONTENTCLICKED" {
+				n.handleAction(d.event, ActionOpen)
+				return
+			}
+			for _, a := range d.actions {
+				if answer == actionLabels[a] {
+					n.handleAction(d.event, a)
+				}
+			}
+		}()
+		return nil
+	}
+
+	if path, err := exec.LookPath("terminal-notifier"); err == nil {
+		args := []string{"-title", d.title, "-message", d.message, "-group", group, "-open", GmailDraftsURL}
+		args = append(args, d.helperArgs(n.appID)...)
+		return exec.Command(path, args...).Run()
+	}
+
+	if d.urgent && d.sound != SoundNone {
+		return beeep.Alert(d.title, d.message, d.icon)
+	}
+	return beeep.Notify(d.title, d.message, d.icon)
+}
+
+// helperArgs returns the identity, icon and sound arguments shared by
+// alerter and terminal-notifier
+func (d *desktopNotification) helperArgs(appID string) []string {
+	var args []string
+	if appID != "" {
+		args = append(args, "-sender", appID)
+	}
+	if d.icon != "" {
+		args = append(args, "-appIcon", d.icon)
+	}
+	sound := d.sound
+	if sound == "" && d.urgent {
+		sound = "default"
+	}
+	if sound != "" && sound != SoundNone {
+		args = append(args, "-sound", sound)
+	}
+	return args
+}
+
+// openURL opens a URL in the default browser
+func openURL(url string) error {
+	return exec.Command("open", url).Start()
+}
@@ -0,0 +1,22 @@
+//go:build !darwin && !windows && !linux && !freebsd && !netbsd && !openbsd
+
+package notifier
+
+import (
+	"errors"
+
+	"github.com/gen2brain/beeep"
+)
+
+// showDesktop shows a notification through beeep
+func (n *Notifier) showDesktop(d *desktopNotification) error {
+	if d.urgent && d.sound != SoundNone {
+		return beeep.Alert(d.title, d.message, d.icon)
+	}
+	return beeep.Notify(d.title, d.message, d.icon)
+}
+
+// openURL is not supported on this platform
+func openURL(url string) error {
+	return errors.New("opening URLs is not supported on this platform")
+}
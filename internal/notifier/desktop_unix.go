@@ -0,0 +1,125 @@
+//go:build linux || freebsd || netbsd || openbsd
+
+package notifier
+
+import (
+	"os/exec"
+	"sync"
+
+	"github.com/esiqveland/notify"
+	"github.com/gen2brain/beeep"
+	"github.com/godbus/dbus/v5"
+)
+
+// session is the connection to the desktop's org.freedesktop.Notifications
+// server, made on first use
+var session struct {
+	once     sync.Once
+	err      error
+	server   notify.Notifier
+	mu       sync.Mutex
+	ids      map[Event]uint32 // Last notification of each event, replaced by the next one
+	events   map[uint32]Event // Event of each shown notification, for actions
+	notifier *Notifier        // Receives the actions
+}
+
+// eventUrgency is the urgency hint of each event; others are normal
+var eventUrgency = map[Event]notify.Urgency{
+	EventSummary: notify.UrgencyLow,
+	EventAlarm:   notify.UrgencyCritical,
+	EventAuth:    notify.UrgencyCritical,
+}
+
+// connectSession connects to the notification server and listens for
+// clicked actions
+func connectSession(n *Notifier) error {
+	session.once.Do(func() {
+		conn, err := dbus.SessionBusPrivate()
+		if err == nil {
+			if err = conn.Auth(nil); err == nil {
+				err = conn.Hello()
+			}
+		}
+		if err != nil {
+			session.err = err
+			return
+		}
+		session.ids = make(map[Event]uint32)
+		session.events = make(map[uint32]Event)
+		session.notifier = n
+		session.server, session.err = notify.New(conn, notify.WithOnAction(func(s *notify.ActionInvokedSignal) {
+			session.mu.Lock()
+			event := session.events[s.ID]
+			session.mu.Unlock()
+			action := Action(s.ActionKey)
+			if s.ActionKey == "default" {
+				action = ActionOpen
+			}
+			session.notifier.handleAction(event, action)
+		}))
+	})
+	return session.err
+}
+
+// showDesktop shows a notification through D-Bus, with an urgency, the
+// "email" category, the icon and sound, and the action buttons. A notification replaces the
+// previous one of the same event, so the draft count updates in place.
+// Without a notification server, beeep's fallbacks such as notify-send are
+// used.
+func (n *Notifier) showDesktop(d *desktopNotification) error {
+	if err := connectSession(n); err != nil {
+		if d.urgent && d.sound != SoundNone {
+			return beeep.Alert(d.title, d.message, d.icon)
+		}
+		return beeep.Notify(d.title, d.message, d.icon)
+	}
+
+	note := notify.Notification{
+		AppName:       n.appName,
+		AppIcon:       d.icon,
+		Summary:       d.title,
+		Body:          d.message,
+		Actions:       []notify.Action{notify.NewDefaultAction(actionLabels[ActionOpen])},
+		ExpireTimeout: notify.ExpireTimeoutSetByNotificationServer,
+	}
+	for _, a := range d.actions {
+		note.Actions = append(note.Actions, notify.Action{Key: string(a), Label: actionLabels[a]})
+	}
+	urgency, ok := eventUrgency[d.event]
+	if !ok {
+		urgency = notify.UrgencyNormal
+	}
+	if d.urgent {
+		urgency = notify.UrgencyCritical
+	}
+	note.SetUrgency(urgency)
+	note.AddHint(notify.Hint{ID: "category", Variant: dbus.MakeVariant("email")})
+	switch d.sound {
+	case "":
+	case SoundNone:
+		note.AddHint(notify.Hint{ID: "suppress-sound", Variant: dbus.MakeVariant(true)})
+	default:
+		note.AddHint(notify.HintSoundWithName(d.sound))
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if d.event != "" {
+		note.ReplacesID = session.ids[d.event]
+	}
+	id, err := session.server.SendNotification(note)
+	if err != nil {
+		return err
+	}
+	if d.event != "" {
+		delete(session.events, note.ReplacesID)
+		session.ids[d.event] = id
+	}
+	session.events[id] = d.event
+	return nil
+}
+
+// openURL opens a URL in the default browser
+func openURL(url string) error {
+	return exec.Command("xdg-open", url).Start()
+}
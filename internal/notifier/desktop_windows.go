@@ -0,0 +1,78 @@
+package notifier
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+
+	"git.sr.ht/~jackmordaunt/go-toast"
+)
+
+// activationGUID identifies CalmDrafts' COM activation callback, through
+// which Windows reports clicks on toasts
+const activationGUID = "{5B0B3C8E-2F4D-4C9A-9E51-7A1D3F6C2B84}"
+
+// registerToasts registers the AppUserModelID and the activation callback
+// once per process
+var registerToasts sync.Once
+
+// showDesktop shows a toast in the Action Center under the registered
+// AppUserModelID, with the notification's action buttons. Clicks are handled
+// while CalmDrafts is running.
+func (n *Notifier) showDesktop(d *desktopNotification) error {
+	appID := n.appID
+	if appID == "" {
+		appID = n.appName
+	}
+
+	var err error
+	registerToasts.Do(func() {
+		err = toast.SetAppData(toast.AppData{AppID: appID, GUID: activationGUID})
+		toast.SetActivationCallback(func(args string, _ []toast.UserData) {
+			event, action, _ := strings.Cut(args, ":")
+			if action == "" {
+				action = string(ActionOpen)
+			}
+			n.handleAction(Event(event), Action(action))
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	t := toast.Notification{
+		AppID:               appID,
+		Title:               d.title,
+		Body:                d.message,
+		ActivationType:      toast.Foreground,
+		ActivationArguments: string(d.event) + ":",
+		Icon:                d.icon,
+		Audio:               toast.Silent,
+	}
+	if d.urgent {
+		t.Audio = toast.Default
+		t.Duration = toast.Long
+	}
+	switch {
+	case d.sound == SoundNone:
+		t.Audio = toast.Silent
+	case strings.Contains(d.sound, ":"):
+		t.Audio = d.sound
+	case d.sound != "":
+		// Short names such as "Mail" or "Reminder"
+		t.Audio = "ms-winsoundevent:Notification." + d.sound
+	}
+	for _, a := range d.actions {
+		t.Actions = append(t.Actions, toast.Action{
+			Type:      toast.Foreground,
+			Content:   actionLabels[a],
+			Arguments: string(d.event) + ":" + string(a),
+		})
+	}
+	return t.Push()
+}
+
+// openURL opens a URL in the default browser
+func openURL(url string) error {
+	return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+}
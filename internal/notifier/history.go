@@ -0,0 +1,75 @@
+package notifier
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"calmdrafts/internal/jsonl"
+)
+
+// Record is a notification delivered, or not, to one channel
+type Record struct {
+	Time       time.Time `json:"time"`
+	Channel    string    `json:"channel"`
+	Event      Event     `json:"event,omitempty"`
+	Title      string    `json:"title"`
+	Message    string    `json:"message"`
+	Error      string    `json:"error,omitempty"`      // Why delivery failed; empty when it succeeded
+	Suppressed bool      `json:"suppressed,omitempty"` // Dropped by the channel's rate limit
+}
+
+// History is an append-only JSON-lines log of notifications
+type History struct {
+	path string
+}
+
+// OpenHistory returns the notification history stored at path. The file is
+// created on first write.
+func OpenHistory(path string) *History {
+	return &History{path: path}
+}
+
+// Append writes a record
+func (h *History) Append(r *Record) error {
+	return jsonl.Append(h.path, r)
+}
+
+// Records reads all records, oldest first
+func (h *History) Records() ([]*Record, error) {
+	f, err := os.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to open notification history: %v", err)
+	}
+	defer f.Close()
+
+	records := []*Record{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		r := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, fmt.Errorf("unable to parse notification history: %v", err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read notification history: %v", err)
+	}
+	return records, nil
+}
+
+// Prune drops records older than maxAge, then the oldest records until the
+// file is no larger than maxBytes. Zero limits are ignored. It returns the
+// number of records dropped.
+func (h *History) Prune(maxAge time.Duration, maxBytes int64) (int, error) {
+	return jsonl.Prune(h.path, maxAge, maxBytes, func(r *Record) time.Time { return r.Time })
+}
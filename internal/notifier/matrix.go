@@ -0,0 +1,65 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Matrix posts notifications to a Matrix room as the user of an access
+// token, for self-hosters who use Matrix instead of Slack or Discord
+type Matrix struct {
+	Homeserver  string // e.g. "https://matrix.example.org"
+	AccessToken string
+	RoomID      string // e.g. "!abcdef:example.org"
+	Client      *http.Client
+}
+
+// Send posts a notification as a notice, with the title in bold
+func (m *Matrix) Send(msg *Message) error {
+	txn := make([]byte, 8)
+	if _, err := rand.Read(txn); err != nil {
+		return fmt.Errorf("matrix: %v", err)
+	}
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(m.Homeserver, "/"), url.PathEscape(m.RoomID), hex.EncodeToString(txn))
+
+	body, err := json.Marshal(map[string]string{
+		"msgtype":        "m.notice",
+		"body":           msg.Title + ": " + msg.Message,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": "<b>" + html.EscapeString(msg.Title) + "</b>: " + html.EscapeString(msg.Message),
+	})
+	if err != nil {
+		return fmt.Errorf("matrix: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("matrix: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+m.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := m.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("matrix: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("matrix: %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"calmdrafts/internal/mqtt"
+)
+
+// MQTT publishes notifications as JSON events to an MQTT broker, under
+// <topic>/events/<event>, for home-automation setups to react to
+type MQTT struct {
+	Broker *mqtt.Broker
+	Topic  string
+}
+
+// mqttEvent is the payload of a published notification
+type mqttEvent struct {
+	Event   Event     `json:"event"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Send publishes a notification. Notifications about no particular event
+// are published under <topic>/events/test.
+func (m *MQTT) Send(msg *Message) error {
+	event := msg.Event
+	if event == "" {
+		event = "test"
+	}
+	payload, err := json.Marshal(&mqttEvent{Event: event, Title: msg.Title, Message: msg.Message, Time: time.Now()})
+	if err != nil {
+		return fmt.Errorf("mqtt: %v", err)
+	}
+	return m.Broker.Publish(&mqtt.Message{Topic: m.Topic + "/events/" + string(event), Payload: payload})
+}
@@ -1,47 +1,138 @@
 package notifier
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/gen2brain/beeep"
+	"calmdrafts/internal/i18n"
+	"calmdrafts/internal/runs"
 )
 
+// Backend is an additional notification channel that receives every
+// notification alongside the desktop one
+type Backend interface {
+	Send(m *Message) error
+}
+
+// Message is a notification as sent to a backend
+type Message struct {
+	Title   string
+	Message string
+	Event   Event  // Empty for notifications about no particular event, such as tests
+	Icon    string // Icon configured for the backend, if any
+	Sound   string // Sound configured for the backend, if any
+	Data    any    // Details for backends that send JSON, such as the run result of EventRun
+}
+
+// Desktop is the name of the desktop channel, for SetEvents
+const Desktop = "desktop"
+
+// Event is a kind of notification. Each channel can be limited to some
+// events with SetEvents.
+type Event string
+
+const (
+	EventSummary  Event = "summary"  // Draft count after each check
+	EventEmpty    Event = "empty"    // Empty drafts were found
+	EventStale    Event = "stale"    // Drafts look abandoned
+	EventNudge    Event = "nudge"    // Drafts look ready to send
+	EventPending  Event = "pending"  // Drafts were queued for deletion after the grace period
+	EventDeletion Event = "deletion" // Drafts were deleted
+	EventTrash    Event = "trash"    // Trashed drafts will soon be purged
+	EventAlarm    Event = "alarm"    // The drafts folder exceeds its limits
+	EventError    Event = "error"    // A check failed
+	EventAuth     Event = "auth"     // Gmail has to be authorized again
+	EventRun      Event = "run"      // A check finished, with its run result; webhooks only
+)
+
+// Events lists every event, in the order shown to users
+var Events = []Event{EventSummary, EventEmpty, EventStale, EventNudge, EventPending, EventDeletion, EventTrash, EventAlarm, EventError, EventAuth, EventRun}
+
+// ParseEvent returns the event with the given name
+func ParseEvent(name string) (Event, error) {
+	for _, e := range Events {
+		if string(e) == name {
+			return e, nil
+		}
+	}
+	names := make([]string, len(Events))
+	for i, e := range Events {
+		names[i] = string(e)
+	}
+	return "", fmt.Errorf("unknown notification event %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// namedBackend is a registered channel with the name used in SetEvents
+type namedBackend struct {
+	name string
+	Backend
+}
+
 // Notifier handles desktop notifications
 type Notifier struct {
-	appName string
+	appName    string
+	version    string
+	backends   []namedBackend
+	noDesktop  bool
+	events     map[string]map[Event]bool // Events each channel is limited to; missing channels get all
+	appID      string                    // Identity of desktop notifications, see SetAppID
+	onAction   func(Event, Action)       // Called when the user clicks an action, see SetActionHandler
+	wall       bool                      // Broadcast with wall when there is no terminal, see SetWall
+	desktopErr error                     // Why the last desktop notification fell back to the terminal
+	styles     map[[2]string]Style       // Icons and sounds by channel and event, see SetStyle
+	history    *History                  // Where deliveries are recorded, see SetHistory
+	limits     map[string]*rateLimit     // Notifications per hour by channel, see SetRateLimit
+	locale     *i18n.Locale              // Language of the messages, see SetLocale
+	accessible bool                      // Plain terminal output for screen readers, see SetAccessible
+
+	// The daemon's jobs notify concurrently; mu serializes deliveries,
+	// which update the rate limits and desktopErr, and retries
+	mu sync.Mutex
 }
 
-// New creates a new notifier
-func New(appName string) *Notifier {
+// errNoSession is the desktop error when there is no graphical session
+var errNoSession = errors.New("no graphical session (SSH or text console)")
+
+// New creates a new notifier. The version is included in error notifications
+// so reports can be matched to a build.
+func New(appName, version string) *Notifier {
 	return &Notifier{
 		appName: appName,
+		version: version,
 	}
 }
 
 // NotifyDrafts sends a notification about the number of drafts
 func (n *Notifier) NotifyDrafts(count int) error {
 	title := n.appName
-	message := fmt.Sprintf("You have %d draft(s) in your Gmail", count)
+	message := n.locale.Sprintf("You have %s draft(s) in your Gmail", n.locale.Number(count))
 
 	if count == 0 {
-		message = "No drafts in your Gmail"
+		message = n.locale.Sprintf("No drafts in your Gmail")
 	} else if count == 1 {
-		message = "You have 1 draft in your Gmail"
+		message = n.locale.Sprintf("You have 1 draft in your Gmail")
 	}
 
-	return beeep.Notify(title, message, "")
+	return n.send(title, message, EventSummary)
 }
 
 // NotifyDraftsWithDetails sends a notification with draft details
 func (n *Notifier) NotifyDraftsWithDetails(count int, emptyCount int) error {
 	title := n.appName
-	message := fmt.Sprintf("You have %d draft(s) in your Gmail", count)
+	message := n.locale.Sprintf("You have %s draft(s) in your Gmail", n.locale.Number(count))
 
 	if emptyCount > 0 {
-		message += fmt.Sprintf(" (%d empty)", emptyCount)
+		message += n.locale.Sprintf(" (%s empty)", n.locale.Number(emptyCount))
+		return n.send(title, message, EventSummary, EventEmpty)
 	}
 
-	return beeep.Notify(title, message, "")
+	return n.send(title, message, EventSummary)
 }
 
 // NotifyCleanup sends a notification about deleted empty drafts
@@ -51,15 +142,380 @@ func (n *Notifier) NotifyCleanup(deletedCount int) error {
 	}
 
 	title := n.appName
-	message := fmt.Sprintf("Deleted %d old empty draft(s)", deletedCount)
+	message := n.locale.Sprintf("Deleted %s old empty draft(s)", n.locale.Number(deletedCount))
+
+	return n.send(title, message, EventDeletion)
+}
+
+// NotifyCleanupFailures sends one notification summarizing a cleanup in
+// which some deletions failed, instead of one per failure. causes names why
+// they failed, most common first, e.g. "quota". With retry, the failed
+// deletions are queued for the next check.
+func (n *Notifier) NotifyCleanupFailures(deletedCount, failedCount int, causes []string, retry bool) error {
+	if failedCount == 0 {
+		return n.NotifyCleanup(deletedCount)
+	}
+
+	title := n.appName
+	localized := make([]string, len(causes))
+	for i, cause := range causes {
+		localized[i] = n.locale.Sprintf(cause)
+	}
+	message := n.locale.Sprintf("Deleted %s draft(s), %s failed: %s", n.locale.Number(deletedCount), n.locale.Number(failedCount), strings.Join(localized, ", "))
+	if retry {
+		message += n.locale.Sprintf(". They will be retried at the next check")
+	}
+
+	return n.send(title, message, EventError)
+}
+
+// NotifyRun sends the result of a check to the backends that send JSON,
+// such as webhooks, with the result as the data of the message. Other
+// channels would only repeat the notifications already sent during the
+// check, so they never receive it. It isn't counted toward rate limits.
+func (n *Notifier) NotifyRun(r *runs.Result) error {
+	message := n.locale.Sprintf("Checked %s draft(s): %s deleted, %s stale", n.locale.Number(r.Counts.Drafts), n.locale.Number(r.Counts.Deleted), n.locale.Number(r.Counts.Stale))
+	if r.Counts.Failed > 0 {
+		message += n.locale.Sprintf(", %s failed", n.locale.Number(r.Counts.Failed))
+	}
+	m := &Message{Title: n.appName, Message: message, Event: EventRun, Data: r}
+
+	var err error
+	for _, b := range n.backends {
+		if s, ok := b.Backend.(structured); !ok || !s.SendsData() || !n.enabled(b.name, EventRun) {
+			continue
+		}
+		berr := b.Send(m)
+		n.record(b.name, &desktopNotification{title: m.Title, message: m.Message, event: m.Event}, berr, false)
+		if berr != nil && err == nil {
+			err = berr
+		}
+	}
+	return err
+}
 
-	return beeep.Notify(title, message, "")
+// structured is a backend that sends the data of a message along with its
+// text, such as Webhook
+type structured interface {
+	SendsData() bool
+}
+
+// NotifyPending tells that drafts were queued for deletion, offering to
+// delete them now
+func (n *Notifier) NotifyPending(count int) error {
+	if count == 0 {
+		return nil
+	}
+
+	title := n.appName
+	message := n.locale.Sprintf("%s draft(s) will be deleted after the grace period. Run \"calmdrafts review\" to approve or reject them", n.locale.Number(count))
+
+	return n.send(title, message, EventPending)
+}
+
+// NotifyStale sends a reminder about drafts that need attention, naming the
+// most important one. When it is a reply, replyTo names the sender of the
+// message it answers, sent replyAge ago, since reply drafts often have no
+// subject of their own.
+func (n *Notifier) NotifyStale(staleCount int, topSubject, replyTo string, replyAge time.Duration) error {
+	if staleCount == 0 {
+		return nil
+	}
+
+	title := n.appName
+	message := n.locale.Sprintf("%s stale draft(s) need your attention", n.locale.Number(staleCount))
+	if topSubject == "" && replyTo != "" {
+		topSubject = n.locale.Sprintf("(no subject)")
+	}
+	if topSubject != "" {
+		message += n.locale.Sprintf(", starting with %q", topSubject)
+	}
+	if replyTo != "" {
+		message += n.locale.Sprintf(", reply to %s from %s", replyTo, n.locale.Ago(replyAge))
+	}
+
+	return n.send(title, message, EventStale)
+}
+
+// NotifyNudge asks what to do with drafts that look ready to send but
+// haven't changed in a while
+func (n *Notifier) NotifyNudge(count int, topSubject string) error {
+	if count == 0 {
+		return nil
+	}
+
+	title := n.appName
+	message := n.locale.Sprintf("%s draft(s) look ready to send.", n.locale.Number(count))
+	if topSubject != "" {
+		message = n.locale.Sprintf("Send or delete %q?", topSubject)
+		if count > 1 {
+			message += n.locale.Sprintf(" (and %s more)", n.locale.Number(count-1))
+		}
+	}
+	message += n.locale.Sprintf(" Run \"calmdrafts nudge\" to send now, snooze or delete")
+
+	return n.send(title, message, EventNudge)
+}
+
+// NotifyConfirmSend asks the user to confirm sending the draft a nudge
+// named, after they chose Send now. Only its Confirm send button sends it.
+// It answers a click on the desktop, so it is shown there only and never
+// held back by the rate limit.
+func (n *Notifier) NotifyConfirmSend(subject, to string) error {
+	if subject == "" {
+		subject = n.locale.Sprintf("(no subject)")
+	}
+	d := &desktopNotification{
+		title:   n.appName,
+		message: n.locale.Sprintf("Send %q to %s now?", subject, to),
+		event:   EventNudge,
+		urgent:  true,
+		actions: []Action{ActionConfirmSend},
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.noDesktop || headless() {
+		return errNoSession
+	}
+	style := n.style(Desktop, d.event)
+	d.icon, d.sound = style.Icon, style.Sound
+	err := n.showDesktop(d)
+	n.record(Desktop, d, err, false)
+	return err
+}
+
+// NotifyTrashPurge reminds that drafts CalmDrafts moved to Trash will soon be
+// purged by Gmail
+func (n *Notifier) NotifyTrashPurge(count int, days int) error {
+	if count == 0 {
+		return nil
+	}
+
+	title := n.appName
+	message := n.locale.Sprintf("%s trashed draft(s) will be permanently purged in %s. Run \"calmdrafts restore --from-trash all\" to keep them",
+		n.locale.Number(count), n.locale.Duration(time.Duration(days)*24*time.Hour))
+
+	return n.send(title, message, EventTrash)
+}
+
+// NotifyAlarm raises an urgent alert, with a sound where the desktop
+// supports it, on every channel
+func (n *Notifier) NotifyAlarm(message string) error {
+	title := n.locale.Sprintf("%s - Alarm", n.appName)
+
+	d := &desktopNotification{title: title, message: message, event: EventAlarm, urgent: true}
+	return n.deliver(d, EventAlarm)
 }
 
 // NotifyError sends an error notification
 func (n *Notifier) NotifyError(err error) error {
-	title := fmt.Sprintf("%s - Error", n.appName)
-	message := fmt.Sprintf("Error: %v", err)
+	title := n.locale.Sprintf("%s - Error", n.appName)
+	message := n.locale.Sprintf("Error: %v", err)
+	if n.version != "" {
+		message += fmt.Sprintf(" (%s)", n.version)
+	}
+
+	return n.send(title, message, EventError)
+}
+
+// NotifyErrorOngoing reminds about an error that keeps happening, count
+// times since since, after it was first notified with NotifyError or
+// NotifyAuth
+func (n *Notifier) NotifyErrorOngoing(err error, since time.Time, count int) error {
+	title := n.locale.Sprintf("%s - Error", n.appName)
+	message := n.locale.Sprintf("Error: %v", err)
+	message += n.locale.Sprintf(" (ongoing since %s, %s time(s))", since.Local().Format("2006-01-02 15:04"), n.locale.Number(count))
+	if n.version != "" {
+		message += fmt.Sprintf(" (%s)", n.version)
+	}
+
+	return n.send(title, message, EventError)
+}
+
+// NotifyRecovered tells that an error that kept happening since since, as
+// described by message, is gone
+func (n *Notifier) NotifyRecovered(message string, since time.Time) error {
+	title := n.locale.Sprintf("%s - Working again", n.appName)
+	text := n.locale.Sprintf("Checks work again after failing since %s: %s", since.Local().Format("2006-01-02 15:04"), message)
+
+	return n.send(title, text, EventError)
+}
+
+// NotifyAuth asks the user to authorize Gmail access again
+func (n *Notifier) NotifyAuth(err error) error {
+	title := n.locale.Sprintf("%s - Sign in again", n.appName)
+	message := n.locale.Sprintf("Gmail access needs to be authorized again: %v", err)
+
+	return n.send(title, message, EventAuth)
+}
+
+// NotifyTest sends a test notification to every channel, whatever events
+// they are limited to
+func (n *Notifier) NotifyTest() error {
+	return n.send(n.appName, n.locale.Sprintf("Test notification - notifications are working"))
+}
+
+// CheckDesktop reports whether the desktop notification backend is likely
+// to work in the current session
+func CheckDesktop() error {
+	if headless() {
+		return errNoSession
+	}
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+			if _, err := exec.LookPath("notify-send"); err != nil {
+				return fmt.Errorf("no D-Bus session bus and notify-send is not installed")
+			}
+		}
+	case "darwin":
+		if _, err := exec.LookPath("osascript"); err != nil {
+			return fmt.Errorf("osascript not found")
+		}
+	}
+	return nil
+}
+
+// AddBackend registers an additional notification channel under a name
+// used by SetEvents
+func (n *Notifier) AddBackend(name string, b Backend) {
+	n.backends = append(n.backends, namedBackend{name: name, Backend: b})
+}
+
+// retrier is a backend that keeps failed notifications to deliver later
+type retrier interface {
+	Retry() error
+}
+
+// Retry lets backends that queue failed notifications, such as Webhook,
+// deliver the ones whose retry time has come. It returns the first error.
+func (n *Notifier) Retry() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var err error
+	for _, b := range n.backends {
+		if r, ok := b.Backend.(retrier); ok {
+			if rerr := r.Retry(); rerr != nil && err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
+
+// SetEvents limits a channel, Desktop or a backend name, to some events.
+// Channels without limits receive every event.
+func (n *Notifier) SetEvents(channel string, events []Event) {
+	if n.events == nil {
+		n.events = make(map[string]map[Event]bool)
+	}
+	n.events[channel] = make(map[Event]bool, len(events))
+	for _, e := range events {
+		n.events[channel][e] = true
+	}
+}
+
+// enabled reports whether a channel receives a notification about any of
+// the events. A notification without events goes everywhere.
+func (n *Notifier) enabled(channel string, events ...Event) bool {
+	allowed, ok := n.events[channel]
+	if !ok || len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if allowed[e] {
+			return true
+		}
+	}
+	return false
+}
 
-	return beeep.Notify(title, message, "")
+// DisableDesktop stops notifications from being shown on the desktop, for
+// headless servers where only the backends are useful
+func (n *Notifier) DisableDesktop() {
+	n.noDesktop = true
+}
+
+// send delivers a notification to the desktop and all registered backends
+// that receive its events. The first event decides the desktop actions.
+func (n *Notifier) send(title, message string, events ...Event) error {
+	d := &desktopNotification{title: title, message: message}
+	if len(events) > 0 {
+		d.event = events[0]
+		d.actions = eventActions[d.event]
+	}
+	return n.deliver(d, events...)
+}
+
+// deliver shows a notification on the desktop and sends it to the backends
+// that receive its events and are within their rate limit, returning the
+// first error encountered
+func (n *Notifier) deliver(d *desktopNotification, events ...Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	var err error
+	if !n.noDesktop && n.enabled(Desktop, events...) {
+		if ok, suppressed := n.admit(Desktop, now); !ok {
+			n.record(Desktop, d, nil, true)
+		} else {
+			d := *d
+			d.message = coalesced(d.message, suppressed)
+			style := n.style(Desktop, d.event)
+			d.icon, d.sound = style.Icon, style.Sound
+			n.desktopErr = errNoSession
+			if !headless() {
+				n.desktopErr = n.showDesktop(&d)
+			}
+			n.record(Desktop, &d, n.desktopErr, false)
+			// Without a desktop, notify on the terminal instead of failing silently
+			if n.desktopErr != nil {
+				err = n.showTerminal(&d)
+				n.record("terminal", &d, err, false)
+			}
+		}
+	}
+	for _, b := range n.backends {
+		if !n.enabled(b.name, events...) {
+			continue
+		}
+		ok, suppressed := n.admit(b.name, now)
+		if !ok {
+			n.record(b.name, d, nil, true)
+			continue
+		}
+		style := n.style(b.name, d.event)
+		m := &Message{Title: d.title, Message: coalesced(d.message, suppressed), Event: d.event, Icon: style.Icon, Sound: style.Sound}
+		berr := b.Send(m)
+		n.record(b.name, &desktopNotification{title: m.Title, message: m.Message, event: m.Event}, berr, false)
+		if berr != nil && err == nil {
+			err = berr
+		}
+	}
+	return err
+}
+
+// SetLocale sets the language of the messages. Without a locale they are
+// in English.
+func (n *Notifier) SetLocale(l *i18n.Locale) {
+	n.locale = l
+}
+
+// SetHistory records every delivery in a history
+func (n *Notifier) SetHistory(h *History) {
+	n.history = h
+}
+
+// record adds a delivery, or a notification suppressed by the rate limit,
+// to the history. Failing to record never fails the notification itself.
+func (n *Notifier) record(channel string, d *desktopNotification, err error, suppressed bool) {
+	if n.history == nil {
+		return
+	}
+	r := &Record{Time: time.Now(), Channel: channel, Event: d.event, Title: d.title, Message: d.message, Suppressed: suppressed}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	n.history.Append(r)
 }
@@ -0,0 +1,91 @@
+package notifier
+
+import (
+	"fmt"
+	"time"
+)
+
+// rateLimit caps how many notifications a channel gets per hour
+type rateLimit struct {
+	perHour    int
+	loaded     bool        // Whether sent and suppressed were read from the history
+	sent       []time.Time // Deliveries in the last hour
+	suppressed int         // Notifications dropped since the last delivery
+}
+
+// SetRateLimit caps the notifications a channel, Desktop or a backend name,
+// gets per hour. Notifications over the limit are dropped and counted, and
+// the next one delivered says how many were. 0 removes the limit.
+func (n *Notifier) SetRateLimit(channel string, perHour int) {
+	if n.limits == nil {
+		n.limits = make(map[string]*rateLimit)
+	}
+	if perHour <= 0 {
+		delete(n.limits, channel)
+		return
+	}
+	n.limits[channel] = &rateLimit{perHour: perHour}
+}
+
+// admit reports whether a channel may get a notification now. When it may,
+// it also returns how many were suppressed since its last one.
+func (n *Notifier) admit(channel string, now time.Time) (bool, int) {
+	limit, ok := n.limits[channel]
+	if !ok {
+		return true, 0
+	}
+	if !limit.loaded {
+		limit.loaded = true
+		n.loadRate(channel, limit)
+	}
+
+	recent := limit.sent[:0]
+	for _, t := range limit.sent {
+		if now.Sub(t) < time.Hour {
+			recent = append(recent, t)
+		}
+	}
+	limit.sent = recent
+	if len(limit.sent) >= limit.perHour {
+		limit.suppressed++
+		return false, 0
+	}
+	limit.sent = append(limit.sent, now)
+	suppressed := limit.suppressed
+	limit.suppressed = 0
+	return true, suppressed
+}
+
+// loadRate restores a channel's recent deliveries from the history, so the
+// limit holds across runs of "calmdrafts -check"
+func (n *Notifier) loadRate(channel string, limit *rateLimit) {
+	if n.history == nil {
+		return
+	}
+	records, err := n.history.Records()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, r := range records {
+		if r.Channel != channel {
+			continue
+		}
+		if r.Suppressed {
+			limit.suppressed++
+			continue
+		}
+		limit.suppressed = 0
+		if now.Sub(r.Time) < time.Hour {
+			limit.sent = append(limit.sent, r.Time)
+		}
+	}
+}
+
+// coalesced adds the number of suppressed notifications to a message
+func coalesced(message string, suppressed int) string {
+	if suppressed == 0 {
+		return message
+	}
+	return fmt.Sprintf("%s (%d more notification(s) suppressed by the rate limit, run \"calmdrafts notifications\" to see them)", message, suppressed)
+}
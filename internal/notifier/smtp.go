@@ -0,0 +1,117 @@
+package notifier
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP TLS modes
+const (
+	TLSStartTLS = "starttls" // Upgrade a plain connection, usually on port 587 (default)
+	TLSImplicit = "tls"      // Connect with TLS, usually on port 465
+	TLSNone     = "none"     // Plain text, for a relay on the local network
+)
+
+// SMTP delivers notifications by email through any SMTP server, such as a
+// company relay, independently of the Gmail API
+type SMTP struct {
+	Host     string
+	Port     int // Default: 465 with TLSImplicit, 587 otherwise
+	TLS      string
+	Username string // Empty for relays without authentication
+	Password string
+	From     string
+	To       []string
+}
+
+// Send emails a notification, with the start of the message as subject
+func (s *SMTP) Send(m *Message) error {
+	port := s.Port
+	if port == 0 {
+		port = 587
+		if s.TLS == TLSImplicit {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: s.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if s.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp: unable to connect to %s: %v", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %v", err)
+	}
+	defer c.Close()
+
+	if s.TLS == "" || s.TLS == TLSStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp: STARTTLS failed: %v", err)
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("smtp: authentication failed: %v", err)
+		}
+	}
+
+	if err := c.Mail(s.From); err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	for _, to := range s.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp: recipient %s refused: %v", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	if _, err := w.Write(s.message(m, time.Now())); err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	return c.Quit()
+}
+
+// message returns a notification as a plain text RFC 822 message
+func (s *SMTP) message(m *Message, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+	subject := m.Title + ": " + m.Message
+	if r := []rune(subject); len(r) > 78 {
+		subject = string(r[:77]) + "…"
+	}
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	if m.Event != "" {
+		fmt.Fprintf(&b, "X-CalmDrafts-Event: %s\r\n", m.Event)
+	}
+	b.WriteString("\r\n")
+	b.WriteString(m.Message)
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,71 @@
+package notifier
+
+import (
+	_ "embed"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Any matches every channel or every event in SetStyle
+const Any = "*"
+
+// SoundNone silences a notification
+const SoundNone = "none"
+
+// Style is how notifications look and sound on a channel
+type Style struct {
+	Icon  string // Path to a PNG icon; empty for the bundled one on the desktop
+	Sound string // Sound name, or SoundNone; empty for the platform default
+}
+
+//go:embed icon.png
+var bundledIcon []byte
+
+// bundledIconPath is where the bundled icon is written for the desktop to
+// read, once per process
+var bundledIconPath = sync.OnceValue(func() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, "calmdrafts", "icon.png")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return ""
+	}
+	if err := os.WriteFile(path, bundledIcon, 0600); err != nil {
+		return ""
+	}
+	return path
+})
+
+// SetStyle sets the icon and sound of an event on a channel. Either can be
+// Any; the most specific style wins, the channel before the event.
+func (n *Notifier) SetStyle(channel, event string, style Style) {
+	if n.styles == nil {
+		n.styles = make(map[[2]string]Style)
+	}
+	n.styles[[2]string{channel, event}] = style
+}
+
+// style returns the style of an event on a channel. Fields left empty by a
+// specific style are taken from the more general ones.
+func (n *Notifier) style(channel string, event Event) Style {
+	var s Style
+	for _, key := range [][2]string{{channel, string(event)}, {channel, Any}, {Any, string(event)}, {Any, Any}} {
+		match, ok := n.styles[key]
+		if !ok {
+			continue
+		}
+		if s.Icon == "" {
+			s.Icon = match.Icon
+		}
+		if s.Sound == "" {
+			s.Sound = match.Sound
+		}
+	}
+	if channel == Desktop && s.Icon == "" {
+		s.Icon = bundledIconPath()
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package notifier
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// headless reports whether there is no graphical session to show desktop
+// notifications in, e.g. over SSH or on a text console
+func headless() bool {
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == ""
+	case "darwin":
+		return os.Getenv("SSH_CONNECTION") != "" && os.Getenv("TERM_PROGRAM") == ""
+	}
+	return false
+}
+
+// SetWall broadcasts notifications with wall when there is neither a
+// desktop nor a terminal to show them in, e.g. for a daemon on a shared
+// server
+func (n *Notifier) SetWall(wall bool) {
+	n.wall = wall
+}
+
+// DesktopError returns why the last desktop notification fell back to the
+// terminal, or nil
+func (n *Notifier) DesktopError() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.desktopErr
+}
+
+// onTerminal reports whether stderr is a terminal. /dev/null is a character
+// device too, so it is ruled out explicitly.
+func onTerminal() bool {
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+// SetAccessible prints notifications shown on the terminal as a single
+// plain line, without the banner of asterisks that screen readers read out
+func (n *Notifier) SetAccessible(accessible bool) {
+	n.accessible = accessible
+}
+
+// showTerminal prints a notification prominently on the terminal, with a
+// bell unless silenced, or broadcasts it with wall when no terminal is attached and SetWall
+// enabled it
+func (n *Notifier) showTerminal(d *desktopNotification) error {
+	if onTerminal() {
+		bell := "\a"
+		if d.sound == SoundNone {
+			bell = ""
+		}
+		if n.accessible {
+			_, err := fmt.Fprintf(os.Stderr, "%sNotification: %s: %s\n", bell, d.title, d.message)
+			return err
+		}
+		line := strings.Repeat("*", min(len(d.title)+len(d.message)+6, 72))
+		_, err := fmt.Fprintf(os.Stderr, "%s\n%s\n** %s: %s\n%s\n\n", bell, line, d.title, d.message, line)
+		return err
+	}
+	if !n.wall {
+		return fmt.Errorf("no desktop session and no terminal to show the notification in")
+	}
+	cmd := exec.Command("wall")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("%s: %s\n", d.title, d.message))
+	return cmd.Run()
+}
@@ -0,0 +1,460 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Webhook delivery headers
+const (
+	HeaderDelivery  = "X-CalmDrafts-Delivery"  // ID of the delivery, the same on every retry
+	HeaderEvent     = "X-CalmDrafts-Event"     // Event of the notification
+	HeaderSignature = "X-CalmDrafts-Signature" // "t=<unix time>,v1=<hex HMAC-SHA256>", see Sign
+)
+
+// Webhook retry limits
+const (
+	WebhookMaxAttempts = 10
+	webhookBaseBackoff = time.Minute
+	webhookMaxBackoff  = 6 * time.Hour
+)
+
+// WebhookFormat is the shape of the JSON body of a delivery
+type WebhookFormat string
+
+const (
+	FormatCalmDrafts WebhookFormat = "calmdrafts" // WebhookPayload, the default
+	FormatFlat       WebhookFormat = "flat"       // FlatPayload, for Zapier, Make and similar services
+	FormatIFTTT      WebhookFormat = "ifttt"      // value1 to value3, for IFTTT's webhook trigger
+)
+
+// ParseWebhookFormat returns the format with the given name. "zapier" and
+// "make" are names for the flat format.
+func ParseWebhookFormat(name string) (WebhookFormat, error) {
+	switch name {
+	case "", string(FormatCalmDrafts):
+		return FormatCalmDrafts, nil
+	case string(FormatFlat), "zapier", "make":
+		return FormatFlat, nil
+	case string(FormatIFTTT):
+		return FormatIFTTT, nil
+	}
+	return "", fmt.Errorf("unknown webhook format %q (use calmdrafts, flat, zapier, make or ifttt)", name)
+}
+
+// Webhook posts every notification as JSON to a URL. With a Secret the
+// payload is signed, so receivers can check it came from CalmDrafts.
+// Deliveries are kept in a queue until the URL accepts them, and failed
+// ones are retried with exponential backoff by Retry. With a QueuePath the
+// queue survives restarts, and is shared with other processes: saving
+// merges changes into what is on disk rather than overwriting it.
+type Webhook struct {
+	URL       string
+	Secret    string
+	Format    WebhookFormat // Default: FormatCalmDrafts
+	QueuePath string        // Empty keeps the queue in memory only
+	Client    *http.Client
+
+	mu      sync.Mutex
+	queue   map[string]*WebhookDelivery
+	base    map[string]string // The deliveries as last read or written, encoded, to tell which ones changed here
+	posting map[string]bool   // Deliveries being posted by a flush
+	loaded  bool
+}
+
+// WebhookPayload is the JSON body of a delivery
+type WebhookPayload struct {
+	ID      string    `json:"id"`
+	Event   Event     `json:"event"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	Data    any       `json:"data,omitempty"` // The run result of the "run" event
+}
+
+// FlatPayload is the body in the flat format: one level of fields whose
+// names never change, with times in ISO 8601, so no-code services can map
+// them directly
+type FlatPayload struct {
+	DeliveryID     string `json:"delivery_id"`
+	Event          string `json:"event"`
+	Level          string `json:"level"` // "info", "success", "warning" or "failure"
+	Title          string `json:"title"`
+	Message        string `json:"message"`
+	OccurredAt     string `json:"occurred_at"` // UTC, e.g. "2026-10-16T18:52:20Z"
+	OccurredAtUnix int64  `json:"occurred_at_unix"`
+}
+
+// iftttPayload is the body in the IFTTT format
+type iftttPayload struct {
+	Value1 string `json:"value1"` // Title
+	Value2 string `json:"value2"` // Message
+	Value3 string `json:"value3"` // Event
+}
+
+// Payload returns the JSON body of a notification in a format
+func Payload(format WebhookFormat, id string, msg *Message, t time.Time) ([]byte, error) {
+	event := msg.Event
+	if event == "" {
+		event = "test"
+	}
+	switch format {
+	case FormatFlat:
+		level, ok := eventLevels[msg.Event]
+		if !ok {
+			level = "info"
+		}
+		return json.Marshal(&FlatPayload{
+			DeliveryID:     id,
+			Event:          string(event),
+			Level:          level,
+			Title:          msg.Title,
+			Message:        msg.Message,
+			OccurredAt:     t.UTC().Format(time.RFC3339),
+			OccurredAtUnix: t.Unix(),
+		})
+	case FormatIFTTT:
+		return json.Marshal(&iftttPayload{Value1: msg.Title, Value2: msg.Message, Value3: string(event)})
+	}
+	return json.Marshal(&WebhookPayload{ID: id, Event: event, Title: msg.Title, Message: msg.Message, Time: t, Data: msg.Data})
+}
+
+// SendsData reports whether deliveries include the data of messages. Only
+// the calmdrafts format has room for it.
+func (w *Webhook) SendsData() bool {
+	return w.Format == "" || w.Format == FormatCalmDrafts
+}
+
+// WebhookDelivery is a payload waiting to be accepted by the URL
+type WebhookDelivery struct {
+	ID          string          `json:"id"`
+	Event       Event           `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Attempts    int             `json:"attempts,omitempty"`
+	NextAttempt time.Time       `json:"next_attempt,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+// Sign returns the value of the signature header for a body sent at t: the
+// hex HMAC-SHA256, keyed with the secret, of the Unix time, a dot and the
+// body. Including the time lets receivers reject replayed deliveries.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send queues a notification and delivers it, along with any earlier
+// deliveries that are due for a retry. The error is that of this
+// notification's delivery.
+func (w *Webhook) Send(msg *Message) error {
+	event := msg.Event
+	if event == "" {
+		event = "test"
+	}
+	id, err := newDeliveryID()
+	if err != nil {
+		return fmt.Errorf("webhook: %v", err)
+	}
+	now := time.Now()
+	payload, err := Payload(w.Format, id, msg, now)
+	if err != nil {
+		return fmt.Errorf("webhook: %v", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.load(); err != nil {
+		return err
+	}
+	d := &WebhookDelivery{ID: id, Event: event, Payload: payload, CreatedAt: now}
+	w.queue[id] = d
+	if err := w.save(); err != nil {
+		return err
+	}
+	errs := w.flush(now)
+	return errs[id]
+}
+
+// Retry delivers the queued deliveries whose retry time has come, returning
+// an error when any of them failed again
+func (w *Webhook) Retry() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.load(); err != nil {
+		return err
+	}
+	for _, err := range w.flush(time.Now()) {
+		return err
+	}
+	return nil
+}
+
+// Pending returns the queued deliveries, oldest first
+func (w *Webhook) Pending() ([]*WebhookDelivery, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	return w.deliveries(), nil
+}
+
+// flush attempts every due delivery, oldest first, and saves the queue. It
+// returns the errors by delivery ID. It is called with w.mu held, and
+// releases it while posting so a slow URL doesn't hold up other
+// notifications; a delivery being posted is skipped by other flushes.
+func (w *Webhook) flush(now time.Time) map[string]error {
+	due := []*WebhookDelivery{}
+	for _, d := range w.deliveries() {
+		if d.NextAttempt.After(now) || w.posting[d.ID] {
+			continue
+		}
+		w.posting[d.ID] = true
+		copied := *d
+		due = append(due, &copied)
+	}
+
+	results := make(map[string]error, len(due))
+	w.mu.Unlock()
+	for _, d := range due {
+		results[d.ID] = w.post(d, now)
+	}
+	w.mu.Lock()
+
+	errs := make(map[string]error)
+	for _, sent := range due {
+		delete(w.posting, sent.ID)
+		err := results[sent.ID]
+		d, queued := w.queue[sent.ID]
+		if err == nil {
+			delete(w.queue, sent.ID)
+			continue
+		}
+		if !queued {
+			continue // Delivered by another process meanwhile
+		}
+		d.Attempts++
+		d.LastError = err.Error()
+		if d.Attempts >= WebhookMaxAttempts {
+			delete(w.queue, d.ID)
+			err = fmt.Errorf("%v, giving up on delivery %s after %d attempts", err, d.ID, d.Attempts)
+		} else {
+			backoff := webhookBaseBackoff << (d.Attempts - 1)
+			if backoff > webhookMaxBackoff || backoff <= 0 {
+				backoff = webhookMaxBackoff
+			}
+			d.NextAttempt = now.Add(backoff)
+		}
+		errs[d.ID] = err
+	}
+	if err := w.save(); err != nil {
+		for id := range errs {
+			errs[id] = err
+		}
+	}
+	return errs
+}
+
+// post sends one delivery. Any 2xx response accepts it.
+func (w *Webhook) post(d *WebhookDelivery, now time.Time) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return fmt.Errorf("webhook: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderEvent, string(d.Event))
+	if w.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.Secret, now, d.Payload))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook: %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+// deliveries returns the queue, oldest first
+func (w *Webhook) deliveries() []*WebhookDelivery {
+	deliveries := make([]*WebhookDelivery, 0, len(w.queue))
+	for _, d := range w.queue {
+		deliveries = append(deliveries, d)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries
+}
+
+// load reads the queue the first time it is needed
+func (w *Webhook) load() error {
+	if w.loaded {
+		return nil
+	}
+	w.queue = make(map[string]*WebhookDelivery)
+	w.posting = make(map[string]bool)
+	if w.QueuePath != "" {
+		queue, err := loadWebhookQueue(w.QueuePath)
+		if err != nil {
+			return err
+		}
+		w.queue = queue
+	}
+	w.snapshot()
+	w.loaded = true
+	return nil
+}
+
+// loadWebhookQueue reads the deliveries stored at path, by ID. A missing
+// file is an empty queue.
+func loadWebhookQueue(path string) (map[string]*WebhookDelivery, error) {
+	queue := make(map[string]*WebhookDelivery)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return queue, nil
+		}
+		return nil, fmt.Errorf("unable to read webhook queue: %v", err)
+	}
+
+	deliveries := []*WebhookDelivery{}
+	if err := json.Unmarshal(data, &deliveries); err != nil {
+		return nil, fmt.Errorf("unable to parse webhook queue: %v", err)
+	}
+	for _, d := range deliveries {
+		queue[d.ID] = d
+	}
+	return queue, nil
+}
+
+// snapshot records the current deliveries as the base for the next merge
+func (w *Webhook) snapshot() {
+	w.base = make(map[string]string, len(w.queue))
+	for id, d := range w.queue {
+		w.base[id] = encodeDelivery(d)
+	}
+}
+
+// encodeDelivery returns d as JSON, to compare deliveries
+func encodeDelivery(d *WebhookDelivery) string {
+	b, _ := json.Marshal(d)
+	return string(b)
+}
+
+// save writes the queue atomically. Deliveries added, changed or removed
+// since the queue was loaded or last saved replace those on disk; the
+// others are taken from disk, so deliveries queued or made by another
+// process in the meantime are kept.
+func (w *Webhook) save() error {
+	if w.QueuePath == "" {
+		return nil
+	}
+	if err := w.merge(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(w.deliveries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.QueuePath), 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(w.QueuePath), ".webhook-*")
+	if err != nil {
+		return fmt.Errorf("unable to write webhook queue: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write webhook queue: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write webhook queue: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("unable to write webhook queue: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), w.QueuePath); err != nil {
+		return fmt.Errorf("unable to write webhook queue: %v", err)
+	}
+	w.snapshot()
+	return nil
+}
+
+// merge re-reads the queue on disk and takes from it every delivery that
+// wasn't changed here
+func (w *Webhook) merge() error {
+	disk, err := loadWebhookQueue(w.QueuePath)
+	if err != nil {
+		return err
+	}
+
+	ids := make(map[string]bool, len(w.queue)+len(disk))
+	for id := range w.queue {
+		ids[id] = true
+	}
+	for id := range w.base {
+		ids[id] = true
+	}
+	for id := range disk {
+		ids[id] = true
+	}
+
+	for id := range ids {
+		ours, inOurs := w.queue[id]
+		base, inBase := w.base[id]
+		if inOurs != inBase || (inOurs && encodeDelivery(ours) != base) {
+			continue // Changed here
+		}
+		theirs, onDisk := disk[id]
+		switch {
+		case !onDisk:
+			delete(w.queue, id)
+		case inOurs:
+			*ours = *theirs
+		default:
+			w.queue[id] = theirs
+		}
+	}
+	return nil
+}
+
+// newDeliveryID returns a random identifier for a delivery
+func newDeliveryID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate delivery ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,78 @@
+package notifier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWebhookQueueMerges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "webhook-queue.json")
+
+	// The daemon and a one-off command share the queue
+	daemon := &Webhook{URL: server.URL, QueuePath: path}
+	command := &Webhook{URL: server.URL, QueuePath: path}
+	for i, w := range []*Webhook{daemon, command, daemon} {
+		if err := w.Send(&Message{Title: "Drafts cleaned", Event: EventRun}); err == nil {
+			t.Fatalf("send %d: the webhook accepted a delivery while down", i)
+		}
+	}
+
+	pending, err := (&Webhook{URL: server.URL, QueuePath: path}).Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 3 {
+		t.Fatalf("%d deliveries queued, want 3", len(pending))
+	}
+	for _, d := range pending {
+		if d.Attempts != 1 || d.LastError == "" {
+			t.Errorf("delivery %s has %d attempts, error %q, want 1 failed attempt", d.ID, d.Attempts, d.LastError)
+		}
+	}
+}
+
+func TestWebhookPostsWithoutLock(t *testing.T) {
+	reached := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+
+	w := &Webhook{URL: server.URL, QueuePath: filepath.Join(t.TempDir(), "webhook-queue.json")}
+	sent := make(chan error)
+	go func() {
+		sent <- w.Send(&Message{Title: "Drafts cleaned", Event: EventRun})
+	}()
+	<-reached
+
+	pending := make(chan int, 1)
+	go func() {
+		deliveries, _ := w.Pending()
+		pending <- len(deliveries)
+	}()
+	select {
+	case n := <-pending:
+		if n != 1 {
+			t.Errorf("%d deliveries queued while posting, want 1", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the queue stayed locked while a delivery was being posted")
+	}
+
+	close(release)
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if deliveries, _ := w.Pending(); len(deliveries) != 0 {
+		t.Errorf("%d deliveries queued after the webhook accepted them, want none", len(deliveries))
+	}
+}
@@ -0,0 +1,121 @@
+package nudge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"calmdrafts/internal/gmail"
+)
+
+// Entry is a draft the user was asked to send, snooze or delete
+type Entry struct {
+	DraftID      string    `json:"draft_id"`
+	MessageID    string    `json:"message_id"` // Changes when the draft is edited, which drops the nudge
+	Subject      string    `json:"subject,omitempty"`
+	To           string    `json:"to,omitempty"`
+	NudgedAt     time.Time `json:"nudged_at"`
+	SnoozedUntil time.Time `json:"snoozed_until,omitempty"`
+}
+
+// Snoozed reports whether the user postponed the nudge past now
+func (e *Entry) Snoozed(now time.Time) bool {
+	return now.Before(e.SnoozedUntil)
+}
+
+// Ready reports whether a draft looks ready to send, with a recipient and a
+// body, but hasn't changed for at least after
+func Ready(draft *gmail.Draft, lastChange time.Time, after time.Duration, now time.Time) bool {
+	if len(draft.Recipients()) == 0 || draft.BodyLength == 0 {
+		return false
+	}
+	if draft.InternalDate.After(lastChange) {
+		lastChange = draft.InternalDate
+	}
+	return now.Sub(lastChange) >= after
+}
+
+// Store holds the outstanding nudges, stored as a JSON file
+type Store struct {
+	path    string
+	entries map[string]*Entry
+}
+
+// Open loads the store at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, entries: make(map[string]*Entry)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unable to read nudges: %v", err)
+	}
+
+	entries := []*Entry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("unable to parse nudges: %v", err)
+	}
+	for _, e := range entries {
+		s.entries[e.DraftID] = e
+	}
+	return s, nil
+}
+
+// Get returns the nudge for a draft, or nil if there is none
+func (s *Store) Get(draftID string) *Entry {
+	return s.entries[draftID]
+}
+
+// Add records a nudge, replacing any previous one for the same draft and
+// setting NudgedAt when unset
+func (s *Store) Add(entry *Entry) {
+	if entry.NudgedAt.IsZero() {
+		entry.NudgedAt = time.Now()
+	}
+	s.entries[entry.DraftID] = entry
+}
+
+// Remove drops the nudge for a draft
+func (s *Store) Remove(draftID string) {
+	delete(s.entries, draftID)
+}
+
+// Entries returns all nudges, oldest first
+func (s *Store) Entries() []*Entry {
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].NudgedAt.Equal(entries[j].NudgedAt) {
+			return entries[i].NudgedAt.Before(entries[j].NudgedAt)
+		}
+		return entries[i].DraftID < entries[j].DraftID
+	})
+	return entries
+}
+
+// Save writes the store atomically
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("unable to write nudges: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("unable to write nudges: %v", err)
+	}
+	return nil
+}
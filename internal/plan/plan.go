@@ -0,0 +1,114 @@
+package plan
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"calmdrafts/internal/actions"
+)
+
+// CurrentVersion is the plan file format version
+const CurrentVersion = 1
+
+// Plan is the list of actions a cleanup intends to take, signed so that
+// apply only runs plans produced by this installation and left unedited
+type Plan struct {
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"created_at"`
+	Mailbox   string            `json:"mailbox,omitempty"` // Empty for the user's own mailbox
+	Actions   []*actions.Action `json:"actions"`
+	Signature string            `json:"signature,omitempty"` // Hex HMAC-SHA256 of the plan without its signature
+}
+
+// LoadKey reads the signing key at path, generating it when missing
+func LoadKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, fmt.Errorf("unable to create state directory: %v", err)
+		}
+		err = os.WriteFile(path, key, 0600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read plan key: %v", err)
+	}
+	return key, nil
+}
+
+// Sign sets the plan's signature
+func (p *Plan) Sign(key []byte) error {
+	mac, err := p.mac(key)
+	if err != nil {
+		return err
+	}
+	p.Signature = hex.EncodeToString(mac)
+	return nil
+}
+
+// Verify checks the plan's signature
+func (p *Plan) Verify(key []byte) error {
+	got, err := hex.DecodeString(p.Signature)
+	if err != nil || len(got) == 0 {
+		return fmt.Errorf("plan is not signed")
+	}
+	want, err := p.mac(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(got, want) {
+		return fmt.Errorf("plan signature doesn't match: it was edited or made by another installation")
+	}
+	return nil
+}
+
+// mac computes the HMAC of the plan without its signature
+func (p *Plan) mac(key []byte) ([]byte, error) {
+	unsigned := *p
+	unsigned.Signature = ""
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+	return m.Sum(nil), nil
+}
+
+// Save writes the plan as indented JSON
+func (p *Plan) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("unable to write plan: %v", err)
+	}
+	return nil
+}
+
+// Load reads a plan file
+func Load(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read plan: %v", err)
+	}
+	p := &Plan{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("unable to parse plan: %v", err)
+	}
+	if p.Version != CurrentVersion {
+		return nil, fmt.Errorf("unsupported plan version %d", p.Version)
+	}
+	return p, nil
+}
@@ -0,0 +1,275 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/notifier"
+)
+
+// ProtocolVersion is sent to every plugin so it can detect incompatible changes
+const ProtocolVersion = 1
+
+// DefaultTimeout bounds how long a single plugin invocation may run
+const DefaultTimeout = 10 * time.Second
+
+// Kind identifies an extension point. Plugins live in a subdirectory of the
+// plugins directory named after their kind, e.g. plugins/classifier/my-script.
+type Kind string
+
+const (
+	KindClassifier Kind = "classifier" // Decides whether a draft is empty
+	KindRule       Kind = "rule"       // Decides whether a draft should be kept or deleted
+	KindNotifier   Kind = "notifier"   // Receives every notification
+)
+
+// Kinds lists all supported extension points
+var Kinds = []Kind{KindClassifier, KindRule, KindNotifier}
+
+// Action is the decision returned by a rule plugin
+type Action string
+
+const (
+	ActionNone   Action = ""       // Plugin has no opinion
+	ActionKeep   Action = "keep"   // Never delete this draft
+	ActionDelete Action = "delete" // Delete this draft regardless of emptiness
+)
+
+// Plugin is an external executable implementing one extension point
+type Plugin struct {
+	Name string
+	Path string
+	Kind Kind
+}
+
+// DraftInfo is the JSON representation of a draft passed to plugins
+type DraftInfo struct {
+	ID            string          `json:"id"`
+	MessageID     string          `json:"message_id"`
+	Subject       string          `json:"subject"`
+	To            string          `json:"to"`
+	ToAddresses   []gmail.Address `json:"to_addresses,omitempty"`
+	Cc            []gmail.Address `json:"cc,omitempty"`
+	Bcc           []gmail.Address `json:"bcc,omitempty"`
+	InternalDate  time.Time       `json:"internal_date"`
+	IsEmpty       bool            `json:"is_empty"`
+	IsReply       bool            `json:"is_reply"`
+	BodyLength    int             `json:"body_length"`
+	Labels        []string        `json:"labels,omitempty"`
+	Client        string          `json:"client,omitempty"`
+	ReplyTo       *gmail.Parent   `json:"reply_to,omitempty"`
+	ParentDeleted bool            `json:"parent_deleted,omitempty"`
+}
+
+// Request is written as JSON to a plugin's stdin
+type Request struct {
+	Version int        `json:"version"`
+	Kind    Kind       `json:"kind"`
+	Draft   *DraftInfo `json:"draft,omitempty"`
+	Title   string     `json:"title,omitempty"`
+	Message string     `json:"message,omitempty"`
+	Event   string     `json:"event,omitempty"`
+	Icon    string     `json:"icon,omitempty"`
+	Sound   string     `json:"sound,omitempty"`
+}
+
+// Response is read as JSON from a plugin's stdout. Classifier plugins set
+// Empty, rule plugins set Action; notifier plugins may print nothing.
+type Response struct {
+	Empty  *bool  `json:"empty,omitempty"`
+	Action Action `json:"action,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Manager discovers and runs plugins
+type Manager struct {
+	plugins map[Kind][]*Plugin
+	timeout time.Duration
+}
+
+// Load discovers executables in the kind subdirectories of dir. A missing
+// directory yields an empty manager.
+func Load(dir string) (*Manager, error) {
+	m := &Manager{
+		plugins: make(map[Kind][]*Plugin),
+		timeout: DefaultTimeout,
+	}
+	if dir == "" {
+		return m, nil
+	}
+
+	for _, kind := range Kinds {
+		kindDir := filepath.Join(dir, string(kind))
+		entries, err := os.ReadDir(kindDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to read plugin directory %s: %v", kindDir, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil, fmt.Errorf("unable to stat plugin %s: %v", entry.Name(), err)
+			}
+			if !executable(entry.Name(), info.Mode()) {
+				continue
+			}
+			m.plugins[kind] = append(m.plugins[kind], &Plugin{
+				Name: entry.Name(),
+				Path: filepath.Join(kindDir, entry.Name()),
+				Kind: kind,
+			})
+		}
+		sort.Slice(m.plugins[kind], func(i, j int) bool {
+			return m.plugins[kind][i].Name < m.plugins[kind][j].Name
+		})
+	}
+
+	return m, nil
+}
+
+// executable reports whether a file in a plugin directory can be run: by
+// its extension on Windows, which has no executable bits, and by those bits
+// elsewhere
+func executable(name string, mode os.FileMode) bool {
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".exe", ".bat", ".cmd":
+			return true
+		}
+		return false
+	}
+	return mode&0111 != 0
+}
+
+// Plugins returns the discovered plugins for a kind, in execution order
+func (m *Manager) Plugins(kind Kind) []*Plugin {
+	return m.plugins[kind]
+}
+
+// Count returns the total number of discovered plugins
+func (m *Manager) Count() int {
+	count := 0
+	for _, plugins := range m.plugins {
+		count += len(plugins)
+	}
+	return count
+}
+
+// Classify asks classifier plugins whether a draft is empty. The first plugin
+// that answers wins; ok is false when no plugin had an opinion.
+func (m *Manager) Classify(ctx context.Context, draft *gmail.Draft) (empty bool, ok bool, err error) {
+	for _, p := range m.plugins[KindClassifier] {
+		resp, err := p.run(ctx, m.timeout, &Request{Kind: KindClassifier, Draft: newDraftInfo(draft)})
+		if err != nil {
+			return false, false, err
+		}
+		if resp.Empty != nil {
+			return *resp.Empty, true, nil
+		}
+	}
+	return false, false, nil
+}
+
+// Decide asks rule plugins what to do with a draft. The first plugin that
+// returns a non-empty action wins.
+func (m *Manager) Decide(ctx context.Context, draft *gmail.Draft) (Action, string, error) {
+	for _, p := range m.plugins[KindRule] {
+		resp, err := p.run(ctx, m.timeout, &Request{Kind: KindRule, Draft: newDraftInfo(draft)})
+		if err != nil {
+			return ActionNone, "", err
+		}
+		switch resp.Action {
+		case ActionNone:
+			continue
+		case ActionKeep, ActionDelete:
+			return resp.Action, fmt.Sprintf("%s: %s", p.Name, resp.Reason), nil
+		default:
+			return ActionNone, "", fmt.Errorf("plugin %s returned unknown action %q", p.Name, resp.Action)
+		}
+	}
+	return ActionNone, "", nil
+}
+
+// Send delivers a notification to every notifier plugin. It satisfies
+// notifier.Backend.
+func (m *Manager) Send(msg *notifier.Message) error {
+	var firstErr error
+	for _, p := range m.plugins[KindNotifier] {
+		ctx := context.Background()
+		req := &Request{Kind: KindNotifier, Title: msg.Title, Message: msg.Message, Event: string(msg.Event), Icon: msg.Icon, Sound: msg.Sound}
+		if _, err := p.run(ctx, m.timeout, req); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// run executes the plugin with the request on stdin and decodes its stdout
+func (p *Plugin) run(ctx context.Context, timeout time.Duration, req *Request) (*Response, error) {
+	req.Version = ProtocolVersion
+
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode plugin request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("plugin %s failed: %v: %s", p.Name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	resp := &Response{}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return resp, nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("plugin %s returned invalid JSON: %v", p.Name, err)
+	}
+
+	return resp, nil
+}
+
+// newDraftInfo converts a draft into its plugin representation
+func newDraftInfo(d *gmail.Draft) *DraftInfo {
+	return &DraftInfo{
+		ID:            d.ID,
+		MessageID:     d.MessageID,
+		Subject:       d.Subject,
+		To:            d.To,
+		ToAddresses:   d.ToAddresses,
+		Cc:            d.Cc,
+		Bcc:           d.Bcc,
+		InternalDate:  d.InternalDate,
+		IsEmpty:       d.IsEmpty,
+		IsReply:       d.IsReply,
+		BodyLength:    d.BodyLength,
+		Labels:        d.Labels,
+		Client:        d.Client,
+		ReplyTo:       d.ReplyTo,
+		ParentDeleted: d.ParentDeleted,
+	}
+}
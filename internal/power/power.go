@@ -0,0 +1,21 @@
+// Package power tells whether the computer runs on battery or uses a
+// metered connection, so laptops can put off checks that aren't urgent
+package power
+
+// Battery is the state of the computer's battery
+type Battery struct {
+	Discharging bool // Running on battery rather than on mains power
+	Percent     int  // Charge from 0 to 100, or -1 when unknown
+}
+
+// ReadBattery returns the battery state, or nil when the computer has no
+// battery or its state can't be read on this platform
+func ReadBattery() (*Battery, error) {
+	return readBattery()
+}
+
+// Metered reports whether the internet connection is metered, such as a
+// phone hotspot. It reports false where this can't be detected.
+func Metered() (bool, error) {
+	return metered()
+}
@@ -0,0 +1,33 @@
+package power
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pmsetPercent matches the charge in pmset's battery line
+var pmsetPercent = regexp.MustCompile(`(\d+)%`)
+
+// readBattery parses "pmset -g batt"
+func readBattery() (*Battery, error) {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return nil, err
+	}
+	text := string(out)
+	if !strings.Contains(text, "InternalBattery") {
+		return nil, nil
+	}
+	battery := &Battery{Discharging: strings.Contains(text, "'Battery Power'"), Percent: -1}
+	if m := pmsetPercent.FindStringSubmatch(text); m != nil {
+		battery.Percent, _ = strconv.Atoi(m[1])
+	}
+	return battery, nil
+}
+
+// metered isn't detectable on macOS without a network extension
+func metered() (bool, error) {
+	return false, nil
+}
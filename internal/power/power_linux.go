@@ -0,0 +1,84 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// sysPowerSupply lists the power supplies known to the kernel
+const sysPowerSupply = "/sys/class/power_supply"
+
+// readBattery reads the battery and mains adapters from sysfs
+func readBattery() (*Battery, error) {
+	supplies, err := os.ReadDir(sysPowerSupply)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var battery *Battery
+	mains, online := false, false
+	for _, s := range supplies {
+		dir := filepath.Join(sysPowerSupply, s.Name())
+		switch readAttr(dir, "type") {
+		case "Mains":
+			mains = true
+			if readAttr(dir, "online") == "1" {
+				online = true
+			}
+		case "Battery":
+			if readAttr(dir, "scope") == "Device" {
+				continue // A mouse or keyboard battery
+			}
+			percent, err := strconv.Atoi(readAttr(dir, "capacity"))
+			if err != nil {
+				percent = -1
+			}
+			battery = &Battery{Discharging: readAttr(dir, "status") == "Discharging", Percent: percent}
+		}
+	}
+	if battery != nil && mains {
+		battery.Discharging = !online
+	}
+	return battery, nil
+}
+
+// readAttr returns a sysfs attribute, or "" when it can't be read
+func readAttr(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// NetworkManager's NMMetered values meaning the connection is metered
+const (
+	nmMeteredYes      = 1
+	nmMeteredGuessYes = 3
+)
+
+// metered asks NetworkManager whether the primary connection is metered.
+// Without a system bus or NetworkManager, it can't tell.
+func metered() (bool, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return false, nil
+	}
+	defer conn.Close()
+	v, err := conn.Object("org.freedesktop.NetworkManager", "/org/freedesktop/NetworkManager").GetProperty("org.freedesktop.NetworkManager.Metered")
+	if dbusErr, ok := err.(dbus.Error); ok && dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown" {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	m, _ := v.Value().(uint32)
+	return m == nmMeteredYes || m == nmMeteredGuessYes, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package power
+
+// readBattery isn't supported on this platform
+func readBattery() (*Battery, error) {
+	return nil, nil
+}
+
+// metered isn't supported on this platform
+func metered() (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,54 @@
+package power
+
+import (
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// systemPowerStatus is SYSTEM_POWER_STATUS
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+var getSystemPowerStatus = syscall.NewLazyDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+
+// readBattery calls GetSystemPowerStatus
+func readBattery() (*Battery, error) {
+	var s systemPowerStatus
+	if r, _, err := getSystemPowerStatus.Call(uintptr(unsafe.Pointer(&s))); r == 0 {
+		return nil, err
+	}
+	if s.BatteryFlag&128 != 0 || s.BatteryFlag == 255 {
+		return nil, nil // No battery, or unknown
+	}
+	battery := &Battery{Discharging: s.ACLineStatus == 0, Percent: int(s.BatteryLifePercent)}
+	if s.BatteryLifePercent == 255 {
+		battery.Percent = -1
+	}
+	return battery, nil
+}
+
+// costScript prints the cost type of the internet connection profile
+const costScript = `[void][Windows.Networking.Connectivity.NetworkInformation,Windows.Networking.Connectivity,ContentType=WindowsRuntime]
+$p = [Windows.Networking.Connectivity.NetworkInformation]::GetInternetConnectionProfile()
+if ($p) { $p.GetConnectionCost().NetworkCostType }`
+
+// metered asks Windows for the cost of the internet connection: "Fixed"
+// and "Variable" are metered
+func metered() (bool, error) {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", costScript)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	out, err := cmd.Output()
+	if err != nil {
+		return false, err
+	}
+	cost := strings.TrimSpace(string(out))
+	return cost == "Fixed" || cost == "Variable", nil
+}
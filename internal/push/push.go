@@ -0,0 +1,144 @@
+package push
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/idtoken"
+)
+
+// Notification is the change notice Gmail publishes to Pub/Sub
+type Notification struct {
+	EmailAddress string `json:"emailAddress"`
+	HistoryID    uint64 `json:"historyId"`
+}
+
+// envelope is the body of a Pub/Sub push delivery
+type envelope struct {
+	Message struct {
+		Data      string `json:"data"`
+		MessageID string `json:"messageId"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// maxBody bounds the size of a push delivery
+const maxBody = 64 << 10
+
+// Handler accepts Pub/Sub push deliveries of Gmail notifications. Requests
+// must carry the shared Token as a "token" query parameter, a Google-signed
+// OIDC token for Audience issued to ServiceAccount in the Authorization
+// header, or both when both are configured.
+type Handler struct {
+	Token          string
+	Audience       string
+	ServiceAccount string              // Email of the service account the push subscription authenticates as
+	Notify         func(*Notification) // Called for every verified notification
+
+	// validate checks a Google-signed ID token, idtoken.Validate unless a
+	// test replaces it
+	validate func(ctx context.Context, token, audience string) (*idtoken.Payload, error)
+}
+
+// ServeHTTP verifies and decodes a push delivery. Any 2xx response
+// acknowledges the message, so only malformed requests are rejected;
+// Pub/Sub would otherwise retry them forever.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.verify(r); err != nil {
+		log.Printf("Rejected push delivery from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	n, err := Decode(body)
+	if err != nil {
+		log.Printf("Ignoring push delivery: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.Notify(n)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verify checks the configured shared token and OIDC token. Any Google
+// service account can get an ID token for any audience, so the token must
+// also be issued to the subscription's service account, with a verified
+// email.
+func (h *Handler) verify(r *http.Request) error {
+	if h.Token == "" && h.Audience == "" {
+		return fmt.Errorf("no token or audience configured")
+	}
+
+	if h.Token != "" {
+		got := r.URL.Query().Get("token")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(h.Token)) != 1 {
+			return fmt.Errorf("invalid token")
+		}
+	}
+
+	if h.Audience != "" {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return fmt.Errorf("missing bearer token")
+		}
+		if h.ServiceAccount == "" {
+			return fmt.Errorf("no service account configured for the audience")
+		}
+		validate := h.validate
+		if validate == nil {
+			validate = idtoken.Validate
+		}
+		payload, err := validate(r.Context(), bearer, h.Audience)
+		if err != nil {
+			return fmt.Errorf("invalid bearer token: %v", err)
+		}
+		email, _ := payload.Claims["email"].(string)
+		verified, _ := payload.Claims["email_verified"].(bool)
+		if email != h.ServiceAccount || !verified {
+			return fmt.Errorf("bearer token issued to %q, not the push service account", email)
+		}
+	}
+
+	return nil
+}
+
+// Decode extracts the Gmail notification from a Pub/Sub push body
+func Decode(body []byte) (*Notification, error) {
+	env := envelope{}
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("invalid push envelope: %v", err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(env.Message.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message data: %v", err)
+	}
+
+	n := &Notification{}
+	if err := json.Unmarshal(data, n); err != nil {
+		return nil, fmt.Errorf("invalid Gmail notification: %v", err)
+	}
+	if n.EmailAddress == "" || n.HistoryID == 0 {
+		return nil, fmt.Errorf("not a Gmail notification")
+	}
+	return n, nil
+}
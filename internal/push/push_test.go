@@ -0,0 +1,94 @@
+package push
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/idtoken"
+)
+
+const pushAccount = "push@my-project.iam.gserviceaccount.com"
+
+// fakeValidate accepts the ID tokens "<email>" and "<email> unverified"
+// for the audience "https://drafts.example.com/gmail/push"
+func fakeValidate(ctx context.Context, token, audience string) (*idtoken.Payload, error) {
+	if audience != "https://drafts.example.com/gmail/push" || token == "forged" {
+		return nil, fmt.Errorf("idtoken: invalid token")
+	}
+	email, unverified := strings.CutSuffix(token, " unverified")
+	return &idtoken.Payload{Audience: audience, Claims: map[string]interface{}{"email": email, "email_verified": !unverified}}, nil
+}
+
+func TestVerify(t *testing.T) {
+	tokenOnly := &Handler{Token: "secret"}
+	oidc := &Handler{Audience: "https://drafts.example.com/gmail/push", ServiceAccount: pushAccount, validate: fakeValidate}
+	both := &Handler{Token: "secret", Audience: "https://drafts.example.com/gmail/push", ServiceAccount: pushAccount, validate: fakeValidate}
+	noAccount := &Handler{Audience: "https://drafts.example.com/gmail/push", validate: fakeValidate}
+
+	tests := []struct {
+		name    string
+		handler *Handler
+		query   string
+		bearer  string
+		ok      bool
+	}{
+		{"token", tokenOnly, "?token=secret", "", true},
+		{"wrong token", tokenOnly, "?token=guess", "", false},
+		{"missing token", tokenOnly, "", "", false},
+		{"nothing configured", &Handler{}, "?token=", "", false},
+		{"service account", oidc, "", pushAccount, true},
+		{"missing bearer", oidc, "", "", false},
+		{"forged bearer", oidc, "", "forged", false},
+		{"other service account", oidc, "", "attacker@evil-project.iam.gserviceaccount.com", false},
+		{"unverified email", oidc, "", pushAccount + " unverified", false},
+		{"audience without service account", noAccount, "", pushAccount, false},
+		{"token and service account", both, "?token=secret", pushAccount, true},
+		{"service account without token", both, "", pushAccount, false},
+		{"token without service account", both, "?token=secret", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/gmail/push"+tt.query, nil)
+		if tt.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.bearer)
+		}
+		err := tt.handler.verify(r)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: verify returned %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	envelope := func(data string) string {
+		return `{"message": {"data": "` + data + `", "messageId": "1"}, "subscription": "projects/p/subscriptions/s"}`
+	}
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	n, err := Decode([]byte(envelope(encode(`{"emailAddress": "me@example.com", "historyId": 9876}`))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.EmailAddress != "me@example.com" || n.HistoryID != 9876 {
+		t.Errorf("decoded %+v, want me@example.com at history 9876", n)
+	}
+
+	for name, body := range map[string]string{
+		"not JSON":        "token=secret",
+		"bad base64":      envelope("not base64!"),
+		"bad data":        envelope(encode("{")),
+		"no address":      envelope(encode(`{"historyId": 9876}`)),
+		"no history":      envelope(encode(`{"emailAddress": "me@example.com"}`)),
+		"empty message":   `{"message": {}}`,
+		"other publisher": envelope(encode(`{"hello": "world"}`)),
+	} {
+		if n, err := Decode([]byte(body)); err == nil {
+			t.Errorf("%s: decoded %+v, want an error", name, n)
+		}
+	}
+}
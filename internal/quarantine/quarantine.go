@@ -0,0 +1,202 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Decision is the user's verdict on a pending deletion
+type Decision string
+
+const (
+	DecisionPending  Decision = ""
+	DecisionApproved Decision = "approved" // Delete at the next check without waiting
+	DecisionRejected Decision = "rejected" // Keep the draft until it changes
+)
+
+// Entry is a draft waiting out its grace period before deletion
+type Entry struct {
+	DraftID   string    `json:"draft_id"`
+	MessageID string    `json:"message_id"` // Changes when the draft is edited, which rescues it
+	Subject   string    `json:"subject,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	QueuedAt  time.Time `json:"queued_at"`
+	Decision  Decision  `json:"decision,omitempty"`
+	Unlabeled bool      `json:"unlabeled,omitempty"` // The pending label was removed after rejection
+}
+
+// Queue is the set of pending deletions, stored as a JSON file. The daemon
+// and `review` can both hold it open, so Save merges its changes into what
+// is on disk rather than overwriting it.
+type Queue struct {
+	path    string
+	entries map[string]*Entry
+	base    map[string]Entry // The entries as last read or written, to tell which ones changed here
+}
+
+// Open loads the queue stored at path. A missing file is an empty queue.
+func Open(path string) (*Queue, error) {
+	entries, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{path: path, entries: entries}
+	q.snapshot()
+	return q, nil
+}
+
+// load reads the entries stored at path, by draft ID
+func load(path string) (map[string]*Entry, error) {
+	entries := make(map[string]*Entry)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, fmt.Errorf("unable to read pending queue: %v", err)
+	}
+
+	list := []*Entry{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("unable to parse pending queue: %v", err)
+	}
+	for _, e := range list {
+		entries[e.DraftID] = e
+	}
+	return entries, nil
+}
+
+// snapshot records the current entries as the base for the next merge
+func (q *Queue) snapshot() {
+	q.base = make(map[string]Entry, len(q.entries))
+	for id, e := range q.entries {
+		q.base[id] = *e
+	}
+}
+
+// Get returns the entry for a draft, or nil if it isn't queued
+func (q *Queue) Get(draftID string) *Entry {
+	return q.entries[draftID]
+}
+
+// Add queues an entry, replacing any previous entry for the same draft and
+// setting QueuedAt when unset
+func (q *Queue) Add(entry *Entry) {
+	if entry.QueuedAt.IsZero() {
+		entry.QueuedAt = time.Now()
+	}
+	q.entries[entry.DraftID] = entry
+}
+
+// Remove drops a draft from the queue
+func (q *Queue) Remove(draftID string) {
+	delete(q.entries, draftID)
+}
+
+// Entries returns all entries, oldest first
+func (q *Queue) Entries() []*Entry {
+	entries := make([]*Entry, 0, len(q.entries))
+	for _, e := range q.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].QueuedAt.Equal(entries[j].QueuedAt) {
+			return entries[i].QueuedAt.Before(entries[j].QueuedAt)
+		}
+		return entries[i].DraftID < entries[j].DraftID
+	})
+	return entries
+}
+
+// Due reports whether the entry should be deleted now
+func (e *Entry) Due(grace time.Duration, now time.Time) bool {
+	switch e.Decision {
+	case DecisionApproved:
+		return true
+	case DecisionRejected:
+		return false
+	}
+	return !now.Before(e.QueuedAt.Add(grace))
+}
+
+// Save writes the queue atomically. Entries added, changed or removed since
+// the queue was opened or last saved replace those on disk; the others are
+// taken from disk, so changes saved by another process in the meantime are
+// kept.
+func (q *Queue) Save() error {
+	if err := q.merge(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(q.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), ".pending-*")
+	if err != nil {
+		return fmt.Errorf("unable to write pending queue: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write pending queue: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write pending queue: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("unable to write pending queue: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), q.path); err != nil {
+		return fmt.Errorf("unable to write pending queue: %v", err)
+	}
+	q.snapshot()
+	return nil
+}
+
+// merge re-reads the queue on disk and takes from it every entry that
+// wasn't changed here. Entries are updated in place, so pointers handed
+// out by Get and Entries stay valid.
+func (q *Queue) merge() error {
+	disk, err := load(q.path)
+	if err != nil {
+		return err
+	}
+
+	ids := make(map[string]bool, len(q.entries)+len(disk))
+	for id := range q.entries {
+		ids[id] = true
+	}
+	for id := range q.base {
+		ids[id] = true
+	}
+	for id := range disk {
+		ids[id] = true
+	}
+
+	for id := range ids {
+		ours, inOurs := q.entries[id]
+		base, inBase := q.base[id]
+		if inOurs != inBase || (inOurs && *ours != base) {
+			continue // Changed here
+		}
+		theirs, onDisk := disk[id]
+		switch {
+		case !onDisk:
+			delete(q.entries, id)
+		case inOurs:
+			*ours = *theirs
+		default:
+			q.entries[id] = theirs
+		}
+	}
+	return nil
+}
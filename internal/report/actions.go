@@ -0,0 +1,45 @@
+package report
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+
+	"calmdrafts/internal/gmail"
+)
+
+// Actions a report links to
+const (
+	ActionDelete = "delete"
+	ActionKeep   = "keep"
+)
+
+// Actions makes the one-click delete and keep links of a report, served by
+// the daemon. Links are signed, so only those written in a report act on a
+// draft, and name the version of the draft that was reported, so a draft
+// edited since is left alone.
+type Actions struct {
+	URL string // Base URL of the daemon's endpoint, e.g. "http://127.0.0.1:8093"
+	Key []byte // Secret signing the links
+}
+
+// Link returns the URL that applies action to a draft
+func (a *Actions) Link(action string, d *gmail.Draft) string {
+	query := url.Values{"message": {d.MessageID}, "sig": {a.sign(action, d.ID, d.MessageID)}}
+	return a.URL + "/drafts/" + url.PathEscape(d.ID) + "/" + action + "?" + query.Encode()
+}
+
+// Verify reports whether sig signs a link applying action to the version
+// messageID of a draft
+func (a *Actions) Verify(action, draftID, messageID, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(a.sign(action, draftID, messageID)))
+}
+
+// sign returns the hex HMAC-SHA256 of a link's action, draft and version
+func (a *Actions) sign(action, draftID, messageID string) string {
+	mac := hmac.New(sha256.New, a.Key)
+	fmt.Fprintf(mac, "%s\n%s\n%s", action, draftID, messageID)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,62 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/gmail"
+)
+
+// DigestSubject is the subject of the digest draft kept in the mailbox
+const DigestSubject = "CalmDrafts: your draft backlog"
+
+// DigestBody renders the list of stale drafts as HTML, with a link to open
+// each one in the Gmail session of mailbox, see DraftLink
+func DigestBody(mailbox string, stale []*gmail.Draft) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<p>%d draft(s) look abandoned. Finish, send or delete them:</p>\n<ul>\n", len(stale))
+	for _, d := range stale {
+		subject := d.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a>", html.EscapeString(DraftLink(mailbox, d)), html.EscapeString(subject))
+		switch recipients := d.Recipients(); {
+		case len(recipients) == 1:
+			fmt.Fprintf(&b, " to %s", html.EscapeString(recipients[0].String()))
+		case len(recipients) > 1:
+			fmt.Fprintf(&b, " to %d recipients", len(recipients))
+		}
+		if !d.InternalDate.IsZero() {
+			fmt.Fprintf(&b, ", last saved %s", d.InternalDate.Format("2006-01-02"))
+		}
+		if d.ReplyTo != nil {
+			fmt.Fprintf(&b, ", reply to %s from %s", html.EscapeString(d.ReplyTo.Sender()), d.ReplyTo.Date.Format("2006-01-02"))
+		}
+		if d.Snippet != "" {
+			fmt.Fprintf(&b, "<br><i>%s</i>", html.EscapeString(d.Snippet))
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</ul>\n")
+	return b.String()
+}
+
+// DigestMessage returns the digest draft as a raw RFC 822 message. It has no
+// recipient, so it can't be sent by accident. A note, such as how many API
+// calls failed this week, goes in the footer.
+func DigestMessage(body, note string, now time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Subject: %s\r\n", DigestSubject)
+	b.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	b.WriteString(body)
+	if note != "" {
+		fmt.Fprintf(&b, "<p><small>%s.</small></p>\n", html.EscapeString(note))
+	}
+	fmt.Fprintf(&b, "<p><small>Updated by CalmDrafts at %s.</small></p>\n", now.Format("2006-01-02 15:04"))
+	return []byte(b.String())
+}
@@ -0,0 +1,162 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/gmail"
+	"calmdrafts/internal/i18n"
+	"calmdrafts/internal/stats"
+)
+
+// Bucket is a suggested triage group for a draft
+type Bucket string
+
+const (
+	BucketSafeToDelete  Bucket = "Probably safe to delete"
+	BucketNeedsDecision Bucket = "Needs a decision"
+	BucketInProgress    Bucket = "Actively in progress"
+	BucketTemplates     Bucket = "Templates" // Kept as canned responses, never cleaned up
+)
+
+// Buckets lists the triage buckets in display order
+var Buckets = []Bucket{BucketSafeToDelete, BucketNeedsDecision, BucketInProgress, BucketTemplates}
+
+// Entry is a draft placed in a triage bucket
+type Entry struct {
+	Draft *gmail.Draft
+	Score float64 // Abandoned-draft score, 0 when unknown
+}
+
+// Triage groups the drafts left after a check into suggested buckets
+type Triage struct {
+	GeneratedAt    time.Time
+	Entries        map[Bucket][]Entry
+	LargeDraftSize int64        // Drafts of at least this many bytes are listed separately; 0 disables
+	Locale         *i18n.Locale // Language of the report; nil for English
+	Mailbox        string       // Mailbox the Gmail links open, see DraftLink
+	Actions        *Actions     // One-click delete and keep links; nil leaves them out
+}
+
+// NewTriage creates an empty triage report
+func NewTriage(now time.Time) *Triage {
+	return &Triage{
+		GeneratedAt: now,
+		Entries:     make(map[Bucket][]Entry),
+	}
+}
+
+// Add places a draft in a bucket
+func (t *Triage) Add(bucket Bucket, draft *gmail.Draft, score float64) {
+	t.Entries[bucket] = append(t.Entries[bucket], Entry{Draft: draft, Score: score})
+}
+
+// Summary returns a one-line description of the bucket sizes
+func (t *Triage) Summary() string {
+	parts := []string{}
+	for _, bucket := range Buckets {
+		if n := len(t.Entries[bucket]); n > 0 {
+			parts = append(parts, t.Locale.Sprintf("%s "+strings.ToLower(string(bucket)), t.Locale.Number(n)))
+		}
+	}
+	if len(parts) == 0 {
+		return t.Locale.Sprintf("no drafts")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteMarkdown renders the report as Markdown with a link to open each
+// draft in Gmail and, with Actions, links to delete or keep it
+func (t *Triage) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	l := t.Locale
+	fmt.Fprintf(&b, "# %s\n\n%s\n", l.Sprintf("CalmDrafts report"), l.Sprintf("Generated %s: %s.", t.GeneratedAt.Format("2006-01-02 15:04"), t.Summary()))
+
+	for _, bucket := range Buckets {
+		entries := t.Entries[bucket]
+		if len(entries) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n## %s (%s)\n\n", l.Sprintf(string(bucket)), l.Number(len(entries)))
+		for _, e := range entries {
+			subject := e.Draft.Subject
+			if subject == "" {
+				subject = l.Sprintf("(no subject)")
+			}
+			fmt.Fprintf(&b, "- [%s](%s)", escapeLinkText(subject), DraftLink(t.Mailbox, e.Draft))
+			switch recipients := e.Draft.Recipients(); {
+			case len(recipients) == 1:
+				b.WriteString(l.Sprintf(" to %s", recipients[0]))
+			case len(recipients) > 1:
+				b.WriteString(l.Sprintf(" to %s recipients", l.Number(len(recipients))))
+			}
+			if !e.Draft.InternalDate.IsZero() {
+				b.WriteString(l.Sprintf(", last saved %s", l.Ago(t.GeneratedAt.Sub(e.Draft.InternalDate))))
+			}
+			if p := e.Draft.ReplyTo; p != nil {
+				b.WriteString(l.Sprintf(", reply to %s from %s", p.Sender(), l.Ago(t.GeneratedAt.Sub(p.Date))))
+			}
+			if e.Score > 0 {
+				b.WriteString(l.Sprintf(", abandoned score %s", l.Decimal(e.Score, 2)))
+			}
+			if t.Actions != nil && bucket != BucketTemplates {
+				b.WriteString(l.Sprintf(" ([delete](%s), [keep](%s))", t.Actions.Link(ActionDelete, e.Draft), t.Actions.Link(ActionKeep, e.Draft)))
+			}
+			if e.Draft.Snippet != "" {
+				fmt.Fprintf(&b, "\n  > %s", e.Draft.Snippet)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	// Show where the backlog lives by age
+	drafts := []*gmail.Draft{}
+	for _, bucket := range Buckets {
+		for _, e := range t.Entries[bucket] {
+			drafts = append(drafts, e.Draft)
+		}
+	}
+	if len(drafts) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n%s", l.Sprintf("Draft ages"), stats.NewHistogram(drafts, t.GeneratedAt).Markdown())
+		fmt.Fprintf(&b, "\n%s\n", l.Sprintf("Total size: %s.", stats.FormatBytes(stats.TotalSize(drafts))))
+	}
+
+	// Large drafts quietly use up storage quota
+	if large := stats.Large(drafts, t.LargeDraftSize); len(large) > 0 {
+		fmt.Fprintf(&b, "\n## %s (%s)\n\n", l.Sprintf("Large drafts"), l.Number(len(large)))
+		for _, d := range large {
+			subject := d.Subject
+			if subject == "" {
+				subject = l.Sprintf("(no subject)")
+			}
+			fmt.Fprintf(&b, "- [%s](%s), %s\n", escapeLinkText(subject), DraftLink(t.Mailbox, d), stats.FormatBytes(d.Size))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// DraftLink returns a URL that opens the draft in the Gmail web UI. With a
+// mailbox it opens in the session signed in to that address, rather than
+// the browser's first account.
+func DraftLink(mailbox string, d *gmail.Draft) string {
+	account := "0"
+	if mailbox != "" {
+		account = url.PathEscape(mailbox)
+	}
+	return "https://mail.google.com/mail/u/" + account + "/#drafts?compose=" + d.MessageID
+}
+
+// markdownLinkText escapes the characters that would end a Markdown link's
+// text early or turn it into another link
+var markdownLinkText = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, `(`, `\(`, `)`, `\)`)
+
+// escapeLinkText returns s safe to use as the text of a Markdown link
+func escapeLinkText(s string) string {
+	return markdownLinkText.Replace(s)
+}
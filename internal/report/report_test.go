@@ -0,0 +1,88 @@
+package report
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"calmdrafts/internal/gmail"
+)
+
+func TestDraftLink(t *testing.T) {
+	d := &gmail.Draft{ID: "r-1", MessageID: "18c2f"}
+	if got := DraftLink("", d); got != "https://mail.google.com/mail/u/0/#drafts?compose=18c2f" {
+		t.Errorf("link without a mailbox is %s", got)
+	}
+	if got := DraftLink("me@example.com", d); got != "https://mail.google.com/mail/u/me@example.com/#drafts?compose=18c2f" {
+		t.Errorf("link for me@example.com is %s", got)
+	}
+}
+
+func TestEscapeLinkText(t *testing.T) {
+	for subject, want := range map[string]string{
+		"Quarterly report":               "Quarterly report",
+		"[urgent] Budget (draft)":        `\[urgent\] Budget \(draft\)`,
+		"See [here](https://evil.test/)": `See \[here\]\(https://evil.test/\)`,
+		`C:\Reports`:                     `C:\\Reports`,
+	} {
+		if got := escapeLinkText(subject); got != want {
+			t.Errorf("escaped %q as %q, want %q", subject, got, want)
+		}
+	}
+}
+
+func TestWriteMarkdownLinks(t *testing.T) {
+	triage := NewTriage(time.Now())
+	triage.Mailbox = "me@example.com"
+	triage.Actions = &Actions{URL: "http://127.0.0.1:8093", Key: []byte("secret")}
+	triage.Add(BucketNeedsDecision, &gmail.Draft{ID: "r-1", MessageID: "18c2f", Subject: "Re: [ops] outage (part 2)"}, 0.8)
+	triage.Add(BucketTemplates, &gmail.Draft{ID: "r-2", MessageID: "18c30", Subject: "Canned reply", IsTemplate: true}, 0)
+
+	var b strings.Builder
+	if err := triage.WriteMarkdown(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`- [Re: \[ops\] outage \(part 2\)](https://mail.google.com/mail/u/me@example.com/#drafts?compose=18c2f)`,
+		"([delete](" + triage.Actions.Link(ActionDelete, triage.Entries[BucketNeedsDecision][0].Draft) + "), [keep](",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "[delete](") != 1 {
+		t.Errorf("report has action links for templates:\n%s", out)
+	}
+}
+
+func TestActions(t *testing.T) {
+	a := &Actions{URL: "http://127.0.0.1:8093", Key: []byte("secret")}
+	d := &gmail.Draft{ID: "r-1", MessageID: "18c2f"}
+
+	link, err := url.Parse(a.Link(ActionDelete, d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Host != "127.0.0.1:8093" || link.Path != "/drafts/r-1/delete" {
+		t.Errorf("delete link is %s", link)
+	}
+	message, sig := link.Query().Get("message"), link.Query().Get("sig")
+	if message != "18c2f" || !a.Verify(ActionDelete, "r-1", message, sig) {
+		t.Errorf("delete link %s doesn't verify", link)
+	}
+
+	for name, ok := range map[string]bool{
+		"other action":  a.Verify(ActionKeep, "r-1", message, sig),
+		"other draft":   a.Verify(ActionDelete, "r-2", message, sig),
+		"edited draft":  a.Verify(ActionDelete, "r-1", "18c31", sig),
+		"other key":     (&Actions{Key: []byte("other")}).Verify(ActionDelete, "r-1", message, sig),
+		"no signature":  a.Verify(ActionDelete, "r-1", message, ""),
+		"bad signature": a.Verify(ActionDelete, "r-1", message, strings.Repeat("0", len(sig))),
+	} {
+		if ok {
+			t.Errorf("%s: the delete link verified", name)
+		}
+	}
+}
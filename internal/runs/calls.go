@@ -0,0 +1,136 @@
+package runs
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CallStats are the API calls the checks of a period made and how many of
+// them failed, to tell whether the mailbox is checked too often or its
+// credentials are going bad
+type CallStats struct {
+	Runs   int
+	Calls  int
+	Failed map[string]int // By cause: the HTTP status, e.g. "429", or "network"
+}
+
+// Calls adds up the API calls of the results started at or after since
+func Calls(results []*Result, since time.Time) *CallStats {
+	s := &CallStats{Failed: make(map[string]int)}
+	for _, r := range results {
+		if r.Started.Before(since) {
+			continue
+		}
+		s.Runs++
+		for _, stage := range r.Stages {
+			s.Calls += stage.Calls
+			for cause, n := range stage.Failed {
+				s.Failed[cause] += n
+			}
+		}
+	}
+	return s
+}
+
+// Failures returns the number of failed calls
+func (s *CallStats) Failures() int {
+	n := 0
+	for _, failed := range s.Failed {
+		n += failed
+	}
+	return n
+}
+
+// Rate returns the share of calls that failed, from 0 to 1
+func (s *CallStats) Rate() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return float64(s.Failures()) / float64(s.Calls)
+}
+
+// Causes returns the causes of failed calls, most common first
+func (s *CallStats) Causes() []string {
+	causes := make([]string, 0, len(s.Failed))
+	for cause := range s.Failed {
+		causes = append(causes, cause)
+	}
+	sort.Slice(causes, func(i, j int) bool {
+		if s.Failed[causes[i]] != s.Failed[causes[j]] {
+			return s.Failed[causes[i]] > s.Failed[causes[j]]
+		}
+		return causes[i] < causes[j]
+	})
+	return causes
+}
+
+// Summary describes the failed calls of the period in one line, e.g. "3%
+// of 1200 API calls failed this week, mostly 429 (rate limited)"
+func (s *CallStats) Summary(period string) string {
+	failures := s.Failures()
+	if failures == 0 {
+		return fmt.Sprintf("None of %d API calls failed %s", s.Calls, period)
+	}
+	return fmt.Sprintf("%s of %d API calls failed %s, mostly %s", percent(s.Rate()), s.Calls, period, describeCause(s.Causes()[0]))
+}
+
+// Brief returns the share of calls that failed and their most common
+// cause, e.g. "3% (429)", or "" if there were no calls
+func (s *CallStats) Brief() string {
+	switch {
+	case s.Calls == 0:
+		return ""
+	case s.Failures() == 0:
+		return "0%"
+	}
+	return fmt.Sprintf("%s (%s)", percent(s.Rate()), s.Causes()[0])
+}
+
+// Advice returns what to do about the failed calls, or "" if there are
+// too few to worry about
+func (s *CallStats) Advice() string {
+	if s.Rate() < 0.01 {
+		return ""
+	}
+	switch cause := s.Causes()[0]; {
+	case cause == "429":
+		return "Gmail is rate limiting the checks: raise check_interval, cap the calls of each stage with pipeline.limits, or turn on batch_delete"
+	case cause == "401":
+		return "Gmail is refusing the credentials: run \"calmdrafts doctor\", and delete token.json to authorize again if it was revoked"
+	case cause == "403":
+		return "Gmail is refusing requests for lack of permission or over a quota: run \"calmdrafts doctor\" to check the token's scopes"
+	case cause == "network":
+		return "Requests aren't reaching Gmail: check the network connection and proxy settings"
+	case strings.HasPrefix(cause, "5"):
+		return "Gmail had server errors; they usually pass, and the failed deletions are retried"
+	}
+	return ""
+}
+
+// describeCause names a cause of failed calls for people
+func describeCause(cause string) string {
+	switch {
+	case cause == "429":
+		return "429 (rate limited)"
+	case cause == "401":
+		return "401 (credentials)"
+	case cause == "403":
+		return "403 (permission or quota)"
+	case cause == "404":
+		return "404 (already gone)"
+	case strings.HasPrefix(cause, "5"):
+		return cause + " (server error)"
+	}
+	return cause
+}
+
+// percent formats a rate as a percentage, with a decimal below 1%
+func percent(rate float64) string {
+	if rate < 0.01 {
+		return fmt.Sprintf("%.1f%%", math.Max(rate*100, 0.1))
+	}
+	return fmt.Sprintf("%.0f%%", rate*100)
+}
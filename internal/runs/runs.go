@@ -0,0 +1,205 @@
+package runs
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/jsonl"
+)
+
+// Result is what one check did: how many drafts it saw, what it did with
+// them, which rules matched, what went wrong and how long each stage took.
+// It is returned by the check, recorded in the run history and sent to
+// webhooks.
+type Result struct {
+	ID         string         `json:"id"`
+	Account    string         `json:"account,omitempty"`
+	Started    time.Time      `json:"started"`
+	DurationMS int64          `json:"duration_ms"`
+	DryRun     bool           `json:"dry_run,omitempty"` // Nothing was changed, by dry_run or the observation period
+	Counts     Counts         `json:"counts"`
+	Rules      map[string]int `json:"rules,omitempty"` // Drafts each rule matched
+	Actions    []*Action      `json:"actions,omitempty"`
+	Stages     []*Stage       `json:"stages,omitempty"`
+	Causes     []string       `json:"causes,omitempty"` // Why deletions failed, most common first, e.g. "quota"
+	Errors     []string       `json:"errors,omitempty"` // Errors that didn't stop the check
+	Error      string         `json:"error,omitempty"`  // Why the check failed, if it did
+}
+
+// Counts are the totals of a check
+type Counts struct {
+	Drafts  int `json:"drafts"`
+	Empty   int `json:"empty"`
+	Stale   int `json:"stale"`
+	Pending int `json:"pending"` // Waiting for their grace period
+	Queued  int `json:"queued"`  // Newly added to the pending-delete queue
+	Deleted int `json:"deleted"` // Including those a dry run would have deleted
+	Failed  int `json:"failed"`  // Deletions that failed, to be retried
+	Retried int `json:"retried"` // Deletions from earlier checks that succeeded
+}
+
+// Action is something a check did, or would have done, with one draft
+type Action struct {
+	DraftID string   `json:"draft_id"`
+	Subject string   `json:"subject,omitempty"`
+	Rule    string   `json:"rule,omitempty"`
+	Outcome string   `json:"outcome"` // As shown by --explain, e.g. "deleted" or "stale"
+	Reason  string   `json:"reason,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Trace   []string `json:"trace,omitempty"` // Every rule and exclusion considered
+}
+
+// Stage is how long a part of the check took and how many API calls it
+// made
+type Stage struct {
+	Name       string         `json:"name"`
+	DurationMS int64          `json:"duration_ms"`
+	Calls      int            `json:"calls,omitempty"`
+	Failed     map[string]int `json:"failed,omitempty"` // Failed calls by cause, e.g. "429"
+}
+
+// New starts the result of a check
+func New(account string, started time.Time) *Result {
+	return &Result{ID: newID(), Account: account, Started: started, Rules: make(map[string]int)}
+}
+
+// Logf logs an error that didn't stop the check and records it
+func (r *Result) Logf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Print(msg)
+	r.Errors = append(r.Errors, msg)
+}
+
+// Time records the duration, API calls and failed calls of a stage that
+// began at start, and returns the current time to start the next one
+func (r *Result) Time(stage string, start time.Time, calls int, failed map[string]int) time.Time {
+	now := time.Now()
+	if len(failed) == 0 {
+		failed = nil
+	}
+	r.Stages = append(r.Stages, &Stage{Name: stage, DurationMS: now.Sub(start).Milliseconds(), Calls: calls, Failed: failed})
+	return now
+}
+
+// Finish records the total duration and, if the check failed, its error
+func (r *Result) Finish(err error) {
+	r.DurationMS = time.Since(r.Started).Milliseconds()
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Duration returns how long the check took
+func (r *Result) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
+}
+
+// RuleNames returns the rules that matched, most matches first
+func (r *Result) RuleNames() []string {
+	names := make([]string, 0, len(r.Rules))
+	for name := range r.Rules {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if r.Rules[names[i]] != r.Rules[names[j]] {
+			return r.Rules[names[i]] > r.Rules[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// newID returns a short random identifier for a run
+func newID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("150405")
+	}
+	return hex.EncodeToString(b)
+}
+
+// History is an append-only JSON-lines log of run results
+type History struct {
+	path string
+}
+
+// OpenHistory returns the run history stored at path. The file is created
+// on first write.
+func OpenHistory(path string) *History {
+	return &History{path: path}
+}
+
+// Append records a result
+func (h *History) Append(r *Result) error {
+	return jsonl.Append(h.path, r)
+}
+
+// Results reads all results, oldest first
+func (h *History) Results() ([]*Result, error) {
+	f, err := os.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to open run history: %v", err)
+	}
+	defer f.Close()
+
+	results := []*Result{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		r := &Result{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, fmt.Errorf("unable to parse run history: %v", err)
+		}
+		results = append(results, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read run history: %v", err)
+	}
+	return results, nil
+}
+
+// Find returns the result of the run with the given ID, or with the only
+// ID starting with it
+func (h *History) Find(id string) (*Result, error) {
+	results, err := h.Results()
+	if err != nil {
+		return nil, err
+	}
+	var found *Result
+	for _, r := range results {
+		switch {
+		case r.ID == id:
+			return r, nil
+		case id != "" && strings.HasPrefix(r.ID, id):
+			if found != nil && found.ID != r.ID {
+				return nil, fmt.Errorf("several runs have an ID starting with %s", id)
+			}
+			found = r
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no run found for %s", id)
+	}
+	return found, nil
+}
+
+// Prune drops results older than maxAge, then the oldest results until the
+// file is no larger than maxBytes. Zero limits are ignored. It returns the
+// number of results dropped.
+func (h *History) Prune(maxAge time.Duration, maxBytes int64) (int, error) {
+	return jsonl.Prune(h.path, maxAge, maxBytes, func(r *Result) time.Time { return r.Started })
+}
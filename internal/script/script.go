@@ -0,0 +1,139 @@
+package script
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"calmdrafts/internal/gmail"
+)
+
+// Verdict is the decision returned by a classification script
+type Verdict string
+
+const (
+	VerdictNone   Verdict = ""       // Script has no opinion
+	VerdictKeep   Verdict = "keep"   // Never delete this draft
+	VerdictDelete Verdict = "delete" // Delete this draft
+	VerdictStale  Verdict = "stale"  // Keep the draft but remind the user about it
+)
+
+// maxSteps bounds the work a script may do per draft
+const maxSteps = 1000000
+
+// Script is a compiled Starlark classification script. The script must
+// define a function classify(draft) that returns "keep", "delete", "stale"
+// or None.
+type Script struct {
+	path     string
+	classify starlark.Callable
+
+	// Age returns the age of a draft created at the given time, for the
+	// age_hours and age_days fields. Default: the time since then.
+	Age func(created time.Time) time.Duration
+}
+
+// Load reads and executes the script at path, returning its classify function
+func Load(path string) (*Script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read script: %v", err)
+	}
+
+	thread := &starlark.Thread{Name: "load"}
+	globals, err := starlark.ExecFile(thread, path, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute script %s: %v", path, err)
+	}
+
+	fn, ok := globals["classify"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script %s does not define a classify(draft) function", path)
+	}
+
+	return &Script{path: path, classify: fn}, nil
+}
+
+// Classify runs the script's classify function for a draft
+func (s *Script) Classify(draft *gmail.Draft) (Verdict, error) {
+	thread := &starlark.Thread{Name: draft.ID}
+	thread.SetMaxExecutionSteps(maxSteps)
+
+	age := time.Since
+	if s.Age != nil {
+		age = s.Age
+	}
+	result, err := starlark.Call(thread, s.classify, starlark.Tuple{draftValue(draft, age)}, nil)
+	if err != nil {
+		return VerdictNone, fmt.Errorf("script %s failed for draft %s: %v", s.path, draft.ID, err)
+	}
+
+	if result == starlark.None {
+		return VerdictNone, nil
+	}
+	str, ok := starlark.AsString(result)
+	if !ok {
+		return VerdictNone, fmt.Errorf("script %s returned %s, want a string or None", s.path, result.Type())
+	}
+
+	switch verdict := Verdict(str); verdict {
+	case VerdictNone, VerdictKeep, VerdictDelete, VerdictStale:
+		return verdict, nil
+	default:
+		return VerdictNone, fmt.Errorf("script %s returned unknown verdict %q", s.path, str)
+	}
+}
+
+// draftValue exposes a draft to Starlark as an immutable struct
+func draftValue(d *gmail.Draft, age func(time.Time) time.Duration) starlark.Value {
+	ageHours := 0.0
+	if !d.InternalDate.IsZero() {
+		ageHours = age(d.InternalDate).Hours()
+	}
+
+	labels := make(starlark.Tuple, 0, len(d.Labels))
+	for _, label := range d.Labels {
+		labels = append(labels, starlark.String(label))
+	}
+
+	// Addresses and domains of every recipient, for rules about who a
+	// draft is for
+	emails := func(addresses []gmail.Address) starlark.Tuple {
+		t := make(starlark.Tuple, 0, len(addresses))
+		for _, a := range addresses {
+			t = append(t, starlark.String(a.Email))
+		}
+		return t
+	}
+	recipients := d.Recipients()
+	domains := starlark.Tuple{}
+	seen := make(map[string]bool)
+	for _, a := range recipients {
+		if domain := a.Domain(); domain != "" && !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, starlark.String(domain))
+		}
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("draft"), starlark.StringDict{
+		"id":            starlark.String(d.ID),
+		"message_id":    starlark.String(d.MessageID),
+		"subject":       starlark.String(d.Subject),
+		"to":            starlark.String(d.To),
+		"internal_date": starlark.MakeInt64(d.InternalDate.Unix()),
+		"age_hours":     starlark.Float(ageHours),
+		"age_days":      starlark.Float(ageHours / 24),
+		"is_empty":      starlark.Bool(d.IsEmpty),
+		"is_reply":      starlark.Bool(d.IsReply),
+		"body_length":   starlark.MakeInt(d.BodyLength),
+		"labels":        labels,
+		"recipients":    emails(recipients),
+		"cc":            emails(d.Cc),
+		"bcc":           emails(d.Bcc),
+		"domains":       domains,
+		"client":        starlark.String(d.Client),
+	})
+}
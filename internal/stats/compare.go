@@ -0,0 +1,145 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/runs"
+)
+
+// Account is the latest observation of one mailbox, for comparing backlogs
+// across accounts. Obs is nil when the account was never checked.
+type Account struct {
+	Name  string
+	Obs   *Observation
+	Calls *runs.CallStats // API calls of the past week, nil without a run history
+}
+
+// olderThanWeek counts the drafts in the buckets starting at a week or later
+func (a *Account) olderThanWeek() int {
+	if a.Obs == nil || a.Obs.Ages == nil {
+		return 0
+	}
+	n := 0
+	for i := 1; i < len(AgeBuckets); i++ {
+		if AgeBuckets[i-1].Max >= 7*24*time.Hour {
+			n += a.Obs.Ages.Empty[i] + a.Obs.Ages.NonEmpty[i]
+		}
+	}
+	return n
+}
+
+// SortAccounts orders accounts by the number of drafts older than a week,
+// the backlog most in need of attention first
+func SortAccounts(accounts []*Account) {
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return accounts[i].olderThanWeek() > accounts[j].olderThanWeek()
+	})
+}
+
+// compareRow returns the cells of an account's row
+func compareRow(a *Account) []string {
+	if a.Obs == nil {
+		return []string{a.Name, "", "", "", "", "", "", "", "", "", "never checked"}
+	}
+	o := a.Obs
+	row := []string{a.Name, fmt.Sprint(o.Drafts), fmt.Sprint(o.Empty), fmt.Sprint(o.Stale)}
+	for i := range AgeBuckets {
+		n := 0
+		if o.Ages != nil {
+			n = o.Ages.Empty[i] + o.Ages.NonEmpty[i]
+		}
+		row = append(row, fmt.Sprint(n))
+	}
+	return append(row, FormatBytes(o.Bytes), a.failedCalls(), o.Time.Local().Format("2006-01-02 15:04"))
+}
+
+// compareHeader returns the column names of the comparison
+func compareHeader() []string {
+	header := []string{"Account", "Drafts", "Empty", "Stale"}
+	for _, b := range AgeBuckets {
+		header = append(header, b.Label)
+	}
+	return append(header, "Size", "Failed calls", "Checked")
+}
+
+// failedCalls returns the share of the past week's API calls that failed
+func (a *Account) failedCalls() string {
+	if a.Calls == nil {
+		return ""
+	}
+	return a.Calls.Brief()
+}
+
+// WriteComparison renders one row per account as a text table
+func WriteComparison(w io.Writer, accounts []*Account) error {
+	rows := [][]string{compareHeader()}
+	for _, a := range accounts {
+		rows = append(rows, compareRow(a))
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+
+	var b strings.Builder
+	for _, row := range rows {
+		for i, cell := range row {
+			switch {
+			case i == 0:
+				fmt.Fprintf(&b, "%-*s", widths[i], cell)
+			case i == len(row)-1:
+				fmt.Fprintf(&b, "  %s", cell)
+			default:
+				fmt.Fprintf(&b, "  %*s", widths[i], cell)
+			}
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteComparisonList renders one paragraph per account, for screen readers
+func WriteComparisonList(w io.Writer, accounts []*Account) error {
+	var b strings.Builder
+	for _, a := range accounts {
+		if a.Obs == nil {
+			fmt.Fprintf(&b, "%s: never checked.\n\n", a.Name)
+			continue
+		}
+		o := a.Obs
+		fmt.Fprintf(&b, "%s: %d drafts, %d empty, %d stale, %s in total, checked %s.\n",
+			a.Name, o.Drafts, o.Empty, o.Stale, FormatBytes(o.Bytes), o.Time.Local().Format("2006-01-02 15:04"))
+		for i, bucket := range AgeBuckets {
+			n := 0
+			if o.Ages != nil {
+				n = o.Ages.Empty[i] + o.Ages.NonEmpty[i]
+			}
+			fmt.Fprintf(&b, "%s: %d.\n", bucket.Spoken, n)
+		}
+		if a.Calls != nil && a.Calls.Calls > 0 {
+			fmt.Fprintf(&b, "%s.\n", a.Calls.Summary("this week"))
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ComparisonMarkdown renders one row per account as a Markdown table
+func ComparisonMarkdown(accounts []*Account) string {
+	var b strings.Builder
+	header := compareHeader()
+	b.WriteString("| " + strings.Join(header, " | ") + " |\n|---|")
+	b.WriteString(strings.Repeat("---:|", len(header)-2) + "---|\n")
+	for _, a := range accounts {
+		b.WriteString("| " + strings.Join(compareRow(a), " | ") + " |\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"calmdrafts/internal/jsonl"
+)
+
+// Observation is a snapshot of the mailbox recorded after each check
+type Observation struct {
+	Time    time.Time  `json:"time"`
+	Drafts  int        `json:"drafts"`
+	Empty   int        `json:"empty"`
+	Deleted int        `json:"deleted"`
+	Stale   int        `json:"stale"`
+	Pending int        `json:"pending"`
+	Ages    *Histogram `json:"ages"`
+	Bytes   int64      `json:"bytes"` // Estimated total size of all drafts
+}
+
+// History is a JSON-lines file of observations
+type History struct {
+	path string
+}
+
+// OpenHistory returns the history stored at path. The file is created on
+// first write.
+func OpenHistory(path string) *History {
+	return &History{path: path}
+}
+
+// Append records an observation
+func (h *History) Append(obs *Observation) error {
+	return jsonl.Append(h.path, obs)
+}
+
+// Observations reads all observations, oldest first
+func (h *History) Observations() ([]*Observation, error) {
+	f, err := os.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to open history: %v", err)
+	}
+	defer f.Close()
+
+	observations := []*Observation{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		obs := &Observation{}
+		if err := json.Unmarshal(scanner.Bytes(), obs); err != nil {
+			return nil, fmt.Errorf("unable to parse history: %v", err)
+		}
+		observations = append(observations, obs)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read history: %v", err)
+	}
+
+	return observations, nil
+}
+
+// Prune drops observations older than maxAge, then the oldest observations
+// until the file is no larger than maxBytes. Zero limits are ignored. It
+// returns the number of observations dropped.
+func (h *History) Prune(maxAge time.Duration, maxBytes int64) (int, error) {
+	return jsonl.Prune(h.path, maxAge, maxBytes, func(obs *Observation) time.Time { return obs.Time })
+}
@@ -0,0 +1,192 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"calmdrafts/internal/gmail"
+)
+
+// AgeBucket is a range of draft ages in a histogram
+type AgeBucket struct {
+	Label  string
+	Spoken string        // Label in words for accessible output
+	Max    time.Duration // Exclusive upper bound; 0 means unbounded
+}
+
+// AgeBuckets lists the histogram ranges in display order
+var AgeBuckets = []AgeBucket{
+	{Label: "0-1d", Spoken: "Under a day old", Max: 24 * time.Hour},
+	{Label: "1-7d", Spoken: "1 to 7 days old", Max: 7 * 24 * time.Hour},
+	{Label: "7-30d", Spoken: "7 to 30 days old", Max: 30 * 24 * time.Hour},
+	{Label: "30d+", Spoken: "Over 30 days old"},
+}
+
+// Histogram counts drafts per age bucket, split by whether they are empty.
+// Both slices are indexed like AgeBuckets.
+type Histogram struct {
+	Empty    []int `json:"empty"`
+	NonEmpty []int `json:"non_empty"`
+}
+
+// NewHistogram sorts drafts into age buckets relative to now
+func NewHistogram(drafts []*gmail.Draft, now time.Time) *Histogram {
+	h := &Histogram{
+		Empty:    make([]int, len(AgeBuckets)),
+		NonEmpty: make([]int, len(AgeBuckets)),
+	}
+	for _, d := range drafts {
+		i := BucketIndex(now.Sub(d.InternalDate))
+		if d.IsEmpty {
+			h.Empty[i]++
+		} else {
+			h.NonEmpty[i]++
+		}
+	}
+	return h
+}
+
+// BucketIndex returns the index in AgeBuckets for a draft of the given age
+func BucketIndex(age time.Duration) int {
+	for i, b := range AgeBuckets {
+		if b.Max == 0 || age < b.Max {
+			return i
+		}
+	}
+	return len(AgeBuckets) - 1
+}
+
+// Total returns the number of drafts in the histogram
+func (h *Histogram) Total() int {
+	total := 0
+	for i := range AgeBuckets {
+		total += h.Empty[i] + h.NonEmpty[i]
+	}
+	return total
+}
+
+// TotalSize returns the estimated size of all drafts in bytes
+func TotalSize(drafts []*gmail.Draft) int64 {
+	var total int64
+	for _, d := range drafts {
+		total += d.Size
+	}
+	return total
+}
+
+// Large returns the drafts of at least threshold bytes, largest first. A
+// threshold of 0 returns none.
+func Large(drafts []*gmail.Draft, threshold int64) []*gmail.Draft {
+	large := []*gmail.Draft{}
+	if threshold <= 0 {
+		return large
+	}
+	for _, d := range drafts {
+		if d.Size >= threshold {
+			large = append(large, d)
+		}
+	}
+	sort.SliceStable(large, func(i, j int) bool { return large[i].Size > large[j].Size })
+	return large
+}
+
+// ClientCount is the number of drafts created by one mail client
+type ClientCount struct {
+	Client string // "unknown" when the headers don't tell
+	Drafts int
+	Empty  int
+}
+
+// ByClient counts drafts per client that created them, most drafts first
+func ByClient(drafts []*gmail.Draft) []ClientCount {
+	index := make(map[string]int)
+	counts := []ClientCount{}
+	for _, d := range drafts {
+		client := d.Client
+		if client == "" {
+			client = "unknown"
+		}
+		i, ok := index[client]
+		if !ok {
+			i = len(counts)
+			index[client] = i
+			counts = append(counts, ClientCount{Client: client})
+		}
+		counts[i].Drafts++
+		if d.IsEmpty {
+			counts[i].Empty++
+		}
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Drafts != counts[j].Drafts {
+			return counts[i].Drafts > counts[j].Drafts
+		}
+		return counts[i].Client < counts[j].Client
+	})
+	return counts
+}
+
+// FormatBytes renders a size with a binary unit, like "2.5 MiB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// maxBar is the width of the longest bar in text output
+const maxBar = 40
+
+// WriteText renders the histogram as a text chart, with empty drafts drawn
+// as '#' and non-empty drafts as '='
+func (h *Histogram) WriteText(w io.Writer) error {
+	largest := 0
+	for i := range AgeBuckets {
+		largest = max(largest, h.Empty[i]+h.NonEmpty[i])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-6s %6s %9s\n", "Age", "Empty", "Non-empty")
+	for i, bucket := range AgeBuckets {
+		empty, nonEmpty := h.Empty[i], h.NonEmpty[i]
+		if largest > maxBar {
+			empty = (empty*maxBar + largest - 1) / largest
+			nonEmpty = (nonEmpty*maxBar + largest - 1) / largest
+		}
+		fmt.Fprintf(&b, "%-6s %6d %9d  %s%s\n", bucket.Label, h.Empty[i], h.NonEmpty[i],
+			strings.Repeat("#", empty), strings.Repeat("=", nonEmpty))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteList renders the histogram as one sentence per age bucket, for
+// screen readers
+func (h *Histogram) WriteList(w io.Writer) error {
+	var b strings.Builder
+	for i, bucket := range AgeBuckets {
+		fmt.Fprintf(&b, "%s: %d empty, %d non-empty.\n", bucket.Spoken, h.Empty[i], h.NonEmpty[i])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Markdown renders the histogram as a Markdown table
+func (h *Histogram) Markdown() string {
+	var b strings.Builder
+	b.WriteString("| Age | Empty | Non-empty |\n|---|---:|---:|\n")
+	for i, bucket := range AgeBuckets {
+		fmt.Fprintf(&b, "| %s | %d | %d |\n", bucket.Label, h.Empty[i], h.NonEmpty[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,249 @@
+package tenant
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Tenant is an end user who connected their mailbox to the server
+type Tenant struct {
+	Email       string          `json:"email"`
+	ConnectedAt time.Time       `json:"connected_at"`
+	Settings    json.RawMessage `json:"settings,omitempty"` // Partial config overriding the server policy, see AllowedSettings
+}
+
+// AllowedSettings lists the config fields a tenant may override. Paths,
+// credentials and plugins stay under the operator's control.
+var AllowedSettings = []string{
+	"cleanup_age",
+	"grace_period",
+	"dry_run",
+	"max_deletions",
+	"use_trash",
+	"trash_reminder",
+	"recent_edit_guard",
+	"min_age",
+	"abandoned_threshold",
+}
+
+// ValidateSettings rejects settings that aren't a JSON object of allowed fields
+func ValidateSettings(raw json.RawMessage) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return fmt.Errorf("settings must be a JSON object: %v", err)
+	}
+	for name := range fields {
+		allowed := false
+		for _, a := range AllowedSettings {
+			if name == a {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("setting %q can't be changed per tenant (allowed: %s)", name, strings.Join(AllowedSettings, ", "))
+		}
+	}
+	return nil
+}
+
+// Store keeps one directory per tenant, holding its profile, its OAuth token
+// encrypted with AES-256-GCM, and its local state
+type Store struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// Open opens the store in dir, reading the encryption key from keyPath or
+// generating it there when missing. The key must be outside dir, or a copy
+// of the directory would be all it takes to read the tokens.
+func Open(dir, keyPath string) (*Store, error) {
+	if within(dir, keyPath) {
+		return nil, fmt.Errorf("tenant key %s must be outside the tenant directory %s", keyPath, dir)
+	}
+	key, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+			return nil, fmt.Errorf("unable to create key directory: %v", err)
+		}
+		err = os.WriteFile(keyPath, key, 0600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read tenant key: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("tenant key %s must be 32 bytes", keyPath)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, aead: aead}, nil
+}
+
+// Dir returns the directory of a tenant
+func (s *Store) Dir(email string) string {
+	return filepath.Join(s.dir, email)
+}
+
+// List returns all tenants, sorted by address
+func (s *Store) List() ([]*Tenant, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Tenant{}, nil
+		}
+		return nil, fmt.Errorf("unable to list tenants: %v", err)
+	}
+
+	tenants := []*Tenant{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		t, err := s.Get(entry.Name())
+		if err != nil {
+			continue // not a tenant, or half-onboarded
+		}
+		tenants = append(tenants, t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Email < tenants[j].Email })
+	return tenants, nil
+}
+
+// Get loads a tenant
+func (s *Store) Get(email string) (*Tenant, error) {
+	if err := validEmail(email); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir(email), "tenant.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unknown tenant %s", email)
+		}
+		return nil, fmt.Errorf("unable to read tenant %s: %v", email, err)
+	}
+	t := &Tenant{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("unable to parse tenant %s: %v", email, err)
+	}
+	return t, nil
+}
+
+// Save writes a tenant's profile
+func (s *Store) Save(t *Tenant) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.write(t.Email, "tenant.json", append(data, '\n'))
+}
+
+// SaveToken encrypts and stores a tenant's OAuth token
+func (s *Store) SaveToken(email string, token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, data, []byte(email))
+	return s.write(email, "token.enc", sealed)
+}
+
+// Token decrypts a tenant's OAuth token
+func (s *Store) Token(email string) (*oauth2.Token, error) {
+	if err := validEmail(email); err != nil {
+		return nil, err
+	}
+	sealed, err := os.ReadFile(filepath.Join(s.Dir(email), "token.enc"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token of %s: %v", email, err)
+	}
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, fmt.Errorf("token of %s is corrupt", email)
+	}
+	data, err := s.aead.Open(nil, sealed[:n], sealed[n:], []byte(email))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt token of %s: %v", email, err)
+	}
+	token := &oauth2.Token{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("unable to parse token of %s: %v", email, err)
+	}
+	return token, nil
+}
+
+// Remove deletes a tenant with its token and local state
+func (s *Store) Remove(email string) error {
+	if err := validEmail(email); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(s.Dir(email)); err != nil {
+		return fmt.Errorf("unable to remove tenant %s: %v", email, err)
+	}
+	return nil
+}
+
+// write atomically replaces a file in a tenant's directory
+func (s *Store) write(email, name string, data []byte) error {
+	if err := validEmail(email); err != nil {
+		return err
+	}
+	dir := s.Dir(email)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("unable to create tenant directory: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("unable to write %s: %v", name, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("unable to write %s: %v", name, err)
+	}
+	return nil
+}
+
+// within reports whether path is dir or inside it
+func within(dir, path string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// validEmail rejects addresses that aren't safe as a directory name
+func validEmail(email string) error {
+	if !strings.Contains(email, "@") || strings.ContainsAny(email, `/\`) || strings.HasPrefix(email, ".") {
+		return fmt.Errorf("invalid tenant address %q", email)
+	}
+	return nil
+}
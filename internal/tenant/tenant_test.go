@@ -0,0 +1,120 @@
+package tenant
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	dir, keyPath := filepath.Join(root, "tenants"), filepath.Join(root, "keys", "tenant.key")
+	s, err := Open(dir, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &oauth2.Token{AccessToken: "ya29.secret", RefreshToken: "1//refresh", Expiry: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)}
+	if err := s.SaveToken("me@example.com", token); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := os.ReadFile(filepath.Join(dir, "me@example.com", "token.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) || bytes.Contains(sealed, []byte("refresh")) {
+		t.Errorf("token.enc holds the token in the clear")
+	}
+	if info, err := os.Stat(keyPath); err != nil || info.Size() != 32 || info.Mode().Perm() != 0600 {
+		t.Errorf("key file is %v, %v, want 32 bytes readable by the owner only", info, err)
+	}
+
+	// A reopened store reads the token with the same key
+	s, err = Open(dir, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Token("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != token.AccessToken || got.RefreshToken != token.RefreshToken || !got.Expiry.Equal(token.Expiry) {
+		t.Errorf("decrypted %+v, want %+v", got, token)
+	}
+
+	// A token moved to another tenant's directory doesn't decrypt
+	if err := os.MkdirAll(s.Dir("eve@example.com"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(s.Dir("eve@example.com"), "token.enc"), sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Token("eve@example.com"); err == nil {
+		t.Errorf("decrypted a token sealed for another tenant")
+	}
+
+	// Nor does it with another key
+	other, err := Open(dir, filepath.Join(root, "other.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Token("me@example.com"); err == nil {
+		t.Errorf("decrypted a token with another key")
+	}
+}
+
+func TestOpenRefusesKeyInDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "tenants")
+	for _, keyPath := range []string{
+		filepath.Join(dir, "tenant.key"),
+		filepath.Join(dir, "me@example.com", "tenant.key"),
+		dir,
+	} {
+		if _, err := Open(dir, keyPath); err == nil {
+			t.Errorf("opened a store with the key at %s", keyPath)
+		}
+	}
+	for _, keyPath := range []string{
+		filepath.Join(root, "tenant.key"),
+		filepath.Join(root, "tenants.key"),
+		filepath.Join(root, "..tenants", "tenant.key"),
+	} {
+		if _, err := Open(dir, keyPath); err != nil {
+			t.Errorf("key at %s: %v", keyPath, err)
+		}
+	}
+}
+
+func TestOpenRejectsShortKey(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "tenant.key")
+	if err := os.WriteFile(keyPath, []byte("too short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(t.TempDir(), keyPath); err == nil {
+		t.Errorf("opened a store with a 9-byte key")
+	}
+}
+
+func TestValidEmail(t *testing.T) {
+	for email, ok := range map[string]bool{
+		"me@example.com":         true,
+		"first.last@example.com": true,
+		"example.com":            false,
+		"":                       false,
+		"../me@example.com":      false,
+		"me@example.com/..":      false,
+		`..\me@example.com`:      false,
+		"a/b@example.com":        false,
+		".@example.com":          false,
+		".hidden@example.com":    false,
+	} {
+		if err := validEmail(email); (err == nil) != ok {
+			t.Errorf("validEmail(%q) returned %v, want ok %v", email, err, ok)
+		}
+	}
+}
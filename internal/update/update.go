@@ -0,0 +1,264 @@
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReleaseURL is the feed listing the latest release
+const ReleaseURL = "https://api.github.com/repos/imclaren/calmdrafts/releases/latest"
+
+// ChecksumsAsset is the release asset listing SHA-256 sums of all binaries
+const ChecksumsAsset = "checksums.txt"
+
+// PublicKey is the base64 Ed25519 key that signs checksums.txt. It is set at
+// build time with -ldflags "-X calmdrafts/internal/update.PublicKey=...".
+// The checksums come from the same feed as the binaries, so without it an
+// update can't be authenticated and Install refuses to run unless told to
+// be insecure.
+var PublicKey = ""
+
+// Release is a published version and its downloadable files
+type Release struct {
+	Version string
+	Assets  map[string]string // Asset name to download URL
+}
+
+// httpClient is used for all update requests
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Latest fetches the newest release from the release feed
+func Latest() (*Release, error) {
+	body, err := get(ReleaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}{}
+	if err := json.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("unable to parse release feed: %v", err)
+	}
+
+	release := &Release{Version: feed.TagName, Assets: make(map[string]string)}
+	for _, asset := range feed.Assets {
+		release.Assets[asset.Name] = asset.URL
+	}
+	return release, nil
+}
+
+// AssetName returns the binary asset name for the running platform
+func AssetName() string {
+	name := fmt.Sprintf("calmdrafts_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// IsNewer reports whether the release is a later version than current.
+// Development builds without a semantic version are never up to date.
+func (r *Release) IsNewer(current string) bool {
+	latest, ok := parseVersion(r.Version)
+	if !ok {
+		return false
+	}
+	running, ok := parseVersion(current)
+	if !ok {
+		return true
+	}
+
+	for i := range latest {
+		if latest[i] != running[i] {
+			return latest[i] > running[i]
+		}
+	}
+	return false
+}
+
+// parseVersion parses "v1.2.3" (pre-release suffixes are ignored)
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// Install downloads the binary for this platform, verifies it against the
+// release checksums and their signature, and atomically replaces the
+// running executable. With insecure, a build without a public key installs
+// on the checksums alone.
+func (r *Release) Install(insecure bool) error {
+	asset := AssetName()
+	binaryURL, ok := r.Assets[asset]
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s/%s", r.Version, runtime.GOOS, runtime.GOARCH)
+	}
+	checksumsURL, ok := r.Assets[ChecksumsAsset]
+	if !ok {
+		return fmt.Errorf("release %s has no %s", r.Version, ChecksumsAsset)
+	}
+
+	checksums, err := get(checksumsURL)
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(r, checksums, insecure); err != nil {
+		return err
+	}
+	want, err := findChecksum(checksums, asset)
+	if err != nil {
+		return err
+	}
+
+	binary, err := get(binaryURL)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(binary)
+	if hex.EncodeToString(sum[:]) != want {
+		return fmt.Errorf("checksum mismatch for %s", asset)
+	}
+
+	return replaceExecutable(binary)
+}
+
+// verifySignature checks checksums.txt.sig against the built-in public key
+func verifySignature(r *Release, checksums []byte, insecure bool) error {
+	if PublicKey == "" {
+		if insecure {
+			return nil
+		}
+		return fmt.Errorf("this build has no update signing key, so release %s can't be authenticated; install it by hand, or pass --insecure to trust the checksums from the release alone", r.Version)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid built-in update public key")
+	}
+	sigURL, ok := r.Assets[ChecksumsAsset+".sig"]
+	if !ok {
+		return fmt.Errorf("release %s is not signed", r.Version)
+	}
+	encoded, err := get(sigURL)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), checksums, sig) {
+		return fmt.Errorf("signature verification failed for release %s", r.Version)
+	}
+	return nil
+}
+
+// findChecksum looks up an asset in a sha256sum-style checksums file
+func findChecksum(checksums []byte, asset string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum listed for %s", asset)
+}
+
+// replaceExecutable writes the new binary next to the running one and
+// renames it into place so the swap is atomic
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to locate running executable: %v", err)
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return fmt.Errorf("unable to locate running executable: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".calmdrafts-update-*")
+	if err != nil {
+		return fmt.Errorf("unable to write update: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write update: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write update: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return fmt.Errorf("unable to write update: %v", err)
+	}
+
+	// Windows cannot replace a running executable, but it can rename it
+	old := ""
+	if runtime.GOOS == "windows" {
+		old = exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("unable to move old executable aside: %v", err)
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		// Put the old executable back rather than leave none
+		if old != "" {
+			if restoreErr := os.Rename(old, exe); restoreErr != nil {
+				return fmt.Errorf("unable to replace executable: %v; the previous one is at %s (%v)", err, old, restoreErr)
+			}
+		}
+		return fmt.Errorf("unable to replace executable: %v", err)
+	}
+	return nil
+}
+
+// get downloads a URL, treating non-200 responses as errors
+func get(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to download %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
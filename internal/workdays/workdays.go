@@ -0,0 +1,137 @@
+// Package workdays measures draft ages in business days, so a draft started
+// on Friday afternoon isn't three days old on Monday morning
+package workdays
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// dateLayout is how holidays are written
+const dateLayout = "2006-01-02"
+
+// Calendar tells business days from weekends and holidays. A nil Calendar
+// counts every day.
+type Calendar struct {
+	weekend  map[time.Weekday]bool
+	holidays map[string]bool
+}
+
+// New returns a calendar with the given weekend days, such as "saturday",
+// and holidays, such as "2026-12-25". Without weekend days, the weekend is
+// Saturday and Sunday.
+func New(weekend []string, holidays []string) (*Calendar, error) {
+	c := &Calendar{weekend: make(map[time.Weekday]bool), holidays: make(map[string]bool)}
+	if len(weekend) == 0 {
+		weekend = []string{"saturday", "sunday"}
+	}
+	for _, name := range weekend {
+		day, err := parseWeekday(name)
+		if err != nil {
+			return nil, err
+		}
+		c.weekend[day] = true
+	}
+	for _, date := range holidays {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return nil, fmt.Errorf("invalid holiday %q (want YYYY-MM-DD)", date)
+		}
+		c.holidays[date] = true
+	}
+	return c, nil
+}
+
+// parseWeekday parses an English day name, in full or abbreviated
+func parseWeekday(name string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if n := strings.ToLower(name); n == full || n == full[:3] {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekend day %q", name)
+}
+
+// BusinessDay reports whether the day of t is neither a weekend day nor a
+// holiday
+func (c *Calendar) BusinessDay(t time.Time) bool {
+	if c == nil {
+		return true
+	}
+	return !c.weekend[t.Weekday()] && !c.holidays[t.Format(dateLayout)]
+}
+
+// Age returns how much business time passed between from and now, in the
+// time zone of now
+func (c *Calendar) Age(from, now time.Time) time.Duration {
+	if c == nil || from.IsZero() || !now.After(from) {
+		return max(now.Sub(from), 0)
+	}
+	var age time.Duration
+	for t := from.In(now.Location()); t.Before(now); {
+		y, m, d := t.Date()
+		next := time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		if next.After(now) {
+			next = now
+		}
+		if c.BusinessDay(t) {
+			age += next.Sub(t)
+		}
+		t = next
+	}
+	return age
+}
+
+// LoadICS returns the days covered by the all-day events of an iCalendar
+// file, such as a public holiday calendar exported from a calendar app
+func LoadICS(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read holidays: %v", err)
+	}
+	defer f.Close()
+
+	days := []string{}
+	var start, end time.Time
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, _, _ = strings.Cut(name, ";")
+		switch name {
+		case "BEGIN":
+			start, end = time.Time{}, time.Time{}
+		case "DTSTART", "DTEND":
+			// All-day events have dates without a time
+			date, err := time.Parse("20060102", value)
+			if err != nil {
+				continue
+			}
+			if name == "DTSTART" {
+				start = date
+			} else {
+				end = date
+			}
+		case "END":
+			if value != "VEVENT" || start.IsZero() {
+				continue
+			}
+			if end.IsZero() {
+				end = start.AddDate(0, 0, 1)
+			}
+			for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+				days = append(days, d.Format(dateLayout))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read holidays: %v", err)
+	}
+	return days, nil
+}